@@ -7,12 +7,16 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"flowsilicon/internal/common"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/key"
 	"flowsilicon/internal/logger"
 	"flowsilicon/internal/model"
 	"flowsilicon/web"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -49,6 +53,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	// stats 子命令：输出统计表格后退出，不启动服务
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		os.Exit(runStatsCommand(os.Args[2:]))
+	}
+
+	// import-keys 子命令：从文件批量导入API密钥后退出，不启动服务
+	if len(os.Args) > 1 && os.Args[1] == "import-keys" {
+		os.Exit(runImportKeysCommand(os.Args[2:]))
+	}
+
 	// 检测是否是GUI模式（使用-H windowsgui参数打包）
 	// 通过检测是否有控制台窗口来判断
 	isGui := !isConsolePresent()
@@ -76,8 +90,16 @@ func main() {
 		logger.Info("已确保必要的目录结构存在")
 	}
 
+	// 选择配置档案：--profile参数优先，其次是上次切换到的档案，默认使用data目录
+	profilePaths, err := config.InitProfile(executableDir, config.SelectStartupProfile(executableDir, config.ProfileFromArgs(os.Args[1:])))
+	if err != nil {
+		logger.Error("初始化配置档案失败: %v", err)
+		os.Exit(1)
+	}
+	logger.Info("使用配置档案: %s (%s)", profilePaths.Name, profilePaths.Dir)
+
 	// 初始化配置数据库
-	dbPath := getAbsolutePath("data/config.db")
+	dbPath := profilePaths.DBPath
 	err = config.InitConfigDB(dbPath)
 	if err != nil {
 		logger.Error("初始化配置数据库失败: %v", err)
@@ -123,18 +145,6 @@ func main() {
 		logger.Info("确保API密钥表存在成功")
 	}
 
-	// 设置数据文件路径
-	config.SetDailyFilePath(getAbsolutePath("data/daily.json"))
-
-	// 确保初始化每日统计数据
-	err = config.InitDailyStats()
-	if err != nil {
-		logger.Error("初始化每日统计数据失败: %v", err)
-		// 继续执行，因为这不是致命错误
-	} else {
-		logger.Info("每日统计数据初始化成功")
-	}
-
 	// 加载配置
 	cfg, err := config.LoadConfigFromDB()
 	if err != nil {
@@ -148,6 +158,35 @@ func main() {
 		return
 	}
 
+	// 设置数据文件路径
+	config.SetDailyFilePath(profilePaths.DailyFilePath)
+
+	// 设置统计环境，不同环境的统计数据分开存储，加载统计数据时只取出该环境的数据
+	if err := config.SetStatsEnvironment(cfg.Stats.Environment); err != nil {
+		logger.Error("设置统计环境失败: %v", err)
+	}
+
+	// 只读副本模式不写入统计文件，需要在加载统计数据之前设置
+	if cfg.Stats.ReadOnlyReplica {
+		config.SetDailyStatsReadOnly(true)
+	}
+
+	// 获取统计文件锁，其他实例正在使用同一统计文件时按配置进入只读模式或拒绝启动
+	// 必须在加载统计数据之前，避免与其他实例同时读写统计文件
+	if err := config.AcquireStatsFileLock(); err != nil {
+		logger.Error("统计文件锁定检查失败，拒绝启动: %v", err)
+		os.Exit(1)
+	}
+
+	// 确保初始化每日统计数据
+	err = config.InitDailyStats()
+	if err != nil {
+		logger.Error("初始化每日统计数据失败: %v", err)
+		// 继续执行，因为这不是致命错误
+	} else {
+		logger.Info("每日统计数据初始化成功")
+	}
+
 	// 获取数据库中的版本号，并更新应用标题
 	dbVersion := config.GetVersion()
 	if dbVersion != "" {
@@ -212,6 +251,23 @@ func main() {
 	key.StartKeyManager()
 	logger.Info("API密钥管理器已启动")
 
+	// 启动每日统计摘要发送，是否发送由stats.digest配置决定
+	common.StartDigestReporter()
+
+	// 启动用量异常检测
+	common.StartAnomalyDetector()
+
+	// 只读副本模式：监听统计文件变化并自动重新加载
+	statsCtx, statsCancel := context.WithCancel(context.Background())
+	if cfg.Stats.ReadOnlyReplica {
+		if err := config.StartFileWatcher(statsCtx); err != nil {
+			logger.Error("启动统计文件监听失败: %v", err)
+		}
+	}
+
+	// 将旧版本按掩码记录的密钥统计关联到稳定密钥标识
+	config.MigrateKeyUsageIdentifiers()
+
 	// 输出模型策略配置
 	logModelStrategies()
 
@@ -267,6 +323,14 @@ func main() {
 	key.StopKeyManager()
 	logger.Info("API密钥管理器已停止")
 
+	// 停止统计文件监听
+	statsCancel()
+
+	// 同步保存每日统计数据
+	if err := config.FlushDailyStats(); err != nil {
+		logger.Error("保存每日统计数据失败: %v", err)
+	}
+
 	// 保存API密钥
 	if err := config.SaveApiKeys(); err != nil {
 		logger.Error("保存API密钥失败: %v", err)
@@ -381,6 +445,14 @@ func onReady() {
 	systray.SetTitle("流动硅基")
 	systray.SetTooltip("流动硅基 FlowSilicon " + dbVersion)
 
+	// 当前配置档案，只用于显示，切换档案后更新
+	mProfile := systray.AddMenuItem("配置档案: "+config.GetActiveProfile(), "当前使用的配置档案")
+	mProfile.Disable()
+	config.OnProfileChanged(func(name string) {
+		mProfile.SetTitle("配置档案: " + name)
+	})
+	systray.AddSeparator()
+
 	// 添加菜单项
 	mOpen := systray.AddMenuItem("打开界面", "打开Web界面")
 	systray.AddSeparator()
@@ -435,6 +507,10 @@ func onReady() {
 func onExit() {
 	// 如果是真正的退出请求，则退出程序
 	if realQuit {
+		// 保存每日统计数据
+		if err := config.FlushDailyStats(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
 		// 保存API密钥
 		config.SaveApiKeys()
 		// 关闭数据库连接
@@ -613,3 +689,106 @@ func restartProgram() {
 	realQuit = true
 	systray.Quit()
 }
+
+// runStatsCommand 执行 stats 子命令，以只读方式加载配置档案的统计文件并输出表格
+func runStatsCommand(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	date := fs.String("date", "", "统计日期，格式YYYY-MM-DD，默认今天")
+	profile := fs.String("profile", "", "查看的配置档案，默认为上次使用的档案")
+	env := fs.String("env", "", "查看的统计环境，默认为配置档案中的stats.environment")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// 日志只写入文件，避免与表格输出混在一起
+	logger.SetGuiMode(true)
+	if err := logger.InitLogger(); err != nil {
+		fmt.Fprintf(os.Stderr, "初始化日志系统失败: %v\n", err)
+		return 1
+	}
+
+	// 与服务启动时使用相同的档案统计文件和统计环境
+	if _, err := config.LoadProfileStats(executableDir, config.SelectStartupProfile(executableDir, *profile), *env); err != nil {
+		fmt.Fprintf(os.Stderr, "加载统计数据失败: %v\n", err)
+		return 1
+	}
+
+	if err := config.RenderStatsTable(os.Stdout, *date); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runImportKeysCommand 执行 import-keys 子命令，将每行一个密钥的文件导入到配置档案的密钥池
+// 文件为-时从标准输入读取；程序运行中导入的密钥需重启后生效，运行时可改用/api/admin/keys/import接口
+func runImportKeysCommand(args []string) int {
+	fs := flag.NewFlagSet("import-keys", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "只向上游校验密钥，不保存")
+	balance := fs.Float64("balance", 0, "所有密钥使用的余额，大于0时不向上游校验")
+	profile := fs.String("profile", "", "导入到的配置档案，默认为上次使用的档案")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "用法: flowsilicon import-keys [--dry-run] [--balance 余额] [--profile 档案] <文件|->")
+		return 2
+	}
+
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取密钥文件失败: %v\n", err)
+		return 1
+	}
+
+	// 日志只写入文件，避免与导入结果混在一起
+	logger.SetGuiMode(true)
+	if err := logger.InitLogger(); err != nil {
+		fmt.Fprintf(os.Stderr, "初始化日志系统失败: %v\n", err)
+		return 1
+	}
+
+	profilePaths, err := config.InitProfile(executableDir, config.SelectStartupProfile(executableDir, *profile))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "初始化配置档案失败: %v\n", err)
+		return 1
+	}
+	if err := config.InitConfigDB(profilePaths.DBPath); err != nil {
+		fmt.Fprintf(os.Stderr, "初始化配置数据库失败: %v\n", err)
+		return 1
+	}
+	defer config.CloseConfigDB()
+	if err := config.EnsureDefaultConfig(profilePaths.DBPath); err != nil {
+		fmt.Fprintf(os.Stderr, "确保默认配置失败: %v\n", err)
+		return 1
+	}
+	if err := config.EnsureApikeys(profilePaths.DBPath); err != nil {
+		fmt.Fprintf(os.Stderr, "创建apikeys表失败: %v\n", err)
+		return 1
+	}
+	if _, err := config.LoadConfigFromDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		return 1
+	}
+	if err := config.LoadApiKeysFromDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "加载API密钥失败: %v\n", err)
+		return 1
+	}
+
+	result := key.ImportKeys(string(data), key.ImportOptions{DryRun: *dryRun, Balance: *balance})
+	for _, item := range result.Items {
+		fmt.Printf("第%d行\t%s\t%s\t%.2f\t%s\n", item.Line, item.MaskedKey, item.Status, item.Balance, item.Error)
+	}
+	fmt.Printf("档案 %s：共%d个，添加%d个，校验通过%d个，重复%d个，无效%d个\n",
+		profilePaths.Name, result.Total, result.Added, result.Valid, result.Duplicates, result.Invalid)
+	if result.Invalid > 0 {
+		return 1
+	}
+	return 0
+}
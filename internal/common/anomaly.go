@@ -0,0 +1,83 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 20:10:00
+  @desc: 定时检测用量异常，发送告警并按配置自动禁用密钥或暂停代理
+**/
+
+package common
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// anomalyCheckInterval 用量异常检测间隔
+const anomalyCheckInterval = time.Minute
+
+// anomalyDetectorOnce 保证异常检测协程只启动一次
+var anomalyDetectorOnce sync.Once
+
+// StartAnomalyDetector 启动用量异常检测协程，是否检测在每次执行时按配置决定
+func StartAnomalyDetector() {
+	anomalyDetectorOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(anomalyCheckInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				cfg := config.GetAnomalyConfig()
+				if !cfg.Enabled {
+					continue
+				}
+				for _, a := range config.DetectAnomalies(time.Now()) {
+					handleAnomaly(a, cfg)
+				}
+			}
+		}()
+	})
+}
+
+// handleAnomaly 记录异常，按配置执行保护动作并发送告警
+func handleAnomaly(a config.Anomaly, cfg config.AnomalyConfig) {
+	subject := "密钥池"
+	if a.Scope == config.AnomalyScopeKey {
+		subject = "密钥 " + config.DisplayKeyID(a.Subject, false)
+	}
+	logger.Error("[高危] 检测到用量异常: %s 在 %s 的 %s 为 %d，超过阈值 %.0f（基线平均 %.1f）",
+		subject, a.Period, a.Metric, a.Current, a.Threshold, a.Baseline)
+
+	switch {
+	case a.Scope == config.AnomalyScopeKey && cfg.AutoDisableKey:
+		if config.ProtectKeyByID(a.Subject) {
+			a.Action = "disable_key"
+			logger.Warn("已自动禁用用量异常的%s，可在密钥管理中手动启用", subject)
+		}
+	case a.Scope == config.AnomalyScopePool && cfg.AutoPause:
+		config.PauseProxy(fmt.Sprintf("%s 的 %s 用量异常（%d，阈值 %.0f）", a.Period, a.Metric, a.Current, a.Threshold))
+		a.Action = "pause_proxy"
+		logger.Warn("密钥池用量异常，已自动暂停所有代理请求，可在管理界面恢复")
+	}
+
+	config.RecordAnomaly(a)
+
+	// anomaly.webhook_url保持原有的异常JSON格式，与通知渠道一样异步发送
+	if cfg.WebhookURL != "" {
+		enqueueNotify("anomaly.webhook_url", func() error { return postJSONWebhook(cfg.WebhookURL, a) })
+	}
+
+	content := fmt.Sprintf("%s 在 %s 的 %s 为 %d，超过阈值 %.0f（基线平均 %.1f）",
+		subject, a.Period, a.Metric, a.Current, a.Threshold, a.Baseline)
+	switch a.Action {
+	case "disable_key":
+		content += "\n已自动禁用该密钥，可在密钥管理中手动启用。"
+	case "pause_proxy":
+		content += "\n已自动暂停所有代理请求，可在管理界面恢复。"
+	}
+	Notify(Notification{
+		Title:    "用量异常",
+		Content:  content,
+		Severity: a.Severity,
+	})
+}
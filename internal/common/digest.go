@@ -0,0 +1,236 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 19:10:00
+  @desc: 每日统计摘要的定时发送，支持Webhook和SMTP邮件
+**/
+
+package common
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// digestMaxAttempts 定时发送失败时的最大尝试次数
+	digestMaxAttempts = 3
+	// digestRetryDelay 重试间隔，按尝试次数递增
+	digestRetryDelay = 30 * time.Second
+	// digestHTTPTimeout Webhook请求超时
+	digestHTTPTimeout = 15 * time.Second
+	// defaultSMTPPort 未配置端口时使用的SMTP端口
+	defaultSMTPPort = 587
+)
+
+// digestReporterOnce 保证摘要发送协程只启动一次
+var digestReporterOnce sync.Once
+
+// digestEmailTemplate 摘要邮件的HTML模板
+var digestEmailTemplate = template.Must(template.New("digest").Parse(`<html><body>
+<h3>FlowSilicon 每日统计 {{.Date}}</h3>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><td>请求数</td><td align="right">{{.Requests}}</td></tr>
+<tr><td>成功</td><td align="right">{{.Success}}</td></tr>
+<tr><td>失败</td><td align="right">{{.Failed}}</td></tr>
+<tr><td>成功率</td><td align="right">{{printf "%.2f" .SuccessRate}}%</td></tr>
+<tr><td>总令牌数</td><td align="right">{{.Tokens.Total}}</td></tr>
+<tr><td>输入令牌</td><td align="right">{{.Tokens.Prompt}}</td></tr>
+<tr><td>输出令牌</td><td align="right">{{.Tokens.Completion}}</td></tr>
+</table>
+{{if .TopModels}}<h4>热门模型</h4>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>模型</th><th>请求数</th><th>令牌数</th><th>失败</th></tr>
+{{range .TopModels}}<tr><td>{{.Model}}</td><td align="right">{{.Requests}}</td><td align="right">{{.Tokens}}</td><td align="right">{{.Failed}}</td></tr>
+{{end}}</table>{{end}}
+{{if .TopKeys}}<h4>热门密钥</h4>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>密钥</th><th>请求数</th><th>令牌数</th></tr>
+{{range .TopKeys}}<tr><td>{{.Key}}</td><td align="right">{{.Requests}}</td><td align="right">{{.Tokens}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Warnings}}<h4>警告</h4>
+<ul>{{range .Warnings}}<li>{{.}}</li>{{end}}</ul>{{end}}
+</body></html>`))
+
+// StartDigestReporter 启动每日摘要发送协程，是否发送和发送时间在每次执行时按配置决定
+func StartDigestReporter() {
+	digestReporterOnce.Do(func() {
+		go func() {
+			for {
+				next := config.NextDigestTime(time.Now(), config.GetDigestConfig().Time)
+				time.Sleep(time.Until(next))
+
+				if !config.GetDigestConfig().Enabled {
+					continue
+				}
+				if err := sendDigestWithRetry(""); err != nil {
+					logger.Error("每日统计摘要发送失败: %v", err)
+				}
+			}
+		}()
+	})
+}
+
+// SendDailyDigest 立即生成并发送指定日期的摘要（date为空时为昨天），只尝试一次，用于验证配置
+func SendDailyDigest(date string) (*config.DailyDigest, error) {
+	digest, err := config.BuildDailyDigest(date)
+	if err != nil {
+		return nil, err
+	}
+	return digest, deliverDigest(digest, config.GetDigestConfig())
+}
+
+// sendDigestWithRetry 生成并发送摘要，失败时按递增间隔重试
+func sendDigestWithRetry(date string) error {
+	digest, err := config.BuildDailyDigest(date)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = deliverDigest(digest, config.GetDigestConfig())
+		if err == nil {
+			logger.Info("已发送 %s 的每日统计摘要", digest.Date)
+			return nil
+		}
+		if attempt >= digestMaxAttempts {
+			return err
+		}
+		logger.Warn("每日统计摘要第%d次发送失败，稍后重试: %v", attempt, err)
+		time.Sleep(time.Duration(attempt) * digestRetryDelay)
+	}
+}
+
+// deliverDigest 发送摘要到所有已配置的目标，任一目标失败时返回错误
+func deliverDigest(digest *config.DailyDigest, cfg config.DigestConfig) error {
+	if cfg.WebhookURL == "" && cfg.SMTP.Host == "" {
+		return errors.New("未配置摘要发送目标（webhook_url或smtp.host）")
+	}
+
+	var errs []error
+	if cfg.WebhookURL != "" {
+		if err := postJSONWebhook(cfg.WebhookURL, digest); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	if cfg.SMTP.Host != "" {
+		if err := sendDigestEmail(cfg.SMTP, digest); err != nil {
+			errs = append(errs, fmt.Errorf("smtp: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// postJSONWebhook 以JSON格式POST到Webhook地址，非2xx状态码视为失败
+func postJSONWebhook(url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: digestHTTPTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendDigestEmail 以HTML邮件发送摘要
+func sendDigestEmail(cfg config.DigestSMTPConfig, digest *config.DailyDigest) error {
+	if len(cfg.To) == 0 {
+		return errors.New("未配置收件人")
+	}
+	from := cfg.From
+	if from == "" {
+		from = cfg.Username
+	}
+	if from == "" {
+		return errors.New("未配置发件人")
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+
+	var html bytes.Buffer
+	if err := digestEmailTemplate.Execute(&html, digest); err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + strings.Join(cfg.To, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", "FlowSilicon 每日统计 "+digest.Date) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	msg.Write(html.Bytes())
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	// 465端口使用SSL直连，其他端口由smtp.SendMail在服务器支持时升级为STARTTLS
+	if port != 465 {
+		return smtp.SendMail(addr, auth, from, cfg.To, msg.Bytes())
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: digestHTTPTimeout}, "tcp", addr, &tls.Config{ServerName: cfg.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, to := range cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,333 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 21:10:00
+  @desc: 告警通知渠道（Webhook、Bark、Server酱、Telegram），异步发送并有限次重试
+**/
+
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// notifyQueueSize 待发送通知队列长度，队列满时丢弃新通知
+	notifyQueueSize = 100
+	// notifyWorkers 发送通知的协程数，单个渠道响应慢时不影响其他渠道
+	notifyWorkers = 4
+	// notifyMaxAttempts 每条通知的最大尝试次数
+	notifyMaxAttempts = 3
+	// notifyRetryDelay 重试间隔，按尝试次数递增
+	notifyRetryDelay = 5 * time.Second
+	// notifyHTTPTimeout 通知请求超时
+	notifyHTTPTimeout = 10 * time.Second
+
+	defaultBarkServer      = "https://api.day.app"
+	defaultBarkGroup       = "FlowSilicon"
+	defaultTelegramAPIBase = "https://api.telegram.org"
+)
+
+// serverChan3KeyPattern Server酱³的SendKey格式，其中的数字为用户编号
+var serverChan3KeyPattern = regexp.MustCompile(`^sctp(\d+)t`)
+
+// Notification 一条告警通知
+type Notification struct {
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Severity string `json:"severity"` // info、warning、critical
+	Time     string `json:"time"`
+}
+
+// Notifier 通知渠道
+type Notifier interface {
+	// Name 渠道名称
+	Name() string
+	// Send 同步发送一条通知，失败时返回错误
+	Send(n Notification) error
+}
+
+// notifyJob 待发送的通知任务
+type notifyJob struct {
+	channel string
+	send    func() error
+}
+
+var (
+	// notifyQueue 待发送通知队列
+	notifyQueue = make(chan notifyJob, notifyQueueSize)
+	// notifyWorkersOnce 保证发送协程只启动一次
+	notifyWorkersOnce sync.Once
+)
+
+// severityLabel 通知级别的中文名称
+func severityLabel(severity string) string {
+	switch severity {
+	case config.SeverityCritical:
+		return "严重"
+	case config.SeverityWarning:
+		return "警告"
+	default:
+		return "信息"
+	}
+}
+
+// Notify 异步发送通知到所有已启用且最低级别不高于该通知的渠道，不会阻塞调用方
+func Notify(n Notification) {
+	if n.Severity == "" {
+		n.Severity = config.SeverityInfo
+	}
+	if n.Time == "" {
+		n.Time = time.Now().Format("2006-01-02 15:04:05")
+	}
+
+	cfg := config.GetNotifyConfig()
+	for _, channel := range []string{config.NotifyChannelWebhook, config.NotifyChannelBark, config.NotifyChannelServerChan, config.NotifyChannelTelegram} {
+		enabled, minSeverity := notifyChannelState(cfg, channel)
+		if !enabled || !config.SeverityAtLeast(n.Severity, minSeverity) {
+			continue
+		}
+		notifier, err := newNotifier(cfg, channel)
+		if err != nil {
+			logger.Warn("通知渠道 %s 配置无效: %v", channel, err)
+			continue
+		}
+		enqueueNotify(channel, func() error { return notifier.Send(n) })
+	}
+}
+
+// SendTestNotification 同步向指定渠道发送一条测试通知，渠道未启用时同样发送，便于启用前验证配置
+func SendTestNotification(channel string) error {
+	notifier, err := newNotifier(config.GetNotifyConfig(), channel)
+	if err != nil {
+		return err
+	}
+	return notifier.Send(Notification{
+		Title:    "FlowSilicon 测试通知",
+		Content:  "这是一条测试通知，收到说明渠道 " + channel + " 配置正确。",
+		Severity: config.SeverityInfo,
+		Time:     time.Now().Format("2006-01-02 15:04:05"),
+	})
+}
+
+// enqueueNotify 将发送任务放入队列，队列已满时丢弃并记录日志
+func enqueueNotify(channel string, send func() error) {
+	notifyWorkersOnce.Do(func() {
+		for i := 0; i < notifyWorkers; i++ {
+			go func() {
+				for job := range notifyQueue {
+					deliverNotifyJob(job)
+				}
+			}()
+		}
+	})
+
+	select {
+	case notifyQueue <- notifyJob{channel: channel, send: send}:
+	default:
+		logger.Warn("通知队列已满，丢弃发送到 %s 的通知", channel)
+	}
+}
+
+// deliverNotifyJob 发送通知，失败时按递增间隔重试
+func deliverNotifyJob(job notifyJob) {
+	for attempt := 1; ; attempt++ {
+		err := job.send()
+		if err == nil {
+			return
+		}
+		if attempt >= notifyMaxAttempts {
+			logger.Error("发送通知到 %s 失败，已重试%d次: %v", job.channel, attempt, err)
+			return
+		}
+		logger.Warn("发送通知到 %s 第%d次失败，稍后重试: %v", job.channel, attempt, err)
+		time.Sleep(time.Duration(attempt) * notifyRetryDelay)
+	}
+}
+
+// notifyChannelState 获取渠道是否启用及最低通知级别
+func notifyChannelState(cfg config.NotifyConfig, channel string) (bool, string) {
+	switch channel {
+	case config.NotifyChannelWebhook:
+		return cfg.Webhook.Enabled, cfg.Webhook.MinSeverity
+	case config.NotifyChannelBark:
+		return cfg.Bark.Enabled, cfg.Bark.MinSeverity
+	case config.NotifyChannelServerChan:
+		return cfg.ServerChan.Enabled, cfg.ServerChan.MinSeverity
+	case config.NotifyChannelTelegram:
+		return cfg.Telegram.Enabled, cfg.Telegram.MinSeverity
+	}
+	return false, ""
+}
+
+// newNotifier 按配置创建渠道，缺少必填项时返回错误
+func newNotifier(cfg config.NotifyConfig, channel string) (Notifier, error) {
+	switch channel {
+	case config.NotifyChannelWebhook:
+		if cfg.Webhook.URL == "" {
+			return nil, errors.New("未配置url")
+		}
+		return &webhookNotifier{url: cfg.Webhook.URL}, nil
+	case config.NotifyChannelBark:
+		if cfg.Bark.DeviceKey == "" {
+			return nil, errors.New("未配置device_key")
+		}
+		server := strings.TrimRight(cfg.Bark.Server, "/")
+		if server == "" {
+			server = defaultBarkServer
+		}
+		group := cfg.Bark.Group
+		if group == "" {
+			group = defaultBarkGroup
+		}
+		return &barkNotifier{server: server, deviceKey: cfg.Bark.DeviceKey, group: group}, nil
+	case config.NotifyChannelServerChan:
+		if cfg.ServerChan.SendKey == "" {
+			return nil, errors.New("未配置send_key")
+		}
+		return &serverChanNotifier{sendKey: cfg.ServerChan.SendKey}, nil
+	case config.NotifyChannelTelegram:
+		if cfg.Telegram.BotToken == "" || cfg.Telegram.ChatID == "" {
+			return nil, errors.New("未配置bot_token或chat_id")
+		}
+		apiBase := strings.TrimRight(cfg.Telegram.APIBase, "/")
+		if apiBase == "" {
+			apiBase = defaultTelegramAPIBase
+		}
+		return &telegramNotifier{apiBase: apiBase, botToken: cfg.Telegram.BotToken, chatID: cfg.Telegram.ChatID}, nil
+	}
+	return nil, fmt.Errorf("未知的通知渠道: %s", channel)
+}
+
+// postNotify 发送通知请求，非2xx状态码视为失败，返回响应体
+func postNotify(target, contentType string, body []byte) ([]byte, error) {
+	client := &http.Client{Timeout: notifyHTTPTimeout}
+	resp, err := client.Post(target, contentType, bytes.NewReader(body))
+	if err != nil {
+		// 地址中可能包含SendKey或机器人令牌，错误信息中去掉地址避免写入日志
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return respBody, fmt.Errorf("返回状态码 %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+// webhookNotifier 通用Webhook渠道，POST通知的JSON
+type webhookNotifier struct {
+	url string
+}
+
+func (w *webhookNotifier) Name() string { return config.NotifyChannelWebhook }
+
+func (w *webhookNotifier) Send(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	_, err = postNotify(w.url, "application/json", body)
+	return err
+}
+
+// barkNotifier Bark推送渠道
+type barkNotifier struct {
+	server    string
+	deviceKey string
+	group     string
+}
+
+func (b *barkNotifier) Name() string { return config.NotifyChannelBark }
+
+func (b *barkNotifier) Send(n Notification) error {
+	// 严重通知使用时效性通知，在专注模式下也会提醒
+	level := "active"
+	if n.Severity == config.SeverityCritical {
+		level = "timeSensitive"
+	}
+	body, err := json.Marshal(map[string]string{
+		"device_key": b.deviceKey,
+		"title":      "[" + severityLabel(n.Severity) + "] " + n.Title,
+		"body":       n.Content,
+		"group":      b.group,
+		"level":      level,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = postNotify(b.server+"/push", "application/json", body)
+	return err
+}
+
+// serverChanNotifier Server酱推送渠道
+type serverChanNotifier struct {
+	sendKey string
+}
+
+func (s *serverChanNotifier) Name() string { return config.NotifyChannelServerChan }
+
+func (s *serverChanNotifier) Send(n Notification) error {
+	target := "https://sctapi.ftqq.com/" + s.sendKey + ".send"
+	if m := serverChan3KeyPattern.FindStringSubmatch(s.sendKey); m != nil {
+		target = "https://" + m[1] + ".push.ft07.com/send/" + s.sendKey + ".send"
+	}
+
+	// desp支持Markdown
+	form := url.Values{}
+	form.Set("title", "["+severityLabel(n.Severity)+"] "+n.Title)
+	form.Set("desp", n.Content+"\n\n> "+n.Time)
+	respBody, err := postNotify(target, "application/x-www-form-urlencoded", []byte(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	// 状态码为200时以响应中的code判断是否成功
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(respBody, &result) == nil && result.Code != 0 {
+		return fmt.Errorf("返回错误 %d: %s", result.Code, result.Message)
+	}
+	return nil
+}
+
+// telegramNotifier Telegram机器人渠道
+type telegramNotifier struct {
+	apiBase  string
+	botToken string
+	chatID   string
+}
+
+func (t *telegramNotifier) Name() string { return config.NotifyChannelTelegram }
+
+func (t *telegramNotifier) Send(n Notification) error {
+	// 使用纯文本，避免标题和内容中的特殊字符需要转义
+	text := fmt.Sprintf("[%s] %s\n\n%s\n\n%s", severityLabel(n.Severity), n.Title, n.Content, n.Time)
+	body, err := json.Marshal(map[string]string{
+		"chat_id": t.chatID,
+		"text":    text,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = postNotify(t.apiBase+"/bot"+t.botToken+"/sendMessage", "application/json", body)
+	return err
+}
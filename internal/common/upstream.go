@@ -0,0 +1,147 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 19:30:00
+  @desc: 上游基础URL的热切换，切换前探测新地址，切换后复查失败时自动回滚
+**/
+
+package common
+
+import (
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// upstreamProbeTimeout 单次探测的超时时间
+	upstreamProbeTimeout = 10 * time.Second
+	// upstreamProbeAttempts 切换前探测的最大尝试次数
+	upstreamProbeAttempts = 2
+	// upstreamVerifyDelay 切换后复查新地址的等待时间
+	upstreamVerifyDelay = 30 * time.Second
+)
+
+// NormalizeUpstreamURL 校验并规范化上游基础URL，去掉末尾的斜杠
+func NormalizeUpstreamURL(raw string) (string, error) {
+	raw = strings.TrimRight(strings.TrimSpace(raw), "/")
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("上游地址格式错误: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("上游地址必须是http或https地址: %s", raw)
+	}
+	return raw, nil
+}
+
+// ProbeUpstream 使用一个可用密钥请求 baseURL 的模型列表接口，2xx视为可用
+// 没有可用密钥时不带认证请求，401/403也视为可用
+func ProbeUpstream(baseURL string) error {
+	req, err := http.NewRequest("GET", baseURL+"/v1/models", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept-Encoding", "identity")
+
+	authenticated := false
+	if keys := config.GetActiveApiKeys(); len(keys) > 0 {
+		req.Header.Set("Authorization", "Bearer "+keys[0].Key)
+		authenticated = true
+	}
+
+	resp, err := utils.CreateClientWithTimeout(upstreamProbeTimeout).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if !authenticated && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		return nil
+	}
+	return fmt.Errorf("返回状态码 %d", resp.StatusCode)
+}
+
+// probeUpstreamWithRetry 探测上游地址，失败时短暂等待后重试，并记录最后一次结果
+func probeUpstreamWithRetry(baseURL string) error {
+	var err error
+	for attempt := 1; attempt <= upstreamProbeAttempts; attempt++ {
+		if err = ProbeUpstream(baseURL); err == nil {
+			break
+		}
+		if attempt < upstreamProbeAttempts {
+			time.Sleep(time.Second)
+		}
+	}
+	config.RecordUpstreamProbe(baseURL, err)
+	return err
+}
+
+// SwitchUpstreamBaseURL 探测通过后切换上游基础URL，探测失败时保持旧地址并返回错误
+// 切换成功后会在后台复查新地址，复查失败时自动回滚到旧地址
+func SwitchUpstreamBaseURL(raw string) error {
+	newURL, err := NormalizeUpstreamURL(raw)
+	if err != nil {
+		return err
+	}
+
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return errors.New("无法获取系统配置")
+	}
+	oldURL := cfg.ApiProxy.BaseURL
+	if newURL == oldURL {
+		return nil
+	}
+
+	if err := probeUpstreamWithRetry(newURL); err != nil {
+		logger.Warn("上游地址 %s 探测失败，继续使用 %s: %v", newURL, oldURL, err)
+		return fmt.Errorf("新上游地址探测失败: %v", err)
+	}
+
+	switched, err := config.SetUpstreamBaseURL(newURL, oldURL, false)
+	if err != nil {
+		logger.Error("保存上游地址配置失败: %v", err)
+		return fmt.Errorf("保存上游地址配置失败: %v", err)
+	}
+	if !switched {
+		return errors.New("上游地址在探测期间已被修改，本次切换未生效")
+	}
+	logger.Info("上游地址已从 %s 切换为 %s", oldURL, newURL)
+
+	go verifyUpstreamSwitch(newURL, oldURL)
+	return nil
+}
+
+// verifyUpstreamSwitch 切换后复查新地址，失败时回滚到旧地址
+func verifyUpstreamSwitch(newURL, oldURL string) {
+	time.Sleep(upstreamVerifyDelay)
+
+	err := probeUpstreamWithRetry(newURL)
+	if err == nil || oldURL == "" {
+		return
+	}
+
+	switched, saveErr := config.SetUpstreamBaseURL(oldURL, newURL, true)
+	if saveErr != nil {
+		logger.Error("保存上游地址配置失败: %v", saveErr)
+	}
+	if switched {
+		logger.Warn("上游地址 %s 切换后复查失败，已自动回滚到 %s: %v", newURL, oldURL, err)
+		Notify(Notification{
+			Title:    "上游地址已回滚",
+			Content:  fmt.Sprintf("上游地址 %s 切换后复查失败，已自动回滚到 %s：%v", newURL, oldURL, err),
+			Severity: config.SeverityWarning,
+		})
+	}
+}
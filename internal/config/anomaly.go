@@ -0,0 +1,304 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 20:10:00
+  @desc: 请求量与令牌用量的异常检测，以及检测到异常后的自动保护状态
+**/
+
+package config
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 异常检测的默认值
+const (
+	defaultAnomalyMultiplier      = 10
+	defaultAnomalyBaselineDays    = 7
+	defaultAnomalyMinBaselineDays = 3
+	defaultAnomalyMinRequests     = 100
+	defaultAnomalyMinTokens       = 100000
+	// maxRecentAnomalies 保留的最近异常记录数
+	maxRecentAnomalies = 50
+)
+
+// 异常范围
+const (
+	AnomalyScopePool = "pool" // 整个密钥池的当前小时用量，与前几天同一小时的平均值比较
+	AnomalyScopeKey  = "key"  // 单个密钥的当日用量，与前几天的日均值比较
+)
+
+// AnomalyConfig 用量异常检测配置
+type AnomalyConfig struct {
+	Enabled         bool    `mapstructure:"enabled"`           // 是否每分钟检测一次用量异常
+	Multiplier      float64 `mapstructure:"multiplier"`        // 超过基线平均值的倍数视为异常，默认10
+	BaselineDays    int     `mapstructure:"baseline_days"`     // 基线使用的天数，默认7
+	MinBaselineDays int     `mapstructure:"min_baseline_days"` // 至少有多少天历史数据才开始检测，避免冷启动误报，默认3
+	MinRequests     int     `mapstructure:"min_requests"`      // 请求数低于该值时不视为异常，默认100
+	MinTokens       int     `mapstructure:"min_tokens"`        // 令牌数低于该值时不视为异常，默认100000
+	WebhookURL      string  `mapstructure:"webhook_url"`       // 检测到异常时以JSON格式POST通知的地址，为空时只记录日志
+	AutoDisableKey  bool    `mapstructure:"auto_disable_key"`  // 密钥用量异常时自动禁用该密钥，需在管理界面手动启用
+	AutoPause       bool    `mapstructure:"auto_pause"`        // 密钥池用量异常时暂停所有代理请求，需在管理界面手动恢复
+}
+
+// Anomaly 一次用量异常
+type Anomaly struct {
+	Scope      string  `json:"scope"`             // pool或key
+	Subject    string  `json:"subject,omitempty"` // 密钥范围时为稳定密钥标识
+	Metric     string  `json:"metric"`            // requests或tokens
+	Period     string  `json:"period"`            // 统计周期：密钥池为YYYY-MM-DD HH时，密钥为YYYY-MM-DD
+	Current    int     `json:"current"`           // 当前值
+	Baseline   float64 `json:"baseline"`          // 基线平均值
+	Threshold  float64 `json:"threshold"`         // 判定阈值
+	Severity   string  `json:"severity"`
+	DetectedAt string  `json:"detected_at"`
+	Action     string  `json:"action,omitempty"` // 自动执行的保护动作
+}
+
+// ProxyPauseState 代理暂停状态
+type ProxyPauseState struct {
+	Paused bool   `json:"paused"`
+	Reason string `json:"reason,omitempty"`
+	Since  string `json:"since,omitempty"`
+}
+
+var (
+	// recentAnomalies 最近检测到的异常，按时间升序
+	recentAnomalies []Anomaly
+	// alertedAnomalies 已告警的异常，键为范围、对象、指标和周期，同一周期只告警一次
+	alertedAnomalies = make(map[string]bool)
+	// anomalyProtectedKeys 因用量异常被自动禁用的密钥，只能在管理界面手动启用
+	anomalyProtectedKeys = make(map[string]bool)
+	// proxyPause 代理暂停状态
+	proxyPause ProxyPauseState
+	// anomalyMutex 保护以上状态
+	anomalyMutex sync.RWMutex
+)
+
+// GetAnomalyConfig 获取异常检测配置，未配置的项使用默认值
+func GetAnomalyConfig() AnomalyConfig {
+	cfg := getStatsConfig().Anomaly
+	if cfg.Multiplier <= 0 {
+		cfg.Multiplier = defaultAnomalyMultiplier
+	}
+	if cfg.BaselineDays <= 0 {
+		cfg.BaselineDays = defaultAnomalyBaselineDays
+	}
+	if cfg.MinBaselineDays <= 0 {
+		cfg.MinBaselineDays = defaultAnomalyMinBaselineDays
+	}
+	if cfg.MinBaselineDays > cfg.BaselineDays {
+		cfg.MinBaselineDays = cfg.BaselineDays
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = defaultAnomalyMinRequests
+	}
+	if cfg.MinTokens <= 0 {
+		cfg.MinTokens = defaultAnomalyMinTokens
+	}
+	return cfg
+}
+
+// DetectAnomalies 检测now所在小时的密钥池用量和当日各密钥用量，返回本周期内新出现的异常
+// 基线日期中有统计数据的天数少于min_baseline_days时不检测
+func DetectAnomalies(now time.Time) []Anomaly {
+	cfg := GetAnomalyConfig()
+
+	dailyDataLock.RLock()
+	found := detectAnomaliesLocked(cfg, now)
+	dailyDataLock.RUnlock()
+
+	anomalyMutex.Lock()
+	defer anomalyMutex.Unlock()
+
+	var fresh []Anomaly
+	for _, a := range found {
+		id := a.Scope + "|" + a.Subject + "|" + a.Metric + "|" + a.Period
+		if alertedAnomalies[id] {
+			continue
+		}
+		alertedAnomalies[id] = true
+		fresh = append(fresh, a)
+	}
+	// 只保留当天的告警记录
+	today := now.Format("2006-01-02")
+	for id := range alertedAnomalies {
+		if !containsPeriodDate(id, today) {
+			delete(alertedAnomalies, id)
+		}
+	}
+	return fresh
+}
+
+// containsPeriodDate 判断告警记录的周期是否属于指定日期
+func containsPeriodDate(id, date string) bool {
+	for i := len(id) - 1; i >= 0; i-- {
+		if id[i] == '|' {
+			period := id[i+1:]
+			return len(period) >= len(date) && period[:len(date)] == date
+		}
+	}
+	return false
+}
+
+// detectAnomaliesLocked 计算当前用量与基线（已加锁）
+func detectAnomaliesLocked(cfg AnomalyConfig, now time.Time) []Anomaly {
+	if dailyData == nil {
+		return nil
+	}
+
+	today := now.Format("2006-01-02")
+	hour := now.Hour()
+	byDate := make(map[string]*DailyStats, len(dailyData.DailyStats))
+	for i := range dailyData.DailyStats {
+		byDate[dailyData.DailyStats[i].Date] = &dailyData.DailyStats[i]
+	}
+
+	var baselineDates []string
+	for i := 1; i <= cfg.BaselineDays; i++ {
+		date := now.AddDate(0, 0, -i).Format("2006-01-02")
+		if _, ok := byDate[date]; ok {
+			baselineDates = append(baselineDates, date)
+		}
+	}
+	if len(baselineDates) < cfg.MinBaselineDays {
+		return nil
+	}
+	days := float64(len(baselineDates))
+
+	var anomalies []Anomaly
+	check := func(scope, subject, metric, period string, current int, baseline float64, floor int) {
+		threshold := baseline * cfg.Multiplier
+		if threshold < float64(floor) {
+			threshold = float64(floor)
+		}
+		if float64(current) <= threshold {
+			return
+		}
+		anomalies = append(anomalies, Anomaly{
+			Scope:      scope,
+			Subject:    subject,
+			Metric:     metric,
+			Period:     period,
+			Current:    current,
+			Baseline:   baseline,
+			Threshold:  threshold,
+			Severity:   SeverityCritical,
+			DetectedAt: now.Format(time.RFC3339),
+		})
+	}
+
+	// 密钥池：当前小时与前几天同一小时的平均值比较
+	if todayStats, ok := byDate[today]; ok && hour < len(todayStats.Hourly) {
+		var baseRequests, baseTokens int
+		for _, date := range baselineDates {
+			if hourly := byDate[date].Hourly; hour < len(hourly) {
+				baseRequests += hourly[hour].Requests
+				baseTokens += hourly[hour].Tokens
+			}
+		}
+		period := fmt.Sprintf("%s %02d", today, hour)
+		current := todayStats.Hourly[hour]
+		check(AnomalyScopePool, "", "requests", period, current.Requests, float64(baseRequests)/days, cfg.MinRequests)
+		check(AnomalyScopePool, "", "tokens", period, current.Tokens, float64(baseTokens)/days, cfg.MinTokens)
+	}
+
+	// 单个密钥：当日用量与前几天的日均值比较，没有历史记录的密钥基线为0，只按下限判断
+	for keyID, usageByDate := range dailyData.KeysUsage {
+		current, ok := usageByDate[today]
+		if !ok {
+			continue
+		}
+		var baseRequests, baseTokens int
+		for _, date := range baselineDates {
+			baseRequests += usageByDate[date].Requests
+			baseTokens += usageByDate[date].Tokens
+		}
+		check(AnomalyScopeKey, keyID, "requests", today, current.Requests, float64(baseRequests)/days, cfg.MinRequests)
+		check(AnomalyScopeKey, keyID, "tokens", today, current.Tokens, float64(baseTokens)/days, cfg.MinTokens)
+	}
+
+	return anomalies
+}
+
+// RecordAnomaly 保存一条异常记录，供管理界面查看
+func RecordAnomaly(a Anomaly) {
+	anomalyMutex.Lock()
+	defer anomalyMutex.Unlock()
+
+	recentAnomalies = append(recentAnomalies, a)
+	if len(recentAnomalies) > maxRecentAnomalies {
+		recentAnomalies = recentAnomalies[len(recentAnomalies)-maxRecentAnomalies:]
+	}
+}
+
+// GetRecentAnomalies 获取最近检测到的异常，按时间升序
+func GetRecentAnomalies() []Anomaly {
+	anomalyMutex.RLock()
+	defer anomalyMutex.RUnlock()
+
+	result := make([]Anomaly, len(recentAnomalies))
+	copy(result, recentAnomalies)
+	return result
+}
+
+// ProtectKeyByID 因用量异常禁用稳定标识对应的密钥，恢复检查不会自动启用该密钥
+// 返回是否找到并禁用了密钥
+func ProtectKeyByID(keyID string) bool {
+	apiKey, ok := resolveKeyID(keyID)
+	if !ok || !DisableApiKey(apiKey) {
+		return false
+	}
+
+	anomalyMutex.Lock()
+	anomalyProtectedKeys[keyID] = true
+	anomalyMutex.Unlock()
+	return true
+}
+
+// IsKeyAnomalyProtected 判断密钥是否因用量异常被禁用
+func IsKeyAnomalyProtected(apiKey string) bool {
+	anomalyMutex.RLock()
+	defer anomalyMutex.RUnlock()
+	return anomalyProtectedKeys[KeyID(apiKey)]
+}
+
+// ClearKeyAnomalyProtection 清除密钥的异常保护标记，在管理界面手动启用密钥前调用
+func ClearKeyAnomalyProtection(apiKey string) {
+	anomalyMutex.Lock()
+	defer anomalyMutex.Unlock()
+	delete(anomalyProtectedKeys, KeyID(apiKey))
+}
+
+// PauseProxy 暂停所有代理请求，已暂停时保留原因和开始时间
+func PauseProxy(reason string) {
+	anomalyMutex.Lock()
+	defer anomalyMutex.Unlock()
+
+	if proxyPause.Paused {
+		return
+	}
+	proxyPause = ProxyPauseState{
+		Paused: true,
+		Reason: reason,
+		Since:  time.Now().Format(time.RFC3339),
+	}
+}
+
+// ResumeProxy 恢复代理请求，返回之前是否处于暂停状态
+func ResumeProxy() bool {
+	anomalyMutex.Lock()
+	defer anomalyMutex.Unlock()
+
+	paused := proxyPause.Paused
+	proxyPause = ProxyPauseState{}
+	return paused
+}
+
+// GetProxyPause 获取代理暂停状态
+func GetProxyPause() ProxyPauseState {
+	anomalyMutex.RLock()
+	defer anomalyMutex.RUnlock()
+	return proxyPause
+}
@@ -0,0 +1,146 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 19:50:00
+  @desc: 代理请求的并发限制与优先级配置，以及各优先级的排队等待统计
+**/
+
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// 请求优先级
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+const (
+	// defaultPriorityHeader 未配置时用于指定请求优先级的请求头
+	defaultPriorityHeader = "X-FS-Priority"
+	// defaultQueueTimeout 未配置时的最长排队时间
+	defaultQueueTimeout = 60 * time.Second
+	// defaultPriorityAging 未配置时排队多久提升一个优先级
+	defaultPriorityAging = 10 * time.Second
+)
+
+// ConcurrencyConfig 代理请求并发限制配置，MaxInFlight为0时不限制也不排队
+type ConcurrencyConfig struct {
+	MaxInFlight         int               `mapstructure:"max_in_flight"`         // 同时转发到上游的最大请求数，0表示不限制
+	QueueTimeoutSeconds int               `mapstructure:"queue_timeout_seconds"` // 排队的最长等待时间（秒），默认60
+	PriorityHeader      string            `mapstructure:"priority_header"`       // 指定优先级（high/normal/low）的请求头，默认X-FS-Priority
+	ClientPriorities    map[string]string `mapstructure:"client_priorities"`     // 客户端密钥（请求中的Bearer令牌）对应的优先级，优先于请求头
+	LowMaxFraction      float64           `mapstructure:"low_max_fraction"`      // 低优先级请求最多占用的并发比例（0-1），0表示不限制
+	AgingSeconds        int               `mapstructure:"aging_seconds"`         // 排队每超过该时间提升一个优先级，避免低优先级饿死，默认10
+}
+
+// QueueWaitStats 某个优先级的排队等待统计，只在开启并发限制时记录
+type QueueWaitStats struct {
+	Requests int     `json:"requests"` // 经过并发限制的请求数
+	Queued   int     `json:"queued"`   // 需要排队的请求数
+	TotalMs  int64   `json:"total_ms"` // 累计排队时间（毫秒）
+	MaxMs    int64   `json:"max_ms"`   // 最长排队时间（毫秒）
+	AvgMs    float64 `json:"avg_ms"`   // 平均排队时间（毫秒），按全部请求计算
+	Timeouts int     `json:"timeouts"` // 排队超时次数
+}
+
+// GetConcurrencyConfig 获取并发限制配置
+func GetConcurrencyConfig() ConcurrencyConfig {
+	cfg := GetConfig()
+	if cfg == nil {
+		return ConcurrencyConfig{}
+	}
+	return cfg.ApiProxy.Concurrency
+}
+
+// QueueTimeout 获取最长排队时间
+func (c ConcurrencyConfig) QueueTimeout() time.Duration {
+	if c.QueueTimeoutSeconds > 0 {
+		return time.Duration(c.QueueTimeoutSeconds) * time.Second
+	}
+	return defaultQueueTimeout
+}
+
+// Aging 获取排队多久提升一个优先级
+func (c ConcurrencyConfig) Aging() time.Duration {
+	if c.AgingSeconds > 0 {
+		return time.Duration(c.AgingSeconds) * time.Second
+	}
+	return defaultPriorityAging
+}
+
+// LowPriorityCap 获取低优先级请求最多占用的并发数，0表示不限制
+// 配置了比例时至少保留一个并发，保证低优先级请求最终能被处理
+func (c ConcurrencyConfig) LowPriorityCap() int {
+	if c.MaxInFlight <= 0 || c.LowMaxFraction <= 0 || c.LowMaxFraction >= 1 {
+		return 0
+	}
+	limit := int(float64(c.MaxInFlight) * c.LowMaxFraction)
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+// ResolvePriority 根据客户端密钥和请求头确定请求优先级，无法识别时为normal
+func (c ConcurrencyConfig) ResolvePriority(clientKey string, header func(string) string) string {
+	if clientKey != "" {
+		if p := normalizePriority(c.ClientPriorities[clientKey]); p != "" {
+			return p
+		}
+	}
+	name := c.PriorityHeader
+	if name == "" {
+		name = defaultPriorityHeader
+	}
+	if p := normalizePriority(header(name)); p != "" {
+		return p
+	}
+	return PriorityNormal
+}
+
+// normalizePriority 规范化优先级名称，无法识别时返回空字符串
+func normalizePriority(p string) string {
+	switch strings.ToLower(strings.TrimSpace(p)) {
+	case PriorityHigh:
+		return PriorityHigh
+	case PriorityNormal:
+		return PriorityNormal
+	case PriorityLow:
+		return PriorityLow
+	}
+	return ""
+}
+
+// AddQueueWait 记录一个请求在并发限制中的排队结果
+func AddQueueWait(priority string, wait time.Duration, queued, timedOut bool) {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	todayStats := todayStatsLocked()
+	if todayStats.QueueWait == nil {
+		todayStats.QueueWait = make(map[string]QueueWaitStats)
+	}
+
+	ms := wait.Milliseconds()
+	s := todayStats.QueueWait[priority]
+	s.Requests++
+	if queued {
+		s.Queued++
+	}
+	if timedOut {
+		s.Timeouts++
+	}
+	s.TotalMs += ms
+	if ms > s.MaxMs {
+		s.MaxMs = ms
+	}
+	s.AvgMs = float64(s.TotalMs) / float64(s.Requests)
+	todayStats.QueueWait[priority] = s
+
+	dailyDirty = true
+	scheduleDailySaveLocked()
+}
@@ -37,9 +37,15 @@ type Config struct {
 		Port int `mapstructure:"port"`
 	} `mapstructure:"server"`
 	ApiProxy struct {
-		BaseURL    string      `mapstructure:"base_url"`
-		ModelIndex int         `mapstructure:"model_index"` // 当前使用的模型索引
-		Retry      RetryConfig `mapstructure:"retry"`       // 重试配置
+		BaseURL       string              `mapstructure:"base_url"`
+		ModelIndex    int                 `mapstructure:"model_index"`    // 当前使用的模型索引
+		Retry         RetryConfig         `mapstructure:"retry"`          // 重试配置
+		Mirror        MirrorConfig        `mapstructure:"mirror"`         // 影子流量配置
+		DryRun        bool                `mapstructure:"dry_run"`        // 演练模式：所有代理请求只返回将要发往上游的请求描述，不实际转发
+		AdminToken    string              `mapstructure:"admin_token"`    // 管理令牌，通过X-FS-Admin-Token请求头传入；为空时只允许本机访问管理功能
+		StreamTimeout StreamTimeoutConfig `mapstructure:"stream_timeout"` // 流式请求首字节超时和空闲超时
+		Concurrency   ConcurrencyConfig   `mapstructure:"concurrency"`    // 并发限制与请求优先级，默认不限制
+		VirtualKeys   VirtualKeysConfig   `mapstructure:"virtual_keys"`   // 下游虚拟密钥
 	} `mapstructure:"api_proxy"`
 	Proxy struct {
 		HttpProxy  string `mapstructure:"http_proxy"`  // HTTP代理地址
@@ -73,11 +79,33 @@ type Config struct {
 		HideIcon bool `mapstructure:"hide_icon"` // 是否隐藏系统托盘图标
 		// 禁用的模型列表
 		DisabledModels []string `mapstructure:"disabled_models"` // 禁用的模型ID列表
+		// 密钥每日配额
+		KeyQuota KeyQuotaConfig `mapstructure:"key_quota"` // 密钥每日请求/令牌配额
+		// 密钥脱敏策略
+		KeyMaskPolicy string `mapstructure:"key_mask_policy"` // prefix6、prefix8-suffix4、hash-only、reveal-to-admin，默认prefix6
+		// 密钥到期配置
+		PreferExpiringKeys bool `mapstructure:"prefer_expiring_keys"` // 默认路由在同等健康的密钥中优先使用即将到期的密钥
+		ExpiryWarningDays  int  `mapstructure:"expiry_warning_days"`  // 到期前多少天开始提醒，0表示不提醒
+		// 加权轮询配置
+		WeightedRoundRobin bool           `mapstructure:"weighted_round_robin"` // 默认路由按密钥权重加权轮询，代替普通轮询
+		KeyWeights         map[string]int `mapstructure:"key_weights"`          // 按密钥标识或旧版掩码（前6位+***）设置的权重，未设置的密钥权重为1
+		// 密钥选择器配置，可选round_robin、random、least_used_today、least_recently_used、lowest_latency、highest_balance
+		KeySelector       string            `mapstructure:"key_selector"`        // 全局密钥选择器，没有模型策略的请求使用，为空时使用内置的选择规则
+		ModelKeySelectors map[string]string `mapstructure:"model_key_selectors"` // 按模型设置的密钥选择器，优先于模型策略和全局选择器
+		// 限流冷却配置
+		KeyCooldownSeconds    int `mapstructure:"key_cooldown_seconds"`     // 上游返回429或额度错误时密钥首次冷却的秒数，连续触发时翻倍，0表示使用默认值30
+		KeyCooldownMaxSeconds int `mapstructure:"key_cooldown_max_seconds"` // 密钥冷却时间上限（秒），0表示使用默认值600
+		// 熔断配置
+		KeyBreaker KeyBreakerConfig `mapstructure:"key_breaker"` // 密钥连续失败时的熔断与半开恢复
+		// 定时校验配置
+		KeyValidation KeyValidationConfig `mapstructure:"key_validation"` // 定时向上游校验密钥，禁用已失效的密钥
 	} `mapstructure:"app"`
 	Log struct {
 		MaxSizeMB int    `mapstructure:"max_size_mb"` // 日志文件最大大小（MB）
 		Level     string `mapstructure:"level"`       // 日志等级（debug, info, warn, error, fatal）
 	} `mapstructure:"log"`
+	Stats  StatsConfig  `mapstructure:"stats"`  // 统计数据配置
+	Notify NotifyConfig `mapstructure:"notify"` // 告警通知渠道
 }
 
 // ApiKey API密钥结构
@@ -103,6 +131,9 @@ type ApiKey struct {
 	Delete bool `json:"delete"` // 是否标记为删除
 	// 新增使用标记字段
 	IsUsed bool `json:"is_used"` // 是否被使用过
+	// 到期时间
+	ExpiresAt int64 `json:"expires_at"` // 到期时间戳，0表示不过期
+	Expired   bool  `json:"expired"`    // 是否已过期，过期不计为失败
 }
 
 // RequestStats 请求统计结构
@@ -158,15 +189,9 @@ func GetApiKeys() []ApiKey {
 	return keysCopy
 }
 
-// MaskKey 遮盖API密钥，只显示前4位和后4位
+// MaskKey 按脱敏策略遮盖API密钥，用于日志输出
 func MaskKey(key string) string {
-	if len(key) <= 8 {
-		return key // 密钥太短，返回原样
-	}
-
-	prefix := key[:4]
-	suffix := key[len(key)-4:]
-	return prefix + "..." + suffix
+	return MaskKeyWithPolicy(key, false)
 }
 
 // AddApiKey 添加新的API密钥
@@ -208,12 +233,12 @@ func AddApiKey(key string, balance float64) {
 		var exists bool
 		var isDeleted bool
 		err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM `+apikeysTableName+` WHERE key = ?), 
-			(SELECT is_delete FROM `+apikeysTableName+` WHERE key = ?)`, key, key).Scan(&exists, &isDeleted)
+			(SELECT is_delete FROM `+apikeysTableName+` WHERE key = ?)`, storedApiKey(key), storedApiKey(key)).Scan(&exists, &isDeleted)
 
 		if err == nil && exists && isDeleted {
 			// 密钥存在但被逻辑删除，恢复它
 			_, err := db.Exec(`UPDATE `+apikeysTableName+` SET is_delete = ?, balance = ? WHERE key = ?`,
-				false, balance, key)
+				false, balance, storedApiKey(key))
 			if err == nil {
 				log.Printf("从数据库恢复之前逻辑删除的API密钥: %s", MaskKey(key))
 
@@ -297,7 +322,7 @@ func UpdateApiKeyLastUsed(key string, timestamp int64) bool {
 			// 保存更新到数据库
 			if db != nil {
 				_, err := db.Exec(`UPDATE `+apikeysTableName+` 
-					SET last_used = ? WHERE key = ?`, timestamp, key)
+					SET last_used = ? WHERE key = ?`, timestamp, storedApiKey(key))
 				if err != nil {
 					logger.Error("更新API密钥最后使用时间到数据库失败: %v", err)
 				}
@@ -322,7 +347,7 @@ func MarkApiKeyAsUsed(key string) bool {
 			// 保存更新到数据库
 			if db != nil {
 				_, err := db.Exec(`UPDATE `+apikeysTableName+` 
-					SET is_used = ? WHERE key = ?`, true, key)
+					SET is_used = ? WHERE key = ?`, true, storedApiKey(key))
 				if err != nil {
 					logger.Error("更新API密钥使用状态到数据库失败: %v", err)
 				}
@@ -496,7 +521,7 @@ func UpdateApiKeySuccess(key string) bool {
 				_, err := db.Exec(`UPDATE `+apikeysTableName+` 
 					SET total_calls = ?, success_calls = ?, success_rate = ?, consecutive_failures = ? 
 					WHERE key = ?`,
-					apiKeys[i].TotalCalls, apiKeys[i].SuccessCalls, apiKeys[i].SuccessRate, 0, key)
+					apiKeys[i].TotalCalls, apiKeys[i].SuccessCalls, apiKeys[i].SuccessRate, 0, storedApiKey(key))
 				if err != nil {
 					logger.Error("更新API密钥成功调用统计到数据库失败: %v", err)
 				}
@@ -525,7 +550,7 @@ func UpdateApiKeyFailure(key string) bool {
 				_, err := db.Exec(`UPDATE `+apikeysTableName+` 
 					SET total_calls = ?, success_rate = ?, consecutive_failures = ? 
 					WHERE key = ?`,
-					apiKeys[i].TotalCalls, apiKeys[i].SuccessRate, apiKeys[i].ConsecutiveFailures, key)
+					apiKeys[i].TotalCalls, apiKeys[i].SuccessRate, apiKeys[i].ConsecutiveFailures, storedApiKey(key))
 				if err != nil {
 					logger.Error("更新API密钥失败调用统计到数据库失败: %v", err)
 				}
@@ -578,7 +603,7 @@ func DisableApiKey(key string) bool {
 		_, err := db.Exec(`UPDATE `+apikeysTableName+` 
 			SET disabled = ?, disabled_at = ? 
 			WHERE key = ?`,
-			true, keyDisabledAt, key)
+			true, keyDisabledAt, storedApiKey(key))
 		if err != nil {
 			logger.Error("更新API密钥禁用状态到数据库失败: %v", err)
 		} else {
@@ -589,8 +614,13 @@ func DisableApiKey(key string) bool {
 	return true
 }
 
-// EnableApiKey 启用API密钥
+// EnableApiKey 启用API密钥，因用量异常禁用的密钥需要先调用ClearKeyAnomalyProtection
 func EnableApiKey(key string) bool {
+	if IsKeyAnomalyProtected(key) {
+		logger.Warn("API密钥 %s 因用量异常被禁用，需要在管理界面手动启用", MaskKey(key))
+		return false
+	}
+
 	keysMutex.Lock()
 
 	var keyFound bool
@@ -642,7 +672,7 @@ func EnableApiKey(key string) bool {
 		_, err := db.Exec(`UPDATE `+apikeysTableName+` 
 			SET disabled = ?, disabled_at = ?, consecutive_failures = ? 
 			WHERE key = ?`,
-			false, 0, 0, key)
+			false, 0, 0, storedApiKey(key))
 		if err != nil {
 			logger.Error("更新API密钥启用状态到数据库失败: %v", err)
 		} else {
@@ -830,19 +860,21 @@ func SortApiKeysByPriority() {
 	apiKeys = sortedKeys
 }
 
-// GetActiveApiKeys 获取所有未禁用且余额充足的API密钥
+// GetActiveApiKeys 获取所有未禁用、未过期、余额充足且不在限流冷却中的API密钥，开启配额强制时不含今日已超额的密钥
 func GetActiveApiKeys() []ApiKey {
 	allKeys := GetApiKeys() // 已经过滤掉标记为删除的密钥
 
-	// 筛选出未禁用且余额充足的密钥
+	// 筛选出未禁用、未过期、余额充足且未超出每日配额的密钥
+	now := time.Now().Unix()
 	var activeKeys []ApiKey
 	for _, key := range allKeys {
-		if !key.Disabled && key.Balance >= config.App.MinBalanceThreshold {
+		if !key.Disabled && !key.IsExpiredAt(now) && key.Balance >= config.App.MinBalanceThreshold {
 			activeKeys = append(activeKeys, key)
 		}
 	}
 
-	return activeKeys
+	// 冷却中、熔断器断开的密钥和开启配额强制时今日用量已达到配额的密钥不参与选择
+	return keysWithinQuota(keysBreakerAllowed(keysNotCoolingDown(activeKeys)))
 }
 
 // GetDisabledApiKeys 获取所有禁用的API密钥
@@ -1053,7 +1085,7 @@ func GetCurrentRPD() int {
 	}
 
 	// 如果从daily.json中获取数据
-	if dailyStats, err := GetDailyStats(""); err == nil && dailyStats != nil {
+	if dailyStats, found, err := GetDailyStats(""); err == nil && found {
 		// 使用daily.json中的数据
 		return dailyStats.Requests.Total
 	}
@@ -1083,7 +1115,7 @@ func GetCurrentTPD() int {
 	}
 
 	// 如果从daily.json中获取数据
-	if dailyStats, err := GetDailyStats(""); err == nil && dailyStats != nil {
+	if dailyStats, found, err := GetDailyStats(""); err == nil && found {
 		// 使用daily.json中的数据
 		return dailyStats.Tokens.Total
 	}
@@ -1298,7 +1330,7 @@ func MarkApiKeyAsUnused(key string) bool {
 			// 保存更新到数据库
 			if db != nil {
 				_, err := db.Exec(`UPDATE `+apikeysTableName+` 
-					SET is_used = ? WHERE key = ?`, false, key)
+					SET is_used = ? WHERE key = ?`, false, storedApiKey(key))
 				if err != nil {
 					logger.Error("更新API密钥未使用状态到数据库失败: %v", err)
 				}
@@ -7,34 +7,90 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flowsilicon/internal/logger"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 var (
 	dailyData     *DailyData
 	dailyDataLock sync.RWMutex
 	dailyFilePath string // 将在初始化时设置
+	dailyReadOnly bool   // 只读模式下不写入统计文件
+	dailyDirty    bool   // 内存中有尚未写入文件的变更
+	dailyPending  int    // 上次保存后累计的请求记录数
+	lastSaveErr   error  // 最近一次保存的结果，nil表示成功或尚未保存
+	trimPauses    int    // PauseTrimming的未恢复次数，大于0时不清理超出保留期的数据
+
+	// lastRequestTime 本次运行中最近一次记录请求的时间，只保存在内存中
+	lastRequestTime time.Time
+	// statsNow 获取当前时间，测试时可替换
+	statsNow = time.Now
 )
 
+// NoRequestRecorded 本次运行尚未记录任何请求时TimeSinceLastRequest的返回值
+const NoRequestRecorded = time.Duration(math.MaxInt64)
+
+// defaultDailyStatsRetentionDays 未配置stats.retention_days时每日统计数据保留的天数
+const defaultDailyStatsRetentionDays = 30
+
+// maxEndpointsPerDay 每天最多单独统计的接口路径数，超过后新路径计入otherEndpoint
+// 客户端可以请求任意路径，避免异常路径导致统计数据无限增长
+const maxEndpointsPerDay = 100
+
+// otherEndpoint 超过maxEndpointsPerDay后的接口路径汇总项
+const otherEndpoint = "other"
+
+// maxSerializedModels 保存时每天最多写入的模型数，超过时只写入令牌数最多的模型
+// 防止异常客户端制造大量不同的模型名导致统计文件过大、序列化过慢
+const maxSerializedModels = 10000
+
+// ErrStatsNotInitialized 每日统计数据尚未初始化
+var ErrStatsNotInitialized = errors.New("每日统计数据未初始化")
+
+// ErrStatsReadOnly 统计数据处于只读模式，不允许修改统计文件
+var ErrStatsReadOnly = errors.New("每日统计数据处于只读模式")
+
 // DailyStats 每日统计数据结构
 type DailyStats struct {
-	Date     string                `json:"date"`
-	Requests DailyRequestStats     `json:"requests"`
-	Tokens   DailyTokenStats       `json:"tokens"`
-	Models   map[string]ModelStats `json:"models"`
-	Hourly   []HourlyStats         `json:"hourly"`
+	Date              string                       `json:"date"`
+	Requests          DailyRequestStats            `json:"requests"`
+	Tokens            DailyTokenStats              `json:"tokens"`
+	StreamRequests    int                          `json:"stream_requests"`              // 流式请求数
+	NonStreamRequests int                          `json:"non_stream_requests"`          // 非流式请求数
+	TTFT              TTFTStats                    `json:"ttft"`                         // 流式请求首字延迟
+	TTFB              TTFTStats                    `json:"ttfb"`                         // 流式请求首字节延迟（收到首个数据块）
+	StreamTimeouts    StreamTimeoutStats           `json:"stream_timeouts"`              // 流式请求首字节超时和空闲超时次数
+	QueueWait         map[string]QueueWaitStats    `json:"queue_wait,omitempty"`         // 按优先级统计的排队等待，开启并发限制时记录
+	Fallbacks         map[string]int               `json:"fallbacks,omitempty"`          // 模型回退次数，按原请求模型统计
+	RejectedReasons   map[string]int               `json:"rejected_reasons,omitempty"`   // 本地拒绝的请求数，按拒绝原因统计
+	Endpoints         map[string]DailyRequestStats `json:"endpoints,omitempty"`          // 按上游接口路径统计的请求数
+	MetaRequests      int                          `json:"meta_requests,omitempty"`      // 不计入流量的元请求数（模型列表、健康检查等）
+	MaxRequestTokens  int                          `json:"max_request_tokens,omitempty"` // 单个请求的最大令牌数，旧版本文件中为0
+	ModelsTruncated   int                          `json:"models_truncated,omitempty"`   // 保存时因模型数超过上限而省略的模型数，为0表示未省略
+	HourlyRolledUp    bool                         `json:"hourly_rolled_up,omitempty"`   // 超过stats.hourly_retention_days后已清除小时明细，只保留每日汇总
+	Models            map[string]ModelStats        `json:"models"`
+	Hourly            []HourlyStats                `json:"hourly"`
+	// Requests 沿用旧含义（按上游尝试记录），以下两项区分客户端视角和上游尝试
+	Client   ClientRequestStats `json:"client"`   // 客户端请求结果，每个请求只计一次
+	Attempts AttemptStats       `json:"attempts"` // 上游尝试统计，包含重试
 }
 
 // DailyRequestStats 每日请求统计
 type DailyRequestStats struct {
-	Total   int `json:"total"`
-	Success int `json:"success"`
-	Failed  int `json:"failed"`
+	Total    int `json:"total"`
+	Success  int `json:"success"`
+	Failed   int `json:"failed"`
+	Rejected int `json:"rejected,omitempty"` // 未发送到上游即被本地拒绝的请求，计入Total但不计入Failed
 }
 
 // DailyTokenStats 每日令牌统计
@@ -42,25 +98,69 @@ type DailyTokenStats struct {
 	Total      int `json:"total"`
 	Prompt     int `json:"prompt"`
 	Completion int `json:"completion"`
+	// 按请求结果区分的令牌数，流式请求中途失败时可能已消耗令牌
+	// 新记录的Total等于两者之和，旧版本文件中的数据没有这两项
+	SuccessTokens int     `json:"success_tokens,omitempty"`
+	FailedTokens  int     `json:"failed_tokens,omitempty"`
+	Cost          float64 `json:"cost,omitempty"` // 按stats.pricing单价表估算的费用，未配置单价时为0
 }
 
 // ModelStats 模型使用统计
 type ModelStats struct {
-	Requests int `json:"requests"`
-	Tokens   int `json:"tokens"`
+	Requests          int               `json:"requests"`
+	Tokens            int               `json:"tokens"`
+	Success           int               `json:"success"`             // 成功请求数
+	Failed            int               `json:"failed"`              // 失败请求数
+	StreamRequests    int               `json:"stream_requests"`     // 流式请求数
+	NonStreamRequests int               `json:"non_stream_requests"` // 非流式请求数
+	TTFT              TTFTStats         `json:"ttft"`                // 流式请求首字延迟
+	TTFB              TTFTStats         `json:"ttfb"`                // 流式请求首字节延迟
+	Latency           *LatencyHistogram `json:"latency,omitempty"`   // 请求耗时直方图，用于估算百分位延迟
+	Cost              float64           `json:"cost,omitempty"`      // 按单价表估算的费用
+}
+
+// TTFTStats 流式请求首字延迟（time-to-first-token）统计
+type TTFTStats struct {
+	TotalMs int64   `json:"total_ms"` // 累计首字延迟（毫秒）
+	Count   int     `json:"count"`    // 采样次数
+	AvgMs   float64 `json:"avg_ms"`   // 平均首字延迟（毫秒）
+}
+
+// add 累加一次首字延迟采样
+func (t *TTFTStats) add(firstTokenMs int64) {
+	t.TotalMs += firstTokenMs
+	t.Count++
+	t.AvgMs = float64(t.TotalMs) / float64(t.Count)
 }
 
 // HourlyStats 每小时统计
 type HourlyStats struct {
-	Hour     int `json:"hour"`
+	Hour             int `json:"hour"`
+	Requests         int `json:"requests"`
+	Tokens           int `json:"tokens"`            // 提示词与补全令牌之和
+	PromptTokens     int `json:"prompt_tokens"`     // 提示词令牌数
+	CompletionTokens int `json:"completion_tokens"` // 补全令牌数
+	// 按模型的小时统计，开启 stats.hourly_by_model 后记录，只包含有请求的模型
+	Models map[string]HourlyModelStats `json:"models,omitempty"`
+}
+
+// HourlyModelStats 单个模型在某小时内的统计
+type HourlyModelStats struct {
 	Requests int `json:"requests"`
 	Tokens   int `json:"tokens"`
 }
 
+// isZero 该小时是否没有任何统计数据
+func (h HourlyStats) isZero() bool {
+	return h.Requests == 0 && h.Tokens == 0 && h.PromptTokens == 0 && h.CompletionTokens == 0 && len(h.Models) == 0
+}
+
 // KeyUsage 密钥使用统计
 type KeyUsage struct {
-	Requests int `json:"requests"`
-	Tokens   int `json:"tokens"`
+	Requests int     `json:"requests"`
+	Tokens   int     `json:"tokens"`
+	Cost     float64 `json:"cost,omitempty"`    // 按单价表估算的费用
+	Balance  float64 `json:"balance,omitempty"` // 查询时填入的密钥当前余额，不保存到统计文件
 }
 
 // DailyData 每日数据文件结构
@@ -68,8 +168,29 @@ type DailyData struct {
 	Version     string                         `json:"version"`
 	Description string                         `json:"description"`
 	LastUpdated string                         `json:"last_updated"`
-	DailyStats  []DailyStats                   `json:"daily_stats"`
-	KeysUsage   map[string]map[string]KeyUsage `json:"keys_usage"`
+	DailyStats  []DailyStats                   `json:"daily_stats"` // 当前环境的每日统计
+	KeysUsage   map[string]map[string]KeyUsage `json:"keys_usage"`  // 当前环境的密钥使用统计
+	// 当前环境的虚拟密钥使用统计，按虚拟密钥标识和日期组织
+	VirtualKeysUsage map[string]map[string]KeyUsage `json:"virtual_keys_usage,omitempty"`
+	// 其他环境的统计数据，仅在保存时写回文件
+	Environments map[string]*EnvironmentStats `json:"-"`
+}
+
+// DailyRequestRecord 单次请求的统计记录
+type DailyRequestRecord struct {
+	ApiKey           string
+	Model            string
+	RequestCount     int
+	PromptTokens     int
+	CompletionTokens int
+	IsSuccess        bool
+	IsStream         bool   // 是否为流式请求
+	FirstTokenMs     int64  // 流式请求的首字延迟（毫秒），0表示未测量
+	FirstByteMs      int64  // 流式请求的首字节延迟（毫秒），0表示未测量
+	OriginalModel    string // 发生模型回退时客户端原本请求的模型，为空或与Model相同表示未回退
+	LatencyMs        int64  // 请求总耗时（毫秒），0表示未测量
+	Endpoint         string // 上游接口路径，如/v1/chat/completions，为空时不按接口统计
+	VirtualKey       string // 请求使用的虚拟密钥标识，为空表示未使用虚拟密钥
 }
 
 // SetDailyFilePath 设置每日统计数据文件路径
@@ -120,42 +241,223 @@ func InitDailyStats() error {
 	// 确保今天的数据存在
 	ensureTodayDataExistsLocked()
 
+	// 清除超过保留期的小时明细，今天的数据已存在时ensureTodayDataExistsLocked不会执行
+	if rollupHourlyLocked() > 0 {
+		if err := saveDailyDataLocked(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
+	}
+
+	// 启动定期保存
+	startDailyFlusher()
+
+	// 启动每晚一致性检查
+	startConsistencyChecker()
+
+	return nil
+}
+
+// SetDailyStatsReadOnly 设置统计数据只读模式，只读模式下统计数据不会写入文件
+func SetDailyStatsReadOnly(readOnly bool) {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+	dailyReadOnly = readOnly
+	logger.Info("每日统计数据只读模式: %v", readOnly)
+}
+
+// IsDailyStatsReadOnly 统计数据是否处于只读模式
+func IsDailyStatsReadOnly() bool {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+	return dailyReadOnly
+}
+
+// GetStatsFileInfo 获取统计文件大小、保留的天数和出现过的密钥数，用于容量监控
+// 只有没有对应文件时大小才返回0（未设置统计文件或文件尚未创建），只读副本返回所读取文件的大小
+func GetStatsFileInfo() (sizeBytes int64, dayCount int, keyCount int, err error) {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return 0, 0, 0, ErrStatsNotInitialized
+	}
+
+	// KeysUsage按密钥标识组织，每个密钥下为按日期的使用统计
+	dayCount = len(dailyData.DailyStats)
+	keyCount = len(dailyData.KeysUsage)
+
+	if dailyFilePath == "" {
+		return 0, dayCount, keyCount, nil
+	}
+	info, statErr := os.Stat(dailyFilePath)
+	if statErr != nil {
+		if os.IsNotExist(statErr) {
+			return 0, dayCount, keyCount, nil
+		}
+		return 0, dayCount, keyCount, statErr
+	}
+	return info.Size(), dayCount, keyCount, nil
+}
+
+// GetRetentionUsage 获取已保留的天数、最多保留的天数以及保留数据的最早和最晚日期
+// 没有任何数据时日期返回空字符串
+func GetRetentionUsage() (usedDays int, maxDays int, oldestDate, newestDate string, err error) {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return 0, statsRetentionDays(), "", "", ErrStatsNotInitialized
+	}
+
+	for _, stats := range dailyData.DailyStats {
+		// 日期格式固定，可直接按字符串比较
+		if oldestDate == "" || stats.Date < oldestDate {
+			oldestDate = stats.Date
+		}
+		if stats.Date > newestDate {
+			newestDate = stats.Date
+		}
+	}
+	return len(dailyData.DailyStats), statsRetentionDays(), oldestDate, newestDate, nil
+}
+
+// ReloadDailyStats 从文件重新加载每日统计数据，加载失败时保留内存中的数据
+func ReloadDailyStats() error {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if err := loadDailyDataLocked(); err != nil {
+		return err
+	}
+
+	ensureTodayDataExistsLocked()
 	return nil
 }
 
 // loadDailyDataLocked 从文件加载每日统计数据（已加锁）
+// 统计文件不存在或解析失败时从备份恢复，备份同样不可用时返回读取统计文件的错误
 func loadDailyDataLocked() error {
+	loadedData, err := readDailyDataFile(dailyFilePath)
+	if err != nil {
+		backupData, backupErr := readDailyDataFile(dailyBackupPath(dailyFilePath))
+		if backupErr != nil {
+			return err
+		}
+		if os.IsNotExist(err) {
+			logger.Warn("每日统计数据文件不存在，已从备份 %s 恢复", dailyBackupPath(dailyFilePath))
+		} else {
+			logger.Warn("解析每日统计数据文件失败，已从备份 %s 恢复: %v", dailyBackupPath(dailyFilePath), err)
+			// 保留损坏的文件供排查，避免下次保存时覆盖可用的备份
+			if !dailyReadOnly {
+				if renameErr := os.Rename(dailyFilePath, dailyFilePath+".corrupt"); renameErr != nil {
+					logger.Warn("保留损坏的统计文件失败: %v", renameErr)
+				}
+			}
+		}
+		loadedData = backupData
+	}
+
+	dailyData = loadedData
+	return nil
+}
+
+// readDailyDataFile 持有读写锁读取并解析统计文件，取出当前环境的数据
+func readDailyDataFile(path string) (*DailyData, error) {
 	// 检查文件是否存在
-	if _, err := os.Stat(dailyFilePath); os.IsNotExist(err) {
-		return err
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, err
 	}
 
-	// 读取文件内容
-	data, err := os.ReadFile(dailyFilePath)
-	if err != nil {
-		return err
+	var data []byte
+	if err := withDailyIOLock(dailyFilePath, false, func() error {
+		var readErr error
+		data, readErr = os.ReadFile(path)
+		return readErr
+	}); err != nil {
+		return nil, err
 	}
+	return decodeDailyData(data, statsEnvironment)
+}
 
-	// 解析JSON
-	var loadedData DailyData
-	if err := json.Unmarshal(data, &loadedData); err != nil {
-		return err
+// normalizeDailyStatsList 修复旧版本或手工编辑导致的不完整数据
+func normalizeDailyStatsList(statsList []DailyStats) {
+	for i := range statsList {
+		if statsList[i].Models == nil {
+			statsList[i].Models = make(map[string]ModelStats)
+		}
+		// 旧数据没有按模型区分成功和失败，全部计为成功
+		for name, ms := range statsList[i].Models {
+			if ms.Success == 0 && ms.Failed == 0 && ms.Requests > 0 {
+				ms.Success = ms.Requests
+				statsList[i].Models[name] = ms
+			}
+		}
+		// 已清除小时明细的日期保持为空，不补齐24小时
+		if statsList[i].HourlyRolledUp {
+			statsList[i].Hourly = []HourlyStats{}
+			continue
+		}
+		statsList[i].Hourly = normalizeHourly(statsList[i].Hourly)
 	}
+}
 
-	dailyData = &loadedData
-	return nil
+// newDailyStats 创建指定日期的空统计数据
+func newDailyStats(date string) DailyStats {
+	return DailyStats{
+		Date:   date,
+		Models: make(map[string]ModelStats),
+		Hourly: newHourlyStats(),
+	}
 }
 
-// saveDailyData 保存每日统计数据到文件
-func saveDailyData() error {
-	dailyDataLock.RLock()
-	defer dailyDataLock.RUnlock()
-	return saveDailyDataLocked()
+// newHourlyStats 创建24小时的统计数据
+func newHourlyStats() []HourlyStats {
+	hourlyStats := make([]HourlyStats, 24)
+	for i := 0; i < 24; i++ {
+		hourlyStats[i] = HourlyStats{Hour: i}
+	}
+	return hourlyStats
+}
+
+// normalizeHourly 将小时统计规整为按小时排列的24条记录
+// 按Hour字段而不是位置归位，重复的小时会合并，超出范围的小时会被丢弃
+// 旧版本没有区分提示词和补全令牌，其令牌数全部计入提示词令牌
+func normalizeHourly(hourly []HourlyStats) []HourlyStats {
+	normalized := newHourlyStats()
+	for _, h := range hourly {
+		if h.Hour < 0 || h.Hour >= 24 {
+			logger.Warn("忽略无效的小时统计数据: hour=%d", h.Hour)
+			continue
+		}
+		if h.PromptTokens == 0 && h.CompletionTokens == 0 {
+			h.PromptTokens = h.Tokens
+		}
+		normalized[h.Hour].Requests += h.Requests
+		normalized[h.Hour].Tokens += h.Tokens
+		normalized[h.Hour].PromptTokens += h.PromptTokens
+		normalized[h.Hour].CompletionTokens += h.CompletionTokens
+		for name, ms := range h.Models {
+			if normalized[h.Hour].Models == nil {
+				normalized[h.Hour].Models = make(map[string]HourlyModelStats, len(h.Models))
+			}
+			merged := normalized[h.Hour].Models[name]
+			merged.Requests += ms.Requests
+			merged.Tokens += ms.Tokens
+			normalized[h.Hour].Models[name] = merged
+		}
+	}
+	return normalized
 }
 
 // saveDailyDataLocked 保存每日统计数据到文件（已加锁）
 func saveDailyDataLocked() error {
-	if dailyData == nil {
+	return writeDailyDataLocked(dailyIOLockTimeout)
+}
+
+// writeDailyDataLocked 序列化并写入统计文件（已加锁），最多等待lockWait获取读写锁
+// lockWait为0时只尝试一次，读写锁被其他实例持有时返回包含errFileLocked的错误
+func writeDailyDataLocked(lockWait time.Duration) error {
+	if dailyData == nil || dailyReadOnly {
 		return nil
 	}
 
@@ -163,51 +465,184 @@ func saveDailyDataLocked() error {
 	dailyData.LastUpdated = time.Now().Format(time.RFC3339)
 
 	// 序列化为JSON
-	data, err := json.MarshalIndent(dailyData, "", "  ")
+	data, err := encodeDailyDataLocked()
 	if err != nil {
+		lastSaveErr = err
 		return err
 	}
 
-	// 写入文件
-	return os.WriteFile(dailyFilePath, data, 0644)
+	// 持有读写锁写入文件，避免与其他实例的读写交错
+	if err := withDailyIOLockWait(dailyFilePath, true, lockWait, func() error {
+		return writeDailyFile(dailyFilePath, data, 0644)
+	}); err != nil {
+		lastSaveErr = err
+		return err
+	}
+	dailyDirty = false
+	dailyPending = 0
+	lastSaveErr = nil
+	dailyLastSave = time.Now()
+	return nil
 }
 
-// createDefaultDailyData 创建默认的每日统计数据结构
-func createDefaultDailyData() *DailyData {
-	today := time.Now().Format("2006-01-02")
+// compactDailyStatsList 生成省略全零小时统计的浅拷贝，加载时由normalizeHourly补全24小时
+func compactDailyStatsList(statsList []DailyStats) []DailyStats {
+	compacted := make([]DailyStats, len(statsList))
+	for i, stats := range statsList {
+		hourly := make([]HourlyStats, 0)
+		for _, h := range stats.Hourly {
+			if !h.isZero() {
+				hourly = append(hourly, h)
+			}
+		}
+		stats.Hourly = hourly
+		compacted[i] = stats
+	}
+	return compacted
+}
 
-	// 创建24小时的统计数据
-	hourlyStats := make([]HourlyStats, 24)
-	for i := 0; i < 24; i++ {
-		hourlyStats[i] = HourlyStats{
-			Hour:     i,
-			Requests: 0,
-			Tokens:   0,
+// limitSerializedModels 保存前检查每天的模型数，超过maxSerializedModels时只保留令牌数最多的模型，
+// 并在写入的数据中记录省略的模型数；内存中的数据不受影响，没有超过上限时原样返回
+func limitSerializedModels(statsList []DailyStats) []DailyStats {
+	var limited []DailyStats
+	for i, stats := range statsList {
+		if len(stats.Models) <= maxSerializedModels {
+			continue
+		}
+		if limited == nil {
+			limited = make([]DailyStats, len(statsList))
+			copy(limited, statsList)
 		}
+
+		names := make([]string, 0, len(stats.Models))
+		for name := range stats.Models {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(a, b int) bool {
+			ta, tb := stats.Models[names[a]].Tokens, stats.Models[names[b]].Tokens
+			if ta != tb {
+				return ta > tb
+			}
+			return names[a] < names[b]
+		})
+
+		models := make(map[string]ModelStats, maxSerializedModels)
+		for _, name := range names[:maxSerializedModels] {
+			models[name] = stats.Models[name]
+		}
+		dropped := len(stats.Models) - maxSerializedModels
+		logger.Error("%s 的模型数 %d 超过上限 %d，保存时只写入令牌数最多的 %d 个模型，省略 %d 个",
+			stats.Date, len(stats.Models), maxSerializedModels, maxSerializedModels, dropped)
+
+		limited[i].Models = models
+		limited[i].ModelsTruncated = dropped
 	}
+	if limited == nil {
+		return statsList
+	}
+	return limited
+}
+
+// dailyBackupPath 统计文件的备份路径，保存时原文件保留为备份
+func dailyBackupPath(path string) string {
+	return path + ".bak"
+}
 
+// writeFileAtomic 先写入同目录下的临时文件再重命名，避免写入中断导致文件损坏
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpName, err := writeTempFile(path, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// writeDailyFile 保存统计文件时使用的写入函数，测试时可替换
+var writeDailyFile = writeFileWithBackup
+
+// writeFileWithBackup 与writeFileAtomic相同，但替换前将原文件保留为备份（path.bak）
+// 备份通过硬链接或复制生成，原文件在替换前一直存在，替换只需一次重命名
+func writeFileWithBackup(path string, data []byte, perm os.FileMode) error {
+	tmpName, err := writeTempFile(path, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := backupFile(path, dailyBackupPath(path), perm); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// backupFile 将path的当前内容保存为backup，path不存在时不处理
+// 优先将原文件硬链接到临时文件再重命名为备份，文件系统不支持硬链接时复制内容
+func backupFile(path, backup string, perm os.FileMode) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	linkName := backup + ".link"
+	os.Remove(linkName)
+	if err := os.Link(path, linkName); err == nil {
+		if err := os.Rename(linkName, backup); err != nil {
+			os.Remove(linkName)
+			return err
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(backup, data, perm)
+}
+
+// writeTempFile 将数据写入path同目录下的临时文件并同步到磁盘，返回临时文件路径
+func writeTempFile(path string, data []byte, perm os.FileMode) (string, error) {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmpName := tmpFile.Name()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return "", err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return "", err
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+	return tmpName, nil
+}
+
+// createDefaultDailyData 创建默认的每日统计数据结构
+func createDefaultDailyData() *DailyData {
 	return &DailyData{
 		Version:     "1.0",
 		Description: "每日API请求统计数据",
 		LastUpdated: time.Now().Format(time.RFC3339),
-		DailyStats: []DailyStats{
-			{
-				Date: today,
-				Requests: DailyRequestStats{
-					Total:   0,
-					Success: 0,
-					Failed:  0,
-				},
-				Tokens: DailyTokenStats{
-					Total:      0,
-					Prompt:     0,
-					Completion: 0,
-				},
-				Models: make(map[string]ModelStats),
-				Hourly: hourlyStats,
-			},
-		},
-		KeysUsage: make(map[string]map[string]KeyUsage),
+		DailyStats:  []DailyStats{newDailyStats(time.Now().Format("2006-01-02"))},
+		KeysUsage:   make(map[string]map[string]KeyUsage),
 	}
 }
 
@@ -227,96 +662,304 @@ func ensureTodayDataExistsLocked() {
 		}
 	}
 
-	// 创建24小时的统计数据
-	hourlyStats := make([]HourlyStats, 24)
-	for i := 0; i < 24; i++ {
-		hourlyStats[i] = HourlyStats{
-			Hour:     i,
-			Requests: 0,
-			Tokens:   0,
+	// 添加今天的数据
+	dailyData.DailyStats = append(dailyData.DailyStats, newDailyStats(today))
+
+	trimDailyRetentionLocked()
+}
+
+// trimDailyRetentionLocked 只保留最近stats.retention_days天的数据（已加锁）
+// 开启stats.monthly_archive时被清理的日期先汇总到月度归档，否则直接删除
+// 同时清理保留期之前的密钥使用记录，没有剩余记录的密钥整体删除
+func trimDailyRetentionLocked() {
+	// 新月份开始后先归档已结束的月份
+	archiveCompletedMonthsLocked()
+
+	if trimPauses > 0 {
+		return
+	}
+	rollupHourlyLocked()
+
+	// 如果数据超过保留天数，删除最旧的数据，删除前归档以免月中被清理的日期丢失
+	if retentionDays := statsRetentionDays(); len(dailyData.DailyStats) > retentionDays {
+		trimmed := len(dailyData.DailyStats) - retentionDays
+		archiveDailyStatsLocked(dailyData.DailyStats[:trimmed])
+		dailyData.DailyStats = dailyData.DailyStats[trimmed:]
+	}
+
+	// 以保留的最早日期作为密钥使用记录的截止日期
+	cutoff := ""
+	for _, stats := range dailyData.DailyStats {
+		if cutoff == "" || stats.Date < cutoff {
+			cutoff = stats.Date
 		}
 	}
+	if cutoff != "" {
+		pruneKeysUsageLocked(dailyData.KeysUsage, cutoff)
+		pruneKeysUsageLocked(dailyData.VirtualKeysUsage, cutoff)
+	}
+}
 
-	// 添加今天的数据
-	dailyData.DailyStats = append(dailyData.DailyStats, DailyStats{
-		Date: today,
-		Requests: DailyRequestStats{
-			Total:   0,
-			Success: 0,
-			Failed:  0,
-		},
-		Tokens: DailyTokenStats{
-			Total:      0,
-			Prompt:     0,
-			Completion: 0,
-		},
-		Models: make(map[string]ModelStats),
-		Hourly: hourlyStats,
-	})
+// rollupHourlyLocked 清除早于stats.hourly_retention_days天的小时明细，保留每日汇总（已加锁）
+// 未配置时不清除，返回本次清除的天数
+func rollupHourlyLocked() int {
+	days := getStatsConfig().HourlyRetentionDays
+	if days <= 0 || dailyData == nil {
+		return 0
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
+	rolledUp := 0
+	for i := range dailyData.DailyStats {
+		stats := &dailyData.DailyStats[i]
+		if stats.HourlyRolledUp || stats.Date >= cutoff {
+			continue
+		}
+		stats.Hourly = []HourlyStats{}
+		stats.HourlyRolledUp = true
+		rolledUp++
+	}
+	if rolledUp > 0 {
+		dailyDirty = true
+		logger.Info("已清除 %d 天超过 %d 天保留期的小时统计明细", rolledUp, days)
+	}
+	return rolledUp
+}
+
+// PauseTrimming 暂停清理超出保留期的数据，用于导出等需要读取完整窗口的任务
+// 可多次调用，每次调用都需要对应一次ResumeTrimming
+func PauseTrimming() {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	trimPauses++
+	if trimPauses == 1 {
+		logger.Info("已暂停清理超出保留期的每日统计数据")
+	}
+}
+
+// ResumeTrimming 恢复清理超出保留期的数据，所有暂停都恢复后立即按保留期清理暂停期间累积的数据
+func ResumeTrimming() {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
 
-	// 如果数据超过30天，删除最旧的数据
-	if len(dailyData.DailyStats) > 30 {
-		dailyData.DailyStats = dailyData.DailyStats[len(dailyData.DailyStats)-30:]
+	if trimPauses == 0 {
+		return
+	}
+	trimPauses--
+	if trimPauses > 0 || dailyData == nil {
+		return
+	}
+
+	before := len(dailyData.DailyStats)
+	trimDailyRetentionLocked()
+	if trimmed := before - len(dailyData.DailyStats); trimmed > 0 {
+		dailyDirty = true
+		scheduleDailySaveLocked()
+		logger.Info("已恢复清理每日统计数据，清理了暂停期间超出保留期的 %d 天", trimmed)
+	} else {
+		logger.Info("已恢复清理超出保留期的每日统计数据")
+	}
+}
+
+// pruneKeysUsageLocked 删除cutoff之前的密钥使用记录，内层map为空的密钥整体删除（已加锁）
+// 返回被删除的密钥数
+func pruneKeysUsageLocked(keysUsage map[string]map[string]KeyUsage, cutoff string) int {
+	removed := 0
+	for keyID, usageByDate := range keysUsage {
+		for date := range usageByDate {
+			if date < cutoff {
+				delete(usageByDate, date)
+			}
+		}
+		if len(usageByDate) == 0 {
+			delete(keysUsage, keyID)
+			removed++
+		}
 	}
+	return removed
 }
 
-// AddDailyRequestStat 添加每日请求统计
-func AddDailyRequestStat(apiKey, model string, requestCount, promptTokens, completionTokens int, isSuccess bool) {
+// EnsureTodayData 确保今天的统计数据存在，不存在时创建并保存，可重复调用
+func EnsureTodayData() error {
 	dailyDataLock.Lock()
 	defer dailyDataLock.Unlock()
 
+	if dailyData != nil {
+		today := time.Now().Format("2006-01-02")
+		for i := range dailyData.DailyStats {
+			if dailyData.DailyStats[i].Date == today {
+				// 已存在时只修复不完整的小时统计
+				if len(dailyData.DailyStats[i].Hourly) != 24 {
+					dailyData.DailyStats[i].Hourly = normalizeHourly(dailyData.DailyStats[i].Hourly)
+				}
+				return nil
+			}
+		}
+	}
+
+	ensureTodayDataExistsLocked()
+	dailyDirty = true
+	return saveDailyDataLocked()
+}
+
+// todayStatsLocked 获取今天的统计数据，不存在时创建（已加锁）
+// 旧版本或损坏的文件中Models/Hourly可能为空或不完整，返回前先修复
+func todayStatsLocked() *DailyStats {
 	// 确保dailyData已初始化
 	if dailyData == nil {
 		dailyData = createDefaultDailyData()
 	}
 
-	// 确保今天的数据存在
 	today := time.Now().Format("2006-01-02")
 	currentHour := time.Now().Hour()
 
 	var todayStats *DailyStats
-	var todayIndex int
-
-	// 查找今天的数据
-	for i, stats := range dailyData.DailyStats {
-		if stats.Date == today {
+	for i := range dailyData.DailyStats {
+		if dailyData.DailyStats[i].Date == today {
 			todayStats = &dailyData.DailyStats[i]
-			todayIndex = i
 			break
 		}
 	}
 
-	// 如果今天的数据不存在，创建新的
+	// 如果今天的数据不存在，创建新的，并清理超出保留期的数据
 	if todayStats == nil {
-		// 创建24小时的统计数据
-		hourlyStats := make([]HourlyStats, 24)
-		for i := 0; i < 24; i++ {
-			hourlyStats[i] = HourlyStats{
-				Hour:     i,
-				Requests: 0,
-				Tokens:   0,
-			}
-		}
+		dailyData.DailyStats = append(dailyData.DailyStats, newDailyStats(today))
+		trimDailyRetentionLocked()
+		todayStats = &dailyData.DailyStats[len(dailyData.DailyStats)-1]
+	}
 
-		dailyData.DailyStats = append(dailyData.DailyStats, DailyStats{
-			Date: today,
-			Requests: DailyRequestStats{
-				Total:   0,
-				Success: 0,
-				Failed:  0,
-			},
-			Tokens: DailyTokenStats{
-				Total:      0,
-				Prompt:     0,
-				Completion: 0,
-			},
-			Models: make(map[string]ModelStats),
-			Hourly: hourlyStats,
-		})
+	if todayStats.Models == nil {
+		todayStats.Models = make(map[string]ModelStats)
+	}
+	if len(todayStats.Hourly) != 24 || todayStats.Hourly[currentHour].Hour != currentHour {
+		todayStats.Hourly = normalizeHourly(todayStats.Hourly)
+	}
+	return todayStats
+}
+
+// AddDailyRequestStat 添加每日请求统计（按非流式请求计）
+// originalModel 为发生模型回退时客户端原本请求的模型，未回退时传空字符串
+// endpoint 为上游接口路径，如/v1/embeddings，传空字符串时不按接口统计
+func AddDailyRequestStat(apiKey, model, originalModel, endpoint string, requestCount, promptTokens, completionTokens int, isSuccess bool) {
+	AddDailyRequestRecord(DailyRequestRecord{
+		ApiKey:           apiKey,
+		Model:            model,
+		OriginalModel:    originalModel,
+		Endpoint:         endpoint,
+		RequestCount:     requestCount,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		IsSuccess:        isSuccess,
+	})
+}
+
+// AddDailyRequestStatF 添加每日请求统计，令牌数为小数，按stats.token_rounding取整后累加
+// 提示词和补全令牌分别取整，总令牌数为取整后的两者之和
+func AddDailyRequestStatF(apiKey, model, originalModel, endpoint string, requestCount int, promptTokens, completionTokens float64, isSuccess bool) {
+	AddDailyRequestStat(apiKey, model, originalModel, endpoint, requestCount, roundTokens(promptTokens), roundTokens(completionTokens), isSuccess)
+}
 
-		todayIndex = len(dailyData.DailyStats) - 1
-		todayStats = &dailyData.DailyStats[todayIndex]
+// AddMetaRequestStat 记录不计入流量的成功元请求（模型列表、健康检查等）
+// 只累加MetaRequests，不影响请求数、令牌数、模型和密钥统计
+func AddMetaRequestStat(requestCount int) {
+	if requestCount <= 0 {
+		return
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	todayStats := todayStatsLocked()
+	todayStats.MetaRequests += requestCount
+	dailyDirty = true
+	scheduleDailySaveLocked()
+}
+
+// AddRejectedRequest 记录一个未发送到上游即被本地拒绝的请求（如模型已禁用、代理已暂停）
+// 只增加请求总数和拒绝数，不计入失败请求和令牌数，reason为空时记为unknown
+func AddRejectedRequest(reason string) {
+	if reason == "" {
+		reason = "unknown"
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	todayStats := todayStatsLocked()
+	todayStats.Requests.Total++
+	todayStats.Requests.Rejected++
+	if todayStats.RejectedReasons == nil {
+		todayStats.RejectedReasons = make(map[string]int)
+	}
+	todayStats.RejectedReasons[reason]++
+	dailyDirty = true
+	scheduleDailySaveLocked()
+}
+
+// GetRejectedReasons 获取指定日期本地拒绝的请求数，按拒绝原因统计，date为空时使用今天
+func GetRejectedReasons(date string) (map[string]int, error) {
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	result := make(map[string]int)
+	if dailyData == nil {
+		return result, ErrStatsNotInitialized
+	}
+
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date != date {
+			continue
+		}
+		for reason, count := range stats.RejectedReasons {
+			result[reason] = count
+		}
+		break
 	}
+	return result, nil
+}
+
+// AddDailyRequestRecord 按请求记录添加每日请求统计
+// 开启异步记录时放入队列由后台协程写入，不在请求处理中等待统计锁
+func AddDailyRequestRecord(record DailyRequestRecord) {
+	emitStatsD(record)
+	recordKeyLatency(record)
+	if getStatsConfig().AsyncRecording {
+		enqueueDailyRequestRecord(record)
+		return
+	}
+	applyDailyRequestRecord(record)
+}
+
+// applyDailyRequestRecord 将请求记录写入每日统计
+func applyDailyRequestRecord(record DailyRequestRecord) {
+	apiKey := record.ApiKey
+	model := normalizeModelName(ResolveModelAlias(record.Model))
+	requestCount := record.RequestCount
+	promptTokens := record.PromptTokens
+	completionTokens := record.CompletionTokens
+	isSuccess := record.IsSuccess
+
+	// 配额回调在释放统计锁之后执行
+	var quotaNotify func()
+	defer func() {
+		if quotaNotify != nil {
+			quotaNotify()
+		}
+	}()
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	lastRequestTime = statsNow()
+
+	today := time.Now().Format("2006-01-02")
+	currentHour := time.Now().Hour()
+	todayStats := todayStatsLocked()
 
 	// 更新请求统计
 	todayStats.Requests.Total += requestCount
@@ -331,6 +974,32 @@ func AddDailyRequestStat(apiKey, model string, requestCount, promptTokens, compl
 	todayStats.Tokens.Total += totalTokens
 	todayStats.Tokens.Prompt += promptTokens
 	todayStats.Tokens.Completion += completionTokens
+	if isSuccess {
+		todayStats.Tokens.SuccessTokens += totalTokens
+	} else {
+		todayStats.Tokens.FailedTokens += totalTokens
+	}
+	// 一条记录包含多个请求时按平均值计
+	perRequestTokens := totalTokens
+	if requestCount > 1 {
+		perRequestTokens = totalTokens / requestCount
+	}
+	if perRequestTokens > todayStats.MaxRequestTokens {
+		todayStats.MaxRequestTokens = perRequestTokens
+	}
+
+	// 更新流式/非流式统计
+	if record.IsStream {
+		todayStats.StreamRequests += requestCount
+		if record.FirstTokenMs > 0 {
+			todayStats.TTFT.add(record.FirstTokenMs)
+		}
+		if record.FirstByteMs > 0 {
+			todayStats.TTFB.add(record.FirstByteMs)
+		}
+	} else {
+		todayStats.NonStreamRequests += requestCount
+	}
 
 	// 更新模型统计
 	if model != "" {
@@ -344,98 +1013,324 @@ func AddDailyRequestStat(apiKey, model string, requestCount, promptTokens, compl
 		modelStats := todayStats.Models[model]
 		modelStats.Requests += requestCount
 		modelStats.Tokens += totalTokens
+		if isSuccess {
+			modelStats.Success += requestCount
+		} else {
+			modelStats.Failed += requestCount
+		}
+		if record.IsStream {
+			modelStats.StreamRequests += requestCount
+			if record.FirstTokenMs > 0 {
+				modelStats.TTFT.add(record.FirstTokenMs)
+			}
+			if record.FirstByteMs > 0 {
+				modelStats.TTFB.add(record.FirstByteMs)
+			}
+		} else {
+			modelStats.NonStreamRequests += requestCount
+		}
+		if record.LatencyMs > 0 {
+			if modelStats.Latency == nil {
+				modelStats.Latency = &LatencyHistogram{}
+			}
+			modelStats.Latency.add(record.LatencyMs)
+		}
 		todayStats.Models[model] = modelStats
 	}
 
+	// 更新接口统计
+	if record.Endpoint != "" {
+		if todayStats.Endpoints == nil {
+			todayStats.Endpoints = make(map[string]DailyRequestStats)
+		}
+		endpoint := record.Endpoint
+		if _, exists := todayStats.Endpoints[endpoint]; !exists && len(todayStats.Endpoints) >= maxEndpointsPerDay {
+			endpoint = otherEndpoint
+		}
+		endpointStats := todayStats.Endpoints[endpoint]
+		endpointStats.Total += requestCount
+		if isSuccess {
+			endpointStats.Success += requestCount
+		} else {
+			endpointStats.Failed += requestCount
+		}
+		todayStats.Endpoints[endpoint] = endpointStats
+	}
+
+	// 更新模型回退统计
+	if originalModel := normalizeModelName(ResolveModelAlias(record.OriginalModel)); originalModel != "" && originalModel != model {
+		if todayStats.Fallbacks == nil {
+			todayStats.Fallbacks = make(map[string]int)
+		}
+		todayStats.Fallbacks[originalModel] += requestCount
+	}
+
 	// 更新小时统计
 	todayStats.Hourly[currentHour].Requests += requestCount
 	todayStats.Hourly[currentHour].Tokens += totalTokens
+	todayStats.Hourly[currentHour].PromptTokens += promptTokens
+	todayStats.Hourly[currentHour].CompletionTokens += completionTokens
+	if model != "" && getStatsConfig().HourlyByModel {
+		hourly := &todayStats.Hourly[currentHour]
+		if hourly.Models == nil {
+			hourly.Models = make(map[string]HourlyModelStats)
+		}
+		hourlyModel := hourly.Models[model]
+		hourlyModel.Requests += requestCount
+		hourlyModel.Tokens += totalTokens
+		hourly.Models[model] = hourlyModel
+	}
 
 	// 更新API密钥使用统计
 	if apiKey != "" {
-		maskedKey := maskAPIKey(apiKey)
+		keyID := KeyID(apiKey)
 
 		// 确保KeysUsage已初始化
 		if dailyData.KeysUsage == nil {
 			dailyData.KeysUsage = make(map[string]map[string]KeyUsage)
 		}
 
-		if _, exists := dailyData.KeysUsage[maskedKey]; !exists {
-			dailyData.KeysUsage[maskedKey] = make(map[string]KeyUsage)
+		if _, exists := dailyData.KeysUsage[keyID]; !exists {
+			dailyData.KeysUsage[keyID] = make(map[string]KeyUsage)
 		}
 
-		if _, exists := dailyData.KeysUsage[maskedKey][today]; !exists {
-			dailyData.KeysUsage[maskedKey][today] = KeyUsage{
+		if _, exists := dailyData.KeysUsage[keyID][today]; !exists {
+			dailyData.KeysUsage[keyID][today] = KeyUsage{
 				Requests: 0,
 				Tokens:   0,
 			}
 		}
 
-		keyUsage := dailyData.KeysUsage[maskedKey][today]
+		keyUsage := dailyData.KeysUsage[keyID][today]
 		keyUsage.Requests += requestCount
 		keyUsage.Tokens += totalTokens
-		dailyData.KeysUsage[maskedKey][today] = keyUsage
+		dailyData.KeysUsage[keyID][today] = keyUsage
+		quotaNotify = checkQuotaExceededLocked(keyID, today, keyUsage.Tokens)
 	}
 
-	// 更新数据库中的数据
-	dailyData.DailyStats[todayIndex] = *todayStats
-
-	// 异步保存数据
-	go func() {
-		if err := saveDailyData(); err != nil {
-			logger.Error("保存每日统计数据失败: %v", err)
+	// 更新估算费用
+	cost := estimateCost(model, promptTokens, completionTokens)
+	if cost > 0 {
+		keyID := ""
+		if apiKey != "" {
+			keyID = KeyID(apiKey)
 		}
-	}()
+		addCostLocked(todayStats, model, keyID, cost)
+	}
+
+	// 更新虚拟密钥使用统计
+	if record.VirtualKey != "" {
+		addVirtualKeyUsageLocked(record.VirtualKey, today, requestCount, totalTokens, cost)
+	}
+
+	dailyDirty = true
+	dailyPending++
+
+	// 安排保存数据
+	scheduleDailySaveLocked()
 }
 
-// GetDailyStats 获取指定日期的统计数据
-func GetDailyStats(date string) (*DailyStats, error) {
+// TimeSinceLastRequest 返回距本次运行最近一次记录请求经过的时间，用于空闲检测
+// 本次运行尚未记录请求时返回NoRequestRecorded
+func TimeSinceLastRequest() time.Duration {
 	dailyDataLock.RLock()
-	defer dailyDataLock.RUnlock()
+	last := lastRequestTime
+	dailyDataLock.RUnlock()
 
-	if dailyData == nil {
-		return nil, nil
+	if last.IsZero() {
+		return NoRequestRecorded
 	}
+	elapsed := statsNow().Sub(last)
+	if elapsed < 0 {
+		// 系统时间被回拨
+		return 0
+	}
+	return elapsed
+}
 
+// GetDailyStats 获取指定日期的统计数据
+// 没有该日期的数据时返回初始化好的空统计和found=false，统计数据未初始化时返回ErrStatsNotInitialized
+func GetDailyStats(date string) (*DailyStats, bool, error) {
 	// 如果未指定日期，使用今天的日期
 	if date == "" {
 		date = time.Now().Format("2006-01-02")
 	}
 
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		empty := newDailyStats(date)
+		return &empty, false, ErrStatsNotInitialized
+	}
+
 	// 查找指定日期的数据
 	for _, stats := range dailyData.DailyStats {
 		if stats.Date == date {
 			// 返回副本以避免外部修改
-			statsCopy := stats
-			return &statsCopy, nil
+			statsCopy := copyDailyStats(stats)
+			return &statsCopy, true, nil
 		}
 	}
 
-	return nil, nil
+	empty := newDailyStats(date)
+	return &empty, false, nil
 }
 
-// GetAllDailyStats 获取所有日期的统计数据
+// GetAllDailyStats 获取所有日期的统计数据，统计数据未初始化时返回空map和ErrStatsNotInitialized
 func GetAllDailyStats() (map[string]*DailyStats, error) {
 	dailyDataLock.RLock()
 	defer dailyDataLock.RUnlock()
 
+	result := make(map[string]*DailyStats)
 	if dailyData == nil {
-		return nil, nil
+		return result, ErrStatsNotInitialized
 	}
 
 	// 创建一个副本以避免并发问题
-	result := make(map[string]*DailyStats)
 	for _, stats := range dailyData.DailyStats {
-		statsCopy := stats
+		statsCopy := copyDailyStats(stats)
 		result[stats.Date] = &statsCopy
 	}
 	return result, nil
 }
 
-// maskAPIKey 掩盖API密钥
-func maskAPIKey(apiKey string) string {
-	if len(apiKey) <= 6 {
-		return "***"
+// GetKeyUsageStats 获取指定日期各密钥的使用统计，以稳定密钥标识为键，显示时使用DisplayKeyID转换
+// 仍在配置中的密钥同时返回当前余额；没有任何密钥在该日期有记录时返回空map和found=false
+func GetKeyUsageStats(date string) (map[string]KeyUsage, bool, error) {
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
 	}
-	return apiKey[:6] + "***"
+
+	result := make(map[string]KeyUsage)
+	dailyDataLock.RLock()
+	if dailyData == nil {
+		dailyDataLock.RUnlock()
+		return result, false, ErrStatsNotInitialized
+	}
+	for keyID, usageByDate := range dailyData.KeysUsage {
+		if usage, ok := usageByDate[date]; ok {
+			result[keyID] = usage
+		}
+	}
+	dailyDataLock.RUnlock()
+
+	// 在统计锁之外读取密钥余额，避免与密钥配置的锁嵌套
+	if len(result) > 0 {
+		for _, k := range GetApiKeys() {
+			if usage, ok := result[KeyID(k.Key)]; ok {
+				usage.Balance = k.Balance
+				result[KeyID(k.Key)] = usage
+			}
+		}
+	}
+	return result, len(result) > 0, nil
+}
+
+// GetFallbackStats 获取指定日期各原请求模型的回退次数，date为空时使用今天
+// 该日期没有统计数据时返回空map和found=false
+func GetFallbackStats(date string) (map[string]int, bool, error) {
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	result := make(map[string]int)
+	if dailyData == nil {
+		return result, false, ErrStatsNotInitialized
+	}
+
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date != date {
+			continue
+		}
+		for model, count := range stats.Fallbacks {
+			result[model] = count
+		}
+		return result, true, nil
+	}
+	return result, false, nil
+}
+
+// copyDailyStats 深拷贝每日统计，避免调用方修改内部的map和切片
+func copyDailyStats(stats DailyStats) DailyStats {
+	statsCopy := stats
+	statsCopy.Models = make(map[string]ModelStats, len(stats.Models))
+	for name, ms := range stats.Models {
+		ms.Latency = ms.Latency.clone()
+		statsCopy.Models[name] = ms
+	}
+	statsCopy.Hourly = make([]HourlyStats, len(stats.Hourly))
+	copy(statsCopy.Hourly, stats.Hourly)
+	for i, h := range stats.Hourly {
+		if h.Models == nil {
+			continue
+		}
+		statsCopy.Hourly[i].Models = make(map[string]HourlyModelStats, len(h.Models))
+		for name, ms := range h.Models {
+			statsCopy.Hourly[i].Models[name] = ms
+		}
+	}
+	statsCopy.Attempts = copyAttemptStats(stats.Attempts)
+	if stats.Fallbacks != nil {
+		statsCopy.Fallbacks = make(map[string]int, len(stats.Fallbacks))
+		for m, n := range stats.Fallbacks {
+			statsCopy.Fallbacks[m] = n
+		}
+	}
+	if stats.RejectedReasons != nil {
+		statsCopy.RejectedReasons = make(map[string]int, len(stats.RejectedReasons))
+		for r, n := range stats.RejectedReasons {
+			statsCopy.RejectedReasons[r] = n
+		}
+	}
+	if stats.Endpoints != nil {
+		statsCopy.Endpoints = make(map[string]DailyRequestStats, len(stats.Endpoints))
+		for e, s := range stats.Endpoints {
+			statsCopy.Endpoints[e] = s
+		}
+	}
+	if stats.QueueWait != nil {
+		statsCopy.QueueWait = make(map[string]QueueWaitStats, len(stats.QueueWait))
+		for p, w := range stats.QueueWait {
+			statsCopy.QueueWait[p] = w
+		}
+	}
+	if stats.StreamTimeouts.ByKey != nil {
+		statsCopy.StreamTimeouts.ByKey = make(map[string]int, len(stats.StreamTimeouts.ByKey))
+		for k, v := range stats.StreamTimeouts.ByKey {
+			statsCopy.StreamTimeouts.ByKey[k] = v
+		}
+	}
+	return statsCopy
+}
+
+// normalizeModelName 规范化作为统计键的模型名称
+// 模型名称可能包含斜杠、冒号、Unicode且较长，均原样保留；只替换非法UTF-8字节，
+// 否则序列化时会被替换为U+FFFD，导致重新加载后与内存中的键不一致
+func normalizeModelName(model string) string {
+	if utf8.ValidString(model) {
+		return model
+	}
+	return strings.ToValidUTF8(model, "\uFFFD")
+}
+
+// marshalStatsJSON 以缩进格式序列化统计数据，不转义HTML字符，
+// 使包含<、>、&的模型名称在文件中保持原样
+func marshalStatsJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// maskAPIKey 按脱敏策略掩盖API密钥，用于非管理界面的显示
+func maskAPIKey(apiKey string) string {
+	return MaskKeyWithPolicy(apiKey, false)
 }
@@ -0,0 +1,252 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 18:50:00
+  @desc: 按月归档每日统计汇总，保留超出滚动保留期的长期记录
+**/
+
+package config
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// MonthlyArchive 月度归档，保存某月已归档日期的汇总统计
+type MonthlyArchive struct {
+	Month             string                `json:"month"` // YYYY-MM
+	UpdatedAt         string                `json:"updated_at"`
+	Requests          DailyRequestStats     `json:"requests"`
+	Tokens            DailyTokenStats       `json:"tokens"`
+	StreamRequests    int                   `json:"stream_requests"`
+	NonStreamRequests int                   `json:"non_stream_requests"`
+	MetaRequests      int                   `json:"meta_requests"`
+	MaxRequestTokens  int                   `json:"max_request_tokens"` // 当月单个请求的最大令牌数
+	Client            ClientRequestStats    `json:"client"`
+	Models            map[string]ModelStats `json:"models"`
+	KeysUsage         map[string]KeyUsage   `json:"keys_usage"`                   // 按稳定密钥标识汇总
+	VirtualKeysUsage  map[string]KeyUsage   `json:"virtual_keys_usage,omitempty"` // 按虚拟密钥标识汇总
+	Days              []MonthlyArchiveDay   `json:"days"`                         // 已归档的日期及当日汇总，按日期升序
+}
+
+// MonthlyArchiveDay 月度归档中单日的汇总
+type MonthlyArchiveDay struct {
+	Date     string `json:"date"`
+	Requests int    `json:"requests"`
+	Success  int    `json:"success"`
+	Failed   int    `json:"failed"`
+	Tokens   int    `json:"tokens"`
+}
+
+// monthlyArchiveFileLocked 获取月度归档文件路径（已加锁）
+func monthlyArchiveFileLocked(month string) string {
+	return filepath.Join(statsArchiveDirLocked(), month+".json")
+}
+
+// GetMonthlyArchive 读取指定月份（YYYY-MM）的归档，found表示归档文件是否存在
+func GetMonthlyArchive(month string) (*MonthlyArchive, bool, error) {
+	if _, err := time.Parse("2006-01", month); err != nil {
+		return nil, false, fmt.Errorf("月份格式错误，应为YYYY-MM: %s", month)
+	}
+
+	dailyDataLock.RLock()
+	path := monthlyArchiveFileLocked(month)
+	dailyDataLock.RUnlock()
+
+	archive, err := readMonthlyArchive(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return archive, true, nil
+}
+
+// readMonthlyArchive 读取月度归档文件
+func readMonthlyArchive(path string) (*MonthlyArchive, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var archive MonthlyArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, fmt.Errorf("解析月度归档 %s 失败: %w", path, err)
+	}
+	return &archive, nil
+}
+
+// archiveCompletedMonthsLocked 将已结束月份的统计写入月度归档（已加锁）
+// 在新的一天加入统计后、清理保留期之前调用，已归档的日期不会重复累加
+func archiveCompletedMonthsLocked() {
+	currentMonth := time.Now().Format("2006-01")
+	var completed []DailyStats
+	for _, stats := range dailyData.DailyStats {
+		if len(stats.Date) >= 7 && stats.Date[:7] < currentMonth {
+			completed = append(completed, stats)
+		}
+	}
+	archiveDailyStatsLocked(completed)
+}
+
+// archiveDailyStatsLocked 将给定日期的统计合并到所属月份的归档文件（已加锁）
+// 开启 stats.monthly_archive 且不是只读模式时生效
+func archiveDailyStatsLocked(statsList []DailyStats) {
+	if len(statsList) == 0 || dailyReadOnly || !getStatsConfig().MonthlyArchive {
+		return
+	}
+
+	byMonth := make(map[string][]DailyStats)
+	for _, stats := range statsList {
+		if len(stats.Date) < 7 {
+			continue
+		}
+		month := stats.Date[:7]
+		byMonth[month] = append(byMonth[month], stats)
+	}
+
+	for month, days := range byMonth {
+		if err := mergeMonthlyArchiveLocked(month, days); err != nil {
+			logger.Error("写入月度归档 %s 失败: %v", month, err)
+		}
+	}
+}
+
+// mergeMonthlyArchiveLocked 将尚未归档的日期累加到月度归档文件（已加锁）
+func mergeMonthlyArchiveLocked(month string, days []DailyStats) error {
+	path := monthlyArchiveFileLocked(month)
+
+	archive, err := readMonthlyArchive(path)
+	if os.IsNotExist(err) {
+		archive = &MonthlyArchive{Month: month}
+	} else if err != nil {
+		return err
+	}
+	if archive.Models == nil {
+		archive.Models = make(map[string]ModelStats)
+	}
+	if archive.KeysUsage == nil {
+		archive.KeysUsage = make(map[string]KeyUsage)
+	}
+
+	archived := make(map[string]bool, len(archive.Days))
+	for _, day := range archive.Days {
+		archived[day.Date] = true
+	}
+
+	added := 0
+	for _, stats := range days {
+		if archived[stats.Date] {
+			continue
+		}
+		archived[stats.Date] = true
+		added++
+		addToMonthlyArchive(archive, stats)
+
+		for keyID, usageByDate := range dailyData.KeysUsage {
+			usage, ok := usageByDate[stats.Date]
+			if !ok {
+				continue
+			}
+			total := archive.KeysUsage[keyID]
+			total.Requests += usage.Requests
+			total.Tokens += usage.Tokens
+			total.Cost += usage.Cost
+			archive.KeysUsage[keyID] = total
+		}
+		for id, usageByDate := range dailyData.VirtualKeysUsage {
+			usage, ok := usageByDate[stats.Date]
+			if !ok {
+				continue
+			}
+			if archive.VirtualKeysUsage == nil {
+				archive.VirtualKeysUsage = make(map[string]KeyUsage)
+			}
+			total := archive.VirtualKeysUsage[id]
+			total.Requests += usage.Requests
+			total.Tokens += usage.Tokens
+			total.Cost += usage.Cost
+			archive.VirtualKeysUsage[id] = total
+		}
+	}
+	if added == 0 {
+		return nil
+	}
+
+	sort.Slice(archive.Days, func(i, j int) bool {
+		return archive.Days[i].Date < archive.Days[j].Date
+	})
+	archive.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := marshalStatsJSON(archive)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return err
+	}
+
+	logger.Info("已将 %d 天的统计数据写入月度归档: %s", added, path)
+	return nil
+}
+
+// addToMonthlyArchive 将单日统计累加到月度归档
+func addToMonthlyArchive(archive *MonthlyArchive, stats DailyStats) {
+	archive.Requests.Total = addCount(archive.Requests.Total, stats.Requests.Total)
+	archive.Requests.Success = addCount(archive.Requests.Success, stats.Requests.Success)
+	archive.Requests.Failed = addCount(archive.Requests.Failed, stats.Requests.Failed)
+	archive.Requests.Rejected = addCount(archive.Requests.Rejected, stats.Requests.Rejected)
+	archive.Tokens.Total = addCount(archive.Tokens.Total, stats.Tokens.Total)
+	archive.Tokens.Prompt = addCount(archive.Tokens.Prompt, stats.Tokens.Prompt)
+	archive.Tokens.Completion = addCount(archive.Tokens.Completion, stats.Tokens.Completion)
+	archive.Tokens.SuccessTokens = addCount(archive.Tokens.SuccessTokens, stats.Tokens.SuccessTokens)
+	archive.Tokens.FailedTokens = addCount(archive.Tokens.FailedTokens, stats.Tokens.FailedTokens)
+	archive.Tokens.Cost += stats.Tokens.Cost
+	archive.StreamRequests = addCount(archive.StreamRequests, stats.StreamRequests)
+	archive.NonStreamRequests = addCount(archive.NonStreamRequests, stats.NonStreamRequests)
+	archive.MetaRequests = addCount(archive.MetaRequests, stats.MetaRequests)
+	if stats.MaxRequestTokens > archive.MaxRequestTokens {
+		archive.MaxRequestTokens = stats.MaxRequestTokens
+	}
+	archive.Client.Total = addCount(archive.Client.Total, stats.Client.Total)
+	archive.Client.Success = addCount(archive.Client.Success, stats.Client.Success)
+	archive.Client.Failed = addCount(archive.Client.Failed, stats.Client.Failed)
+
+	for name, ms := range stats.Models {
+		total := archive.Models[name]
+		total.Requests = addCount(total.Requests, ms.Requests)
+		total.Tokens = addCount(total.Tokens, ms.Tokens)
+		total.Success = addCount(total.Success, ms.Success)
+		total.Failed = addCount(total.Failed, ms.Failed)
+		total.StreamRequests = addCount(total.StreamRequests, ms.StreamRequests)
+		total.NonStreamRequests = addCount(total.NonStreamRequests, ms.NonStreamRequests)
+		total.Cost += ms.Cost
+		total.TTFT.TotalMs += ms.TTFT.TotalMs
+		total.TTFT.Count += ms.TTFT.Count
+		if total.TTFT.Count > 0 {
+			total.TTFT.AvgMs = float64(total.TTFT.TotalMs) / float64(total.TTFT.Count)
+		}
+		total.Latency = mergeLatency(total.Latency, ms.Latency)
+		total.TTFB.TotalMs += ms.TTFB.TotalMs
+		total.TTFB.Count += ms.TTFB.Count
+		if total.TTFB.Count > 0 {
+			total.TTFB.AvgMs = float64(total.TTFB.TotalMs) / float64(total.TTFB.Count)
+		}
+		archive.Models[name] = total
+	}
+
+	archive.Days = append(archive.Days, MonthlyArchiveDay{
+		Date:     stats.Date,
+		Requests: stats.Requests.Total,
+		Success:  stats.Requests.Success,
+		Failed:   stats.Requests.Failed,
+		Tokens:   stats.Tokens.Total,
+	})
+}
@@ -0,0 +1,43 @@
+package config
+
+import "testing"
+
+func TestMonthRolloverWritesArchive(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{MonthlyArchive: true}, `{"version":"1.0","daily_stats":[
+		{"date": "2025-01-30", "requests": {"total": 4, "success": 3, "failed": 1},
+			"tokens": {"total": 40, "prompt": 30, "completion": 10},
+			"models": {"model-a": {"requests": 4, "tokens": 40, "success": 3, "failed": 1}}},
+		{"date": "2025-01-31", "requests": {"total": 6, "success": 6},
+			"tokens": {"total": 60, "prompt": 50, "completion": 10},
+			"models": {"model-a": {"requests": 2, "tokens": 20, "success": 2}, "model-b": {"requests": 4, "tokens": 40, "success": 4}}}
+	],"keys_usage":{"k-one": {"2025-01-30": {"requests": 4, "tokens": 40}, "2025-01-31": {"requests": 6, "tokens": 60}}}}`)
+
+	// 再次触发归档不会重复累加已归档的日期
+	dailyDataLock.Lock()
+	trimDailyRetentionLocked()
+	dailyDataLock.Unlock()
+
+	archive, found, err := GetMonthlyArchive("2025-01")
+	if err != nil || !found {
+		t.Fatalf("GetMonthlyArchive() = %v, %v", found, err)
+	}
+	if archive.Requests.Total != 10 || archive.Requests.Success != 9 || archive.Requests.Failed != 1 {
+		t.Fatalf("归档的请求统计 = %+v", archive.Requests)
+	}
+	if archive.Tokens.Total != 100 || archive.Tokens.Prompt != 80 || archive.Tokens.Completion != 20 {
+		t.Fatalf("归档的令牌统计 = %+v", archive.Tokens)
+	}
+	if archive.Models["model-a"].Requests != 6 || archive.Models["model-b"].Tokens != 40 {
+		t.Fatalf("归档的模型统计 = %+v", archive.Models)
+	}
+	if archive.KeysUsage["k-one"].Requests != 10 || archive.KeysUsage["k-one"].Tokens != 100 {
+		t.Fatalf("归档的密钥统计 = %+v", archive.KeysUsage)
+	}
+	if len(archive.Days) != 2 || archive.Days[0].Date != "2025-01-30" || archive.Days[1].Requests != 6 {
+		t.Fatalf("归档的日期 = %+v", archive.Days)
+	}
+
+	if _, found, err := GetMonthlyArchive("2025-02"); err != nil || found {
+		t.Fatalf("没有数据的月份不应有归档: %v, %v", found, err)
+	}
+}
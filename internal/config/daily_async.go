@@ -0,0 +1,101 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 22:10:00
+  @desc: 请求统计的异步记录：请求处理中只放入队列，由单个后台协程按顺序写入每日统计
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// defaultDailyAsyncBufferSize 异步记录队列的默认长度
+	defaultDailyAsyncBufferSize = 4096
+	// dailyAsyncDropLogEvery 每丢弃多少条记录输出一次日志，避免队列持续满时刷屏
+	dailyAsyncDropLogEvery = 1000
+)
+
+// dailyAsyncItem 异步队列中的一项，record为空时表示排空标记，处理到时关闭done
+type dailyAsyncItem struct {
+	record *DailyRequestRecord
+	done   chan struct{}
+}
+
+var (
+	// dailyAsyncQueue 异步记录队列，首次使用时按配置的长度创建
+	dailyAsyncQueue chan dailyAsyncItem
+	// dailyAsyncOnce 保证队列和写入协程只创建一次
+	dailyAsyncOnce sync.Once
+	// dailyAsyncStarted 队列是否已创建，为true后才能读取dailyAsyncQueue
+	dailyAsyncStarted atomic.Bool
+	// dailyAsyncDropped 队列满时丢弃的记录数
+	dailyAsyncDropped atomic.Int64
+	// applyQueuedDailyRecord 写入协程写入记录的函数，测试时可替换
+	applyQueuedDailyRecord = applyDailyRequestRecord
+)
+
+// startDailyAsyncConsumer 创建异步记录队列并启动写入协程，队列长度在首次使用时确定，修改后重启生效
+func startDailyAsyncConsumer() {
+	dailyAsyncOnce.Do(func() {
+		size := getStatsConfig().AsyncBufferSize
+		if size <= 0 {
+			size = defaultDailyAsyncBufferSize
+		}
+		dailyAsyncQueue = make(chan dailyAsyncItem, size)
+		dailyAsyncStarted.Store(true)
+
+		go func() {
+			for item := range dailyAsyncQueue {
+				if item.record != nil {
+					applyQueuedDailyRecord(*item.record)
+				}
+				if item.done != nil {
+					close(item.done)
+				}
+			}
+		}()
+		logger.Info("已开启异步记录请求统计，队列长度: %d", size)
+	})
+}
+
+// enqueueDailyRequestRecord 将请求记录放入异步队列，不阻塞调用方，队列满时丢弃并计数
+func enqueueDailyRequestRecord(record DailyRequestRecord) {
+	startDailyAsyncConsumer()
+
+	select {
+	case dailyAsyncQueue <- dailyAsyncItem{record: &record}:
+	default:
+		dropped := dailyAsyncDropped.Add(1)
+		if dropped == 1 || dropped%dailyAsyncDropLogEvery == 0 {
+			logger.Warn("异步统计队列已满，丢弃请求记录，累计丢弃 %d 条", dropped)
+		}
+	}
+}
+
+// drainDailyRequestQueue 等待异步队列中已有的记录全部写入，未开启异步记录时直接返回
+// 在队尾放入排空标记，写入协程按顺序处理到标记时说明之前的记录均已写入
+func drainDailyRequestQueue() {
+	if !dailyAsyncStarted.Load() {
+		return
+	}
+	done := make(chan struct{})
+	dailyAsyncQueue <- dailyAsyncItem{done: done}
+	<-done
+}
+
+// GetAsyncStatsDropped 获取异步记录队列满时丢弃的记录数
+func GetAsyncStatsDropped() int64 {
+	return dailyAsyncDropped.Load()
+}
+
+// GetAsyncStatsQueueLength 获取异步记录队列中等待写入的记录数
+func GetAsyncStatsQueueLength() int {
+	if !dailyAsyncStarted.Load() {
+		return 0
+	}
+	return len(dailyAsyncQueue)
+}
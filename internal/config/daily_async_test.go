@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsyncRecordingOrderAndDrops(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{AsyncRecording: true, AsyncBufferSize: 2})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+
+	// 按新的队列长度重新创建队列和写入协程
+	dailyAsyncOnce = sync.Once{}
+	var mu sync.Mutex
+	var applied []string
+	applyQueuedDailyRecord = func(record DailyRequestRecord) {
+		mu.Lock()
+		applied = append(applied, record.Model)
+		mu.Unlock()
+		applyDailyRequestRecord(record)
+	}
+	t.Cleanup(func() { applyQueuedDailyRecord = applyDailyRequestRecord })
+	droppedBefore := GetAsyncStatsDropped()
+
+	// 持有统计锁，让写入协程取出第一条记录后阻塞，之后队列中只能再放入2条
+	dailyDataLock.Lock()
+	AddDailyRequestStat("sk-test", "model-1", "", "", 1, 10, 5, true)
+	deadline := time.Now().Add(5 * time.Second)
+	for GetAsyncStatsQueueLength() != 0 {
+		if time.Now().After(deadline) {
+			dailyDataLock.Unlock()
+			t.Fatal("写入协程没有取出第一条记录")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 2; i <= 5; i++ {
+		AddDailyRequestStat("sk-test", fmt.Sprintf("model-%d", i), "", "", 1, 10, 5, true)
+	}
+	dailyDataLock.Unlock()
+
+	if err := FlushDailyStats(); err != nil {
+		t.Fatalf("FlushDailyStats() = %v", err)
+	}
+	if dropped := GetAsyncStatsDropped() - droppedBefore; dropped != 2 {
+		t.Fatalf("丢弃的记录数 = %d, want 2", dropped)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(applied) != "[model-1 model-2 model-3]" {
+		t.Fatalf("写入顺序 = %v, want [model-1 model-2 model-3]", applied)
+	}
+	stats, _, _ := GetDailyStats("")
+	if stats.Requests.Total != 3 {
+		t.Fatalf("请求数 = %d, want 3", stats.Requests.Total)
+	}
+}
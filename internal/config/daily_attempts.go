@@ -0,0 +1,153 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 11:30:00
+  @desc: 区分客户端请求结果与上游尝试（含重试）的统计
+**/
+
+package config
+
+// 上游尝试的错误分类
+const (
+	AttemptErrorNetwork   = "network"     // 网络错误
+	AttemptErrorTimeout   = "timeout"     // 请求超时
+	AttemptErrorRead      = "read_error"  // 读取响应失败
+	AttemptErrorRateLimit = "rate_limit"  // 上游返回429
+	AttemptErrorClient    = "http_4xx"    // 上游返回其他4xx
+	AttemptErrorServer    = "http_5xx"    // 上游返回5xx
+	AttemptErrorOther     = "other_error" // 其他错误
+)
+
+// ClientRequestStats 客户端视角的请求统计
+// 每个进入的请求只计一次，任一次尝试成功即为成功
+type ClientRequestStats struct {
+	Total   int `json:"total"`
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+}
+
+// AttemptStats 上游尝试统计，一个客户端请求因重试可能产生多次尝试
+type AttemptStats struct {
+	Total        int                        `json:"total"`
+	Success      int                        `json:"success"`
+	Failed       int                        `json:"failed"`
+	ByKey        map[string]KeyAttemptStats `json:"by_key,omitempty"`         // 按稳定密钥标识统计
+	ByErrorClass map[string]int             `json:"by_error_class,omitempty"` // 按错误分类统计失败次数
+}
+
+// KeyAttemptStats 单个密钥的上游尝试统计
+type KeyAttemptStats struct {
+	Total     int `json:"total"`
+	Success   int `json:"success"`
+	Failed    int `json:"failed"`
+	Cooldowns int `json:"cooldowns,omitempty"` // 因上游限流或额度错误进入冷却的次数
+}
+
+// addKeyCooldownStat 记录一次密钥进入冷却
+func addKeyCooldownStat(keyID string) {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	todayStats := todayStatsLocked()
+	if todayStats.Attempts.ByKey == nil {
+		todayStats.Attempts.ByKey = make(map[string]KeyAttemptStats)
+	}
+	keyStats := todayStats.Attempts.ByKey[keyID]
+	keyStats.Cooldowns++
+	todayStats.Attempts.ByKey[keyID] = keyStats
+
+	dailyDirty = true
+	scheduleDailySaveLocked()
+}
+
+// AddClientRequestOutcome 记录一个客户端请求的最终结果
+func AddClientRequestOutcome(success bool) {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	todayStats := todayStatsLocked()
+	todayStats.Client.Total++
+	if success {
+		todayStats.Client.Success++
+	} else {
+		todayStats.Client.Failed++
+	}
+
+	dailyDirty = true
+	scheduleDailySaveLocked()
+}
+
+// AddUpstreamAttempt 记录一次上游尝试，errorClass为空表示成功
+func AddUpstreamAttempt(apiKey, errorClass string) {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	todayStats := todayStatsLocked()
+	attempts := &todayStats.Attempts
+	success := errorClass == ""
+
+	attempts.Total++
+	if success {
+		attempts.Success++
+	} else {
+		attempts.Failed++
+		if attempts.ByErrorClass == nil {
+			attempts.ByErrorClass = make(map[string]int)
+		}
+		attempts.ByErrorClass[errorClass]++
+	}
+
+	if apiKey != "" {
+		if attempts.ByKey == nil {
+			attempts.ByKey = make(map[string]KeyAttemptStats)
+		}
+		keyID := KeyID(apiKey)
+		keyStats := attempts.ByKey[keyID]
+		keyStats.Total++
+		if success {
+			keyStats.Success++
+		} else {
+			keyStats.Failed++
+		}
+		attempts.ByKey[keyID] = keyStats
+	}
+
+	dailyDirty = true
+	scheduleDailySaveLocked()
+}
+
+// StatusSuccess 状态分布中成功尝试的分类名
+const StatusSuccess = "success"
+
+// GetStatusDistribution 获取指定日期上游尝试的结果分布，用于状态饼图
+// 返回success及各错误分类（http_4xx、http_5xx、timeout、rate_limit等）的次数，
+// 按上游尝试统计，包含重试；日期为空时使用今天，没有记录的日期只返回success为0
+func GetStatusDistribution(date string) (map[string]int, error) {
+	stats, _, err := GetDailyStats(date)
+	if err != nil {
+		return nil, err
+	}
+
+	distribution := map[string]int{StatusSuccess: stats.Attempts.Success}
+	for errorClass, count := range stats.Attempts.ByErrorClass {
+		distribution[errorClass] += count
+	}
+	return distribution, nil
+}
+
+// copyAttemptStats 深拷贝上游尝试统计
+func copyAttemptStats(attempts AttemptStats) AttemptStats {
+	attemptsCopy := attempts
+	if attempts.ByKey != nil {
+		attemptsCopy.ByKey = make(map[string]KeyAttemptStats, len(attempts.ByKey))
+		for k, v := range attempts.ByKey {
+			attemptsCopy.ByKey[k] = v
+		}
+	}
+	if attempts.ByErrorClass != nil {
+		attemptsCopy.ByErrorClass = make(map[string]int, len(attempts.ByErrorClass))
+		for k, v := range attempts.ByErrorClass {
+			attemptsCopy.ByErrorClass[k] = v
+		}
+	}
+	return attemptsCopy
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetStatusDistribution(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	for _, errorClass := range []string{"", "", "", AttemptErrorRateLimit, AttemptErrorServer, AttemptErrorServer, AttemptErrorTimeout} {
+		AddUpstreamAttempt("sk-test", errorClass)
+	}
+
+	distribution, err := GetStatusDistribution("")
+	if err != nil {
+		t.Fatalf("GetStatusDistribution() = %v", err)
+	}
+	want := map[string]int{StatusSuccess: 3, AttemptErrorRateLimit: 1, AttemptErrorServer: 2, AttemptErrorTimeout: 1}
+	if !reflect.DeepEqual(distribution, want) {
+		t.Fatalf("GetStatusDistribution() = %v, want %v", distribution, want)
+	}
+	total := 0
+	for _, count := range distribution {
+		total += count
+	}
+	if attempts := mustGetDailyStats(t, "").Attempts.Total; total != attempts {
+		t.Fatalf("各分类之和 = %d, 上游尝试数 = %d", total, attempts)
+	}
+
+	empty, err := GetStatusDistribution("2025-01-02")
+	if err != nil {
+		t.Fatalf("GetStatusDistribution() = %v", err)
+	}
+	if !reflect.DeepEqual(empty, map[string]int{StatusSuccess: 0}) {
+		t.Fatalf("没有记录的日期 = %v, want 只有success为0", empty)
+	}
+}
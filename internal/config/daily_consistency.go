@@ -0,0 +1,297 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 18:00:00
+  @desc: 每日统计汇总值与密钥使用、模型、小时明细之间的一致性检查与修复
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 一致性检查的明细来源
+const (
+	ConsistencySourceKeysUsage = "keys_usage" // 按密钥的使用统计
+	ConsistencySourceModels    = "models"     // 按模型的统计
+	ConsistencySourceHourly    = "hourly"     // 小时统计
+)
+
+const (
+	// consistencyCheckHour 每晚执行一致性检查的时间（本地时间小时）
+	consistencyCheckHour = 3
+)
+
+// ConsistencyIssue 一条不一致记录，Delta = Detail - Total
+type ConsistencyIssue struct {
+	Date   string `json:"date"`
+	Source string `json:"source"` // 明细来源：keys_usage、models、hourly
+	Field  string `json:"field"`  // 比较的字段：requests、tokens
+	Total  int    `json:"total"`  // 每日汇总值
+	Detail int    `json:"detail"` // 明细求和值
+	Delta  int    `json:"delta"`
+}
+
+// ConsistencyReport 一致性检查结果
+type ConsistencyReport struct {
+	CheckedAt     string             `json:"checked_at"`
+	DatesChecked  int                `json:"dates_checked"`
+	Tolerance     float64            `json:"tolerance"` // 相对容差
+	Issues        []ConsistencyIssue `json:"issues"`
+	RepairedDates []string           `json:"repaired_dates,omitempty"` // 已按小时统计重新计算汇总值的日期
+}
+
+var (
+	// lastConsistencyReport 最近一次一致性检查结果，受consistencyLock保护
+	lastConsistencyReport *ConsistencyReport
+	consistencyLock       sync.RWMutex
+	// consistencyCheckerOnce 保证每晚检查协程只启动一次
+	consistencyCheckerOnce sync.Once
+)
+
+// consistencySnapshot 单日检查所需的数据快照
+type consistencySnapshot struct {
+	stats     DailyStats
+	keysTotal KeyUsage
+	hasKeys   bool
+}
+
+// CheckStatsConsistency 对所有保留日期检查汇总值与明细的一致性
+// 检查基于快照进行，不阻塞实时统计；repair为true时用小时统计重新计算不一致日期的请求数和令牌数
+// 修复时若该日期在检查期间又有新记录则跳过，避免覆盖实时数据
+func CheckStatsConsistency(repair bool) (*ConsistencyReport, error) {
+	snapshots, err := snapshotForConsistency()
+	if err != nil {
+		return nil, err
+	}
+
+	tolerance := getStatsConfig().ConsistencyTolerance
+	if tolerance < 0 {
+		tolerance = 0
+	}
+
+	report := &ConsistencyReport{
+		CheckedAt:    time.Now().Format(time.RFC3339),
+		DatesChecked: len(snapshots),
+		Tolerance:    tolerance,
+		Issues:       make([]ConsistencyIssue, 0),
+	}
+
+	repairDates := make(map[string]DailyStats)
+	for _, snap := range snapshots {
+		issues := checkDateConsistency(snap, tolerance)
+		if len(issues) == 0 {
+			continue
+		}
+		report.Issues = append(report.Issues, issues...)
+		repairDates[snap.stats.Date] = snap.stats
+	}
+
+	if repair && len(repairDates) > 0 {
+		report.RepairedDates = repairAggregates(repairDates)
+	}
+
+	for _, issue := range report.Issues {
+		logger.Warn("统计数据不一致: 日期=%s, 来源=%s, 字段=%s, 汇总=%d, 明细=%d, 差值=%d",
+			issue.Date, issue.Source, issue.Field, issue.Total, issue.Detail, issue.Delta)
+	}
+	if len(report.RepairedDates) > 0 {
+		logger.Info("已按小时统计修复 %d 天的汇总数据: %v", len(report.RepairedDates), report.RepairedDates)
+	}
+
+	consistencyLock.Lock()
+	lastConsistencyReport = report
+	consistencyLock.Unlock()
+
+	return report, nil
+}
+
+// GetLastConsistencyReport 获取最近一次一致性检查结果，尚未检查过时返回nil
+func GetLastConsistencyReport() *ConsistencyReport {
+	consistencyLock.RLock()
+	defer consistencyLock.RUnlock()
+	return lastConsistencyReport
+}
+
+// snapshotForConsistency 在读锁下复制检查所需的数据
+func snapshotForConsistency() ([]consistencySnapshot, error) {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return nil, ErrStatsNotInitialized
+	}
+
+	snapshots := make([]consistencySnapshot, 0, len(dailyData.DailyStats))
+	index := make(map[string]int, len(dailyData.DailyStats))
+	for _, stats := range dailyData.DailyStats {
+		index[stats.Date] = len(snapshots)
+		snapshots = append(snapshots, consistencySnapshot{stats: copyDailyStats(stats)})
+	}
+
+	for _, usageByDate := range dailyData.KeysUsage {
+		for date, usage := range usageByDate {
+			i, ok := index[date]
+			if !ok {
+				continue
+			}
+			snapshots[i].hasKeys = true
+			snapshots[i].keysTotal.Requests += usage.Requests
+			snapshots[i].keysTotal.Tokens += usage.Tokens
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].stats.Date < snapshots[j].stats.Date
+	})
+	return snapshots, nil
+}
+
+// checkDateConsistency 比较单日汇总值与各明细的求和
+// 没有任何明细记录的来源不参与比较（如旧数据没有按密钥统计）
+func checkDateConsistency(snap consistencySnapshot, tolerance float64) []ConsistencyIssue {
+	stats := snap.stats
+	var issues []ConsistencyIssue
+
+	compare := func(source, field string, total, detail int) {
+		delta := detail - total
+		if delta == 0 {
+			return
+		}
+		base := math.Max(math.Abs(float64(total)), math.Abs(float64(detail)))
+		if math.Abs(float64(delta)) <= tolerance*base {
+			return
+		}
+		issues = append(issues, ConsistencyIssue{
+			Date:   stats.Date,
+			Source: source,
+			Field:  field,
+			Total:  total,
+			Detail: detail,
+			Delta:  delta,
+		})
+	}
+
+	// 本地拒绝的请求没有密钥、模型和小时明细，不参与比较
+	upstreamRequests := stats.Requests.Total - stats.Requests.Rejected
+	if snap.hasKeys {
+		compare(ConsistencySourceKeysUsage, "requests", upstreamRequests, snap.keysTotal.Requests)
+		compare(ConsistencySourceKeysUsage, "tokens", stats.Tokens.Total, snap.keysTotal.Tokens)
+	}
+
+	if len(stats.Models) > 0 {
+		var requests, tokens int
+		for _, ms := range stats.Models {
+			requests += ms.Requests
+			tokens += ms.Tokens
+		}
+		compare(ConsistencySourceModels, "requests", upstreamRequests, requests)
+		compare(ConsistencySourceModels, "tokens", stats.Tokens.Total, tokens)
+	}
+
+	if requests, tokens := sumHourly(stats.Hourly); requests > 0 || tokens > 0 {
+		compare(ConsistencySourceHourly, "requests", upstreamRequests, requests)
+		compare(ConsistencySourceHourly, "tokens", stats.Tokens.Total, tokens)
+	}
+
+	return issues
+}
+
+// sumHourly 计算小时统计的请求数和令牌数之和
+func sumHourly(hourly []HourlyStats) (requests, tokens int) {
+	for _, h := range hourly {
+		requests += h.Requests
+		tokens += h.Tokens
+	}
+	return requests, tokens
+}
+
+// repairAggregates 用小时统计重新计算汇总的请求数和令牌数，返回已修复的日期
+// 小时统计与请求记录同时更新且不受密钥、模型是否为空影响，是最完整的明细来源
+func repairAggregates(snapshots map[string]DailyStats) []string {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if dailyData == nil || dailyReadOnly {
+		return nil
+	}
+
+	var repaired []string
+	for i := range dailyData.DailyStats {
+		stats := &dailyData.DailyStats[i]
+		snap, ok := snapshots[stats.Date]
+		if !ok {
+			continue
+		}
+		// 检查期间有新记录时跳过
+		if stats.Requests != snap.Requests || stats.Tokens != snap.Tokens {
+			continue
+		}
+
+		requests, tokens := sumHourly(stats.Hourly)
+		if requests == 0 && tokens == 0 {
+			continue
+		}
+		if requests == stats.Requests.Total-stats.Requests.Rejected && tokens == stats.Tokens.Total {
+			continue
+		}
+
+		stats.Requests.Total = requests + stats.Requests.Rejected
+		if stats.Requests.Success > requests {
+			stats.Requests.Success = requests
+		}
+		stats.Requests.Failed = requests - stats.Requests.Success
+
+		if tokens != stats.Tokens.Total {
+			var prompt, completion int
+			for _, h := range stats.Hourly {
+				prompt += h.PromptTokens
+				completion += h.CompletionTokens
+			}
+			stats.Tokens.Total = tokens
+			if prompt+completion == tokens {
+				stats.Tokens.Prompt = prompt
+				stats.Tokens.Completion = completion
+			}
+		}
+		repaired = append(repaired, stats.Date)
+	}
+
+	if len(repaired) > 0 {
+		dailyDirty = true
+		scheduleDailySaveLocked()
+	}
+	return repaired
+}
+
+// startConsistencyChecker 启动每晚一致性检查协程，是否检查和修复在执行时按配置决定
+func startConsistencyChecker() {
+	consistencyCheckerOnce.Do(func() {
+		go func() {
+			for {
+				time.Sleep(time.Until(nextConsistencyCheck(time.Now())))
+
+				cfg := getStatsConfig()
+				if !cfg.ConsistencyCheck {
+					continue
+				}
+				if _, err := CheckStatsConsistency(cfg.ConsistencyRepair); err != nil {
+					logger.Error("每晚统计数据一致性检查失败: %v", err)
+				}
+			}
+		}()
+	})
+}
+
+// nextConsistencyCheck 计算下一次每晚检查的时间
+func nextConsistencyCheck(now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), consistencyCheckHour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -0,0 +1,150 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 00:35:00
+  @desc: 按模型单价估算请求费用，记录到每日、模型和密钥统计中
+**/
+
+package config
+
+import "time"
+
+// defaultPricingModel 单价表中适用于所有未单独配置模型的键
+const defaultPricingModel = "*"
+
+// ModelPrice 模型单价，按每1K令牌计，币种与上游账单一致
+type ModelPrice struct {
+	PromptPer1K     float64 `mapstructure:"prompt_per_1k"`     // 每1K提示词令牌的价格
+	CompletionPer1K float64 `mapstructure:"completion_per_1k"` // 每1K补全令牌的价格
+}
+
+// CostSummary 某一天的估算费用
+type CostSummary struct {
+	Date   string             `json:"date"`
+	Total  float64            `json:"total"`
+	Models map[string]float64 `json:"models"` // 按模型统计的费用
+	Keys   map[string]float64 `json:"keys"`   // 按密钥统计的费用，以脱敏后的密钥为键
+}
+
+// DailyCost 某一天的估算总费用
+type DailyCost struct {
+	Date string  `json:"date"`
+	Cost float64 `json:"cost"`
+}
+
+// modelPrice 获取模型的单价，模型未单独配置时使用"*"的单价，都未配置时ok为false
+func modelPrice(model string) (ModelPrice, bool) {
+	pricing := getStatsConfig().Pricing
+	if len(pricing) == 0 {
+		return ModelPrice{}, false
+	}
+	if price, ok := pricing[model]; ok {
+		return price, true
+	}
+	price, ok := pricing[defaultPricingModel]
+	return price, ok
+}
+
+// estimateCost 按单价表估算请求费用，模型没有单价时为0
+func estimateCost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := modelPrice(model)
+	if !ok {
+		return 0
+	}
+	return float64(promptTokens)/1000*price.PromptPer1K + float64(completionTokens)/1000*price.CompletionPer1K
+}
+
+// addCostLocked 将估算费用累加到统计日期、模型和密钥（已加锁）
+// 模型统计需已存在，model或keyID为空时不记录对应项
+func addCostLocked(stats *DailyStats, model, keyID string, cost float64) {
+	if cost == 0 {
+		return
+	}
+	stats.Tokens.Cost += cost
+	if model != "" {
+		if modelStats, ok := stats.Models[model]; ok {
+			modelStats.Cost += cost
+			stats.Models[model] = modelStats
+		}
+	}
+	if keyID != "" {
+		if dailyData.KeysUsage == nil {
+			dailyData.KeysUsage = make(map[string]map[string]KeyUsage)
+		}
+		if dailyData.KeysUsage[keyID] == nil {
+			dailyData.KeysUsage[keyID] = make(map[string]KeyUsage)
+		}
+		keyUsage := dailyData.KeysUsage[keyID][stats.Date]
+		keyUsage.Cost += cost
+		dailyData.KeysUsage[keyID][stats.Date] = keyUsage
+	}
+}
+
+// GetCostSummary 获取指定日期的估算费用，按模型和密钥分别统计，日期为空时使用今天
+// 费用在记录请求时按当时的单价表计算，修改单价不影响已记录的费用
+func GetCostSummary(date string) (CostSummary, error) {
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	summary := CostSummary{
+		Date:   date,
+		Models: make(map[string]float64),
+		Keys:   make(map[string]float64),
+	}
+
+	keyCosts := make(map[string]float64)
+	dailyDataLock.RLock()
+	if dailyData == nil {
+		dailyDataLock.RUnlock()
+		return summary, ErrStatsNotInitialized
+	}
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date != date {
+			continue
+		}
+		summary.Total = stats.Tokens.Cost
+		for name, ms := range stats.Models {
+			if ms.Cost > 0 {
+				summary.Models[name] = ms.Cost
+			}
+		}
+		break
+	}
+	for keyID, usageByDate := range dailyData.KeysUsage {
+		if usage, ok := usageByDate[date]; ok && usage.Cost > 0 {
+			keyCosts[keyID] = usage.Cost
+		}
+	}
+	dailyDataLock.RUnlock()
+
+	// 在统计锁之外查找原始密钥，避免与密钥配置的锁嵌套
+	for keyID, cost := range keyCosts {
+		summary.Keys[DisplayKeyID(keyID, false)] += cost
+	}
+	return summary, nil
+}
+
+// GetDailyCosts 获取最近days天（含今天）每天的估算总费用，按日期升序，没有数据的日期为0
+func GetDailyCosts(days int) ([]DailyCost, error) {
+	if days <= 0 {
+		days = statsRetentionDays()
+	}
+
+	costs := make(map[string]float64)
+	dailyDataLock.RLock()
+	if dailyData == nil {
+		dailyDataLock.RUnlock()
+		return []DailyCost{}, ErrStatsNotInitialized
+	}
+	for _, stats := range dailyData.DailyStats {
+		costs[stats.Date] = stats.Tokens.Cost
+	}
+	dailyDataLock.RUnlock()
+
+	now := time.Now()
+	result := make([]DailyCost, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		date := now.AddDate(0, 0, -i).Format("2006-01-02")
+		result = append(result, DailyCost{Date: date, Cost: costs[date]})
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 22:30:00
+  @desc: 比较内存中与统计文件中今天的汇总值，用于发现未保存或丢失的数据
+**/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// StatsDiff 今天的统计汇总值在内存与文件之间的差异，各项均为内存值减文件值
+type StatsDiff struct {
+	Date             string `json:"date"`
+	OnDisk           bool   `json:"on_disk"` // 文件中是否有今天的数据
+	Requests         int    `json:"requests"`
+	Success          int    `json:"success"`
+	Failed           int    `json:"failed"`
+	Tokens           int    `json:"tokens"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Dirty            bool   `json:"dirty"` // 内存中是否有尚未写入文件的变更
+}
+
+// IsZero 内存与文件中今天的汇总值是否一致
+func (d *StatsDiff) IsZero() bool {
+	return d.Requests == 0 && d.Success == 0 && d.Failed == 0 &&
+		d.Tokens == 0 && d.PromptTokens == 0 && d.CompletionTokens == 0
+}
+
+// DiffMemoryVsDisk 读取统计文件，比较当前环境今天的汇总值与内存中的数据
+// 差异不为0说明有尚未保存的数据，或保存失败导致文件落后于内存；文件不存在时按文件中全为0比较
+func DiffMemoryVsDisk() (*StatsDiff, error) {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return nil, ErrStatsNotInitialized
+	}
+
+	today := time.Now().Format("2006-01-02")
+	diff := &StatsDiff{Date: today, Dirty: dailyDirty}
+
+	var disk DailyStats
+	data, err := os.ReadFile(dailyFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取统计文件失败: %w", err)
+	}
+	if err == nil {
+		loaded, err := decodeDailyData(data, statsEnvironment)
+		if err != nil {
+			return nil, fmt.Errorf("解析统计文件失败: %w", err)
+		}
+		for _, stats := range loaded.DailyStats {
+			if stats.Date == today {
+				disk = stats
+				diff.OnDisk = true
+				break
+			}
+		}
+	}
+
+	var memory DailyStats
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date == today {
+			memory = stats
+			break
+		}
+	}
+
+	diff.Requests = memory.Requests.Total - disk.Requests.Total
+	diff.Success = memory.Requests.Success - disk.Requests.Success
+	diff.Failed = memory.Requests.Failed - disk.Requests.Failed
+	diff.Tokens = memory.Tokens.Total - disk.Tokens.Total
+	diff.PromptTokens = memory.Tokens.Prompt - disk.Tokens.Prompt
+	diff.CompletionTokens = memory.Tokens.Completion - disk.Tokens.Completion
+	return diff, nil
+}
@@ -0,0 +1,36 @@
+package config
+
+import "testing"
+
+func TestDiffMemoryVsDisk(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	if err := FlushDailyStats(); err != nil {
+		t.Fatalf("FlushDailyStats() = %v", err)
+	}
+
+	AddDailyRequestStat("sk-test", "model-a", "", "", 2, 30, 12, true)
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 8, 0, false)
+	diff, err := DiffMemoryVsDisk()
+	if err != nil {
+		t.Fatalf("DiffMemoryVsDisk() = %v", err)
+	}
+	want := StatsDiff{Date: diff.Date, OnDisk: true, Requests: 3, Success: 2, Failed: 1,
+		Tokens: 50, PromptTokens: 38, CompletionTokens: 12, Dirty: true}
+	if *diff != want || diff.IsZero() {
+		t.Fatalf("未保存时的差异 = %+v, want %+v", *diff, want)
+	}
+
+	if err := FlushDailyStats(); err != nil {
+		t.Fatalf("FlushDailyStats() = %v", err)
+	}
+	diff, err = DiffMemoryVsDisk()
+	if err != nil {
+		t.Fatalf("DiffMemoryVsDisk() = %v", err)
+	}
+	if !diff.IsZero() || diff.Dirty || !diff.OnDisk {
+		t.Fatalf("保存后的差异 = %+v, want 零值", *diff)
+	}
+}
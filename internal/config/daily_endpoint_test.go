@@ -0,0 +1,66 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEndpointStatsAreIsolated(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	today := time.Now().Format("2006-01-02")
+
+	AddDailyRequestStat("sk-test", "model-a", "", "/v1/chat/completions", 3, 10, 5, true)
+	AddDailyRequestStat("sk-test", "model-a", "", "/v1/chat/completions", 1, 10, 0, false)
+	AddDailyRequestStat("sk-test", "embed-a", "", "/v1/embeddings", 2, 8, 0, true)
+
+	chat, err := GetEndpointStats("/v1/chat/completions", today)
+	if err != nil {
+		t.Fatalf("GetEndpointStats() = %v", err)
+	}
+	if chat.Total != 4 || chat.Success != 3 || chat.Failed != 1 {
+		t.Fatalf("chat/completions统计 = %+v", chat)
+	}
+	embeddings, err := GetEndpointStats("/v1/embeddings", "")
+	if err != nil {
+		t.Fatalf("GetEndpointStats() = %v", err)
+	}
+	if embeddings.Total != 2 || embeddings.Success != 2 || embeddings.Failed != 0 {
+		t.Fatalf("embeddings统计 = %+v", embeddings)
+	}
+	if images, _ := GetEndpointStats("/v1/images/generations", today); images != (DailyRequestStats{}) {
+		t.Fatalf("未记录的接口统计 = %+v, want 零值", images)
+	}
+
+	day, _, err := GetDailyStats(today)
+	if err != nil {
+		t.Fatalf("GetDailyStats() = %v", err)
+	}
+	var sum DailyRequestStats
+	for _, s := range day.Endpoints {
+		sum.Total += s.Total
+		sum.Success += s.Success
+		sum.Failed += s.Failed
+	}
+	if sum.Total != day.Requests.Total || sum.Success != day.Requests.Success || sum.Failed != day.Requests.Failed {
+		t.Fatalf("各接口统计之和 = %+v, 当日统计 = %+v", sum, day.Requests)
+	}
+}
+
+func TestEndpointStatsRequiresEndpoint(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 10, 5, true)
+
+	if _, err := GetEndpointStats("", ""); err == nil {
+		t.Fatal("接口路径为空时应返回错误")
+	}
+	day, _, _ := GetDailyStats(time.Now().Format("2006-01-02"))
+	if len(day.Endpoints) != 0 {
+		t.Fatalf("未传接口路径时不应按接口统计: %+v", day.Endpoints)
+	}
+}
@@ -0,0 +1,248 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/6 14:10:00
+  @desc: 每日统计数据按部署环境隔离存储
+**/
+
+package config
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/logger"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultStatsEnvironment 默认统计环境，旧版本文件中的数据迁移到该环境下
+	DefaultStatsEnvironment = "default"
+	// dailyDataFileVersion 按环境存储的统计文件版本
+	dailyDataFileVersion = "1.1"
+)
+
+// statsEnvironment 当前统计环境，受dailyDataLock保护
+var statsEnvironment = DefaultStatsEnvironment
+
+// EnvironmentStats 单个环境的统计数据
+type EnvironmentStats struct {
+	DailyStats       []DailyStats                   `json:"daily_stats"`
+	KeysUsage        map[string]map[string]KeyUsage `json:"keys_usage"`
+	VirtualKeysUsage map[string]map[string]KeyUsage `json:"virtual_keys_usage,omitempty"`
+}
+
+// dailyDataFile 统计文件的磁盘格式
+// 旧版本文件只有顶层的daily_stats/keys_usage，加载时迁移到默认环境
+type dailyDataFile struct {
+	Version      string                         `json:"version"`
+	Description  string                         `json:"description"`
+	LastUpdated  string                         `json:"last_updated"`
+	Environments map[string]*EnvironmentStats   `json:"environments,omitempty"`
+	DailyStats   []DailyStats                   `json:"daily_stats,omitempty"`
+	KeysUsage    map[string]map[string]KeyUsage `json:"keys_usage,omitempty"`
+}
+
+// normalizeStatsEnvironment 规范化环境名称，空值视为默认环境
+func normalizeStatsEnvironment(env string) string {
+	env = strings.TrimSpace(env)
+	if env == "" {
+		return DefaultStatsEnvironment
+	}
+	return env
+}
+
+// GetStatsEnvironment 获取当前统计环境
+func GetStatsEnvironment() string {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+	return statsEnvironment
+}
+
+// SetStatsEnvironment 切换当前统计环境
+// 当前环境的数据会被保留在文件中，新环境已有的数据会被加载为当前数据
+func SetStatsEnvironment(env string) error {
+	env = normalizeStatsEnvironment(env)
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if env == statsEnvironment {
+		return nil
+	}
+
+	if dailyData != nil {
+		if dailyData.Environments == nil {
+			dailyData.Environments = make(map[string]*EnvironmentStats)
+		}
+
+		// 将当前环境的数据移入环境表
+		dailyData.Environments[statsEnvironment] = &EnvironmentStats{
+			DailyStats:       dailyData.DailyStats,
+			KeysUsage:        dailyData.KeysUsage,
+			VirtualKeysUsage: dailyData.VirtualKeysUsage,
+		}
+
+		// 取出新环境的数据
+		if envStats, ok := dailyData.Environments[env]; ok && envStats != nil {
+			dailyData.DailyStats = envStats.DailyStats
+			dailyData.KeysUsage = envStats.KeysUsage
+			dailyData.VirtualKeysUsage = envStats.VirtualKeysUsage
+		} else {
+			dailyData.DailyStats = nil
+			dailyData.KeysUsage = nil
+			dailyData.VirtualKeysUsage = nil
+		}
+		delete(dailyData.Environments, env)
+		if dailyData.KeysUsage == nil {
+			dailyData.KeysUsage = make(map[string]map[string]KeyUsage)
+		}
+	}
+
+	logger.Info("统计环境已从 %s 切换到 %s", statsEnvironment, env)
+	statsEnvironment = env
+
+	if dailyData != nil {
+		ensureTodayDataExistsLocked()
+		if err := saveDailyDataLocked(); err != nil {
+			logger.Error("切换统计环境后保存数据失败: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// ListStatsEnvironments 列出所有有数据的统计环境
+func ListStatsEnvironments() []string {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	envs := []string{statsEnvironment}
+	if dailyData != nil {
+		for env := range dailyData.Environments {
+			if env != statsEnvironment {
+				envs = append(envs, env)
+			}
+		}
+	}
+	sort.Strings(envs)
+	return envs
+}
+
+// GetDailyStatsInEnvironment 获取指定环境、指定日期的统计数据，env为空时使用当前环境
+func GetDailyStatsInEnvironment(env, date string) (*DailyStats, bool, error) {
+	env = normalizeStatsEnvironment(env)
+	if env == GetStatsEnvironment() {
+		return GetDailyStats(date)
+	}
+
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		empty := newDailyStats(date)
+		return &empty, false, ErrStatsNotInitialized
+	}
+
+	if envStats, ok := dailyData.Environments[env]; ok && envStats != nil {
+		for _, stats := range envStats.DailyStats {
+			if stats.Date == date {
+				statsCopy := copyDailyStats(stats)
+				return &statsCopy, true, nil
+			}
+		}
+	}
+
+	empty := newDailyStats(date)
+	return &empty, false, nil
+}
+
+// decodeDailyData 解析统计文件，取出指定环境的数据作为当前数据
+func decodeDailyData(data []byte, env string) (*DailyData, error) {
+	var file dailyDataFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	environments := file.Environments
+	if environments == nil {
+		environments = make(map[string]*EnvironmentStats)
+	}
+
+	// 旧版本文件：顶层数据迁移到默认环境
+	if file.DailyStats != nil || file.KeysUsage != nil {
+		if _, exists := environments[DefaultStatsEnvironment]; !exists {
+			environments[DefaultStatsEnvironment] = &EnvironmentStats{
+				DailyStats: file.DailyStats,
+				KeysUsage:  file.KeysUsage,
+			}
+			logger.Info("已将旧版本统计数据迁移到 %s 环境", DefaultStatsEnvironment)
+		}
+	}
+
+	for _, envStats := range environments {
+		if envStats != nil {
+			normalizeDailyStatsList(envStats.DailyStats)
+		}
+	}
+
+	loaded := &DailyData{
+		Version:     file.Version,
+		Description: file.Description,
+		LastUpdated: file.LastUpdated,
+	}
+	if current, ok := environments[env]; ok && current != nil {
+		loaded.DailyStats = current.DailyStats
+		loaded.KeysUsage = current.KeysUsage
+		loaded.VirtualKeysUsage = current.VirtualKeysUsage
+	}
+	if loaded.KeysUsage == nil {
+		loaded.KeysUsage = make(map[string]map[string]KeyUsage)
+	}
+	delete(environments, env)
+	loaded.Environments = environments
+
+	return loaded, nil
+}
+
+// encodeDailyDataLocked 将所有环境的统计数据序列化为磁盘格式（已加锁）
+func encodeDailyDataLocked() ([]byte, error) {
+	compact := getStatsConfig().CompactHourly
+
+	environments := make(map[string]*EnvironmentStats, len(dailyData.Environments)+1)
+	for env, envStats := range dailyData.Environments {
+		environments[env] = envStats
+	}
+	environments[statsEnvironment] = &EnvironmentStats{
+		DailyStats:       dailyData.DailyStats,
+		KeysUsage:        dailyData.KeysUsage,
+		VirtualKeysUsage: dailyData.VirtualKeysUsage,
+	}
+
+	stored := make(map[string]*storedEnvironmentStats, len(environments))
+	for env, envStats := range environments {
+		if envStats == nil {
+			continue
+		}
+		statsList := limitSerializedModels(envStats.DailyStats)
+		if compact {
+			statsList = compactDailyStatsList(statsList)
+		}
+		stored[env] = &storedEnvironmentStats{
+			DailyStats:       newStoredDailyStatsList(statsList),
+			KeysUsage:        envStats.KeysUsage,
+			VirtualKeysUsage: envStats.VirtualKeysUsage,
+		}
+	}
+
+	dailyData.Version = dailyDataFileVersion
+	return marshalStatsJSON(storedDailyDataFile{
+		Version:      dailyData.Version,
+		Description:  dailyData.Description,
+		LastUpdated:  dailyData.LastUpdated,
+		Environments: stored,
+	})
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStatsEnvironmentsAreIsolated(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	today := time.Now().Format("2006-01-02")
+
+	// 与启动流程相同：先设置环境再加载统计数据
+	if err := SetStatsEnvironment("staging"); err != nil {
+		t.Fatalf("SetStatsEnvironment() = %v", err)
+	}
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-staging", "model-a", "", "", 1, 10, 5, true)
+
+	if err := SetStatsEnvironment("prod"); err != nil {
+		t.Fatalf("SetStatsEnvironment() = %v", err)
+	}
+	AddDailyRequestStat("sk-prod", "model-b", "", "", 2, 20, 10, true)
+	if err := FlushDailyStats(); err != nil {
+		t.Fatalf("FlushDailyStats() = %v", err)
+	}
+
+	prod, _, err := GetDailyStats(today)
+	if err != nil || prod.Requests.Total != 2 || prod.Tokens.Total != 30 {
+		t.Fatalf("prod环境统计 = %+v, %v", prod.Requests, err)
+	}
+	if _, ok := prod.Models["model-a"]; ok {
+		t.Fatal("prod环境不应包含staging环境的模型")
+	}
+	staging, found, err := GetDailyStatsInEnvironment("staging", today)
+	if err != nil || !found || staging.Requests.Total != 1 || staging.Tokens.Total != 15 {
+		t.Fatalf("staging环境统计 = %+v, %v, %v", staging.Requests, found, err)
+	}
+
+	// 重新启动时先设置环境，加载的是该环境的数据
+	dailyDataLock.Lock()
+	dailyData = nil
+	statsEnvironment = DefaultStatsEnvironment
+	dailyDataLock.Unlock()
+	if err := SetStatsEnvironment("staging"); err != nil {
+		t.Fatalf("SetStatsEnvironment() = %v", err)
+	}
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	reloaded, _, _ := GetDailyStats(today)
+	if reloaded.Requests.Total != 1 {
+		t.Fatalf("重新加载后staging环境请求数 = %d, want 1", reloaded.Requests.Total)
+	}
+	envs := ListStatsEnvironments()
+	if len(envs) != 2 || envs[0] != "prod" || envs[1] != "staging" {
+		t.Fatalf("ListStatsEnvironments() = %v", envs)
+	}
+}
+
+func TestLegacyStatsFileMigratesToDefaultEnvironment(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{})
+	legacy := `{"version":"1.0","daily_stats":[{"date":"2025-01-02","requests":{"total":4}}],"keys_usage":{}}`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetStatsEnvironment("prod"); err != nil {
+		t.Fatalf("SetStatsEnvironment() = %v", err)
+	}
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	if _, found, _ := GetDailyStats("2025-01-02"); found {
+		t.Fatal("旧版本数据不应出现在prod环境")
+	}
+	stats, found, err := GetDailyStatsInEnvironment(DefaultStatsEnvironment, "2025-01-02")
+	if err != nil || !found || stats.Requests.Total != 4 {
+		t.Fatalf("default环境统计 = %+v, %v, %v", stats.Requests, found, err)
+	}
+}
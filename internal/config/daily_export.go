@@ -0,0 +1,102 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 14:10:00
+  @desc: 导出匿名化的统计数据，用于分享流量特征
+**/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// anonymizedExport 匿名化导出的文件格式
+type anonymizedExport struct {
+	Version    string       `json:"version"`
+	ExportedAt string       `json:"exported_at"`
+	DailyStats []DailyStats `json:"daily_stats"`
+}
+
+// ExportAnonymized 导出匿名化的统计数据
+// 模型名替换为 model_1、model_2 等化名，移除密钥使用统计，数值和小时分布保持不变
+func ExportAnonymized() ([]byte, error) {
+	data, _, err := ExportAnonymizedWithMapping()
+	return data, err
+}
+
+// ExportAnonymizedWithMapping 导出匿名化的统计数据，同时返回化名到原模型名的映射，便于本地还原
+// 化名按模型名排序分配，同一份数据多次导出结果一致
+func ExportAnonymizedWithMapping() ([]byte, map[string]string, error) {
+	dailyDataLock.RLock()
+	if dailyData == nil {
+		dailyDataLock.RUnlock()
+		return nil, nil, ErrStatsNotInitialized
+	}
+	statsList := make([]DailyStats, len(dailyData.DailyStats))
+	for i, stats := range dailyData.DailyStats {
+		statsList[i] = copyDailyStats(stats)
+	}
+	dailyDataLock.RUnlock()
+
+	// 收集所有模型名并分配化名
+	nameSet := make(map[string]bool)
+	for _, stats := range statsList {
+		for name := range stats.Models {
+			nameSet[name] = true
+		}
+		for _, h := range stats.Hourly {
+			for name := range h.Models {
+				nameSet[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(nameSet))
+	for name := range nameSet {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pseudonyms := make(map[string]string, len(names))
+	mapping := make(map[string]string, len(names))
+	for i, name := range names {
+		alias := fmt.Sprintf("model_%d", i+1)
+		pseudonyms[name] = alias
+		mapping[alias] = name
+	}
+
+	for i := range statsList {
+		models := make(map[string]ModelStats, len(statsList[i].Models))
+		for name, ms := range statsList[i].Models {
+			models[pseudonyms[name]] = ms
+		}
+		statsList[i].Models = models
+		for h := range statsList[i].Hourly {
+			if statsList[i].Hourly[h].Models == nil {
+				continue
+			}
+			hourlyModels := make(map[string]HourlyModelStats, len(statsList[i].Hourly[h].Models))
+			for name, ms := range statsList[i].Hourly[h].Models {
+				hourlyModels[pseudonyms[name]] = ms
+			}
+			statsList[i].Hourly[h].Models = hourlyModels
+		}
+		// 按密钥的尝试统计包含密钥前缀，一并移除
+		statsList[i].Attempts.ByKey = nil
+	}
+
+	sort.Slice(statsList, func(i, j int) bool {
+		return statsList[i].Date < statsList[j].Date
+	})
+
+	data, err := marshalStatsJSON(anonymizedExport{
+		Version:    dailyDataFileVersion,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		DailyStats: statsList,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, mapping, nil
+}
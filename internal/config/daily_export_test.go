@@ -0,0 +1,58 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExportAnonymized(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, `{"version":"1.0","daily_stats":[{
+		"date": "2025-01-02",
+		"requests": {"total": 9, "success": 8, "failed": 1},
+		"tokens": {"total": 1234576901, "prompt": 1234568000, "completion": 8901},
+		"models": {
+			"secret-model-beta": {"requests": 4, "tokens": 8901, "success": 3, "failed": 1},
+			"secret-model-alpha": {"requests": 5, "tokens": 1234568000, "success": 5}
+		},
+		"hourly": [{"hour": 7, "requests": 9, "tokens": 1234576901,
+			"models": {"secret-model-alpha": {"requests": 5, "tokens": 1234568000}}}]
+	}],"keys_usage":{}}`)
+
+	data, mapping, err := ExportAnonymizedWithMapping()
+	if err != nil {
+		t.Fatalf("ExportAnonymizedWithMapping() = %v", err)
+	}
+	if strings.Contains(string(data), "secret-model") {
+		t.Fatalf("导出数据中不应出现原模型名:\n%s", data)
+	}
+	if mapping["model_1"] != "secret-model-alpha" || mapping["model_2"] != "secret-model-beta" {
+		t.Fatalf("化名映射 = %v", mapping)
+	}
+
+	var export anonymizedExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		t.Fatalf("解析导出数据失败: %v", err)
+	}
+	var day *DailyStats
+	for i := range export.DailyStats {
+		if export.DailyStats[i].Date == "2025-01-02" {
+			day = &export.DailyStats[i]
+		}
+	}
+	if day == nil {
+		t.Fatalf("导出数据中缺少2025-01-02: %s", data)
+	}
+	if day.Requests.Total != 9 || day.Tokens.Total != 1234576901 || day.Tokens.Completion != 8901 {
+		t.Fatalf("导出的汇总统计 = %+v, %+v", day.Requests, day.Tokens)
+	}
+	if m := day.Models["model_1"]; m.Requests != 5 || m.Tokens != 1234568000 {
+		t.Fatalf("model_1的统计 = %+v", m)
+	}
+	if m := day.Models["model_2"]; m.Requests != 4 || m.Failed != 1 {
+		t.Fatalf("model_2的统计 = %+v", m)
+	}
+	if h := day.Hourly[7]; h.Requests != 9 || h.Models["model_1"].Tokens != 1234568000 {
+		t.Fatalf("第7小时的统计 = %+v", h)
+	}
+}
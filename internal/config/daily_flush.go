@@ -0,0 +1,168 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/6 16:40:00
+  @desc: 每日统计数据的定期保存与退出前同步保存
+**/
+
+package config
+
+import (
+	"errors"
+	"flowsilicon/internal/logger"
+	"sync"
+	"time"
+)
+
+const (
+	// dailyFlushInterval 定期检查并保存统计数据的间隔
+	dailyFlushInterval = 30 * time.Second
+	// dailyFlushTimeout 退出前同步保存的最长等待时间，避免阻塞退出
+	dailyFlushTimeout = 5 * time.Second
+	// dailySaveDebounce 记录请求后延迟保存的时间，期间的新记录会合并为一次保存
+	dailySaveDebounce = 2 * time.Second
+)
+
+var (
+	// dailyFlusherOnce 保证定期保存协程只启动一次
+	dailyFlusherOnce sync.Once
+	// dailySaveTimer 防抖保存定时器，受dailyDataLock保护
+	dailySaveTimer *time.Timer
+	// dailySaveScheduled 配置了保存间隔时定时器是否已安排保存，受dailyDataLock保护
+	dailySaveScheduled bool
+	// dailyLastSave 最近一次成功保存统计文件的时间，受dailyDataLock保护
+	dailyLastSave time.Time
+)
+
+// statsFlushInterval 获取两次保存统计文件的最短间隔，未配置时为0
+func statsFlushInterval() time.Duration {
+	if seconds := getStatsConfig().FlushIntervalSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+// scheduleDailySaveLocked 安排保存统计数据（已加锁）
+// 累计请求记录数达到FlushEveryNRequests时立即保存，统计文件正被其他实例读写时改为防抖保存；
+// 配置了FlushIntervalSeconds时距上次保存满间隔后保存，期间的记录合并为一次写入；否则在dailySaveDebounce后保存
+// 持续有请求时防抖定时器会不断推迟，由定期保存协程保证最长保存间隔
+func scheduleDailySaveLocked() {
+	if n := getStatsConfig().FlushEveryNRequests; n > 0 && dailyPending >= n {
+		if dailySaveTimer != nil {
+			dailySaveTimer.Stop()
+		}
+		dailySaveScheduled = false
+		// 在请求处理中持有统计锁，不等待其他实例释放读写锁，被占用时改由防抖定时器稍后保存
+		prevErr := lastSaveErr
+		err := writeDailyDataLocked(0)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, errFileLocked) {
+			logger.Error("保存每日统计数据失败: %v", err)
+			return
+		}
+		lastSaveErr = prevErr
+	}
+
+	delay := dailySaveDebounce
+	if interval := statsFlushInterval(); interval > 0 {
+		// 已安排的保存不推迟，保证最多每个间隔写入一次且不会因持续请求而一直不保存
+		if dailySaveScheduled {
+			return
+		}
+		delay = interval - time.Since(dailyLastSave)
+		if delay < 0 {
+			delay = 0
+		}
+		dailySaveScheduled = true
+	}
+
+	if dailySaveTimer == nil {
+		dailySaveTimer = time.AfterFunc(delay, func() {
+			if err := flushScheduledDailyStats(); err != nil {
+				logger.Error("保存每日统计数据失败: %v", err)
+			}
+		})
+		return
+	}
+	dailySaveTimer.Reset(delay)
+}
+
+// flushScheduledDailyStats 防抖定时器到期时保存统计数据
+// 统计文件正被其他实例读写时不持有统计锁等待，在dailySaveDebounce后重试
+func flushScheduledDailyStats() error {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	dailySaveScheduled = false
+	if !dailyDirty {
+		return nil
+	}
+	prevErr := lastSaveErr
+	err := writeDailyDataLocked(0)
+	if errors.Is(err, errFileLocked) {
+		lastSaveErr = prevErr
+		dailySaveTimer.Reset(dailySaveDebounce)
+		return nil
+	}
+	return err
+}
+
+// startDailyFlusher 启动定期保存协程，有未保存的变更时写入文件
+func startDailyFlusher() {
+	dailyFlusherOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(dailyFlushInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if err := flushDailyStatsIfDue(); err != nil {
+					logger.Error("定期保存每日统计数据失败: %v", err)
+				}
+			}
+		}()
+	})
+}
+
+// flushDailyStatsIfDirty 有未保存的变更时保存统计数据
+func flushDailyStatsIfDirty() error {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if !dailyDirty {
+		return nil
+	}
+	return saveDailyDataLocked()
+}
+
+// flushDailyStatsIfDue 有未保存的变更且距上次保存已满FlushIntervalSeconds时保存统计数据
+func flushDailyStatsIfDue() error {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if !dailyDirty || time.Since(dailyLastSave) < statsFlushInterval() {
+		return nil
+	}
+	return saveDailyDataLocked()
+}
+
+// FlushDailyStats 同步保存每日统计数据，用于程序退出前
+// 最多等待dailyFlushTimeout，超时后返回错误，不会无限阻塞退出流程
+func FlushDailyStats() error {
+	done := make(chan error, 1)
+	go func() {
+		// 先写入异步队列中尚未处理的记录
+		drainDailyRequestQueue()
+		done <- flushDailyStatsIfDirty()
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			logger.Info("每日统计数据已保存")
+		}
+		return err
+	case <-time.After(dailyFlushTimeout):
+		return errors.New("保存每日统计数据超时")
+	}
+}
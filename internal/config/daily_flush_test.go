@@ -0,0 +1,44 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+// countDailySaves 统计保存统计文件的次数，返回读取次数的函数
+func countDailySaves(t *testing.T) func() int {
+	t.Helper()
+	saves := 0
+	writeDailyFile = func(path string, data []byte, perm os.FileMode) error {
+		saves++
+		return writeFileWithBackup(path, data, perm)
+	}
+	t.Cleanup(func() { writeDailyFile = writeFileWithBackup })
+	return func() int {
+		dailyDataLock.RLock()
+		defer dailyDataLock.RUnlock()
+		return saves
+	}
+}
+
+func TestFlushEveryNRequests(t *testing.T) {
+	// 保存间隔很长，只有达到请求数时才会保存
+	resetDailyStatsForTest(t, StatsConfig{FlushEveryNRequests: 3, FlushIntervalSeconds: 3600})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	saves := countDailySaves(t)
+
+	for round := 1; round <= 2; round++ {
+		for i := 1; i <= 3; i++ {
+			AddDailyRequestStat("sk-test", "model-a", "", "", 1, 10, 5, true)
+			want := round - 1
+			if i == 3 {
+				want = round
+			}
+			if got := saves(); got != want {
+				t.Fatalf("第%d轮第%d次记录后保存次数 = %d, want %d", round, i, got, want)
+			}
+		}
+	}
+}
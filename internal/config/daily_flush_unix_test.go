@@ -0,0 +1,132 @@
+//go:build !windows
+// +build !windows
+
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	// harnessFileEnv 子进程使用的统计文件路径，设置后TestDailyStatsHarnessProcess才会运行
+	harnessFileEnv = "FLOWSILICON_TEST_HARNESS_FILE"
+	// harnessFlushEnv 子进程的stats.flush_every_n_requests
+	harnessFlushEnv = "FLOWSILICON_TEST_HARNESS_FLUSH_EVERY"
+	// harnessRequests 子进程记录的请求数
+	harnessRequests = 25
+	// harnessReady 子进程记录完请求后输出的标记
+	harnessReady = "harness-ready"
+)
+
+// TestDailyStatsHarnessProcess 子进程入口：记录请求后等待信号，收到SIGTERM时按退出流程保存统计数据
+func TestDailyStatsHarnessProcess(t *testing.T) {
+	path := os.Getenv(harnessFileEnv)
+	if path == "" {
+		t.Skip("只在统计数据子进程中运行")
+	}
+	flushEvery, _ := strconv.Atoi(os.Getenv(harnessFlushEnv))
+	UpdateConfig(&Config{Stats: StatsConfig{FlushEveryNRequests: flushEvery}})
+	SetDailyFilePath(path)
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	for i := 0; i < harnessRequests; i++ {
+		AddDailyRequestStat("sk-harness", "model-a", "", "", 1, 10, 5, true)
+	}
+	fmt.Println(harnessReady)
+
+	<-signals
+	if err := FlushDailyStats(); err != nil {
+		t.Fatalf("FlushDailyStats() = %v", err)
+	}
+	os.Exit(0)
+}
+
+// runStatsHarness 启动记录请求的子进程，记录完成后发送sig结束子进程
+func runStatsHarness(t *testing.T, path string, flushEvery int, sig os.Signal) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDailyStatsHarnessProcess$")
+	cmd.Env = append(os.Environ(),
+		harnessFileEnv+"="+path,
+		harnessFlushEnv+"="+strconv.Itoa(flushEvery))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("启动子进程失败: %v", err)
+	}
+
+	ready := make(chan bool, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if strings.TrimSpace(scanner.Text()) == harnessReady {
+				ready <- true
+				return
+			}
+		}
+		ready <- false
+	}()
+	select {
+	case ok := <-ready:
+		if !ok {
+			cmd.Wait()
+			t.Fatal("子进程未记录完请求就退出")
+		}
+	case <-time.After(30 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("等待子进程记录请求超时")
+	}
+
+	if err := cmd.Process.Signal(sig); err != nil {
+		t.Fatalf("结束子进程失败: %v", err)
+	}
+	cmd.Wait()
+}
+
+// assertHarnessRequestsSaved 模拟重新启动，加载统计文件并检查子进程记录的请求都已保存
+func assertHarnessRequestsSaved(t *testing.T) {
+	t.Helper()
+	dailyDataLock.Lock()
+	dailyData = nil
+	dailyDataLock.Unlock()
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	stats, _, err := GetDailyStats(time.Now().Format("2006-01-02"))
+	if err != nil {
+		t.Fatalf("GetDailyStats() = %v", err)
+	}
+	if stats.Requests.Total != harnessRequests || stats.Tokens.Total != harnessRequests*15 {
+		t.Fatalf("重新启动后的统计 = %+v, %+v, want %d个请求", stats.Requests, stats.Tokens, harnessRequests)
+	}
+}
+
+func TestShutdownFlushKeepsAllRequests(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{})
+
+	// 正常退出：收到SIGTERM后同步保存
+	runStatsHarness(t, path, 0, syscall.SIGTERM)
+	assertHarnessRequestsSaved(t)
+}
+
+func TestKilledProcessKeepsFlushedRequests(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{})
+
+	// 强制结束：每条记录都保存时，进程被杀死也不会丢失已记录的请求
+	runStatsHarness(t, path, 1, syscall.SIGKILL)
+	assertHarnessRequestsSaved(t)
+}
@@ -0,0 +1,155 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/6 20:30:00
+  @desc: 按天和小时组织的请求热力图数据
+**/
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// HeatmapMetricRequests 按请求数着色
+	HeatmapMetricRequests = "requests"
+	// HeatmapMetricTokens 按令牌数着色
+	HeatmapMetricTokens = "tokens"
+
+	// maxHeatmapDays 热力图最多包含的天数
+	maxHeatmapDays = 366
+)
+
+// HourlyHeatmap 热力图数据，Values[i][h] 为 Days[i] 当天第h小时的数值
+type HourlyHeatmap struct {
+	Metric        string    `json:"metric"`
+	Model         string    `json:"model,omitempty"`
+	ModelFiltered bool      `json:"model_filtered"` // 是否按模型过滤，未开启按模型小时统计且没有相应数据时为false并回退到总量
+	Days          []string  `json:"days"`
+	Values        [][24]int `json:"values"`
+	Max           int       `json:"max"`
+}
+
+// GetHourlyHeatmap 获取最近days天（含今天）每小时的请求数或令牌数矩阵
+// 缺失的天和小时以0填充，仅在持有读锁期间复制数据
+func GetHourlyHeatmap(days int, metric, model string) (*HourlyHeatmap, error) {
+	if days <= 0 {
+		return nil, fmt.Errorf("天数必须大于0")
+	}
+	if days > maxHeatmapDays {
+		days = maxHeatmapDays
+	}
+	if metric == "" {
+		metric = HeatmapMetricRequests
+	}
+	if metric != HeatmapMetricRequests && metric != HeatmapMetricTokens {
+		return nil, fmt.Errorf("不支持的指标: %s", metric)
+	}
+
+	heatmap := &HourlyHeatmap{
+		Metric: metric,
+		Model:  model,
+		Days:   make([]string, days),
+		Values: make([][24]int, days),
+	}
+
+	now := time.Now()
+	index := make(map[string]int, days)
+	for i := 0; i < days; i++ {
+		date := now.AddDate(0, 0, i-days+1).Format("2006-01-02")
+		heatmap.Days[i] = date
+		index[date] = i
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return heatmap, ErrStatsNotInitialized
+	}
+
+	// 开启了按模型小时统计，或范围内已有按模型的数据时按模型过滤
+	if model != "" {
+		heatmap.ModelFiltered = getStatsConfig().HourlyByModel
+		for _, stats := range dailyData.DailyStats {
+			if _, ok := index[stats.Date]; ok && hasHourlyModels(stats.Hourly) {
+				heatmap.ModelFiltered = true
+				break
+			}
+		}
+	}
+
+	for _, stats := range dailyData.DailyStats {
+		i, ok := index[stats.Date]
+		if !ok {
+			continue
+		}
+		for _, h := range stats.Hourly {
+			if h.Hour < 0 || h.Hour >= 24 {
+				continue
+			}
+			requests, tokens := h.Requests, h.Tokens
+			if heatmap.ModelFiltered {
+				ms := h.Models[model]
+				requests, tokens = ms.Requests, ms.Tokens
+			}
+			value := requests
+			if metric == HeatmapMetricTokens {
+				value = tokens
+			}
+			heatmap.Values[i][h.Hour] += value
+			if heatmap.Values[i][h.Hour] > heatmap.Max {
+				heatmap.Max = heatmap.Values[i][h.Hour]
+			}
+		}
+	}
+
+	return heatmap, nil
+}
+
+// hasHourlyModels 小时统计中是否包含按模型的数据
+func hasHourlyModels(hourly []HourlyStats) bool {
+	for _, h := range hourly {
+		if len(h.Models) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GetModelHourly 获取指定日期某个模型的24小时统计
+// 第二个返回值表示是否有按模型的小时数据（开启 stats.hourly_by_model 后才会记录）
+func GetModelHourly(date, model string) ([]HourlyStats, bool, error) {
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	result := newHourlyStats()
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return result, false, ErrStatsNotInitialized
+	}
+
+	filtered := getStatsConfig().HourlyByModel
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date != date {
+			continue
+		}
+		if hasHourlyModels(stats.Hourly) {
+			filtered = true
+		}
+		for _, h := range stats.Hourly {
+			if h.Hour < 0 || h.Hour >= 24 {
+				continue
+			}
+			ms := h.Models[model]
+			result[h.Hour].Requests += ms.Requests
+			result[h.Hour].Tokens += ms.Tokens
+		}
+	}
+	return result, filtered, nil
+}
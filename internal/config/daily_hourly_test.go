@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadNormalizesMalformedHourly(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		requests map[int]int // 按小时的请求数，未列出的小时为0
+	}{
+		{"hourly_short.json", map[int]int{0: 1, 1: 2}},
+		{"hourly_empty.json", map[int]int{}},
+		// 重复的小时合并，超出范围的小时丢弃
+		{"hourly_unordered.json", map[int]int{0: 1, 5: 2, 23: 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join(testdataDir, tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			seedDailyStatsForTest(t, StatsConfig{}, string(content))
+
+			stats, found, err := GetDailyStats("2025-01-02")
+			if err != nil || !found {
+				t.Fatalf("GetDailyStats() = %v, %v", found, err)
+			}
+			if len(stats.Hourly) != 24 {
+				t.Fatalf("Hourly长度 = %d, want 24", len(stats.Hourly))
+			}
+			for i, h := range stats.Hourly {
+				if h.Hour != i {
+					t.Fatalf("Hourly[%d].Hour = %d", i, h.Hour)
+				}
+				if h.Requests != tt.requests[i] {
+					t.Fatalf("第%d小时请求数 = %d, want %d", i, h.Requests, tt.requests[i])
+				}
+				if h.Requests > 0 && h.PromptTokens != h.Tokens {
+					t.Fatalf("旧版本令牌数应计入提示词令牌: %+v", h)
+				}
+			}
+		})
+	}
+}
+
+func TestHourlyRollupBeyondRetention(t *testing.T) {
+	path := seedDailyStatsForTest(t, StatsConfig{HourlyRetentionDays: 2}, fmt.Sprintf(`{"version":"1.0","daily_stats":[
+		{"date": %q, "requests": {"total": 5, "success": 5}, "tokens": {"total": 50}, "hourly": [{"hour": 3, "requests": 5, "tokens": 50}]},
+		{"date": %q, "requests": {"total": 2, "success": 2}, "tokens": {"total": 20}, "hourly": [{"hour": 8, "requests": 2, "tokens": 20}]}
+	],"keys_usage":{}}`, daysAgo(5), daysAgo(1)))
+
+	old := mustGetDailyStats(t, daysAgo(5))
+	if !old.HourlyRolledUp || len(old.Hourly) != 0 {
+		t.Fatalf("超过保留期的日期 HourlyRolledUp = %v, 小时数 = %d, want true, 0", old.HourlyRolledUp, len(old.Hourly))
+	}
+	if old.Requests.Total != 5 || old.Tokens.Total != 50 {
+		t.Fatalf("清除小时明细后应保留每日汇总: %+v, %+v", old.Requests, old.Tokens)
+	}
+	recent := mustGetDailyStats(t, daysAgo(1))
+	if recent.HourlyRolledUp || len(recent.Hourly) != 24 || recent.Hourly[8].Requests != 2 {
+		t.Fatalf("保留期内的日期不应清除小时明细: %+v", recent.Hourly)
+	}
+
+	// 清除结果写入文件后，重新加载不会补齐24小时
+	if err := FlushDailyStats(); err != nil {
+		t.Fatalf("FlushDailyStats() = %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), `"hourly_rolled_up"`) {
+		t.Fatalf("统计文件中应记录已清除小时明细: %v", err)
+	}
+	dailyDataLock.Lock()
+	dailyData = nil
+	dailyDataLock.Unlock()
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	if reloaded := mustGetDailyStats(t, daysAgo(5)); !reloaded.HourlyRolledUp || len(reloaded.Hourly) != 0 {
+		t.Fatalf("重新加载后的小时统计 = %+v, want 空", reloaded.Hourly)
+	}
+}
+
+func TestHourlyRollupDisabledByDefault(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, fmt.Sprintf(`{"version":"1.0","daily_stats":[
+		{"date": %q, "hourly": [{"hour": 3, "requests": 5}]}
+	],"keys_usage":{}}`, daysAgo(20)))
+
+	if stats := mustGetDailyStats(t, daysAgo(20)); stats.HourlyRolledUp || stats.Hourly[3].Requests != 5 {
+		t.Fatalf("未配置hourly_retention_days时不应清除小时明细: %+v", stats.Hourly)
+	}
+}
@@ -0,0 +1,87 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 23:50:00
+  @desc: 每日统计数据导出为InfluxDB行协议
+**/
+
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// influxDailyMeasurement 每日汇总的measurement名称
+	influxDailyMeasurement = "flowsilicon_daily"
+	// influxModelMeasurement 每日按模型统计的measurement名称
+	influxModelMeasurement = "flowsilicon_model"
+)
+
+// influxTagEscaper 转义tag值中的逗号、等号和空格
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// WriteInfluxLineProtocol 将[start, end]日期范围内的每日统计按InfluxDB行协议写入w，日期格式为YYYY-MM-DD
+// 每天输出一行flowsilicon_daily汇总和每个模型一行flowsilicon_model（带model标签），
+// 时间戳为当天本地时间0点的纳秒时间戳
+func WriteInfluxLineProtocol(w io.Writer, start, end string) error {
+	startTime, err := time.ParseInLocation("2006-01-02", start, time.Local)
+	if err != nil {
+		return fmt.Errorf("开始日期格式错误，应为YYYY-MM-DD: %s", start)
+	}
+	endTime, err := time.ParseInLocation("2006-01-02", end, time.Local)
+	if err != nil {
+		return fmt.Errorf("结束日期格式错误，应为YYYY-MM-DD: %s", end)
+	}
+	if endTime.Before(startTime) {
+		return fmt.Errorf("结束日期 %s 早于开始日期 %s", end, start)
+	}
+
+	dailyDataLock.RLock()
+	if dailyData == nil {
+		dailyDataLock.RUnlock()
+		return ErrStatsNotInitialized
+	}
+	var days []DailyStats
+	for _, stats := range dailyData.DailyStats {
+		// 日期格式固定，可直接按字符串比较
+		if stats.Date >= start && stats.Date <= end {
+			days = append(days, copyDailyStats(stats))
+		}
+	}
+	dailyDataLock.RUnlock()
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+
+	bw := bufio.NewWriter(w)
+	for _, stats := range days {
+		day, err := time.ParseInLocation("2006-01-02", stats.Date, time.Local)
+		if err != nil {
+			continue
+		}
+		ts := day.UnixNano()
+		date := influxTagEscaper.Replace(stats.Date)
+
+		fmt.Fprintf(bw, "%s,date=%s requests=%di,success=%di,failed=%di,tokens=%di,prompt_tokens=%di,completion_tokens=%di %d\n",
+			influxDailyMeasurement, date,
+			stats.Requests.Total, stats.Requests.Success, stats.Requests.Failed,
+			stats.Tokens.Total, stats.Tokens.Prompt, stats.Tokens.Completion, ts)
+
+		models := make([]string, 0, len(stats.Models))
+		for name := range stats.Models {
+			models = append(models, name)
+		}
+		sort.Strings(models)
+		for _, name := range models {
+			ms := stats.Models[name]
+			fmt.Fprintf(bw, "%s,date=%s,model=%s requests=%di,success=%di,failed=%di,tokens=%di %d\n",
+				influxModelMeasurement, date, influxTagEscaper.Replace(name),
+				ms.Requests, ms.Success, ms.Failed, ms.Tokens, ts)
+		}
+	}
+	return bw.Flush()
+}
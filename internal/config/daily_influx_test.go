@@ -0,0 +1,150 @@
+package config
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// influxPoint 解析后的一行行协议数据
+type influxPoint struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]int
+	timestamp   int64
+}
+
+// splitInfluxUnescaped 按未转义的分隔符拆分，并去除转义
+func splitInfluxUnescaped(s string, sep byte) []string {
+	var parts []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+		case s[i] == sep:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(parts, cur.String())
+}
+
+// parseInfluxLine 解析一行只包含整数字段的行协议
+func parseInfluxLine(t *testing.T, line string) influxPoint {
+	t.Helper()
+	// 转义的空格只出现在tag中，先按未转义的空格拆为三段
+	var sections []string
+	start := 0
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == ' ' {
+			sections = append(sections, line[start:i])
+			start = i + 1
+		}
+	}
+	sections = append(sections, line[start:])
+	if len(sections) != 3 {
+		t.Fatalf("行协议应由3段组成: %q", line)
+	}
+
+	point := influxPoint{tags: make(map[string]string), fields: make(map[string]int)}
+	head := splitInfluxEscapedCommas(sections[0])
+	point.measurement = head[0]
+	for _, tag := range head[1:] {
+		kv := splitInfluxUnescaped(tag, '=')
+		if len(kv) != 2 {
+			t.Fatalf("tag格式错误: %q", tag)
+		}
+		point.tags[kv[0]] = kv[1]
+	}
+	for _, field := range strings.Split(sections[1], ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || !strings.HasSuffix(kv[1], "i") {
+			t.Fatalf("字段应为整数: %q", field)
+		}
+		value, err := strconv.Atoi(strings.TrimSuffix(kv[1], "i"))
+		if err != nil {
+			t.Fatalf("字段值错误: %q", field)
+		}
+		point.fields[kv[0]] = value
+	}
+	ts, err := strconv.ParseInt(sections[2], 10, 64)
+	if err != nil {
+		t.Fatalf("时间戳错误: %q", sections[2])
+	}
+	point.timestamp = ts
+	return point
+}
+
+// splitInfluxEscapedCommas 按未转义的逗号拆分，保留转义字符供后续解析tag
+func splitInfluxEscapedCommas(s string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == ',' {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func TestWriteInfluxLineProtocol(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, `{"version":"1.0","daily_stats":[
+		{"date": "2025-01-03", "requests": {"total": 1, "success": 1}, "tokens": {"total": 9, "prompt": 6, "completion": 3}},
+		{"date": "2025-01-02", "requests": {"total": 5, "success": 4, "failed": 1},
+			"tokens": {"total": 50, "prompt": 30, "completion": 20},
+			"models": {"org/model a,b=c": {"requests": 2, "success": 2, "tokens": 20}, "model-x": {"requests": 3, "success": 2, "failed": 1, "tokens": 30}}},
+		{"date": "2025-01-05", "requests": {"total": 7, "success": 7}}
+	],"keys_usage":{}}`)
+
+	var buf bytes.Buffer
+	if err := WriteInfluxLineProtocol(&buf, "2025-01-02", "2025-01-04"); err != nil {
+		t.Fatalf("WriteInfluxLineProtocol() = %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("输出行数 = %d, want 4:\n%s", len(lines), buf.String())
+	}
+
+	jan2, _ := time.ParseInLocation("2006-01-02", "2025-01-02", time.Local)
+	daily := parseInfluxLine(t, lines[0])
+	if daily.measurement != influxDailyMeasurement || daily.tags["date"] != "2025-01-02" || daily.timestamp != jan2.UnixNano() {
+		t.Fatalf("每日汇总行 = %+v", daily)
+	}
+	wantFields := map[string]int{"requests": 5, "success": 4, "failed": 1, "tokens": 50, "prompt_tokens": 30, "completion_tokens": 20}
+	for name, want := range wantFields {
+		if daily.fields[name] != want {
+			t.Fatalf("字段 %s = %d, want %d", name, daily.fields[name], want)
+		}
+	}
+
+	// 模型按名称排序，tag中的空格、逗号和等号已转义
+	first, second := parseInfluxLine(t, lines[1]), parseInfluxLine(t, lines[2])
+	if first.measurement != influxModelMeasurement || first.tags["model"] != "model-x" || first.fields["failed"] != 1 {
+		t.Fatalf("第一个模型行 = %+v", first)
+	}
+	if second.tags["model"] != "org/model a,b=c" || second.fields["tokens"] != 20 || second.timestamp != jan2.UnixNano() {
+		t.Fatalf("第二个模型行 = %+v", second)
+	}
+	if next := parseInfluxLine(t, lines[3]); next.tags["date"] != "2025-01-03" || next.fields["requests"] != 1 {
+		t.Fatalf("范围内的下一天 = %+v", next)
+	}
+
+	if err := WriteInfluxLineProtocol(&buf, "2025-01-04", "2025-01-02"); err == nil {
+		t.Fatal("结束日期早于开始日期时应返回错误")
+	}
+}
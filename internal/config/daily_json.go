@@ -0,0 +1,79 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 23:20:00
+  @desc: 统计文件中每日统计的JSON序列化，省略未使用的可选部分，减小统计文件并便于比较差异
+**/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// storedDailyStats 写入统计文件的每日统计，序列化时省略未使用的可选部分
+// 只用于统计文件，API响应等其他序列化仍输出完整的DailyStats
+type storedDailyStats DailyStats
+
+// storedEnvironmentStats 写入统计文件的单个环境的统计数据，与EnvironmentStats的格式相同
+type storedEnvironmentStats struct {
+	DailyStats       []storedDailyStats             `json:"daily_stats"`
+	KeysUsage        map[string]map[string]KeyUsage `json:"keys_usage"`
+	VirtualKeysUsage map[string]map[string]KeyUsage `json:"virtual_keys_usage,omitempty"`
+}
+
+// storedDailyDataFile 写入统计文件的格式，与dailyDataFile相同，加载时使用dailyDataFile
+type storedDailyDataFile struct {
+	Version      string                             `json:"version"`
+	Description  string                             `json:"description"`
+	LastUpdated  string                             `json:"last_updated"`
+	Environments map[string]*storedEnvironmentStats `json:"environments,omitempty"`
+}
+
+// newStoredDailyStatsList 转换为写入统计文件的每日统计列表
+func newStoredDailyStatsList(statsList []DailyStats) []storedDailyStats {
+	stored := make([]storedDailyStats, len(statsList))
+	for i, stats := range statsList {
+		stored[i] = storedDailyStats(stats)
+	}
+	return stored
+}
+
+// MarshalJSON 序列化每日统计，延迟、流式超时、客户端和上游尝试统计为零值时省略
+// 省略的部分在加载时为零值，与未使用这些功能时一致
+func (s storedDailyStats) MarshalJSON() ([]byte, error) {
+	// DailyStats没有MarshalJSON方法，嵌入后不会递归；外层同名字段优先于嵌入字段
+	out := struct {
+		DailyStats
+		TTFT           *TTFTStats          `json:"ttft,omitempty"`
+		TTFB           *TTFTStats          `json:"ttfb,omitempty"`
+		StreamTimeouts *StreamTimeoutStats `json:"stream_timeouts,omitempty"`
+		Client         *ClientRequestStats `json:"client,omitempty"`
+		Attempts       *AttemptStats       `json:"attempts,omitempty"`
+	}{DailyStats: DailyStats(s)}
+
+	if s.TTFT != (TTFTStats{}) {
+		out.TTFT = &s.TTFT
+	}
+	if s.TTFB != (TTFTStats{}) {
+		out.TTFB = &s.TTFB
+	}
+	if s.StreamTimeouts.FirstByte != 0 || s.StreamTimeouts.Idle != 0 || len(s.StreamTimeouts.ByKey) > 0 {
+		out.StreamTimeouts = &s.StreamTimeouts
+	}
+	if s.Client != (ClientRequestStats{}) {
+		out.Client = &s.Client
+	}
+	if s.Attempts.Total != 0 || len(s.Attempts.ByKey) > 0 || len(s.Attempts.ByErrorClass) > 0 {
+		out.Attempts = &s.Attempts
+	}
+
+	// 与marshalStatsJSON一致，不转义模型名中的HTML字符
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(out); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
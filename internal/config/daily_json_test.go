@@ -0,0 +1,193 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// optionalDailySections 未使用时在统计文件中省略的部分
+var optionalDailySections = []string{`"ttft"`, `"ttfb"`, `"stream_timeouts"`, `"client"`, `"attempts"`}
+
+func TestStoredDailyStatsOmitsEmptySections(t *testing.T) {
+	stats := newDailyStats("2025-01-02")
+
+	stored, err := json.Marshal(storedDailyStats(stats))
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	for _, section := range optionalDailySections {
+		if strings.Contains(string(stored), section) {
+			t.Fatalf("统计文件中不应包含未使用的 %s: %s", section, stored)
+		}
+	}
+
+	// API响应等其他序列化输出完整的结构
+	full, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	for _, section := range optionalDailySections {
+		if !strings.Contains(string(full), section) {
+			t.Fatalf("DailyStats的序列化应包含 %s: %s", section, full)
+		}
+	}
+
+	stats.TTFT.add(120)
+	stored, _ = json.Marshal(storedDailyStats(stats))
+	if !strings.Contains(string(stored), `"ttft"`) {
+		t.Fatalf("有数据的部分应写入统计文件: %s", stored)
+	}
+}
+
+func TestCompactStatsFileRoundTrip(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{CompactHourly: true})
+	today := time.Now().Format("2006-01-02")
+
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 10, 5, true)
+	if err := FlushDailyStats(); err != nil {
+		t.Fatalf("FlushDailyStats() = %v", err)
+	}
+	before, _, _ := GetDailyStats(today)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Environments map[string]struct {
+			DailyStats []map[string]json.RawMessage `json:"daily_stats"`
+		} `json:"environments"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("解析统计文件失败: %v", err)
+	}
+	days := file.Environments[DefaultStatsEnvironment].DailyStats
+	if len(days) != 1 {
+		t.Fatalf("统计文件中的天数 = %d, want 1", len(days))
+	}
+	for _, section := range optionalDailySections {
+		if _, ok := days[0][strings.Trim(section, `"`)]; ok {
+			t.Fatalf("统计文件中不应包含未使用的 %s", section)
+		}
+	}
+	if strings.Count(string(days[0]["hourly"]), `"hour"`) != 1 {
+		t.Fatalf("开启compact_hourly时只应写入有数据的小时: %s", days[0]["hourly"])
+	}
+
+	// 重新加载后恢复省略的部分和24小时统计
+	dailyDataLock.Lock()
+	dailyData = nil
+	dailyDataLock.Unlock()
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	after, found, err := GetDailyStats(today)
+	if err != nil || !found {
+		t.Fatalf("GetDailyStats() = %v, %v", found, err)
+	}
+	if len(after.Hourly) != 24 {
+		t.Fatalf("重新加载后小时统计数 = %d, want 24", len(after.Hourly))
+	}
+	if after.TTFT != (TTFTStats{}) || after.Client != (ClientRequestStats{}) || after.Attempts.Total != 0 {
+		t.Fatal("省略的部分重新加载后应为零值")
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("重新加载后的统计与保存前不一致:\n%+v\n%+v", before, after)
+	}
+}
+
+func TestCompactHourlyRoundTripThreeActiveHours(t *testing.T) {
+	path := seedDailyStatsForTest(t, StatsConfig{CompactHourly: true}, `{"version":"1.0","daily_stats":[{
+		"date": "2025-01-02",
+		"requests": {"total": 6, "success": 6},
+		"tokens": {"total": 60, "prompt": 40, "completion": 20},
+		"hourly": [
+			{"hour": 2, "requests": 1, "tokens": 10, "prompt_tokens": 6, "completion_tokens": 4},
+			{"hour": 9, "requests": 2, "tokens": 20, "prompt_tokens": 14, "completion_tokens": 6},
+			{"hour": 17, "requests": 3, "tokens": 30, "prompt_tokens": 20, "completion_tokens": 10}
+		]
+	}],"keys_usage":{}}`)
+	before, _, _ := GetDailyStats("2025-01-02")
+
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 10, 5, true)
+	if err := FlushDailyStats(); err != nil {
+		t.Fatalf("FlushDailyStats() = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Environments map[string]struct {
+			DailyStats []struct {
+				Date   string        `json:"date"`
+				Hourly []HourlyStats `json:"hourly"`
+			} `json:"daily_stats"`
+		} `json:"environments"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("解析统计文件失败: %v", err)
+	}
+	var saved []HourlyStats
+	for _, day := range file.Environments[DefaultStatsEnvironment].DailyStats {
+		if day.Date == "2025-01-02" {
+			saved = day.Hourly
+		}
+	}
+	if len(saved) != 3 || saved[0].Hour != 2 || saved[1].Hour != 9 || saved[2].Hour != 17 {
+		t.Fatalf("统计文件中的小时统计 = %+v, want 只有2、9、17时", saved)
+	}
+
+	dailyDataLock.Lock()
+	dailyData = nil
+	dailyDataLock.Unlock()
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	after, _, _ := GetDailyStats("2025-01-02")
+	if len(after.Hourly) != 24 || !reflect.DeepEqual(before, after) {
+		t.Fatalf("重新加载后的统计与保存前不一致:\n%+v\n%+v", before, after)
+	}
+}
+
+func TestLimitSerializedModelsKeepsTopByTokens(t *testing.T) {
+	stats := newDailyStats("2025-01-02")
+	for i := 0; i < maxSerializedModels+2; i++ {
+		stats.Models[fmt.Sprintf("model-%05d", i)] = ModelStats{Requests: 1, Tokens: i}
+	}
+	small := newDailyStats("2025-01-03")
+	small.Models["model-a"] = ModelStats{Requests: 1}
+	statsList := []DailyStats{stats, small}
+
+	limited := limitSerializedModels(statsList)
+	if got := len(limited[0].Models); got != maxSerializedModels {
+		t.Fatalf("保存的模型数 = %d, want %d", got, maxSerializedModels)
+	}
+	if limited[0].ModelsTruncated != 2 {
+		t.Fatalf("ModelsTruncated = %d, want 2", limited[0].ModelsTruncated)
+	}
+	for _, dropped := range []string{"model-00000", "model-00001"} {
+		if _, ok := limited[0].Models[dropped]; ok {
+			t.Fatalf("令牌数最少的 %s 应被省略", dropped)
+		}
+	}
+	if limited[1].ModelsTruncated != 0 || len(limited[1].Models) != 1 {
+		t.Fatalf("未超过上限的日期不应被截断: %+v", limited[1])
+	}
+	if len(statsList[0].Models) != maxSerializedModels+2 || statsList[0].ModelsTruncated != 0 {
+		t.Fatal("截断不应修改内存中的数据")
+	}
+
+	if got := limitSerializedModels(statsList[1:]); &got[0] != &statsList[1] {
+		t.Fatal("没有超过上限时应原样返回")
+	}
+}
@@ -0,0 +1,157 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 22:50:00
+  @desc: 统计文件的进程间建议锁，避免多个实例使用同一统计文件时互相覆盖
+**/
+
+package config
+
+import (
+	"errors"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// dailyInstanceLockSuffix 实例锁文件后缀，写入统计文件的实例在运行期间一直持有
+	dailyInstanceLockSuffix = ".lock"
+	// dailyIOLockSuffix 读写锁文件后缀，每次读取或保存统计文件时持有
+	// 统计文件通过重命名替换，不能直接锁定统计文件本身
+	dailyIOLockSuffix = ".io.lock"
+	// dailyIOLockRetryInterval 等待读写锁时的重试间隔
+	dailyIOLockRetryInterval = 50 * time.Millisecond
+)
+
+// dailyIOLockTimeout 等待读写锁的最长时间，测试中可缩短
+var dailyIOLockTimeout = 5 * time.Second
+
+// 统计文件被其他实例锁定时的处理方式
+const (
+	FileLockModeReadOnly = "readonly" // 进入只读模式继续运行（默认）
+	FileLockModeRefuse   = "refuse"   // 拒绝启动
+)
+
+// errFileLocked 文件已被其他进程锁定
+var errFileLocked = errors.New("文件已被其他进程锁定")
+
+// ErrStatsFileLocked 统计文件正被其他实例使用
+var ErrStatsFileLocked = errors.New("统计文件正被其他实例使用")
+
+// dailyInstanceLock 当前实例持有的实例锁，受dailyDataLock保护
+var dailyInstanceLock *fileLock
+
+// fileLock 已加锁的锁文件
+type fileLock struct {
+	file *os.File
+}
+
+// tryAcquireFileLock 打开（不存在时创建）锁文件并尝试加锁，不等待
+func tryAcquireFileLock(path string, exclusive bool) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileLock{file: f}, nil
+}
+
+// acquireFileLock 加锁，锁被其他进程持有时重试，超过timeout后返回errFileLocked
+func acquireFileLock(path string, exclusive bool, timeout time.Duration) (*fileLock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := tryAcquireFileLock(path, exclusive)
+		if !errors.Is(err, errFileLocked) || time.Now().After(deadline) {
+			return lock, err
+		}
+		time.Sleep(dailyIOLockRetryInterval)
+	}
+}
+
+// release 释放锁并关闭锁文件
+func (l *fileLock) release() {
+	if l == nil || l.file == nil {
+		return
+	}
+	if err := unlockFile(l.file); err != nil {
+		logger.Warn("释放文件锁失败: %v", err)
+	}
+	l.file.Close()
+	l.file = nil
+}
+
+// withDailyIOLock 持有统计文件的读写锁执行fn，读取使用共享锁，保存使用排他锁
+// 不同实例的保存和读取因此串行执行，等待超时时不执行fn并返回错误
+func withDailyIOLock(path string, exclusive bool, fn func() error) error {
+	return withDailyIOLockWait(path, exclusive, dailyIOLockTimeout, fn)
+}
+
+// withDailyIOLockWait 与withDailyIOLock相同，最多等待wait获取读写锁，wait为0时只尝试一次
+func withDailyIOLockWait(path string, exclusive bool, wait time.Duration, fn func() error) error {
+	lock, err := acquireFileLock(path+dailyIOLockSuffix, exclusive, wait)
+	if err != nil {
+		if errors.Is(err, errFileLocked) {
+			return fmt.Errorf("等待统计文件读写锁超时: %w", err)
+		}
+		return fmt.Errorf("获取统计文件读写锁失败: %w", err)
+	}
+	defer lock.release()
+	return fn()
+}
+
+// AcquireStatsFileLock 获取统计文件的实例锁，在加载配置后、InitDailyStats之前调用
+// 只读副本不写入文件，不获取实例锁；其他实例已持有锁时按stats.file_lock_mode处理：
+// readonly进入只读模式继续运行，refuse返回ErrStatsFileLocked，由调用方拒绝启动
+func AcquireStatsFileLock() error {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if dailyInstanceLock != nil || dailyReadOnly || getStatsConfig().ReadOnlyReplica {
+		return nil
+	}
+
+	// 首次启动时数据目录可能尚未创建
+	if err := os.MkdirAll(filepath.Dir(dailyFilePath), 0755); err != nil {
+		logger.Warn("创建数据目录失败: %v", err)
+	}
+	lock, err := tryAcquireFileLock(dailyFilePath+dailyInstanceLockSuffix, true)
+	if err == nil {
+		dailyInstanceLock = lock
+		return nil
+	}
+	if !errors.Is(err, errFileLocked) {
+		// 文件系统不支持加锁等情况下不影响使用
+		logger.Warn("获取统计文件锁失败，继续运行: %v", err)
+		return nil
+	}
+
+	if getStatsConfig().FileLockMode == FileLockModeRefuse {
+		return fmt.Errorf("%w: %s", ErrStatsFileLocked, dailyFilePath)
+	}
+	dailyReadOnly = true
+	logger.Warn("统计文件 %s 正被其他实例使用，本实例进入只读模式，不写入统计数据", dailyFilePath)
+	return nil
+}
+
+// switchDailyInstanceLockLocked 切换统计文件时将实例锁改为新文件（已加锁）
+// 当前未持有实例锁时不处理；新文件正被其他实例使用时返回ErrStatsFileLocked，保留原来的锁
+func switchDailyInstanceLockLocked(path string) error {
+	if dailyInstanceLock == nil {
+		return nil
+	}
+	lock, err := tryAcquireFileLock(path+dailyInstanceLockSuffix, true)
+	if err != nil {
+		if errors.Is(err, errFileLocked) {
+			return fmt.Errorf("%w: %s", ErrStatsFileLocked, path)
+		}
+		return err
+	}
+	dailyInstanceLock.release()
+	dailyInstanceLock = lock
+	return nil
+}
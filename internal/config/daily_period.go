@@ -0,0 +1,46 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 23:30:00
+  @desc: 本周至今和本月至今的累计统计
+**/
+
+package config
+
+import "time"
+
+// GetWeekToDate 汇总本周（ISO周，从周一开始）至今天的统计数据，StartDate为本周第一天
+func GetWeekToDate() (*PeriodStats, error) {
+	now := statsNow()
+	// time.Weekday中周日为0，ISO周中周日为第7天
+	offset := (int(now.Weekday()) + 6) % 7
+	return sumDailyStatsSince(now.AddDate(0, 0, -offset), now)
+}
+
+// GetMonthToDate 汇总本月1日至今天的统计数据，StartDate为本月第一天
+func GetMonthToDate() (*PeriodStats, error) {
+	now := statsNow()
+	return sumDailyStatsSince(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), now)
+}
+
+// sumDailyStatsSince 汇总start至now所在日期（含）的统计数据，没有数据的日期按0计
+// 计数按int64累加，多日汇总在32位平台上同样不会溢出
+func sumDailyStatsSince(start, now time.Time) (*PeriodStats, error) {
+	startDate := start.Format("2006-01-02")
+	endDate := now.Format("2006-01-02")
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return nil, ErrStatsNotInitialized
+	}
+
+	total := newPeriodStats(startDate, endDate)
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date < startDate || stats.Date > endDate {
+			continue
+		}
+		total.add(stats)
+	}
+	return &total, nil
+}
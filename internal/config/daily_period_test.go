@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeekAndMonthToDate(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, `{"version":"1.0","daily_stats":[
+		{"date": "2025-02-28", "requests": {"total": 100, "success": 100}, "tokens": {"total": 1000}},
+		{"date": "2025-03-01", "requests": {"total": 1, "success": 1}, "tokens": {"total": 10}},
+		{"date": "2025-03-02", "requests": {"total": 2, "success": 1, "failed": 1}, "tokens": {"total": 20}},
+		{"date": "2025-03-03", "requests": {"total": 4, "success": 4}, "tokens": {"total": 40}},
+		{"date": "2025-03-09", "requests": {"total": 8, "success": 8}, "tokens": {"total": 80}},
+		{"date": "2025-03-10", "requests": {"total": 16, "success": 16}, "tokens": {"total": 160}}
+	],"keys_usage":{}}`)
+	// 2025-03-09为周日，仍属于从周一2025-03-03开始的一周
+	clock := fakeStatsClock(t, time.Date(2025, 3, 9, 18, 0, 0, 0, time.Local))
+
+	week, err := GetWeekToDate()
+	if err != nil {
+		t.Fatalf("GetWeekToDate() = %v", err)
+	}
+	if week.StartDate != "2025-03-03" || week.EndDate != "2025-03-09" || week.Days != 2 ||
+		week.Requests.Total != 12 || week.Tokens.Total != 120 {
+		t.Fatalf("GetWeekToDate() = %+v, want 2025-03-03至2025-03-09共2天 12请求 120令牌", week)
+	}
+
+	month, err := GetMonthToDate()
+	if err != nil {
+		t.Fatalf("GetMonthToDate() = %v", err)
+	}
+	if month.StartDate != "2025-03-01" || month.Days != 4 || month.Requests.Total != 15 ||
+		month.Requests.Failed != 1 || month.Tokens.Total != 150 {
+		t.Fatalf("GetMonthToDate() = %+v, want 2025-03-01起4天 15请求 150令牌", month)
+	}
+
+	// 周一新的一周只包含当天
+	*clock = time.Date(2025, 3, 10, 9, 0, 0, 0, time.Local)
+	week, _ = GetWeekToDate()
+	if week.StartDate != "2025-03-10" || week.Days != 1 || week.Requests.Total != 16 {
+		t.Fatalf("周一的GetWeekToDate() = %+v", week)
+	}
+}
@@ -0,0 +1,297 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/2 15:40:00
+  @desc: 每日统计数据的手动清理与归档
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// PurgeResult 统计数据清理结果
+type PurgeResult struct {
+	Cutoff           string `json:"cutoff"`             // 截止日期（不含）
+	DailyStatsPurged int    `json:"daily_stats_purged"` // 删除的每日统计条数
+	KeyUsagePurged   int    `json:"key_usage_purged"`   // 删除的密钥每日使用记录条数
+	KeysRemoved      int    `json:"keys_removed"`       // 删除后不再有任何记录的密钥数
+	ArchiveFile      string `json:"archive_file,omitempty"`
+}
+
+// purgeArchive 清理前归档的数据结构
+type purgeArchive struct {
+	Cutoff           string                         `json:"cutoff"`
+	ArchivedAt       string                         `json:"archived_at"`
+	DailyStats       []DailyStats                   `json:"daily_stats"`
+	KeysUsage        map[string]map[string]KeyUsage `json:"keys_usage"`
+	VirtualKeysUsage map[string]map[string]KeyUsage `json:"virtual_keys_usage,omitempty"`
+}
+
+// GetStatsArchiveDir 获取统计数据归档目录，位于每日统计文件同级的archive目录
+func GetStatsArchiveDir() string {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+	return statsArchiveDirLocked()
+}
+
+// statsArchiveDirLocked 获取统计数据归档目录（已加锁）
+func statsArchiveDirLocked() string {
+	path := dailyFilePath
+	if path == "" {
+		path = "data/daily.json"
+	}
+	return filepath.Join(filepath.Dir(path), "archive")
+}
+
+// PurgeStatsBefore 删除早于指定日期（不含）的每日统计和密钥使用记录
+// 只读模式下不会写入统计文件，返回ErrStatsReadOnly
+func PurgeStatsBefore(date string) (PurgeResult, error) {
+	return purgeStatsBefore(date, false)
+}
+
+// PurgeAndArchiveStatsBefore 先将早于指定日期的数据归档到归档目录，再删除
+func PurgeAndArchiveStatsBefore(date string) (PurgeResult, error) {
+	return purgeStatsBefore(date, true)
+}
+
+// purgeStatsBefore 清理统计数据，整个过程持有写锁，避免与请求统计并发写入
+func purgeStatsBefore(date string, archive bool) (PurgeResult, error) {
+	result := PurgeResult{Cutoff: date}
+
+	cutoff, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		return result, fmt.Errorf("日期格式无效，应为YYYY-MM-DD: %w", err)
+	}
+
+	// 今天的数据仍在写入，不允许清理
+	today := time.Now().Format("2006-01-02")
+	if cutoff.Format("2006-01-02") > today {
+		return result, fmt.Errorf("截止日期不能晚于今天: %s", date)
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if dailyData == nil {
+		return result, ErrStatsNotInitialized
+	}
+	// 只读模式下清理只会修改内存数据，重新加载后又会恢复，直接拒绝
+	if dailyReadOnly {
+		return result, ErrStatsReadOnly
+	}
+
+	// 收集需要删除的数据
+	var keptStats, purgedStats []DailyStats
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date < date {
+			purgedStats = append(purgedStats, stats)
+		} else {
+			keptStats = append(keptStats, stats)
+		}
+	}
+
+	purgedUsage := make(map[string]map[string]KeyUsage)
+	for maskedKey, usageByDate := range dailyData.KeysUsage {
+		for usageDate, usage := range usageByDate {
+			if usageDate < date {
+				if purgedUsage[maskedKey] == nil {
+					purgedUsage[maskedKey] = make(map[string]KeyUsage)
+				}
+				purgedUsage[maskedKey][usageDate] = usage
+				result.KeyUsagePurged++
+			}
+		}
+	}
+
+	// 虚拟密钥使用记录随每日统计一起清理，不计入密钥使用记录数
+	purgedVirtualUsage, keptVirtualUsage := splitKeysUsageBefore(dailyData.VirtualKeysUsage, date)
+
+	result.DailyStatsPurged = len(purgedStats)
+	if result.DailyStatsPurged == 0 && result.KeyUsagePurged == 0 && len(purgedVirtualUsage) == 0 {
+		return result, nil
+	}
+
+	// 先归档，归档失败则放弃清理
+	if archive {
+		archiveFile, err := writePurgeArchiveLocked(date, purgedStats, purgedUsage, purgedVirtualUsage)
+		if err != nil {
+			return result, fmt.Errorf("归档统计数据失败: %w", err)
+		}
+		result.ArchiveFile = archiveFile
+	}
+
+	// 在副本上修改，保存成功后再替换内存数据
+	newKeysUsage := make(map[string]map[string]KeyUsage, len(dailyData.KeysUsage))
+	for maskedKey, usageByDate := range dailyData.KeysUsage {
+		kept := make(map[string]KeyUsage, len(usageByDate))
+		for usageDate, usage := range usageByDate {
+			if usageDate >= date {
+				kept[usageDate] = usage
+			}
+		}
+		if len(kept) == 0 {
+			result.KeysRemoved++
+			continue
+		}
+		newKeysUsage[maskedKey] = kept
+	}
+
+	oldStats := dailyData.DailyStats
+	oldKeysUsage := dailyData.KeysUsage
+	oldVirtualKeysUsage := dailyData.VirtualKeysUsage
+	dailyData.DailyStats = keptStats
+	dailyData.KeysUsage = newKeysUsage
+	dailyData.VirtualKeysUsage = keptVirtualUsage
+
+	if err := saveDailyDataLocked(); err != nil {
+		// 保存失败时恢复内存数据，保证内存与磁盘一致
+		dailyData.DailyStats = oldStats
+		dailyData.KeysUsage = oldKeysUsage
+		dailyData.VirtualKeysUsage = oldVirtualKeysUsage
+		return result, fmt.Errorf("保存清理后的统计数据失败: %w", err)
+	}
+
+	// 确保今天的数据仍然存在
+	ensureTodayDataExistsLocked()
+
+	logger.Info("已清理 %s 之前的统计数据: 每日统计 %d 条, 密钥使用记录 %d 条",
+		date, result.DailyStatsPurged, result.KeyUsagePurged)
+	return result, nil
+}
+
+// splitKeysUsageBefore 将使用记录按日期拆分为date之前和之后两部分，不修改原数据
+func splitKeysUsageBefore(keysUsage map[string]map[string]KeyUsage, date string) (before, after map[string]map[string]KeyUsage) {
+	before = make(map[string]map[string]KeyUsage)
+	after = make(map[string]map[string]KeyUsage, len(keysUsage))
+	for id, usageByDate := range keysUsage {
+		for usageDate, usage := range usageByDate {
+			target := after
+			if usageDate < date {
+				target = before
+			}
+			if target[id] == nil {
+				target[id] = make(map[string]KeyUsage)
+			}
+			target[id][usageDate] = usage
+		}
+	}
+	return before, after
+}
+
+// writePurgeArchiveLocked 将待清理的数据写入归档文件（已加锁）
+func writePurgeArchiveLocked(cutoff string, stats []DailyStats, usage, virtualUsage map[string]map[string]KeyUsage) (string, error) {
+	archiveDir := statsArchiveDirLocked()
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return "", err
+	}
+
+	data, err := marshalStatsJSON(purgeArchive{
+		Cutoff:           cutoff,
+		ArchivedAt:       time.Now().Format(time.RFC3339),
+		DailyStats:       stats,
+		KeysUsage:        usage,
+		VirtualKeysUsage: virtualUsage,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	archiveFile := filepath.Join(archiveDir,
+		fmt.Sprintf("purged-before-%s-%s.json", cutoff, time.Now().Format("20060102150405")))
+	if err := writeFileAtomic(archiveFile, data, 0644); err != nil {
+		return "", err
+	}
+
+	logger.Info("已归档待清理的统计数据: %s", archiveFile)
+	return archiveFile, nil
+}
+
+// DeleteKeyUsages 在一次写锁内删除多个密钥的全部使用记录，只保存一次
+// apiKeys 可以是统计数据中的密钥标识（稳定标识或旧掩码），也可以是原始密钥
+// 返回实际删除的密钥数，保存失败时恢复内存数据
+func DeleteKeyUsages(apiKeys []string) (int, error) {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if dailyData == nil {
+		return 0, ErrStatsNotInitialized
+	}
+
+	removed := make(map[string]map[string]KeyUsage)
+	for _, k := range apiKeys {
+		id := k
+		if _, ok := dailyData.KeysUsage[id]; !ok && !isKeyID(k) {
+			id = KeyID(k)
+		}
+		if usageByDate, ok := dailyData.KeysUsage[id]; ok {
+			removed[id] = usageByDate
+			delete(dailyData.KeysUsage, id)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+
+	if err := saveDailyDataLocked(); err != nil {
+		for id, usageByDate := range removed {
+			dailyData.KeysUsage[id] = usageByDate
+		}
+		return 0, fmt.Errorf("保存删除密钥记录后的统计数据失败: %w", err)
+	}
+
+	logger.Info("已删除 %d 个密钥的使用记录", len(removed))
+	return len(removed), nil
+}
+
+// FindOrphanKeyStats 查找不对应任何已配置密钥的使用记录（例如轮换后已删除的密钥），按标识排序返回
+// 每个已配置密钥同时匹配稳定标识和旧版本掩码，返回值可直接传给DeleteKeyUsages清理
+func FindOrphanKeyStats(configuredKeys []string) ([]string, error) {
+	known := make(map[string]bool, len(configuredKeys)*2)
+	for _, k := range configuredKeys {
+		known[KeyID(k)] = true
+		known[legacyMaskAPIKey(k)] = true
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return nil, ErrStatsNotInitialized
+	}
+
+	orphans := make([]string, 0)
+	for id := range dailyData.KeysUsage {
+		if !known[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// ResetKeysUsage 清空所有密钥的使用记录并保存，不影响每日汇总统计，用于计费周期开始时重新计算密钥配额
+// 保存失败时恢复内存数据
+func ResetKeysUsage() error {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if dailyData == nil {
+		return ErrStatsNotInitialized
+	}
+
+	old := dailyData.KeysUsage
+	dailyData.KeysUsage = make(map[string]map[string]KeyUsage)
+	if err := saveDailyDataLocked(); err != nil {
+		dailyData.KeysUsage = old
+		return fmt.Errorf("保存重置密钥记录后的统计数据失败: %w", err)
+	}
+
+	logger.Info("已重置 %d 个密钥的使用记录", len(old))
+	return nil
+}
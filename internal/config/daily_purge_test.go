@@ -0,0 +1,121 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestPurgeStatsBeforeRefusesReadOnly(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{})
+	data := `{"version":"1.0","daily_stats":[{"date":"2025-01-02","requests":{"total":4}}],"keys_usage":{}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	SetDailyStatsReadOnly(true)
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+
+	if _, err := PurgeStatsBefore("2025-02-01"); !errors.Is(err, ErrStatsReadOnly) {
+		t.Fatalf("PurgeStatsBefore() = %v, want ErrStatsReadOnly", err)
+	}
+	if _, err := PurgeAndArchiveStatsBefore("2025-02-01"); !errors.Is(err, ErrStatsReadOnly) {
+		t.Fatalf("PurgeAndArchiveStatsBefore() = %v, want ErrStatsReadOnly", err)
+	}
+	if _, found, _ := GetDailyStats("2025-01-02"); !found {
+		t.Fatal("只读模式下不应删除内存中的统计数据")
+	}
+	if _, err := os.Stat(GetStatsArchiveDir()); !os.IsNotExist(err) {
+		t.Fatalf("只读模式下不应创建归档目录: %v", err)
+	}
+}
+
+func TestPurgeStatsBefore(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{})
+	data := `{"version":"1.0","daily_stats":[{"date":"2025-01-02","requests":{"total":4}},{"date":"2025-03-01","requests":{"total":1}}],"keys_usage":{}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+
+	result, err := PurgeStatsBefore("2025-02-01")
+	if err != nil || result.DailyStatsPurged != 1 {
+		t.Fatalf("PurgeStatsBefore() = %+v, %v", result, err)
+	}
+	if _, found, _ := GetDailyStats("2025-01-02"); found {
+		t.Fatal("截止日期之前的统计数据应被删除")
+	}
+	if _, found, _ := GetDailyStats("2025-03-01"); !found {
+		t.Fatal("截止日期之后的统计数据应保留")
+	}
+}
+
+func TestFindOrphanKeyStats(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	for _, key := range []string{"sk-kept-one", "sk-kept-two", "sk-rotated-away"} {
+		AddDailyRequestStat(key, "model-a", "", "", 1, 10, 5, true)
+	}
+	// 旧版本以掩码保存的记录
+	dailyDataLock.Lock()
+	dailyData.KeysUsage[legacyMaskAPIKey("sk-kept-two")] = map[string]KeyUsage{"2025-01-02": {Requests: 1}}
+	dailyData.KeysUsage["sk-old***"] = map[string]KeyUsage{"2025-01-02": {Requests: 1}}
+	dailyDataLock.Unlock()
+
+	orphans, err := FindOrphanKeyStats([]string{"sk-kept-one", "sk-kept-two"})
+	if err != nil {
+		t.Fatalf("FindOrphanKeyStats() = %v", err)
+	}
+	want := []string{KeyID("sk-rotated-away"), "sk-old***"}
+	if want[0] > want[1] {
+		want[0], want[1] = want[1], want[0]
+	}
+	if len(orphans) != 2 || orphans[0] != want[0] || orphans[1] != want[1] {
+		t.Fatalf("FindOrphanKeyStats() = %v, want %v", orphans, want)
+	}
+
+	// 返回值可以直接用于清理
+	if removed, err := DeleteKeyUsages(orphans); err != nil || removed != 2 {
+		t.Fatalf("DeleteKeyUsages() = %d, %v", removed, err)
+	}
+	if orphans, _ := FindOrphanKeyStats([]string{"sk-kept-one", "sk-kept-two"}); len(orphans) != 0 {
+		t.Fatalf("清理后仍有孤立记录: %v", orphans)
+	}
+}
+
+func TestResetKeysUsageKeepsDailyStats(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-one", "model-a", "", "", 2, 10, 5, true)
+	AddDailyRequestStat("sk-two", "model-b", "", "", 1, 10, 5, false)
+	before, _, _ := GetDailyStats("")
+
+	if err := ResetKeysUsage(); err != nil {
+		t.Fatalf("ResetKeysUsage() = %v", err)
+	}
+
+	after, _, _ := GetDailyStats("")
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("重置密钥记录不应影响每日统计:\n%+v\n%+v", before, after)
+	}
+	// 重新加载后密钥记录同样为空
+	dailyDataLock.Lock()
+	dailyData = nil
+	dailyDataLock.Unlock()
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+	if len(dailyData.KeysUsage) != 0 {
+		t.Fatalf("重置后KeysUsage = %v, want 空", dailyData.KeysUsage)
+	}
+}
@@ -0,0 +1,427 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 09:20:00
+  @desc: 每日统计数据的组合查询
+**/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+)
+
+// ErrHourlyByModelDisabled 未开启按模型小时统计且没有相应数据
+var ErrHourlyByModelDisabled = errors.New("未开启按模型的小时统计(stats.hourly_by_model)")
+
+// ErrModelNeverSeen 保留的统计数据中没有该模型的记录
+var ErrModelNeverSeen = errors.New("统计数据中没有该模型的记录")
+
+// ErrNoFailedRequests 指定日期没有失败的模型请求
+var ErrNoFailedRequests = errors.New("没有失败的模型请求")
+
+// GetStatsByModelGlob 汇总指定日期中模型名匹配通配符的模型统计
+// 通配符语法与path.Match一致，例如 team-a/* 匹配 team-a/ 下的所有模型
+func GetStatsByModelGlob(pattern, date string) (ModelStats, error) {
+	if pattern == "" {
+		return ModelStats{}, fmt.Errorf("模型通配符不能为空")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return ModelStats{}, fmt.Errorf("无效的模型通配符 %q: %w", pattern, err)
+	}
+
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return ModelStats{}, ErrStatsNotInitialized
+	}
+
+	var result ModelStats
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date != date {
+			continue
+		}
+		for name, ms := range stats.Models {
+			if matched, _ := path.Match(pattern, name); !matched {
+				continue
+			}
+			result.Requests += ms.Requests
+			result.Tokens += ms.Tokens
+			result.Success += ms.Success
+			result.Failed += ms.Failed
+			result.StreamRequests += ms.StreamRequests
+			result.NonStreamRequests += ms.NonStreamRequests
+			result.Cost += ms.Cost
+			result.TTFT.TotalMs += ms.TTFT.TotalMs
+			result.TTFT.Count += ms.TTFT.Count
+			result.TTFB.TotalMs += ms.TTFB.TotalMs
+			result.TTFB.Count += ms.TTFB.Count
+			result.Latency = mergeLatency(result.Latency, ms.Latency)
+		}
+		break
+	}
+
+	if result.TTFT.Count > 0 {
+		result.TTFT.AvgMs = float64(result.TTFT.TotalMs) / float64(result.TTFT.Count)
+	}
+	if result.TTFB.Count > 0 {
+		result.TTFB.AvgMs = float64(result.TTFB.TotalMs) / float64(result.TTFB.Count)
+	}
+	return result, nil
+}
+
+// GetModelThroughput 计算模型在最近window时长内的平均每分钟请求数
+// 基于按模型的小时统计，窗口只覆盖某个小时的一部分时按覆盖比例折算该小时的请求数，
+// 当前小时按已经过去的时长计算
+func GetModelThroughput(model string, window time.Duration) (float64, error) {
+	if model == "" {
+		return 0, fmt.Errorf("模型名称不能为空")
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("统计窗口必须大于0: %s", window)
+	}
+
+	now := time.Now()
+	start := now.Add(-window)
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return 0, ErrStatsNotInitialized
+	}
+
+	filtered := getStatsConfig().HourlyByModel
+	requests := 0.0
+	for _, stats := range dailyData.DailyStats {
+		day, err := time.ParseInLocation("2006-01-02", stats.Date, now.Location())
+		if err != nil || !day.Add(24*time.Hour).After(start) || day.After(now) {
+			continue
+		}
+		for _, h := range stats.Hourly {
+			if len(h.Models) > 0 {
+				filtered = true
+			}
+			ms, ok := h.Models[model]
+			if !ok || ms.Requests == 0 || h.Hour < 0 || h.Hour >= 24 {
+				continue
+			}
+
+			bucketStart := day.Add(time.Duration(h.Hour) * time.Hour)
+			bucketEnd := bucketStart.Add(time.Hour)
+			if bucketEnd.After(now) {
+				bucketEnd = now
+			}
+			overlapStart, overlapEnd := bucketStart, bucketEnd
+			if start.After(overlapStart) {
+				overlapStart = start
+			}
+			if !overlapEnd.After(overlapStart) {
+				continue
+			}
+			requests += float64(ms.Requests) * float64(overlapEnd.Sub(overlapStart)) / float64(bucketEnd.Sub(bucketStart))
+		}
+	}
+
+	if !filtered {
+		return 0, ErrHourlyByModelDisabled
+	}
+	return requests / window.Minutes(), nil
+}
+
+// GetModelStatsInRange 汇总模型在[startDate, endDate]日期范围内的统计，日期格式为YYYY-MM-DD
+// 模型名称按原样精确匹配，可包含斜杠、冒号和Unicode字符；计数按int64累加，32位平台上同样不会溢出
+func GetModelStatsInRange(model, startDate, endDate string) (ModelRangeStats, error) {
+	if model == "" {
+		return ModelRangeStats{}, fmt.Errorf("模型名称不能为空")
+	}
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return ModelRangeStats{}, fmt.Errorf("开始日期格式错误，应为YYYY-MM-DD: %s", startDate)
+	}
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		return ModelRangeStats{}, fmt.Errorf("结束日期格式错误，应为YYYY-MM-DD: %s", endDate)
+	}
+	if end.Before(start) {
+		return ModelRangeStats{}, fmt.Errorf("结束日期 %s 早于开始日期 %s", endDate, startDate)
+	}
+
+	model = normalizeModelName(model)
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return ModelRangeStats{}, ErrStatsNotInitialized
+	}
+
+	var result ModelRangeStats
+	for _, stats := range dailyData.DailyStats {
+		// 日期格式固定，可直接按字符串比较
+		if stats.Date < startDate || stats.Date > endDate {
+			continue
+		}
+		if ms, ok := stats.Models[model]; ok {
+			result.add(ms)
+		}
+	}
+	return result, nil
+}
+
+// GetModelFailureRate 获取模型在指定日期的失败率（失败请求数/总请求数），date为空时使用今天
+// 该日期没有该模型的请求时返回错误
+func GetModelFailureRate(model, date string) (float64, error) {
+	if model == "" {
+		return 0, fmt.Errorf("模型名称不能为空")
+	}
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	model = normalizeModelName(model)
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return 0, ErrStatsNotInitialized
+	}
+
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date != date {
+			continue
+		}
+		ms := stats.Models[model]
+		total := ms.Success + ms.Failed
+		if total == 0 {
+			break
+		}
+		return float64(ms.Failed) / float64(total), nil
+	}
+	return 0, fmt.Errorf("%s 没有模型 %s 的请求记录", date, model)
+}
+
+// GetTopFailingModel 获取指定日期失败请求最多的模型及其失败数和失败率，date为空时使用今天
+// 失败数相同时取失败率高的模型，仍相同时按模型名称排序取第一个；当天没有失败请求时返回ErrNoFailedRequests
+func GetTopFailingModel(date string) (model string, failed int, rate float64, err error) {
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return "", 0, 0, ErrStatsNotInitialized
+	}
+
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date != date {
+			continue
+		}
+		for name, ms := range stats.Models {
+			if ms.Failed == 0 {
+				continue
+			}
+			msRate := float64(ms.Failed) / float64(ms.Success+ms.Failed)
+			if ms.Failed > failed ||
+				(ms.Failed == failed && (msRate > rate || (msRate == rate && name < model))) {
+				model, failed, rate = name, ms.Failed, msRate
+			}
+		}
+		break
+	}
+
+	if failed == 0 {
+		return "", 0, 0, ErrNoFailedRequests
+	}
+	return model, failed, rate, nil
+}
+
+// ModelHistoryPoint 模型在某一天的用量
+type ModelHistoryPoint struct {
+	Date     string `json:"date"`
+	Requests int    `json:"requests"`
+	Tokens   int    `json:"tokens"`
+}
+
+// GetModelHistory 获取模型在所有保留日期中的每日用量，按日期升序，省略没有使用该模型的日期
+// model可以是别名，按配置的实际模型名查询
+func GetModelHistory(model string) ([]ModelHistoryPoint, error) {
+	if model == "" {
+		return nil, fmt.Errorf("模型名称不能为空")
+	}
+	model = normalizeModelName(ResolveModelAlias(model))
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return nil, ErrStatsNotInitialized
+	}
+
+	history := make([]ModelHistoryPoint, 0)
+	for _, stats := range dailyData.DailyStats {
+		ms, ok := stats.Models[model]
+		if !ok || ms.Requests == 0 {
+			continue
+		}
+		history = append(history, ModelHistoryPoint{
+			Date:     stats.Date,
+			Requests: ms.Requests,
+			Tokens:   ms.Tokens,
+		})
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Date < history[j].Date
+	})
+	return history, nil
+}
+
+// GetModelFirstSeen 获取模型在保留的统计数据中首次出现的日期，从未出现时返回ErrModelNeverSeen
+// model可以是别名，按配置的实际模型名查询；只统计保留期内的数据，更早的使用无法反映
+func GetModelFirstSeen(model string) (string, error) {
+	if model == "" {
+		return "", fmt.Errorf("模型名称不能为空")
+	}
+	model = normalizeModelName(ResolveModelAlias(model))
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return "", ErrStatsNotInitialized
+	}
+
+	firstSeen := ""
+	for _, stats := range dailyData.DailyStats {
+		if _, ok := stats.Models[model]; !ok {
+			continue
+		}
+		if firstSeen == "" || stats.Date < firstSeen {
+			firstSeen = stats.Date
+		}
+	}
+	if firstSeen == "" {
+		return "", ErrModelNeverSeen
+	}
+	return firstSeen, nil
+}
+
+// KeyUsageEntry 密钥在某一天的使用量
+type KeyUsageEntry struct {
+	KeyID    string  `json:"key_id"`
+	Key      string  `json:"key"` // 按脱敏策略显示的密钥
+	Requests int     `json:"requests"`
+	Tokens   int     `json:"tokens"`
+	Balance  float64 `json:"balance"` // 密钥当前余额，密钥已删除时为0
+}
+
+// GetTopKeys 获取指定日期令牌用量最多的n个密钥，按令牌数降序，令牌数相同时按请求数降序
+// n大于当天有使用记录的密钥数时返回全部，日期为空时使用今天
+func GetTopKeys(date string, n int) ([]KeyUsageEntry, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("数量必须大于0: %d", n)
+	}
+
+	keysUsage, _, err := GetKeyUsageStats(date)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]KeyUsageEntry, 0, len(keysUsage))
+	for keyID, usage := range keysUsage {
+		entries = append(entries, KeyUsageEntry{
+			KeyID:    keyID,
+			Requests: usage.Requests,
+			Tokens:   usage.Tokens,
+			Balance:  usage.Balance,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Tokens != entries[j].Tokens {
+			return entries[i].Tokens > entries[j].Tokens
+		}
+		if entries[i].Requests != entries[j].Requests {
+			return entries[i].Requests > entries[j].Requests
+		}
+		return entries[i].KeyID < entries[j].KeyID
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+
+	// 在统计锁之外查找原始密钥，避免与密钥配置的锁嵌套
+	for i := range entries {
+		entries[i].Key = DisplayKeyID(entries[i].KeyID, false)
+	}
+	return entries, nil
+}
+
+// GetKeyTokenShare 获取密钥在指定日期的令牌数占当天总令牌数的比例，日期为空时使用今天
+// apiKey可以是原始密钥或稳定密钥标识；当天总令牌数为0时比例为0
+func GetKeyTokenShare(apiKey, date string) (keyTokens int, dayTokens int, share float64, err error) {
+	if apiKey == "" {
+		return 0, 0, 0, fmt.Errorf("密钥不能为空")
+	}
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	keyID := apiKey
+	if !isKeyID(apiKey) {
+		keyID = KeyID(apiKey)
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return 0, 0, 0, ErrStatsNotInitialized
+	}
+
+	keyTokens = dailyData.KeysUsage[keyID][date].Tokens
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date == date {
+			dayTokens = stats.Tokens.Total
+			break
+		}
+	}
+	if dayTokens > 0 {
+		share = float64(keyTokens) / float64(dayTokens)
+	}
+	return keyTokens, dayTokens, share, nil
+}
+
+// GetEndpointStats 获取接口路径在指定日期的请求统计，日期为空时使用今天
+// 路径为记录时的上游路径，如/v1/chat/completions，没有记录时返回零值
+func GetEndpointStats(endpoint, date string) (DailyRequestStats, error) {
+	if endpoint == "" {
+		return DailyRequestStats{}, fmt.Errorf("接口路径不能为空")
+	}
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return DailyRequestStats{}, ErrStatsNotInitialized
+	}
+
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date == date {
+			return stats.Endpoints[endpoint], nil
+		}
+	}
+	return DailyRequestStats{}, nil
+}
@@ -0,0 +1,292 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetStatsByModelGlob(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, `{"version":"1.0","daily_stats":[{
+		"date": "2025-01-02",
+		"models": {
+			"team-a/chat": {"requests": 3, "tokens": 30, "success": 3},
+			"team-a/embed": {"requests": 2, "tokens": 8, "success": 1, "failed": 1},
+			"team-b/chat": {"requests": 7, "tokens": 70, "success": 7},
+			"team-a": {"requests": 5, "tokens": 50, "success": 5}
+		}
+	}],"keys_usage":{}}`)
+
+	stats, err := GetStatsByModelGlob("team-a/*", "2025-01-02")
+	if err != nil {
+		t.Fatalf("GetStatsByModelGlob() = %v", err)
+	}
+	if stats.Requests != 5 || stats.Tokens != 38 || stats.Success != 4 || stats.Failed != 1 {
+		t.Fatalf("team-a/*的统计 = %+v", stats)
+	}
+
+	chat, err := GetStatsByModelGlob("*/chat", "2025-01-02")
+	if err != nil || chat.Requests != 10 {
+		t.Fatalf("*/chat的统计 = %+v, %v", chat, err)
+	}
+	none, err := GetStatsByModelGlob("team-c/*", "2025-01-02")
+	if err != nil || none.Requests != 0 {
+		t.Fatalf("没有匹配的模型时 = %+v, %v", none, err)
+	}
+	if _, err := GetStatsByModelGlob("team-[a", "2025-01-02"); err == nil {
+		t.Fatal("无效的通配符应返回错误")
+	}
+}
+
+func TestGetModelThroughput(t *testing.T) {
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
+	threeDaysAgo := now.AddDate(0, 0, -3).Format("2006-01-02")
+	// 48小时窗口完整覆盖昨天，三天前的数据在窗口之外
+	seedDailyStatsForTest(t, StatsConfig{HourlyByModel: true}, fmt.Sprintf(`{"version":"1.0","daily_stats":[
+		{"date": %q, "hourly": [{"hour": 23, "requests": 1000, "models": {"model-a": {"requests": 1000}}}]},
+		{"date": %q, "hourly": [
+			{"hour": 3, "requests": 90, "models": {"model-a": {"requests": 60}, "model-b": {"requests": 30}}},
+			{"hour": 20, "requests": 120, "models": {"model-a": {"requests": 120}}}
+		]}
+	],"keys_usage":{}}`, threeDaysAgo, yesterday))
+
+	window := 48 * time.Hour
+	rate, err := GetModelThroughput("model-a", window)
+	if err != nil {
+		t.Fatalf("GetModelThroughput() = %v", err)
+	}
+	if want := 180 / window.Minutes(); math.Abs(rate-want) > 1e-9 {
+		t.Fatalf("model-a每分钟请求数 = %v, want %v", rate, want)
+	}
+	rate, err = GetModelThroughput("model-b", window)
+	if want := 30 / window.Minutes(); err != nil || math.Abs(rate-want) > 1e-9 {
+		t.Fatalf("model-b每分钟请求数 = %v, %v, want %v", rate, err, want)
+	}
+	if rate, err := GetModelThroughput("model-c", window); err != nil || rate != 0 {
+		t.Fatalf("没有请求的模型 = %v, %v, want 0", rate, err)
+	}
+}
+
+func TestGetModelThroughputRequiresHourlyByModel(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, `{"version":"1.0","daily_stats":[],"keys_usage":{}}`)
+	if _, err := GetModelThroughput("model-a", time.Hour); !errors.Is(err, ErrHourlyByModelDisabled) {
+		t.Fatalf("GetModelThroughput() = %v, want ErrHourlyByModelDisabled", err)
+	}
+}
+
+func TestUnicodeAndLongModelNamesPersist(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	today := time.Now().Format("2006-01-02")
+	unicodeName := "通义千问/Qwen2.5-72B:最新版 🚀"
+	longName := "org/" + strings.Repeat("very-long-model-name-<&>-", 40)
+
+	AddDailyRequestStat("sk-test", unicodeName, "", "", 2, 10, 5, true)
+	AddDailyRequestStat("sk-test", longName, "", "", 3, 20, 10, true)
+	if err := FlushDailyStats(); err != nil {
+		t.Fatalf("FlushDailyStats() = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), unicodeName) || !strings.Contains(string(data), longName) {
+		t.Fatal("模型名称应原样写入统计文件")
+	}
+
+	// 重新加载后按原名查找
+	dailyDataLock.Lock()
+	dailyData = nil
+	dailyDataLock.Unlock()
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	for name, want := range map[string]int64{unicodeName: 2, longName: 3} {
+		stats, err := GetModelStatsInRange(name, today, today)
+		if err != nil || stats.Requests != want {
+			t.Fatalf("GetModelStatsInRange(%q) = %+v, %v, want %d个请求", name, stats, err, want)
+		}
+	}
+	if first, err := GetModelFirstSeen(unicodeName); err != nil || first != today {
+		t.Fatalf("GetModelFirstSeen() = %q, %v", first, err)
+	}
+}
+
+func TestGetModelFailureRate(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-test", "model-a", "", "", 3, 10, 5, true)
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 10, 0, false)
+	AddDailyRequestStat("sk-test", "model-b", "", "", 2, 10, 5, true)
+
+	rate, err := GetModelFailureRate("model-a", "")
+	if err != nil || rate != 0.25 {
+		t.Fatalf("GetModelFailureRate(model-a) = %v, %v, want 0.25", rate, err)
+	}
+	if rate, err := GetModelFailureRate("model-b", ""); err != nil || rate != 0 {
+		t.Fatalf("GetModelFailureRate(model-b) = %v, %v, want 0", rate, err)
+	}
+	if _, err := GetModelFailureRate("model-c", ""); err == nil {
+		t.Fatal("没有请求记录的模型应返回错误")
+	}
+}
+
+func TestGetModelHistory(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, `{"version":"1.0","daily_stats":[
+		{"date": "2025-01-05", "models": {"model-a": {"requests": 5, "tokens": 50}}},
+		{"date": "2025-01-02", "models": {"model-a": {"requests": 2, "tokens": 20}, "model-b": {"requests": 9}}},
+		{"date": "2025-01-03", "models": {"model-b": {"requests": 3}}},
+		{"date": "2025-01-04", "models": {"model-a": {"requests": 0}}}
+	],"keys_usage":{}}`)
+
+	history, err := GetModelHistory("model-a")
+	if err != nil {
+		t.Fatalf("GetModelHistory() = %v", err)
+	}
+	want := []ModelHistoryPoint{
+		{Date: "2025-01-02", Requests: 2, Tokens: 20},
+		{Date: "2025-01-05", Requests: 5, Tokens: 50},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("GetModelHistory() = %+v, want %+v", history, want)
+	}
+	for i := range want {
+		if history[i] != want[i] {
+			t.Fatalf("GetModelHistory()[%d] = %+v, want %+v", i, history[i], want[i])
+		}
+	}
+	if none, err := GetModelHistory("model-c"); err != nil || len(none) != 0 {
+		t.Fatalf("没有使用过的模型 = %+v, %v", none, err)
+	}
+}
+
+func TestGetModelFirstSeen(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{ModelAliases: map[string]string{"alias-b": "model-b"}}, `{"version":"1.0","daily_stats":[
+		{"date": "2025-01-05", "models": {"model-a": {"requests": 5}}},
+		{"date": "2025-01-03", "models": {"model-a": {"requests": 1}, "model-b": {"requests": 2}}},
+		{"date": "2025-01-04", "models": {"model-b": {"requests": 3}}}
+	],"keys_usage":{}}`)
+
+	for model, want := range map[string]string{"model-a": "2025-01-03", "alias-b": "2025-01-03"} {
+		if got, err := GetModelFirstSeen(model); err != nil || got != want {
+			t.Fatalf("GetModelFirstSeen(%q) = %q, %v, want %q", model, got, err, want)
+		}
+	}
+	if _, err := GetModelFirstSeen("model-c"); !errors.Is(err, ErrModelNeverSeen) {
+		t.Fatalf("GetModelFirstSeen(model-c) = %v, want ErrModelNeverSeen", err)
+	}
+	if _, err := GetModelFirstSeen(""); err == nil {
+		t.Fatal("模型名为空时应返回错误")
+	}
+}
+
+func TestGetTopKeys(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	usage := []struct {
+		key              string
+		requests, tokens int
+	}{
+		{"sk-a", 1, 10},
+		{"sk-b", 2, 50},
+		{"sk-c", 1, 30},
+		{"sk-d", 3, 30},
+		{"sk-e", 1, 5},
+	}
+	for _, u := range usage {
+		AddDailyRequestStat(u.key, "model-a", "", "", u.requests, u.tokens, 0, true)
+	}
+
+	top, err := GetTopKeys("", 3)
+	if err != nil {
+		t.Fatalf("GetTopKeys() = %v", err)
+	}
+	// 令牌数相同时请求数多的在前
+	want := []KeyUsageEntry{
+		{KeyID: KeyID("sk-b"), Requests: 2, Tokens: 50},
+		{KeyID: KeyID("sk-d"), Requests: 3, Tokens: 30},
+		{KeyID: KeyID("sk-c"), Requests: 1, Tokens: 30},
+	}
+	if len(top) != len(want) {
+		t.Fatalf("GetTopKeys(3) = %+v, want %d项", top, len(want))
+	}
+	for i := range want {
+		if top[i].KeyID != want[i].KeyID || top[i].Requests != want[i].Requests || top[i].Tokens != want[i].Tokens {
+			t.Fatalf("GetTopKeys(3)[%d] = %+v, want %+v", i, top[i], want[i])
+		}
+	}
+
+	if all, _ := GetTopKeys("", 10); len(all) != len(usage) {
+		t.Fatalf("n大于密钥数时应返回全部: %d项", len(all))
+	}
+	if _, err := GetTopKeys("", 0); err == nil {
+		t.Fatal("数量不大于0时应返回错误")
+	}
+}
+
+func TestGetKeyTokenShare(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-a", "model-a", "", "", 1, 20, 10, true)
+	AddDailyRequestStat("sk-b", "model-a", "", "", 1, 60, 10, true)
+
+	// 原始密钥和稳定密钥标识查询结果相同
+	for _, key := range []string{"sk-a", KeyID("sk-a")} {
+		keyTokens, dayTokens, share, err := GetKeyTokenShare(key, "")
+		if err != nil {
+			t.Fatalf("GetKeyTokenShare() = %v", err)
+		}
+		if keyTokens != 30 || dayTokens != 100 || math.Abs(share-0.3) > 1e-9 {
+			t.Fatalf("GetKeyTokenShare(%q) = %d, %d, %v, want 30, 100, 0.3", key, keyTokens, dayTokens, share)
+		}
+	}
+
+	if keyTokens, _, share, _ := GetKeyTokenShare("sk-c", ""); keyTokens != 0 || share != 0 {
+		t.Fatalf("没有使用记录的密钥 = %d, %v, want 0, 0", keyTokens, share)
+	}
+	if _, dayTokens, share, err := GetKeyTokenShare("sk-a", "2025-01-02"); err != nil || dayTokens != 0 || share != 0 {
+		t.Fatalf("没有数据的日期 = %d, %v, %v, want 0, 0, nil", dayTokens, share, err)
+	}
+	if _, _, _, err := GetKeyTokenShare("", ""); err == nil {
+		t.Fatal("密钥为空时应返回错误")
+	}
+}
+
+func TestGetTopFailingModel(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, `{"version":"1.0","daily_stats":[
+		{"date": "2025-01-02", "models": {
+			"model-a": {"requests": 10, "success": 7, "failed": 3},
+			"model-b": {"requests": 4, "success": 1, "failed": 3},
+			"model-c": {"requests": 20, "success": 18, "failed": 2}
+		}},
+		{"date": "2025-01-03", "models": {"model-a": {"requests": 5, "success": 5}}}
+	],"keys_usage":{}}`)
+
+	// 失败数相同时取失败率高的模型
+	model, failed, rate, err := GetTopFailingModel("2025-01-02")
+	if err != nil {
+		t.Fatalf("GetTopFailingModel() = %v", err)
+	}
+	if model != "model-b" || failed != 3 || rate != 0.75 {
+		t.Fatalf("GetTopFailingModel() = %q, %d, %v, want model-b, 3, 0.75", model, failed, rate)
+	}
+
+	for _, date := range []string{"2025-01-03", "2025-01-04"} {
+		if _, _, _, err := GetTopFailingModel(date); !errors.Is(err, ErrNoFailedRequests) {
+			t.Fatalf("GetTopFailingModel(%q) = %v, want ErrNoFailedRequests", date, err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 23:10:00
+  @desc: 系统时间大幅校正后整理每日统计：合并重复日期、重新排序并补齐今天的数据
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"sort"
+)
+
+// ReconcileAfterClockChange 系统时间校正后整理每日统计数据并保存
+// 合并重复日期的记录，按日期升序排列（清理保留期数据依赖该顺序），确保今天的数据存在；
+// 晚于当前时间的最近请求时间重置为当前时间，晚于今天的日期只记录警告，不删除
+func ReconcileAfterClockChange() error {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if dailyData == nil {
+		return ErrStatsNotInitialized
+	}
+
+	merged := make([]DailyStats, 0, len(dailyData.DailyStats))
+	indexByDate := make(map[string]int, len(dailyData.DailyStats))
+	duplicates := 0
+	for _, stats := range dailyData.DailyStats {
+		if i, exists := indexByDate[stats.Date]; exists {
+			mergeDailyStats(&merged[i], stats)
+			duplicates++
+			continue
+		}
+		indexByDate[stats.Date] = len(merged)
+		merged = append(merged, stats)
+	}
+	dailyData.DailyStats = merged
+
+	ensureTodayDataExistsLocked()
+	sort.SliceStable(dailyData.DailyStats, func(i, j int) bool {
+		return dailyData.DailyStats[i].Date < dailyData.DailyStats[j].Date
+	})
+
+	now := statsNow()
+	today := now.Format("2006-01-02")
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date > today {
+			logger.Warn("每日统计中存在晚于今天的日期 %s，可能是时间校正前记录的", stats.Date)
+		}
+	}
+	if lastRequestTime.After(now) {
+		lastRequestTime = now
+	}
+
+	if duplicates > 0 {
+		logger.Warn("时间校正后合并了 %d 条重复日期的每日统计", duplicates)
+	}
+	dailyDirty = true
+	return saveDailyDataLocked()
+}
+
+// mergeDailyStats 将src的统计累加到dst，用于合并同一日期的重复记录
+func mergeDailyStats(dst *DailyStats, src DailyStats) {
+	dst.Requests.Total = addCount(dst.Requests.Total, src.Requests.Total)
+	dst.Requests.Success = addCount(dst.Requests.Success, src.Requests.Success)
+	dst.Requests.Failed = addCount(dst.Requests.Failed, src.Requests.Failed)
+	dst.Requests.Rejected = addCount(dst.Requests.Rejected, src.Requests.Rejected)
+	dst.Tokens.Total = addCount(dst.Tokens.Total, src.Tokens.Total)
+	dst.Tokens.Prompt = addCount(dst.Tokens.Prompt, src.Tokens.Prompt)
+	dst.Tokens.Completion = addCount(dst.Tokens.Completion, src.Tokens.Completion)
+	dst.Tokens.SuccessTokens = addCount(dst.Tokens.SuccessTokens, src.Tokens.SuccessTokens)
+	dst.Tokens.FailedTokens = addCount(dst.Tokens.FailedTokens, src.Tokens.FailedTokens)
+	dst.Tokens.Cost += src.Tokens.Cost
+	dst.StreamRequests = addCount(dst.StreamRequests, src.StreamRequests)
+	dst.NonStreamRequests = addCount(dst.NonStreamRequests, src.NonStreamRequests)
+	dst.MetaRequests = addCount(dst.MetaRequests, src.MetaRequests)
+	dst.ModelsTruncated = addCount(dst.ModelsTruncated, src.ModelsTruncated)
+	if src.MaxRequestTokens > dst.MaxRequestTokens {
+		dst.MaxRequestTokens = src.MaxRequestTokens
+	}
+	mergeTTFT(&dst.TTFT, src.TTFT)
+	mergeTTFT(&dst.TTFB, src.TTFB)
+
+	dst.StreamTimeouts.FirstByte = addCount(dst.StreamTimeouts.FirstByte, src.StreamTimeouts.FirstByte)
+	dst.StreamTimeouts.Idle = addCount(dst.StreamTimeouts.Idle, src.StreamTimeouts.Idle)
+	for keyID, count := range src.StreamTimeouts.ByKey {
+		if dst.StreamTimeouts.ByKey == nil {
+			dst.StreamTimeouts.ByKey = make(map[string]int)
+		}
+		dst.StreamTimeouts.ByKey[keyID] += count
+	}
+
+	for priority, wait := range src.QueueWait {
+		if dst.QueueWait == nil {
+			dst.QueueWait = make(map[string]QueueWaitStats)
+		}
+		total := dst.QueueWait[priority]
+		total.Requests = addCount(total.Requests, wait.Requests)
+		total.Queued = addCount(total.Queued, wait.Queued)
+		total.TotalMs += wait.TotalMs
+		total.Timeouts = addCount(total.Timeouts, wait.Timeouts)
+		if wait.MaxMs > total.MaxMs {
+			total.MaxMs = wait.MaxMs
+		}
+		if total.Requests > 0 {
+			total.AvgMs = float64(total.TotalMs) / float64(total.Requests)
+		}
+		dst.QueueWait[priority] = total
+	}
+
+	for endpoint, es := range src.Endpoints {
+		if dst.Endpoints == nil {
+			dst.Endpoints = make(map[string]DailyRequestStats)
+		}
+		total := dst.Endpoints[endpoint]
+		total.Total = addCount(total.Total, es.Total)
+		total.Success = addCount(total.Success, es.Success)
+		total.Failed = addCount(total.Failed, es.Failed)
+		dst.Endpoints[endpoint] = total
+	}
+
+	for reason, count := range src.RejectedReasons {
+		if dst.RejectedReasons == nil {
+			dst.RejectedReasons = make(map[string]int)
+		}
+		dst.RejectedReasons[reason] += count
+	}
+
+	for model, count := range src.Fallbacks {
+		if dst.Fallbacks == nil {
+			dst.Fallbacks = make(map[string]int)
+		}
+		dst.Fallbacks[model] += count
+	}
+
+	if dst.Models == nil {
+		dst.Models = make(map[string]ModelStats)
+	}
+	for name, ms := range src.Models {
+		total := dst.Models[name]
+		total.Requests = addCount(total.Requests, ms.Requests)
+		total.Tokens = addCount(total.Tokens, ms.Tokens)
+		total.Success = addCount(total.Success, ms.Success)
+		total.Failed = addCount(total.Failed, ms.Failed)
+		total.StreamRequests = addCount(total.StreamRequests, ms.StreamRequests)
+		total.NonStreamRequests = addCount(total.NonStreamRequests, ms.NonStreamRequests)
+		mergeTTFT(&total.TTFT, ms.TTFT)
+		mergeTTFT(&total.TTFB, ms.TTFB)
+		total.Latency = mergeLatency(total.Latency, ms.Latency)
+		total.Cost += ms.Cost
+		dst.Models[name] = total
+	}
+
+	// 任一记录已清除小时明细时，合并后的小时明细不完整，同样视为已清除
+	if dst.HourlyRolledUp || src.HourlyRolledUp {
+		dst.Hourly = []HourlyStats{}
+		dst.HourlyRolledUp = true
+	} else {
+		dst.Hourly = normalizeHourly(append(append([]HourlyStats{}, dst.Hourly...), src.Hourly...))
+	}
+
+	dst.Client.Total = addCount(dst.Client.Total, src.Client.Total)
+	dst.Client.Success = addCount(dst.Client.Success, src.Client.Success)
+	dst.Client.Failed = addCount(dst.Client.Failed, src.Client.Failed)
+
+	dst.Attempts.Total = addCount(dst.Attempts.Total, src.Attempts.Total)
+	dst.Attempts.Success = addCount(dst.Attempts.Success, src.Attempts.Success)
+	dst.Attempts.Failed = addCount(dst.Attempts.Failed, src.Attempts.Failed)
+	for keyID, ks := range src.Attempts.ByKey {
+		if dst.Attempts.ByKey == nil {
+			dst.Attempts.ByKey = make(map[string]KeyAttemptStats)
+		}
+		total := dst.Attempts.ByKey[keyID]
+		total.Total = addCount(total.Total, ks.Total)
+		total.Success = addCount(total.Success, ks.Success)
+		total.Failed = addCount(total.Failed, ks.Failed)
+		total.Cooldowns = addCount(total.Cooldowns, ks.Cooldowns)
+		dst.Attempts.ByKey[keyID] = total
+	}
+	for errorClass, count := range src.Attempts.ByErrorClass {
+		if dst.Attempts.ByErrorClass == nil {
+			dst.Attempts.ByErrorClass = make(map[string]int)
+		}
+		dst.Attempts.ByErrorClass[errorClass] += count
+	}
+}
+
+// mergeTTFT 合并延迟采样并重新计算平均值
+func mergeTTFT(dst *TTFTStats, src TTFTStats) {
+	dst.TotalMs += src.TotalMs
+	dst.Count += src.Count
+	if dst.Count > 0 {
+		dst.AvgMs = float64(dst.TotalMs) / float64(dst.Count)
+	}
+}
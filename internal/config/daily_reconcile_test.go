@@ -0,0 +1,72 @@
+package config
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestReconcileAfterClockChange(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	now := time.Now()
+	fakeStatsClock(t, now)
+
+	// 模拟时间回拨后重复记录同一日期且顺序错乱
+	first := newDailyStats("2025-01-03")
+	first.Requests = DailyRequestStats{Total: 3, Success: 2, Failed: 1}
+	first.Tokens = DailyTokenStats{Total: 30, Prompt: 20, Completion: 10}
+	first.Models["model-a"] = ModelStats{Requests: 3, Tokens: 30, Success: 2, Failed: 1}
+	first.Hourly[9].Requests = 3
+	second := newDailyStats("2025-01-03")
+	second.Requests = DailyRequestStats{Total: 2, Success: 2}
+	second.Tokens = DailyTokenStats{Total: 8, Prompt: 5, Completion: 3}
+	second.Models["model-a"] = ModelStats{Requests: 1, Tokens: 5, Success: 1}
+	second.Models["model-b"] = ModelStats{Requests: 1, Tokens: 3, Success: 1}
+	second.Hourly[9].Requests = 2
+	dailyDataLock.Lock()
+	dailyData.DailyStats = append(dailyData.DailyStats, first, newDailyStats("2025-01-02"), second)
+	lastRequestTime = now.Add(3 * time.Hour)
+	dailyDataLock.Unlock()
+
+	if err := ReconcileAfterClockChange(); err != nil {
+		t.Fatalf("ReconcileAfterClockChange() = %v", err)
+	}
+
+	dates := retainedDates()
+	if !sort.StringsAreSorted(dates) || len(dates) != 3 || dates[0] != "2025-01-02" || dates[1] != "2025-01-03" {
+		t.Fatalf("整理后的日期 = %v, want 去重并升序", dates)
+	}
+	merged := mustGetDailyStats(t, "2025-01-03")
+	if merged.Requests != (DailyRequestStats{Total: 5, Success: 4, Failed: 1}) {
+		t.Fatalf("合并后的请求统计 = %+v", merged.Requests)
+	}
+	if merged.Tokens.Total != 38 || merged.Tokens.Prompt != 25 || merged.Tokens.Completion != 13 {
+		t.Fatalf("合并后的令牌统计 = %+v", merged.Tokens)
+	}
+	if merged.Models["model-a"].Requests != 4 || merged.Models["model-a"].Tokens != 35 || merged.Models["model-b"].Requests != 1 {
+		t.Fatalf("合并后的模型统计 = %+v", merged.Models)
+	}
+	if len(merged.Hourly) != 24 || merged.Hourly[9].Requests != 5 {
+		t.Fatalf("合并后的小时统计 = %+v", merged.Hourly)
+	}
+	dailyDataLock.RLock()
+	last := lastRequestTime
+	dailyDataLock.RUnlock()
+	if !last.Equal(now) {
+		t.Fatalf("晚于当前时间的最近请求时间应重置为当前时间: %v, want %v", last, now)
+	}
+
+	// 整理结果已保存到文件
+	dailyDataLock.Lock()
+	dailyData = nil
+	dailyDataLock.Unlock()
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	if reloaded := retainedDates(); len(reloaded) != 3 {
+		t.Fatalf("重新加载后的日期 = %v", reloaded)
+	}
+}
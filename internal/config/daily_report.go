@@ -0,0 +1,125 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/2 10:15:00
+  @desc: 每日统计数据的文本报表输出
+**/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// markdownTopModels Markdown报表中展示的模型数量
+const markdownTopModels = 5
+
+// FormatDailyStatsMarkdown 将指定日期的统计数据格式化为Markdown表格
+func FormatDailyStatsMarkdown(date string) (string, error) {
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	stats, found, err := GetDailyStats(date)
+	if err != nil && !errors.Is(err, ErrStatsNotInitialized) {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("### FlowSilicon 每日统计 %s\n\n", date))
+
+	if !found || (stats.Requests.Total == 0 && stats.Client.Total == 0) {
+		sb.WriteString(fmt.Sprintf("_%s 暂无统计数据 (no data)_\n", date))
+		return sb.String(), nil
+	}
+
+	// 汇总表
+	sb.WriteString("| 指标 | 数值 |\n")
+	sb.WriteString("| --- | ---: |\n")
+	if stats.Client.Total > 0 {
+		// 默认展示客户端视角的成功率，上游尝试数用于容量分析
+		sb.WriteString(fmt.Sprintf("| 客户端请求数 | %d |\n", stats.Client.Total))
+		sb.WriteString(fmt.Sprintf("| 成功请求 | %d |\n", stats.Client.Success))
+		sb.WriteString(fmt.Sprintf("| 失败请求 | %d |\n", stats.Client.Failed))
+		sb.WriteString(fmt.Sprintf("| 成功率 | %s |\n", formatPercent(stats.Client.Success, stats.Client.Total)))
+		sb.WriteString(fmt.Sprintf("| 上游尝试数 | %d |\n", stats.Attempts.Total))
+		sb.WriteString(fmt.Sprintf("| 上游失败尝试 | %d |\n", stats.Attempts.Failed))
+	} else {
+		sb.WriteString(fmt.Sprintf("| 总请求数 | %d |\n", stats.Requests.Total))
+		sb.WriteString(fmt.Sprintf("| 成功请求 | %d |\n", stats.Requests.Success))
+		sb.WriteString(fmt.Sprintf("| 失败请求 | %d |\n", stats.Requests.Failed))
+		sb.WriteString(fmt.Sprintf("| 成功率 | %s |\n", formatPercent(stats.Requests.Success, stats.Requests.Total)))
+	}
+	sb.WriteString(fmt.Sprintf("| 总令牌数 | %d |\n", stats.Tokens.Total))
+	sb.WriteString(fmt.Sprintf("| 输入令牌 | %d |\n", stats.Tokens.Prompt))
+	sb.WriteString(fmt.Sprintf("| 输出令牌 | %d |\n", stats.Tokens.Completion))
+	if stats.Tokens.FailedTokens > 0 {
+		sb.WriteString(fmt.Sprintf("| 失败请求令牌 | %d |\n", stats.Tokens.FailedTokens))
+	}
+
+	// 热门模型表
+	if len(stats.Models) > 0 {
+		models := topModelsByRequests(stats.Models, markdownTopModels)
+
+		sb.WriteString("\n| 模型 | 请求数 | 令牌数 | 请求占比 |\n")
+		sb.WriteString("| --- | ---: | ---: | ---: |\n")
+		for _, m := range models {
+			sb.WriteString(fmt.Sprintf("| %s | %d | %d | %s |\n",
+				escapeMarkdownCell(m.name), m.stats.Requests, m.stats.Tokens,
+				formatPercent(m.stats.Requests, stats.Requests.Total)))
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// modelEntry 排序用的模型统计条目
+type modelEntry struct {
+	name  string
+	stats ModelStats
+}
+
+// OneLineSummary 生成指定日期统计的单行摘要，用于定期输出日志，日期为空时使用今天
+// 格式为 reqs=1234 ok=1200 fail=34 tokens=567890 models=5，没有数据的日期各项均为0
+func OneLineSummary(date string) (string, error) {
+	stats, _, err := GetDailyStats(date)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("reqs=%d ok=%d fail=%d tokens=%d models=%d",
+		stats.Requests.Total, stats.Requests.Success, stats.Requests.Failed, stats.Tokens.Total, len(stats.Models)), nil
+}
+
+// topModelsByRequests 按请求数降序取前n个模型，请求数相同时按名称排序
+func topModelsByRequests(models map[string]ModelStats, n int) []modelEntry {
+	entries := make([]modelEntry, 0, len(models))
+	for name, ms := range models {
+		entries = append(entries, modelEntry{name: name, stats: ms})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].stats.Requests != entries[j].stats.Requests {
+			return entries[i].stats.Requests > entries[j].stats.Requests
+		}
+		return entries[i].name < entries[j].name
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// formatPercent 格式化百分比，分母为0时返回0.00%
+func formatPercent(part, total int) string {
+	if total <= 0 {
+		return "0.00%"
+	}
+	return fmt.Sprintf("%.2f%%", float64(part)*100/float64(total))
+}
+
+// escapeMarkdownCell 转义Markdown表格单元格中的竖线
+func escapeMarkdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
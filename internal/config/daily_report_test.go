@@ -0,0 +1,71 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatDailyStatsMarkdown(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, `{"version":"1.0","daily_stats":[{
+		"date": "2025-01-02",
+		"requests": {"total": 8, "success": 6, "failed": 2},
+		"tokens": {"total": 900, "prompt": 700, "completion": 200},
+		"models": {
+			"model-a": {"requests": 6, "tokens": 800},
+			"model|b": {"requests": 2, "tokens": 100}
+		}
+	}],"keys_usage":{}}`)
+
+	out, err := FormatDailyStatsMarkdown("2025-01-02")
+	if err != nil {
+		t.Fatalf("FormatDailyStatsMarkdown() = %v", err)
+	}
+	for _, row := range []string{
+		"### FlowSilicon 每日统计 2025-01-02",
+		"| 总请求数 | 8 |",
+		"| 成功请求 | 6 |",
+		"| 失败请求 | 2 |",
+		"| 成功率 | 75.00% |",
+		"| 总令牌数 | 900 |",
+		"| model-a | 6 | 800 | 75.00% |",
+		"| model\\|b | 2 | 100 | 25.00% |",
+	} {
+		if !strings.Contains(out, row) {
+			t.Fatalf("报表中缺少 %q:\n%s", row, out)
+		}
+	}
+	if strings.Index(out, "model-a") > strings.Index(out, "model\\|b") {
+		t.Fatalf("模型应按请求数降序排列:\n%s", out)
+	}
+
+	empty, err := FormatDailyStatsMarkdown("2025-01-03")
+	if err != nil {
+		t.Fatalf("FormatDailyStatsMarkdown() = %v", err)
+	}
+	if !strings.Contains(empty, "2025-01-03 暂无统计数据") || strings.Contains(empty, "| 指标 |") {
+		t.Fatalf("没有数据的日期应只输出提示:\n%s", empty)
+	}
+}
+
+func TestOneLineSummary(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, `{"version":"1.0","daily_stats":[{
+		"date": "2025-01-02",
+		"requests": {"total": 1234, "success": 1200, "failed": 34},
+		"tokens": {"total": 567890, "prompt": 500000, "completion": 67890},
+		"models": {"m1": {"requests": 1}, "m2": {"requests": 1}, "m3": {"requests": 1}, "m4": {"requests": 1}, "m5": {"requests": 1230}}
+	}],"keys_usage":{}}`)
+
+	tests := map[string]string{
+		"2025-01-02": "reqs=1234 ok=1200 fail=34 tokens=567890 models=5",
+		"2025-01-03": "reqs=0 ok=0 fail=0 tokens=0 models=0",
+	}
+	for date, want := range tests {
+		got, err := OneLineSummary(date)
+		if err != nil {
+			t.Fatalf("OneLineSummary(%q) = %v", date, err)
+		}
+		if got != want {
+			t.Fatalf("OneLineSummary(%q) = %q, want %q", date, got, want)
+		}
+	}
+}
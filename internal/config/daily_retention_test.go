@@ -0,0 +1,89 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// retainedDates 返回内存中保留的日期
+func retainedDates() []string {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+	dates := make([]string, 0, len(dailyData.DailyStats))
+	for _, stats := range dailyData.DailyStats {
+		dates = append(dates, stats.Date)
+	}
+	return dates
+}
+
+func TestPauseAndResumeTrimming(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{RetentionDays: 3}, fmt.Sprintf(`{"version":"1.0","daily_stats":[
+		{"date": %q}, {"date": %q}
+	],"keys_usage":{}}`, daysAgo(2), daysAgo(1)))
+
+	// 嵌套暂停时需要全部恢复才会清理
+	PauseTrimming()
+	PauseTrimming()
+	dailyDataLock.Lock()
+	dailyData.DailyStats = append([]DailyStats{newDailyStats(daysAgo(5)), newDailyStats(daysAgo(4))}, dailyData.DailyStats...)
+	trimDailyRetentionLocked()
+	dailyDataLock.Unlock()
+	if dates := retainedDates(); len(dates) != 5 {
+		t.Fatalf("暂停期间保留的日期 = %v, want 5天", dates)
+	}
+
+	ResumeTrimming()
+	if dates := retainedDates(); len(dates) != 5 {
+		t.Fatalf("仍有未恢复的暂停时保留的日期 = %v, want 5天", dates)
+	}
+
+	ResumeTrimming()
+	dates := retainedDates()
+	if len(dates) != 3 || dates[0] != daysAgo(2) {
+		t.Fatalf("恢复后保留的日期 = %v, want 最近3天", dates)
+	}
+	dailyDataLock.RLock()
+	dirty := dailyDirty
+	dailyDataLock.RUnlock()
+	if !dirty {
+		t.Fatal("恢复后清理了数据应标记为有未保存的变更")
+	}
+
+	// 多余的恢复不影响之后的暂停计数
+	ResumeTrimming()
+	if trimPauses != 0 {
+		t.Fatalf("trimPauses = %d, want 0", trimPauses)
+	}
+}
+
+func TestGetRetentionUsage(t *testing.T) {
+	// 部分使用：保留期5天，只有3天数据
+	seedDailyStatsForTest(t, StatsConfig{RetentionDays: 5}, fmt.Sprintf(`{"version":"1.0","daily_stats":[
+		{"date": %q}, {"date": %q}
+	],"keys_usage":{}}`, daysAgo(3), daysAgo(1)))
+	used, maxDays, oldest, newest, err := GetRetentionUsage()
+	if err != nil {
+		t.Fatalf("GetRetentionUsage() = %v", err)
+	}
+	if used != 3 || maxDays != 5 || oldest != daysAgo(3) || newest != daysAgo(0) {
+		t.Fatalf("GetRetentionUsage() = %d, %d, %s, %s, want 3, 5, %s, %s", used, maxDays, oldest, newest, daysAgo(3), daysAgo(0))
+	}
+
+	// 完全使用：超过保留期的数据已清理
+	seedDailyStatsForTest(t, StatsConfig{RetentionDays: 3}, fmt.Sprintf(`{"version":"1.0","daily_stats":[
+		{"date": %q}, {"date": %q}, {"date": %q}, {"date": %q}
+	],"keys_usage":{}}`, daysAgo(4), daysAgo(3), daysAgo(2), daysAgo(1)))
+	used, maxDays, oldest, newest, err = GetRetentionUsage()
+	if err != nil {
+		t.Fatalf("GetRetentionUsage() = %v", err)
+	}
+	if used != 3 || maxDays != 3 || oldest != daysAgo(2) || newest != daysAgo(0) {
+		t.Fatalf("GetRetentionUsage() = %d, %d, %s, %s, want 3, 3, %s, %s", used, maxDays, oldest, newest, daysAgo(2), daysAgo(0))
+	}
+
+	resetDailyStatsForTest(t, StatsConfig{})
+	if _, maxDays, _, _, err := GetRetentionUsage(); !errors.Is(err, ErrStatsNotInitialized) || maxDays != defaultDailyStatsRetentionDays {
+		t.Fatalf("未初始化时 GetRetentionUsage() = %d, %v", maxDays, err)
+	}
+}
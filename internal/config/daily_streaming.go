@@ -0,0 +1,228 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 22:40:00
+  @desc: 流式请求按数据块增量记录令牌数，请求结束时再记录请求数和结果
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"fmt"
+	"time"
+)
+
+// streamingRequestTTL 进行中的流式请求超过该时间没有更新时视为已中断，按失败结束
+const streamingRequestTTL = time.Hour
+
+// streamingRequest 进行中的流式请求已记录的令牌数
+type streamingRequest struct {
+	apiKey       string
+	model        string
+	tokensByDate map[string]int // 按记录日期的令牌数，请求跨天时分别计入各天的成功或失败令牌数
+	updated      time.Time
+}
+
+// streamingRequests 进行中的流式请求，按请求ID索引，受dailyDataLock保护
+var streamingRequests = make(map[string]*streamingRequest)
+
+// AddStreamingTokenDelta 记录流式请求新收到的令牌数，立即计入今天的令牌、模型、小时和密钥统计
+// 请求数和成功/失败在FinalizeStreamingRequest时记录，同一请求的模型和密钥以首次记录为准
+func AddStreamingTokenDelta(requestID, apiKey, model string, promptDelta, completionDelta int) {
+	if requestID == "" {
+		return
+	}
+	if promptDelta < 0 {
+		promptDelta = 0
+	}
+	if completionDelta < 0 {
+		completionDelta = 0
+	}
+
+	// 配额回调在释放统计锁之后执行
+	var quotaNotify func()
+	defer func() {
+		if quotaNotify != nil {
+			quotaNotify()
+		}
+	}()
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	now := statsNow()
+	expireStreamingRequestsLocked(now)
+
+	entry, exists := streamingRequests[requestID]
+	if !exists {
+		entry = &streamingRequest{
+			apiKey:       apiKey,
+			model:        normalizeModelName(ResolveModelAlias(model)),
+			tokensByDate: make(map[string]int),
+		}
+		streamingRequests[requestID] = entry
+	}
+	entry.updated = now
+
+	totalTokens := promptDelta + completionDelta
+	if totalTokens == 0 {
+		return
+	}
+
+	today := time.Now().Format("2006-01-02")
+	currentHour := time.Now().Hour()
+	todayStats := todayStatsLocked()
+	entry.tokensByDate[today] += totalTokens
+
+	todayStats.Tokens.Total += totalTokens
+	todayStats.Tokens.Prompt += promptDelta
+	todayStats.Tokens.Completion += completionDelta
+
+	if entry.model != "" {
+		modelStats := todayStats.Models[entry.model]
+		modelStats.Tokens += totalTokens
+		todayStats.Models[entry.model] = modelStats
+	}
+
+	hourly := &todayStats.Hourly[currentHour]
+	hourly.Tokens += totalTokens
+	hourly.PromptTokens += promptDelta
+	hourly.CompletionTokens += completionDelta
+	if entry.model != "" && getStatsConfig().HourlyByModel {
+		if hourly.Models == nil {
+			hourly.Models = make(map[string]HourlyModelStats)
+		}
+		hourlyModel := hourly.Models[entry.model]
+		hourlyModel.Tokens += totalTokens
+		hourly.Models[entry.model] = hourlyModel
+	}
+
+	if entry.apiKey != "" {
+		keyID := KeyID(entry.apiKey)
+		addKeyUsageLocked(keyID, today, 0, totalTokens)
+		quotaNotify = checkQuotaExceededLocked(keyID, today, dailyData.KeysUsage[keyID][today].Tokens)
+	}
+
+	if cost := estimateCost(entry.model, promptDelta, completionDelta); cost > 0 {
+		keyID := ""
+		if entry.apiKey != "" {
+			keyID = KeyID(entry.apiKey)
+		}
+		addCostLocked(todayStats, entry.model, keyID, cost)
+	}
+
+	dailyDirty = true
+	scheduleDailySaveLocked()
+}
+
+// FinalizeStreamingRequest 结束流式请求，记录请求数和成功/失败
+// 中途出错的请求以success=false结束，已收到的令牌计入失败令牌数；请求不存在时返回错误
+func FinalizeStreamingRequest(requestID string, success bool) error {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	entry, exists := streamingRequests[requestID]
+	if !exists {
+		return fmt.Errorf("没有进行中的流式请求: %s", requestID)
+	}
+	finalizeStreamingRequestLocked(requestID, entry, success)
+	scheduleDailySaveLocked()
+	return nil
+}
+
+// finalizeStreamingRequestLocked 记录流式请求的请求数和结果并移除（已加锁）
+// 请求数计入今天，令牌按记录时的日期计入成功或失败令牌数
+func finalizeStreamingRequestLocked(requestID string, entry *streamingRequest, success bool) {
+	delete(streamingRequests, requestID)
+	lastRequestTime = statsNow()
+
+	today := time.Now().Format("2006-01-02")
+	currentHour := time.Now().Hour()
+	todayStats := todayStatsLocked()
+
+	todayStats.Requests.Total++
+	todayStats.StreamRequests++
+	if success {
+		todayStats.Requests.Success++
+	} else {
+		todayStats.Requests.Failed++
+	}
+
+	requestTokens := 0
+	for _, tokens := range entry.tokensByDate {
+		requestTokens += tokens
+	}
+	if requestTokens > todayStats.MaxRequestTokens {
+		todayStats.MaxRequestTokens = requestTokens
+	}
+
+	for date, tokens := range entry.tokensByDate {
+		for i := range dailyData.DailyStats {
+			if dailyData.DailyStats[i].Date != date {
+				continue
+			}
+			if success {
+				dailyData.DailyStats[i].Tokens.SuccessTokens += tokens
+			} else {
+				dailyData.DailyStats[i].Tokens.FailedTokens += tokens
+			}
+			break
+		}
+	}
+
+	if entry.model != "" {
+		modelStats := todayStats.Models[entry.model]
+		modelStats.Requests++
+		modelStats.StreamRequests++
+		if success {
+			modelStats.Success++
+		} else {
+			modelStats.Failed++
+		}
+		todayStats.Models[entry.model] = modelStats
+	}
+
+	hourly := &todayStats.Hourly[currentHour]
+	hourly.Requests++
+	if entry.model != "" && getStatsConfig().HourlyByModel {
+		if hourly.Models == nil {
+			hourly.Models = make(map[string]HourlyModelStats)
+		}
+		hourlyModel := hourly.Models[entry.model]
+		hourlyModel.Requests++
+		hourly.Models[entry.model] = hourlyModel
+	}
+
+	if entry.apiKey != "" {
+		addKeyUsageLocked(KeyID(entry.apiKey), today, 1, 0)
+	}
+
+	dailyDirty = true
+	dailyPending++
+}
+
+// expireStreamingRequestsLocked 将超过streamingRequestTTL没有更新的流式请求按失败结束（已加锁）
+// 避免调用方未结束请求时记录一直保留在内存中
+func expireStreamingRequestsLocked(now time.Time) {
+	for requestID, entry := range streamingRequests {
+		if now.Sub(entry.updated) < streamingRequestTTL {
+			continue
+		}
+		logger.Warn("流式请求 %s 超过%v没有更新，按失败结束", requestID, streamingRequestTTL)
+		finalizeStreamingRequestLocked(requestID, entry, false)
+	}
+}
+
+// addKeyUsageLocked 累加密钥在指定日期的使用统计（已加锁）
+func addKeyUsageLocked(keyID, date string, requests, tokens int) {
+	if dailyData.KeysUsage == nil {
+		dailyData.KeysUsage = make(map[string]map[string]KeyUsage)
+	}
+	if dailyData.KeysUsage[keyID] == nil {
+		dailyData.KeysUsage[keyID] = make(map[string]KeyUsage)
+	}
+	keyUsage := dailyData.KeysUsage[keyID][date]
+	keyUsage.Requests += requests
+	keyUsage.Tokens += tokens
+	dailyData.KeysUsage[keyID][date] = keyUsage
+}
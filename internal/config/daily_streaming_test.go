@@ -0,0 +1,69 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamingDeltasThenFinalize(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+
+	AddStreamingTokenDelta("req-1", "sk-test", "model-a", 10, 0)
+	AddStreamingTokenDelta("req-1", "sk-test", "model-a", 0, 4)
+	AddStreamingTokenDelta("req-1", "sk-test", "model-a", 0, 6)
+
+	// 结束前令牌已计入，请求数尚未计入
+	stats := mustGetDailyStats(t, "")
+	if stats.Tokens.Total != 20 || stats.Tokens.Prompt != 10 || stats.Tokens.Completion != 10 {
+		t.Fatalf("结束前令牌统计 = %+v, want 20/10/10", stats.Tokens)
+	}
+	if stats.Requests.Total != 0 || stats.Models["model-a"].Tokens != 20 || stats.Models["model-a"].Requests != 0 {
+		t.Fatalf("结束前请求统计 = %+v, 模型统计 = %+v", stats.Requests, stats.Models["model-a"])
+	}
+
+	if err := FinalizeStreamingRequest("req-1", true); err != nil {
+		t.Fatalf("FinalizeStreamingRequest() = %v", err)
+	}
+	AddStreamingTokenDelta("req-2", "sk-test", "model-a", 5, 3)
+	if err := FinalizeStreamingRequest("req-2", false); err != nil {
+		t.Fatalf("FinalizeStreamingRequest() = %v", err)
+	}
+
+	stats = mustGetDailyStats(t, "")
+	if stats.Requests.Total != 2 || stats.Requests.Success != 1 || stats.Requests.Failed != 1 || stats.StreamRequests != 2 {
+		t.Fatalf("结束后请求统计 = %+v, 流式请求数 = %d", stats.Requests, stats.StreamRequests)
+	}
+	if stats.Tokens.Total != 28 || stats.Tokens.SuccessTokens != 20 || stats.Tokens.FailedTokens != 8 {
+		t.Fatalf("结束后令牌统计 = %+v, want 总计28、成功20、失败8", stats.Tokens)
+	}
+	if model := stats.Models["model-a"]; model.Requests != 2 || model.Success != 1 || model.Failed != 1 || model.Tokens != 28 {
+		t.Fatalf("模型统计 = %+v", model)
+	}
+
+	if err := FinalizeStreamingRequest("req-1", true); err == nil {
+		t.Fatal("重复结束流式请求应返回错误")
+	}
+}
+
+func TestStreamingRequestExpiresAsFailed(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	clock := fakeStatsClock(t, time.Now())
+
+	AddStreamingTokenDelta("req-stale", "sk-test", "model-a", 4, 2)
+	*clock = clock.Add(streamingRequestTTL)
+	AddStreamingTokenDelta("req-new", "sk-test", "model-a", 1, 0)
+
+	stats := mustGetDailyStats(t, "")
+	if stats.Requests.Failed != 1 || stats.Tokens.FailedTokens != 6 {
+		t.Fatalf("超时的流式请求应按失败结束: %+v, %+v", stats.Requests, stats.Tokens)
+	}
+	if err := FinalizeStreamingRequest("req-stale", true); err == nil {
+		t.Fatal("已超时结束的流式请求不应再能结束")
+	}
+}
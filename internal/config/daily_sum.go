@@ -0,0 +1,128 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 23:40:00
+  @desc: 多日统计汇总时的计数累加，汇总结果按int64累加，32位平台上避免int溢出
+**/
+
+package config
+
+import "math"
+
+// addCount 累加计数，溢出时取int的上限或下限而不是回绕，用于合并同一日期的记录等结果仍为int的场景
+// 32位平台上int只有32位更容易溢出；多日汇总使用int64字段，不经过截断
+func addCount(a, b int) int {
+	if b > 0 && a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	if b < 0 && a < math.MinInt-b {
+		return math.MinInt
+	}
+	return a + b
+}
+
+// RangeRequestStats 多日汇总的请求统计
+type RangeRequestStats struct {
+	Total    int64 `json:"total"`
+	Success  int64 `json:"success"`
+	Failed   int64 `json:"failed"`
+	Rejected int64 `json:"rejected,omitempty"`
+}
+
+// RangeTokenStats 多日汇总的令牌统计
+type RangeTokenStats struct {
+	Total         int64   `json:"total"`
+	Prompt        int64   `json:"prompt"`
+	Completion    int64   `json:"completion"`
+	SuccessTokens int64   `json:"success_tokens,omitempty"`
+	FailedTokens  int64   `json:"failed_tokens,omitempty"`
+	Cost          float64 `json:"cost,omitempty"`
+}
+
+// RangeTTFTStats 多日汇总的首字延迟统计
+type RangeTTFTStats struct {
+	TotalMs int64   `json:"total_ms"`
+	Count   int64   `json:"count"`
+	AvgMs   float64 `json:"avg_ms"`
+}
+
+// add 累加一天的首字延迟统计，并重新计算平均值
+func (t *RangeTTFTStats) add(day TTFTStats) {
+	t.TotalMs += day.TotalMs
+	t.Count += int64(day.Count)
+	if t.Count > 0 {
+		t.AvgMs = float64(t.TotalMs) / float64(t.Count)
+	}
+}
+
+// ModelRangeStats 模型在多日内的汇总统计
+type ModelRangeStats struct {
+	Requests          int64             `json:"requests"`
+	Tokens            int64             `json:"tokens"`
+	Success           int64             `json:"success"`
+	Failed            int64             `json:"failed"`
+	StreamRequests    int64             `json:"stream_requests"`
+	NonStreamRequests int64             `json:"non_stream_requests"`
+	TTFT              RangeTTFTStats    `json:"ttft"`
+	TTFB              RangeTTFTStats    `json:"ttfb"`
+	Latency           *LatencyHistogram `json:"latency,omitempty"`
+	Cost              float64           `json:"cost,omitempty"`
+}
+
+// add 累加模型一天的统计
+func (m *ModelRangeStats) add(day ModelStats) {
+	m.Requests += int64(day.Requests)
+	m.Tokens += int64(day.Tokens)
+	m.Success += int64(day.Success)
+	m.Failed += int64(day.Failed)
+	m.StreamRequests += int64(day.StreamRequests)
+	m.NonStreamRequests += int64(day.NonStreamRequests)
+	m.TTFT.add(day.TTFT)
+	m.TTFB.add(day.TTFB)
+	m.Latency = mergeLatency(m.Latency, day.Latency)
+	m.Cost += day.Cost
+}
+
+// PeriodStats 一段日期（如本周至今、本月至今）的汇总统计
+type PeriodStats struct {
+	StartDate         string                     `json:"start_date"`
+	EndDate           string                     `json:"end_date"`
+	Days              int                        `json:"days"` // 有统计数据的天数
+	Requests          RangeRequestStats          `json:"requests"`
+	Tokens            RangeTokenStats            `json:"tokens"`
+	StreamRequests    int64                      `json:"stream_requests"`
+	NonStreamRequests int64                      `json:"non_stream_requests"`
+	MetaRequests      int64                      `json:"meta_requests,omitempty"`
+	Models            map[string]ModelRangeStats `json:"models"`
+}
+
+// newPeriodStats 创建startDate至endDate的空汇总
+func newPeriodStats(startDate, endDate string) PeriodStats {
+	return PeriodStats{
+		StartDate: startDate,
+		EndDate:   endDate,
+		Models:    make(map[string]ModelRangeStats),
+	}
+}
+
+// add 累加一天的统计
+func (p *PeriodStats) add(day DailyStats) {
+	p.Days++
+	p.Requests.Total += int64(day.Requests.Total)
+	p.Requests.Success += int64(day.Requests.Success)
+	p.Requests.Failed += int64(day.Requests.Failed)
+	p.Requests.Rejected += int64(day.Requests.Rejected)
+	p.Tokens.Total += int64(day.Tokens.Total)
+	p.Tokens.Prompt += int64(day.Tokens.Prompt)
+	p.Tokens.Completion += int64(day.Tokens.Completion)
+	p.Tokens.SuccessTokens += int64(day.Tokens.SuccessTokens)
+	p.Tokens.FailedTokens += int64(day.Tokens.FailedTokens)
+	p.Tokens.Cost += day.Tokens.Cost
+	p.StreamRequests += int64(day.StreamRequests)
+	p.NonStreamRequests += int64(day.NonStreamRequests)
+	p.MetaRequests += int64(day.MetaRequests)
+	for name, ms := range day.Models {
+		total := p.Models[name]
+		total.add(ms)
+		p.Models[name] = total
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// largeDayCount 32位平台上单日不溢出、但多日累加后超出int32范围的计数
+const largeDayCount = math.MaxInt32 - 1
+
+// seedLargeDays 从start开始连续days天，每天的请求数和令牌数均为largeDayCount
+func seedLargeDays(t *testing.T, start time.Time, days int) {
+	t.Helper()
+	resetDailyStatsForTest(t, StatsConfig{})
+
+	data := createDefaultDailyData()
+	data.DailyStats = nil
+	for i := 0; i < days; i++ {
+		stats := newDailyStats(start.AddDate(0, 0, i).Format("2006-01-02"))
+		stats.Requests = DailyRequestStats{Total: largeDayCount, Success: largeDayCount}
+		stats.Tokens = DailyTokenStats{Total: largeDayCount, Prompt: largeDayCount}
+		stats.Models["model-a"] = ModelStats{Requests: largeDayCount, Tokens: largeDayCount, Success: largeDayCount}
+		data.DailyStats = append(data.DailyStats, stats)
+	}
+
+	dailyDataLock.Lock()
+	dailyData = data
+	dailyDataLock.Unlock()
+}
+
+// wrapsOn32Bit 模拟32位平台上按int累加：结果超出int32范围时会回绕
+func wrapsOn32Bit(sum int64) bool {
+	return int64(int32(sum)) != sum
+}
+
+func TestGetModelStatsInRangeNoOverflow(t *testing.T) {
+	const days = 40
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	seedLargeDays(t, start, days)
+
+	result, err := GetModelStatsInRange("model-a", "2025-01-01", "2025-02-09")
+	if err != nil {
+		t.Fatalf("GetModelStatsInRange() = %v", err)
+	}
+	want := int64(days) * largeDayCount
+	if result.Requests != want || result.Tokens != want || result.Success != want {
+		t.Fatalf("GetModelStatsInRange() = %d/%d/%d, want %d", result.Requests, result.Tokens, result.Success, want)
+	}
+	if !wrapsOn32Bit(result.Requests) {
+		t.Fatal("测试数据的汇总应超出int32范围")
+	}
+}
+
+func TestPeriodStatsNoOverflow(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	seedLargeDays(t, start, 31)
+	statsNow = func() time.Time { return start.AddDate(0, 0, 30).Add(12 * time.Hour) }
+	t.Cleanup(func() { statsNow = time.Now })
+
+	month, err := GetMonthToDate()
+	if err != nil {
+		t.Fatalf("GetMonthToDate() = %v", err)
+	}
+	want := int64(31) * largeDayCount
+	if month.Days != 31 || month.Requests.Total != want || month.Tokens.Total != want {
+		t.Fatalf("GetMonthToDate() = %d天 %d/%d, want 31天 %d", month.Days, month.Requests.Total, month.Tokens.Total, want)
+	}
+	if month.Models["model-a"].Requests != want {
+		t.Fatalf("模型请求数 = %d, want %d", month.Models["model-a"].Requests, want)
+	}
+	if !wrapsOn32Bit(month.Requests.Total) {
+		t.Fatal("测试数据的汇总应超出int32范围")
+	}
+
+	// 2025-01-31为周五，本周从周一2025-01-27开始
+	week, err := GetWeekToDate()
+	if err != nil {
+		t.Fatalf("GetWeekToDate() = %v", err)
+	}
+	if week.StartDate != "2025-01-27" || week.Days != 5 || week.Requests.Total != 5*largeDayCount {
+		t.Fatalf("GetWeekToDate() = %s %d天 %d", week.StartDate, week.Days, week.Requests.Total)
+	}
+}
+
+func TestAddCountSaturates(t *testing.T) {
+	if got := addCount(math.MaxInt, 1); got != math.MaxInt {
+		t.Fatalf("addCount(MaxInt, 1) = %d, want MaxInt", got)
+	}
+	if got := addCount(math.MinInt, -1); got != math.MinInt {
+		t.Fatalf("addCount(MinInt, -1) = %d, want MinInt", got)
+	}
+}
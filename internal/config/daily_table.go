@@ -0,0 +1,162 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 17:20:00
+  @desc: 以纯文本表格输出每日统计，供命令行子命令使用
+**/
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// tableTopModels 表格中展示的模型数量
+	tableTopModels = 10
+)
+
+// sparkBlocks 小时分布使用的字符，由低到高
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// RenderStatsTable 将指定日期的统计数据以文本表格写入w，date为空时使用今天
+// 指定日期没有数据时输出提示而不返回错误，日期格式错误或统计未初始化时返回错误
+func RenderStatsTable(w io.Writer, date string) error {
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return fmt.Errorf("日期格式错误，应为YYYY-MM-DD: %s", date)
+	}
+
+	stats, found, err := GetDailyStats(date)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "FlowSilicon 每日统计 %s\n\n", date)
+	if !found || (stats.Requests.Total == 0 && stats.Client.Total == 0) {
+		fmt.Fprintf(w, "%s 暂无统计数据\n", date)
+		return nil
+	}
+
+	// 汇总
+	summary := [][]string{
+		{"指标", "数值"},
+		{"总请求数", strconv.Itoa(stats.Requests.Total)},
+		{"成功请求", strconv.Itoa(stats.Requests.Success)},
+		{"失败请求", strconv.Itoa(stats.Requests.Failed)},
+		{"成功率", formatPercent(stats.Requests.Success, stats.Requests.Total)},
+	}
+	if stats.Client.Total > 0 {
+		summary = append(summary,
+			[]string{"客户端请求数", strconv.Itoa(stats.Client.Total)},
+			[]string{"客户端成功率", formatPercent(stats.Client.Success, stats.Client.Total)})
+	}
+	summary = append(summary,
+		[]string{"总令牌数", strconv.Itoa(stats.Tokens.Total)},
+		[]string{"输入令牌", strconv.Itoa(stats.Tokens.Prompt)},
+		[]string{"输出令牌", strconv.Itoa(stats.Tokens.Completion)})
+	if stats.Tokens.FailedTokens > 0 {
+		summary = append(summary, []string{"失败请求令牌", strconv.Itoa(stats.Tokens.FailedTokens)})
+	}
+	writeTextTable(w, summary)
+
+	// 热门模型
+	if len(stats.Models) > 0 {
+		fmt.Fprintf(w, "\n热门模型 (前%d)\n", tableTopModels)
+		rows := [][]string{{"模型", "请求数", "令牌数", "请求占比"}}
+		for _, m := range topModelsByRequests(stats.Models, tableTopModels) {
+			rows = append(rows, []string{m.name, strconv.Itoa(m.stats.Requests), strconv.Itoa(m.stats.Tokens),
+				formatPercent(m.stats.Requests, stats.Requests.Total)})
+		}
+		writeTextTable(w, rows)
+	}
+
+	// 小时分布
+	requests := make([]int, 24)
+	tokens := make([]int, 24)
+	for _, h := range stats.Hourly {
+		if h.Hour >= 0 && h.Hour < 24 {
+			requests[h.Hour] += h.Requests
+			tokens[h.Hour] += h.Tokens
+		}
+	}
+	peakHour := 0
+	for hour, count := range requests {
+		if count > requests[peakHour] {
+			peakHour = hour
+		}
+	}
+
+	fmt.Fprintln(w, "\n小时分布 (00-23)")
+	fmt.Fprintf(w, "请求  %s\n", sparkline(requests))
+	fmt.Fprintf(w, "令牌  %s\n", sparkline(tokens))
+	fmt.Fprintf(w, "高峰  %02d:00 (%d 次请求)\n", peakHour, requests[peakHour])
+	return nil
+}
+
+// writeTextTable 按显示宽度对齐输出表格，中文字符按两个字符宽度计算
+func writeTextTable(w io.Writer, rows [][]string) {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if width := displayWidth(cell); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+
+	for _, row := range rows {
+		var sb strings.Builder
+		for i, cell := range row {
+			sb.WriteString(cell)
+			if i < len(row)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[i]-displayWidth(cell)+2))
+			}
+		}
+		fmt.Fprintln(w, sb.String())
+	}
+}
+
+// displayWidth 估算字符串在终端中的显示宽度
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if r >= 0x1100 && (r <= 0x115F || (r >= 0x2E80 && r <= 0xA4CF) || (r >= 0xAC00 && r <= 0xD7A3) ||
+			(r >= 0xF900 && r <= 0xFAFF) || (r >= 0xFE30 && r <= 0xFE4F) || (r >= 0xFF00 && r <= 0xFF60) ||
+			(r >= 0xFFE0 && r <= 0xFFE6)) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// sparkline 将数值序列转换为字符迷你图，0显示为·
+func sparkline(values []int) string {
+	maxValue := 0
+	for _, v := range values {
+		if v > maxValue {
+			maxValue = v
+		}
+	}
+
+	var sb strings.Builder
+	for _, v := range values {
+		if v <= 0 || maxValue == 0 {
+			sb.WriteRune('·')
+			continue
+		}
+		idx := v * (len(sparkBlocks) - 1) / maxValue
+		sb.WriteRune(sparkBlocks[idx])
+	}
+	return sb.String()
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// seededStatsFile 默认环境和prod环境各有一天数据的统计文件
+const seededStatsFile = `{
+  "version": "1.1",
+  "environments": {
+    "default": {
+      "daily_stats": [{"date": "2025-01-02", "requests": {"total": 1, "success": 1}}]
+    },
+    "prod": {
+      "daily_stats": [{
+        "date": "2025-01-02",
+        "requests": {"total": 12, "success": 9, "failed": 3},
+        "tokens": {"total": 3456, "prompt": 3000, "completion": 456},
+        "models": {"model-a": {"requests": 12, "tokens": 3456, "success": 9, "failed": 3}}
+      }]
+    }
+  }
+}`
+
+func TestRenderStatsTableSeededDay(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	dailyFilePath = filepath.Join(t.TempDir(), "daily.json")
+	if err := os.WriteFile(dailyFilePath, []byte(seededStatsFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	if err := SetStatsEnvironment("prod"); err != nil {
+		t.Fatalf("SetStatsEnvironment() = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := RenderStatsTable(&buf, "2025-01-02"); err != nil {
+		t.Fatalf("RenderStatsTable() = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"FlowSilicon 每日统计 2025-01-02", "12", "75.00%", "3456", "model-a"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("输出中缺少 %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	if err := RenderStatsTable(&buf, "2025-01-03"); err != nil {
+		t.Fatalf("RenderStatsTable() = %v", err)
+	}
+	if !strings.Contains(buf.String(), "2025-01-03 暂无统计数据") {
+		t.Fatalf("没有数据的日期应输出提示:\n%s", buf.String())
+	}
+	if err := RenderStatsTable(&buf, "2025/01/02"); err == nil {
+		t.Fatal("日期格式错误时应返回错误")
+	}
+}
+
+func TestLoadProfileStatsUsesProfileEnvironment(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	baseDir := t.TempDir()
+	paths, err := resolveProfilePaths(baseDir, "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(paths.Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(paths.DailyFilePath, []byte(seededStatsFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 档案配置中的统计环境为prod
+	if err := InitConfigDB(paths.DBPath); err != nil {
+		t.Fatalf("InitConfigDB() = %v", err)
+	}
+	if err := ApplyConfig(&Config{Stats: StatsConfig{Environment: "prod"}}); err != nil {
+		t.Fatalf("ApplyConfig() = %v", err)
+	}
+	CloseConfigDB()
+	UpdateConfig(&Config{})
+
+	if _, err := LoadProfileStats(baseDir, "team", ""); err != nil {
+		t.Fatalf("LoadProfileStats() = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := RenderStatsTable(&buf, "2025-01-02"); err != nil {
+		t.Fatalf("RenderStatsTable() = %v", err)
+	}
+	if !strings.Contains(buf.String(), "3456") {
+		t.Fatalf("应输出档案配置的prod环境的统计:\n%s", buf.String())
+	}
+	if !IsDailyStatsReadOnly() {
+		t.Fatal("命令行查看统计时应为只读模式")
+	}
+	if _, err := os.Stat(filepath.Join(baseDir, profilesDirName, activeProfileFileName)); !os.IsNotExist(err) {
+		t.Fatal("查看统计不应记录当前档案")
+	}
+
+	// 指定的环境优先于档案配置
+	if _, err := LoadProfileStats(baseDir, "team", DefaultStatsEnvironment); err != nil {
+		t.Fatalf("LoadProfileStats() = %v", err)
+	}
+	stats, _, _ := GetDailyStats("2025-01-02")
+	if stats.Requests.Total != 1 {
+		t.Fatalf("default环境请求数 = %d, want 1", stats.Requests.Total)
+	}
+}
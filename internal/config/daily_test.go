@@ -0,0 +1,560 @@
+package config
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFileWithBackupKeepsPrimaryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daily.json")
+
+	if err := writeFileWithBackup(path, []byte("v1"), 0644); err != nil {
+		t.Fatalf("writeFileWithBackup() = %v", err)
+	}
+	if _, err := os.Stat(dailyBackupPath(path)); !os.IsNotExist(err) {
+		t.Fatalf("首次写入不应生成备份: %v", err)
+	}
+
+	if err := writeFileWithBackup(path, []byte("v2"), 0644); err != nil {
+		t.Fatalf("writeFileWithBackup() = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "v2" {
+		t.Fatalf("统计文件内容 = %q, want v2", data)
+	}
+	if data, _ := os.ReadFile(dailyBackupPath(path)); string(data) != "v1" {
+		t.Fatalf("备份内容 = %q, want v1", data)
+	}
+
+	// 备份与新文件互不影响，再次保存时备份更新为上一版本
+	if err := writeFileWithBackup(path, []byte("v3"), 0644); err != nil {
+		t.Fatalf("writeFileWithBackup() = %v", err)
+	}
+	if data, _ := os.ReadFile(dailyBackupPath(path)); string(data) != "v2" {
+		t.Fatalf("备份内容 = %q, want v2", data)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 2 {
+		t.Fatalf("目录中应只有统计文件和备份，实际有 %d 个文件", len(entries))
+	}
+}
+
+func TestBackupFileBeforeReplaceSurvivesInterruptedSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daily.json")
+	if err := os.WriteFile(path, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟生成备份后、重命名前中断：统计文件仍是完整的旧版本
+	if err := backupFile(path, dailyBackupPath(path), 0644); err != nil {
+		t.Fatalf("backupFile() = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "v1" {
+		t.Fatalf("统计文件内容 = %q, want v1", data)
+	}
+	if data, _ := os.ReadFile(dailyBackupPath(path)); string(data) != "v1" {
+		t.Fatalf("备份内容 = %q, want v1", data)
+	}
+}
+
+func TestLoadDailyStatsRecoversFromBackup(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{})
+	backup := `{"version":"1.1","environments":{"default":{"daily_stats":[{"date":"2025-01-02","requests":{"total":3}}]}}}`
+	if err := os.WriteFile(dailyBackupPath(path), []byte(backup), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"version":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	stats, found, err := GetDailyStats("2025-01-02")
+	if err != nil || !found || stats.Requests.Total != 3 {
+		t.Fatalf("GetDailyStats() = %+v, %v, %v，应从备份恢复", stats, found, err)
+	}
+	if _, err := os.Stat(path + ".corrupt"); err != nil {
+		t.Fatalf("应保留损坏的统计文件: %v", err)
+	}
+}
+
+func TestGetStatsFileInfoReadOnlyReplica(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{})
+	data := `{"version":"1.0","daily_stats":[{"date":"2025-01-02","requests":{"total":4}}],"keys_usage":{}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	SetDailyStatsReadOnly(true)
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, _, _, err := GetStatsFileInfo()
+	if err != nil {
+		t.Fatalf("GetStatsFileInfo() = %v", err)
+	}
+	if size != info.Size() || size == 0 {
+		t.Fatalf("只读副本的统计文件大小 = %d, want %d", size, info.Size())
+	}
+}
+
+func TestGetStatsFileInfoWithoutFile(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	SetDailyStatsReadOnly(true)
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+
+	size, _, _, err := GetStatsFileInfo()
+	if err != nil || size != 0 {
+		t.Fatalf("GetStatsFileInfo() = %d, %v, want 0, nil", size, err)
+	}
+}
+
+func TestEnsureTodayDataExistsAddsEmptyDay(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+	dailyData = createDefaultDailyData()
+	dailyData.DailyStats[0].Date = "2025-01-02"
+	ensureTodayDataExistsLocked()
+
+	if len(dailyData.DailyStats) != 2 {
+		t.Fatalf("天数 = %d, want 2", len(dailyData.DailyStats))
+	}
+	today := dailyData.DailyStats[1]
+	if today.Date != time.Now().Format("2006-01-02") || today.Models == nil || len(today.Hourly) != 24 {
+		t.Fatalf("今天的统计数据 = %+v", today)
+	}
+	for i, h := range today.Hourly {
+		if h.Hour != i {
+			t.Fatalf("Hourly[%d].Hour = %d", i, h.Hour)
+		}
+	}
+}
+
+func TestDeleteKeyUsagesSavesOnce(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	for _, key := range []string{"sk-one", "sk-two", "sk-three", "sk-kept"} {
+		AddDailyRequestStat(key, "model-a", "", "", 1, 10, 5, true)
+	}
+	if err := FlushDailyStats(); err != nil {
+		t.Fatalf("FlushDailyStats() = %v", err)
+	}
+
+	saves := countDailySaves(t)
+
+	removed, err := DeleteKeyUsages([]string{"sk-one", "sk-two", KeyID("sk-three"), "sk-missing"})
+	if err != nil || removed != 3 {
+		t.Fatalf("DeleteKeyUsages() = %d, %v, want 3, nil", removed, err)
+	}
+	if got := saves(); got != 1 {
+		t.Fatalf("保存次数 = %d, want 1", got)
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+	if len(dailyData.KeysUsage) != 1 || dailyData.KeysUsage[KeyID("sk-kept")] == nil {
+		t.Fatalf("剩余的密钥记录 = %v", dailyData.KeysUsage)
+	}
+}
+
+func TestAddDailyRequestStatWithNilModels(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	today := time.Now().Format("2006-01-02")
+
+	dailyDataLock.Lock()
+	dailyData = createDefaultDailyData()
+	dailyData.DailyStats = []DailyStats{{Date: today}}
+	dailyDataLock.Unlock()
+
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 10, 5, true)
+
+	stats, found, err := GetDailyStats(today)
+	if err != nil || !found {
+		t.Fatalf("GetDailyStats() = %v, %v", found, err)
+	}
+	if stats.Models["model-a"].Requests != 1 || stats.Requests.Total != 1 {
+		t.Fatalf("统计 = %+v", stats)
+	}
+	if len(stats.Hourly) != 24 {
+		t.Fatalf("Hourly长度 = %d, want 24", len(stats.Hourly))
+	}
+}
+
+func TestEnsureTodayDataOnFreshStore(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{})
+	today := time.Now().Format("2006-01-02")
+
+	for i := 0; i < 2; i++ {
+		if err := EnsureTodayData(); err != nil {
+			t.Fatalf("EnsureTodayData() = %v", err)
+		}
+	}
+
+	dailyDataLock.RLock()
+	days := dailyData.DailyStats
+	dailyDataLock.RUnlock()
+	if len(days) != 1 || days[0].Date != today {
+		t.Fatalf("重复调用后的统计数据 = %+v, want 只有今天一条", days)
+	}
+	if len(days[0].Hourly) != 24 || days[0].Models == nil {
+		t.Fatalf("今天的统计数据 = %+v", days[0])
+	}
+	for i, h := range days[0].Hourly {
+		if h.Hour != i {
+			t.Fatalf("Hourly[%d].Hour = %d", i, h.Hour)
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("创建今天的数据后应保存统计文件: %v", err)
+	}
+}
+
+func TestEnsureTodayDataNormalizesExistingDay(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	today := time.Now().Format("2006-01-02")
+
+	dailyDataLock.Lock()
+	dailyData = createDefaultDailyData()
+	dailyData.DailyStats[0].Hourly = []HourlyStats{{Hour: 3, Requests: 2, Tokens: 20}}
+	dailyDataLock.Unlock()
+
+	if err := EnsureTodayData(); err != nil {
+		t.Fatalf("EnsureTodayData() = %v", err)
+	}
+	stats, _, _ := GetDailyStats(today)
+	if len(stats.Hourly) != 24 || stats.Hourly[3].Requests != 2 {
+		t.Fatalf("修复后的小时统计 = %+v", stats.Hourly)
+	}
+}
+
+func TestRetentionRemovesAgedOutKeys(t *testing.T) {
+	today := time.Now().Format("2006-01-02")
+	seedDailyStatsForTest(t, StatsConfig{RetentionDays: 2}, `{"version":"1.0","daily_stats":[
+		{"date": "2025-01-01", "requests": {"total": 1}},
+		{"date": "2025-01-02", "requests": {"total": 1}}
+	],"keys_usage":{
+		"k-aged": {"2025-01-01": {"requests": 1, "tokens": 10}},
+		"k-mixed": {"2025-01-01": {"requests": 1, "tokens": 10}, "2025-01-02": {"requests": 2, "tokens": 20}}
+	}}`)
+	if err := EnsureTodayData(); err != nil {
+		t.Fatalf("EnsureTodayData() = %v", err)
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+	if len(dailyData.DailyStats) != 2 || dailyData.DailyStats[0].Date != "2025-01-02" || dailyData.DailyStats[1].Date != today {
+		t.Fatalf("保留的日期 = %+v", dailyData.DailyStats)
+	}
+	if _, ok := dailyData.KeysUsage["k-aged"]; ok {
+		t.Fatal("所有日期都已过期的密钥应从KeysUsage中删除")
+	}
+	mixed := dailyData.KeysUsage["k-mixed"]
+	if len(mixed) != 1 || mixed["2025-01-02"].Requests != 2 {
+		t.Fatalf("k-mixed的使用记录 = %+v", mixed)
+	}
+}
+
+func TestHourlyTokenSplit(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 100, 20, true)
+	AddDailyRequestStat("sk-test", "model-b", "", "", 2, 50, 5, true)
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 7, 0, false)
+
+	stats, _, err := GetDailyStats(time.Now().Format("2006-01-02"))
+	if err != nil {
+		t.Fatalf("GetDailyStats() = %v", err)
+	}
+	// 按所有小时求和，避免测试跨越整点时的误判
+	var prompt, completion, tokens int
+	for _, h := range stats.Hourly {
+		if h.Tokens != h.PromptTokens+h.CompletionTokens {
+			t.Fatalf("第%d小时令牌数 %d != 提示词 %d + 补全 %d", h.Hour, h.Tokens, h.PromptTokens, h.CompletionTokens)
+		}
+		prompt += h.PromptTokens
+		completion += h.CompletionTokens
+		tokens += h.Tokens
+	}
+	if prompt != 157 || completion != 25 {
+		t.Fatalf("小时提示词令牌 = %d, 补全令牌 = %d, want 157, 25", prompt, completion)
+	}
+	if prompt != stats.Tokens.Prompt || completion != stats.Tokens.Completion || tokens != stats.Tokens.Total {
+		t.Fatalf("小时令牌之和与当日统计不一致: %d/%d/%d, %+v", prompt, completion, tokens, stats.Tokens)
+	}
+}
+
+func TestTimeSinceLastRequest(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	clock := fakeStatsClock(t, time.Now())
+
+	if got := TimeSinceLastRequest(); got != NoRequestRecorded {
+		t.Fatalf("尚未记录请求时 TimeSinceLastRequest() = %v, want NoRequestRecorded", got)
+	}
+
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 10, 5, true)
+	*clock = clock.Add(90 * time.Second)
+	if got := TimeSinceLastRequest(); got != 90*time.Second {
+		t.Fatalf("TimeSinceLastRequest() = %v, want 90s", got)
+	}
+
+	// 系统时间回拨时返回0
+	*clock = clock.Add(-time.Hour)
+	if got := TimeSinceLastRequest(); got != 0 {
+		t.Fatalf("时间回拨后 TimeSinceLastRequest() = %v, want 0", got)
+	}
+}
+
+func TestFallbackStatsForTwoModels(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-test", "backup-a", "primary-a", "", 1, 10, 5, true)
+	AddDailyRequestStat("sk-test", "backup-a", "primary-a", "", 2, 10, 5, true)
+	AddDailyRequestStat("sk-test", "backup-b", "primary-b", "", 1, 10, 5, false)
+	// 未回退或原模型与实际模型相同时不计入
+	AddDailyRequestStat("sk-test", "primary-a", "", "", 1, 10, 5, true)
+	AddDailyRequestStat("sk-test", "primary-b", "primary-b", "", 1, 10, 5, true)
+
+	fallbacks, found, err := GetFallbackStats("")
+	if err != nil || !found {
+		t.Fatalf("GetFallbackStats() = %v, %v", found, err)
+	}
+	if len(fallbacks) != 2 || fallbacks["primary-a"] != 3 || fallbacks["primary-b"] != 1 {
+		t.Fatalf("回退统计 = %v, want primary-a:3 primary-b:1", fallbacks)
+	}
+
+	// 回退的请求按实际使用的模型统计
+	stats, _, _ := GetDailyStats("")
+	if stats.Models["backup-a"].Requests != 3 || stats.Models["primary-a"].Requests != 1 {
+		t.Fatalf("模型统计 = %+v", stats.Models)
+	}
+}
+
+func TestModelAliasesMergeIntoOneEntry(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{ModelAliases: map[string]string{
+		"gpt-4o":      "Qwen/Qwen2.5-72B-Instruct",
+		"qwen-latest": "Qwen/Qwen2.5-72B-Instruct",
+	}})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-test", "gpt-4o", "", "", 1, 10, 5, true)
+	AddDailyRequestStat("sk-test", "qwen-latest", "", "", 2, 20, 10, true)
+	AddDailyRequestStat("sk-test", "Qwen/Qwen2.5-72B-Instruct", "", "", 1, 10, 0, false)
+
+	stats, _, _ := GetDailyStats("")
+	if len(stats.Models) != 1 {
+		t.Fatalf("别名应合并为一个模型: %+v", stats.Models)
+	}
+	ms := stats.Models["Qwen/Qwen2.5-72B-Instruct"]
+	if ms.Requests != 4 || ms.Tokens != 55 || ms.Success != 3 || ms.Failed != 1 {
+		t.Fatalf("合并后的模型统计 = %+v", ms)
+	}
+}
+
+func TestMetaRequestsDoNotAffectTotals(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-test", "model-a", "", "", 2, 10, 5, true)
+	AddMetaRequestStat(3)
+	AddMetaRequestStat(0)
+	AddMetaRequestStat(-1)
+
+	stats, _, _ := GetDailyStats("")
+	if stats.MetaRequests != 3 {
+		t.Fatalf("MetaRequests = %d, want 3", stats.MetaRequests)
+	}
+	if stats.Requests.Total != 2 || stats.Requests.Success != 2 || stats.Tokens.Total != 15 {
+		t.Fatalf("元请求不应计入请求数和令牌数: %+v, %+v", stats.Requests, stats.Tokens)
+	}
+	if len(stats.Models) != 1 {
+		t.Fatalf("元请求不应计入模型统计: %+v", stats.Models)
+	}
+}
+
+func TestGetStatsFileInfoPopulatedStore(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-one", "model-a", "", "", 1, 10, 5, true)
+	AddDailyRequestStat("sk-two", "model-a", "", "", 1, 10, 5, true)
+	if err := FlushDailyStats(); err != nil {
+		t.Fatalf("FlushDailyStats() = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, days, keys, err := GetStatsFileInfo()
+	if err != nil {
+		t.Fatalf("GetStatsFileInfo() = %v", err)
+	}
+	if size != info.Size() || days != 1 || keys != 2 {
+		t.Fatalf("GetStatsFileInfo() = %d, %d, %d, want %d, 1, 2", size, days, keys, info.Size())
+	}
+}
+
+func TestGetStatsFileInfoWithoutStatsFile(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-one", "model-a", "", "", 1, 10, 5, true)
+
+	// 未设置统计文件时只在内存中统计
+	dailyDataLock.Lock()
+	dailyFilePath = ""
+	dailyDataLock.Unlock()
+
+	size, days, keys, err := GetStatsFileInfo()
+	if err != nil || size != 0 || days != 1 || keys != 1 {
+		t.Fatalf("GetStatsFileInfo() = %d, %d, %d, %v, want 0, 1, 1, nil", size, days, keys, err)
+	}
+}
+
+func TestTokensRouteBySuccess(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 100, 20, true)
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 30, 7, false)
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 5, 0, true)
+
+	tokens := mustGetDailyStats(t, "").Tokens
+	if tokens.SuccessTokens != 125 || tokens.FailedTokens != 37 {
+		t.Fatalf("成功/失败令牌 = %d/%d, want 125/37", tokens.SuccessTokens, tokens.FailedTokens)
+	}
+	if tokens.Total != tokens.SuccessTokens+tokens.FailedTokens {
+		t.Fatalf("总令牌 %d != 成功 %d + 失败 %d", tokens.Total, tokens.SuccessTokens, tokens.FailedTokens)
+	}
+}
+
+func TestAddDailyRequestStatFRounding(t *testing.T) {
+	tests := []struct {
+		rounding           string
+		prompt, completion int
+	}{
+		{"", 3, 3},
+		{TokenRoundingRound, 3, 3},
+		{TokenRoundingFloor, 2, 2},
+		{TokenRoundingCeil, 4, 4},
+	}
+	for _, tt := range tests {
+		t.Run("rounding="+tt.rounding, func(t *testing.T) {
+			resetDailyStatsForTest(t, StatsConfig{TokenRounding: tt.rounding})
+			if err := InitDailyStats(); err != nil {
+				t.Fatalf("InitDailyStats() = %v", err)
+			}
+			// 2.5四舍五入为3，2.4为2，分别取整后再相加
+			AddDailyRequestStatF("sk-test", "model-a", "", "", 1, 2.5, 2.4, true)
+			AddDailyRequestStatF("sk-test", "model-a", "", "", 1, 0.2, 0.6, true)
+
+			tokens := mustGetDailyStats(t, "").Tokens
+			if tokens.Prompt != tt.prompt || tokens.Completion != tt.completion {
+				t.Fatalf("提示词/补全令牌 = %d/%d, want %d/%d", tokens.Prompt, tokens.Completion, tt.prompt, tt.completion)
+			}
+			if tokens.Total != tt.prompt+tt.completion {
+				t.Fatalf("总令牌 = %d, want %d", tokens.Total, tt.prompt+tt.completion)
+			}
+		})
+	}
+}
+
+func TestRoundTokensClampsOutOfRange(t *testing.T) {
+	for _, rounding := range []string{TokenRoundingRound, TokenRoundingFloor, TokenRoundingCeil} {
+		resetDailyStatsForTest(t, StatsConfig{TokenRounding: rounding})
+		for _, tokens := range []float64{1e20, float64(math.MaxInt), math.MaxFloat64} {
+			if got := roundTokens(tokens); got != math.MaxInt {
+				t.Fatalf("%s: roundTokens(%g) = %d, want math.MaxInt", rounding, tokens, got)
+			}
+		}
+		for _, tokens := range []float64{-1e20, math.NaN(), math.Inf(1)} {
+			if got := roundTokens(tokens); got != 0 {
+				t.Fatalf("%s: roundTokens(%g) = %d, want 0", rounding, tokens, got)
+			}
+		}
+	}
+}
+
+func TestMaxRequestTokens(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 100, 20, true)
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 30, 5, false)
+	// 多个请求的记录按平均值计：400/4 = 100
+	AddDailyRequestStat("sk-test", "model-a", "", "", 4, 300, 100, true)
+	if got := mustGetDailyStats(t, "").MaxRequestTokens; got != 120 {
+		t.Fatalf("MaxRequestTokens = %d, want 120", got)
+	}
+
+	// 流式请求按整个请求的令牌数计
+	AddStreamingTokenDelta("req-1", "sk-test", "model-a", 80, 0)
+	AddStreamingTokenDelta("req-1", "sk-test", "model-a", 0, 70)
+	if got := mustGetDailyStats(t, "").MaxRequestTokens; got != 120 {
+		t.Fatalf("流式请求结束前 MaxRequestTokens = %d, want 120", got)
+	}
+	if err := FinalizeStreamingRequest("req-1", true); err != nil {
+		t.Fatalf("FinalizeStreamingRequest() = %v", err)
+	}
+	if got := mustGetDailyStats(t, "").MaxRequestTokens; got != 150 {
+		t.Fatalf("MaxRequestTokens = %d, want 150", got)
+	}
+}
+
+func TestRejectedRequestsDoNotInflateFailures(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 10, 5, true)
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 4, 0, false)
+	AddRejectedRequest("model_disabled")
+	AddRejectedRequest("model_disabled")
+	AddRejectedRequest("")
+
+	stats := mustGetDailyStats(t, "")
+	if stats.Requests != (DailyRequestStats{Total: 5, Success: 1, Failed: 1, Rejected: 3}) {
+		t.Fatalf("请求统计 = %+v, want 总计5、成功1、失败1、拒绝3", stats.Requests)
+	}
+	if stats.Tokens.Total != 19 || stats.Tokens.FailedTokens != 4 {
+		t.Fatalf("本地拒绝不应增加令牌数: %+v", stats.Tokens)
+	}
+	if stats.Models["model-a"].Requests != 2 {
+		t.Fatalf("本地拒绝不应计入模型统计: %+v", stats.Models["model-a"])
+	}
+
+	reasons, err := GetRejectedReasons("")
+	if err != nil {
+		t.Fatalf("GetRejectedReasons() = %v", err)
+	}
+	if len(reasons) != 2 || reasons["model_disabled"] != 2 || reasons["unknown"] != 1 {
+		t.Fatalf("GetRejectedReasons() = %v", reasons)
+	}
+}
@@ -0,0 +1,73 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 22:20:00
+  @desc: 将当天统计压缩编码为可复制粘贴的文本，便于附在问题反馈中
+**/
+
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxTransportStatsBytes 解码时解压后数据的上限，防止异常数据占用过多内存
+const maxTransportStatsBytes = 16 * 1024 * 1024
+
+// EncodeStatsForTransport 将今天的统计数据编码为base64格式的gzip压缩JSON
+// 只包含DailyStats，不含密钥使用统计
+func EncodeStatsForTransport() (string, error) {
+	stats, _, err := GetDailyStats("")
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return "", fmt.Errorf("序列化统计数据失败: %w", err)
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return "", fmt.Errorf("压缩统计数据失败: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("压缩统计数据失败: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeStatsFromTransport 解码EncodeStatsForTransport生成的文本，忽略首尾空白
+func DecodeStatsFromTransport(encoded string) (*DailyStats, error) {
+	compressed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("base64解码失败: %w", err)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("解压统计数据失败: %w", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxTransportStatsBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("解压统计数据失败: %w", err)
+	}
+	if len(data) > maxTransportStatsBytes {
+		return nil, errors.New("解压后的统计数据过大")
+	}
+
+	var stats DailyStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("解析统计数据失败: %w", err)
+	}
+	return &stats, nil
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatsTransportRoundTrip(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	AddDailyRequestStat("sk-test", "model-a", "", "/v1/chat/completions", 2, 30, 12, true)
+	AddDailyRequestStat("sk-test", "model-b", "", "/v1/chat/completions", 1, 8, 0, false)
+
+	encoded, err := EncodeStatsForTransport()
+	if err != nil {
+		t.Fatalf("EncodeStatsForTransport() = %v", err)
+	}
+	decoded, err := DecodeStatsFromTransport("\n " + encoded + " \n")
+	if err != nil {
+		t.Fatalf("DecodeStatsFromTransport() = %v", err)
+	}
+	if want := mustGetDailyStats(t, ""); !reflect.DeepEqual(decoded, want) {
+		t.Fatalf("解码后的统计与原统计不一致:\n%+v\n%+v", decoded, want)
+	}
+
+	for _, bad := range []string{"不是base64", "aGVsbG8="} {
+		if _, err := DecodeStatsFromTransport(bad); err == nil {
+			t.Fatalf("DecodeStatsFromTransport(%q) 应返回错误", bad)
+		}
+	}
+}
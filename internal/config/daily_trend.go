@@ -0,0 +1,262 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 10:05:00
+  @desc: 每日统计数据的移动平均与趋势计算
+**/
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// defaultTrendDays 趋势数据默认返回的天数
+	defaultTrendDays = 30
+	// maxTrendDays 趋势数据最多返回的天数
+	maxTrendDays = 366
+)
+
+// TrendPoint 单日的指标值与移动平均
+type TrendPoint struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+	MA7   float64 `json:"ma7"`  // 7日移动平均，窗口超出最早保留日期时缩小窗口
+	MA30  float64 `json:"ma30"` // 30日移动平均，窗口超出最早保留日期时缩小窗口
+}
+
+// MetricTrend 单个指标的趋势数据
+type MetricTrend struct {
+	Points []TrendPoint `json:"points"`
+	// Slope 最近7天（不足7天时取全部）每日值的线性回归斜率，单位为每天的变化量
+	Slope float64 `json:"slope"`
+	// WeekOverWeek 最近7天均值相比前7天均值的变化百分比，数据不足或前7天为0时为nil
+	WeekOverWeek *float64 `json:"week_over_week"`
+}
+
+// StatsTrend 各指标的趋势数据
+type StatsTrend struct {
+	Requests    MetricTrend `json:"requests"`
+	Tokens      MetricTrend `json:"tokens"`
+	SuccessRate MetricTrend `json:"success_rate"` // 成功率的移动平均按请求数加权
+}
+
+// trendSeries 按天排列的分子/分母序列，每日值为num/den
+type trendSeries struct {
+	num []float64
+	den []float64
+}
+
+// GetStatsTrend 计算最近days天的请求数、令牌数、成功率及其7日/30日移动平均
+// 序列从最早保留的日期开始，中间没有数据的日期按0计
+func GetStatsTrend(days int) (*StatsTrend, error) {
+	if days <= 0 {
+		days = defaultTrendDays
+	}
+	if days > maxTrendDays {
+		days = maxTrendDays
+	}
+
+	dailyDataLock.RLock()
+	if dailyData == nil {
+		dailyDataLock.RUnlock()
+		return &StatsTrend{}, ErrStatsNotInitialized
+	}
+	byDate := make(map[string]DailyRequestStats, len(dailyData.DailyStats))
+	tokensByDate := make(map[string]int, len(dailyData.DailyStats))
+	earliest := ""
+	for _, stats := range dailyData.DailyStats {
+		byDate[stats.Date] = stats.Requests
+		tokensByDate[stats.Date] = stats.Tokens.Total
+		if earliest == "" || stats.Date < earliest {
+			earliest = stats.Date
+		}
+	}
+	dailyDataLock.RUnlock()
+
+	today, _ := time.ParseInLocation("2006-01-02", time.Now().Format("2006-01-02"), time.Local)
+	start := today
+	if earliest != "" {
+		t, err := time.ParseInLocation("2006-01-02", earliest, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("解析日期失败: %w", err)
+		}
+		if t.Before(start) {
+			start = t
+		}
+	}
+
+	var dates []string
+	var requests, tokens, success trendSeries
+	for d := start; !d.After(today); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		req := byDate[date]
+		dates = append(dates, date)
+		requests.append(float64(req.Total), 1)
+		tokens.append(float64(tokensByDate[date]), 1)
+		success.append(float64(req.Success), float64(req.Total))
+	}
+
+	first := len(dates) - days
+	if first < 0 {
+		first = 0
+	}
+	return &StatsTrend{
+		Requests:    requests.trend(dates, first),
+		Tokens:      tokens.trend(dates, first),
+		SuccessRate: success.trend(dates, first),
+	}, nil
+}
+
+// append 追加一天的数据
+func (s *trendSeries) append(num, den float64) {
+	s.num = append(s.num, num)
+	s.den = append(s.den, den)
+}
+
+// value 第i天的值，分母为0时为0
+func (s *trendSeries) value(i int) float64 {
+	if s.den[i] == 0 {
+		return 0
+	}
+	return s.num[i] / s.den[i]
+}
+
+// window 以第i天结尾、最长size天的窗口均值，窗口起点早于序列起点时缩小窗口
+func (s *trendSeries) window(i, size int) float64 {
+	from := i - size + 1
+	if from < 0 {
+		from = 0
+	}
+	var num, den float64
+	for j := from; j <= i; j++ {
+		num += s.num[j]
+		den += s.den[j]
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+// trend 生成从第first天开始的趋势数据
+func (s *trendSeries) trend(dates []string, first int) MetricTrend {
+	result := MetricTrend{Points: make([]TrendPoint, 0, len(dates)-first)}
+	for i := first; i < len(dates); i++ {
+		result.Points = append(result.Points, TrendPoint{
+			Date:  dates[i],
+			Value: s.value(i),
+			MA7:   s.window(i, 7),
+			MA30:  s.window(i, 30),
+		})
+	}
+
+	last := len(dates) - 1
+	if last < 0 {
+		return result
+	}
+
+	// 最近7天每日值的线性回归斜率
+	from := last - 6
+	if from < 0 {
+		from = 0
+	}
+	n := float64(last - from + 1)
+	if n > 1 {
+		var sumX, sumY, sumXY, sumXX float64
+		for j := from; j <= last; j++ {
+			x := float64(j - from)
+			y := s.value(j)
+			sumX += x
+			sumY += y
+			sumXY += x * y
+			sumXX += x * x
+		}
+		if denom := n*sumXX - sumX*sumX; denom != 0 {
+			result.Slope = (n*sumXY - sumX*sumY) / denom
+		}
+	}
+
+	// 周环比需要完整的前7天数据
+	if last >= 13 {
+		current := s.window(last, 7)
+		previous := s.window(last-7, 7)
+		if previous != 0 {
+			change := (current - previous) / previous * 100
+			result.WeekOverWeek = &change
+		}
+	}
+
+	return result
+}
+
+// GetActiveDayRatio 统计最近days天（含今天）中有请求的天数及其占比
+// 没有记录或请求数为0的日期均视为无活动，total始终为days
+func GetActiveDayRatio(days int) (activeDays int, total int, ratio float64, err error) {
+	if days <= 0 {
+		return 0, 0, 0, fmt.Errorf("天数必须大于0: %d", days)
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return 0, 0, 0, ErrStatsNotInitialized
+	}
+
+	now := time.Now()
+	cutoff := now.AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+	today := now.Format("2006-01-02")
+	activeDates := make(map[string]bool)
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date >= cutoff && stats.Date <= today && stats.Requests.Total > 0 {
+			activeDates[stats.Date] = true
+		}
+	}
+
+	activeDays = len(activeDates)
+	return activeDays, days, float64(activeDays) / float64(days), nil
+}
+
+// RatePoint 单日的成功率
+type RatePoint struct {
+	Date   string  `json:"date"`
+	Rate   float64 `json:"rate"`    // 成功请求数/总请求数，没有请求时为0
+	NoData bool    `json:"no_data"` // 当天没有请求，Rate无意义
+}
+
+// GetSuccessRateSeries 获取最近days天（含今天）每天的成功率，按日期升序
+// 没有记录或请求数为0的日期Rate为0并标记NoData
+func GetSuccessRateSeries(days int) ([]RatePoint, error) {
+	if days <= 0 {
+		return nil, fmt.Errorf("天数必须大于0: %d", days)
+	}
+	if days > maxTrendDays {
+		days = maxTrendDays
+	}
+
+	dailyDataLock.RLock()
+	if dailyData == nil {
+		dailyDataLock.RUnlock()
+		return nil, ErrStatsNotInitialized
+	}
+	byDate := make(map[string]DailyRequestStats, len(dailyData.DailyStats))
+	for _, stats := range dailyData.DailyStats {
+		byDate[stats.Date] = stats.Requests
+	}
+	dailyDataLock.RUnlock()
+
+	today, _ := time.ParseInLocation("2006-01-02", time.Now().Format("2006-01-02"), time.Local)
+	points := make([]RatePoint, 0, days)
+	for d := today.AddDate(0, 0, -(days - 1)); !d.After(today); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		req := byDate[date]
+		point := RatePoint{Date: date, NoData: req.Total == 0}
+		if req.Total > 0 {
+			point.Rate = float64(req.Success) / float64(req.Total)
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
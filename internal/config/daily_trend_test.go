@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// daysAgo 返回n天前的日期字符串
+func daysAgo(n int) string {
+	return time.Now().AddDate(0, 0, -n).Format("2006-01-02")
+}
+
+func TestActiveDayRatio(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, fmt.Sprintf(`{"version":"1.0","daily_stats":[
+		{"date": %q, "requests": {"total": 3, "success": 3}},
+		{"date": %q, "requests": {"total": 0}},
+		{"date": %q, "requests": {"total": 1, "failed": 1}},
+		{"date": %q, "requests": {"total": 5, "success": 5}}
+	],"keys_usage":{}}`, daysAgo(0), daysAgo(1), daysAgo(2), daysAgo(10)))
+
+	active, total, ratio, err := GetActiveDayRatio(7)
+	if err != nil {
+		t.Fatalf("GetActiveDayRatio() = %v", err)
+	}
+	if active != 2 || total != 7 || math.Abs(ratio-2.0/7) > 1e-9 {
+		t.Fatalf("GetActiveDayRatio(7) = %d, %d, %v, want 2, 7, %v", active, total, ratio, 2.0/7)
+	}
+
+	if active, total, _, _ = GetActiveDayRatio(30); active != 3 || total != 30 {
+		t.Fatalf("GetActiveDayRatio(30) = %d, %d, want 3, 30", active, total)
+	}
+	if _, _, _, err := GetActiveDayRatio(0); err == nil {
+		t.Fatal("天数不大于0时应返回错误")
+	}
+}
+
+func TestGetSuccessRateSeries(t *testing.T) {
+	seedDailyStatsForTest(t, StatsConfig{}, fmt.Sprintf(`{"version":"1.0","daily_stats":[
+		{"date": %q, "requests": {"total": 4, "success": 3, "failed": 1}},
+		{"date": %q, "requests": {"total": 2, "failed": 2}},
+		{"date": %q, "requests": {"total": 5, "success": 5}}
+	],"keys_usage":{}}`, daysAgo(0), daysAgo(2), daysAgo(5)))
+
+	series, err := GetSuccessRateSeries(4)
+	if err != nil {
+		t.Fatalf("GetSuccessRateSeries() = %v", err)
+	}
+	want := []RatePoint{
+		{Date: daysAgo(3), NoData: true},
+		{Date: daysAgo(2), Rate: 0},
+		{Date: daysAgo(1), NoData: true},
+		{Date: daysAgo(0), Rate: 0.75},
+	}
+	if len(series) != len(want) {
+		t.Fatalf("GetSuccessRateSeries(4) = %+v, want %+v", series, want)
+	}
+	for i := range want {
+		if series[i] != want[i] {
+			t.Fatalf("GetSuccessRateSeries(4)[%d] = %+v, want %+v", i, series[i], want[i])
+		}
+	}
+	if _, err := GetSuccessRateSeries(0); err == nil {
+		t.Fatal("天数不大于0时应返回错误")
+	}
+}
@@ -0,0 +1,100 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/5 10:20:00
+  @desc: 监听每日统计文件变化并自动重新加载，用于只读副本
+**/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"flowsilicon/internal/logger"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileWatcherDebounce 文件变化的防抖间隔，连续变化只触发一次重新加载
+const fileWatcherDebounce = 500 * time.Millisecond
+
+// reloadWatchedDailyStats 文件变化时执行的重新加载，测试时可替换
+var reloadWatchedDailyStats = ReloadDailyStats
+
+// StartFileWatcher 监听统计文件所在目录，文件变化时重新加载统计数据
+// 监听目录而不是文件本身，以兼容先写临时文件再重命名的原子写入方式
+// ctx 取消后停止监听
+func StartFileWatcher(ctx context.Context) error {
+	dailyDataLock.RLock()
+	path := dailyFilePath
+	dailyDataLock.RUnlock()
+
+	if path == "" {
+		return errors.New("每日统计数据文件路径未设置")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	fileName := filepath.Base(path)
+	logger.Info("开始监听每日统计文件变化: %s", path)
+
+	go func() {
+		defer watcher.Close()
+
+		// 防抖定时器，初始为停止状态
+		debounce := time.NewTimer(fileWatcherDebounce)
+		if !debounce.Stop() {
+			<-debounce.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				debounce.Stop()
+				logger.Info("已停止监听每日统计文件")
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Base(event.Name) != fileName {
+					continue
+				}
+				if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+					continue
+				}
+				// 重置防抖定时器
+				if !debounce.Stop() {
+					select {
+					case <-debounce.C:
+					default:
+					}
+				}
+				debounce.Reset(fileWatcherDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error("监听每日统计文件出错: %v", err)
+			case <-debounce.C:
+				if err := reloadWatchedDailyStats(); err != nil {
+					logger.Error("重新加载每日统计数据失败: %v", err)
+				} else {
+					logger.Info("检测到统计文件变化，已重新加载每日统计数据")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
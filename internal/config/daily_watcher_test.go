@@ -0,0 +1,51 @@
+package config
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileWatcherReloadsOnceAfterAtomicRename(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{ReadOnlyReplica: true})
+	if err := os.WriteFile(path, []byte(`{"version":"1.1"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	SetDailyStatsReadOnly(true)
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+
+	var reloads int32
+	reloadWatchedDailyStats = func() error {
+		atomic.AddInt32(&reloads, 1)
+		return ReloadDailyStats()
+	}
+	t.Cleanup(func() { reloadWatchedDailyStats = ReloadDailyStats })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := StartFileWatcher(ctx); err != nil {
+		t.Fatalf("StartFileWatcher() = %v", err)
+	}
+
+	// 模拟主实例的保存：写入临时文件后重命名替换统计文件
+	content := `{"version":"1.1","environments":{"default":{"daily_stats":[{"date":"2025-01-02","requests":{"total":7}}]}}}`
+	if err := writeFileWithBackup(path, []byte(content), 0644); err != nil {
+		t.Fatalf("writeFileWithBackup() = %v", err)
+	}
+
+	time.Sleep(3 * fileWatcherDebounce)
+	if got := atomic.LoadInt32(&reloads); got != 1 {
+		t.Fatalf("重新加载次数 = %d, want 1", got)
+	}
+	stats, found, err := GetDailyStats("2025-01-02")
+	if err != nil || !found || stats.Requests.Total != 7 {
+		t.Fatalf("GetDailyStats() = %+v, %v, %v，应加载主实例写入的数据", stats, found, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != content {
+		t.Fatalf("只读副本不应写入统计文件: %s", data)
+	}
+}
@@ -61,10 +61,60 @@ func InitApiKeysDB() error {
 		tpm INTEGER NOT NULL,
 		score REAL NOT NULL,
 		is_delete BOOLEAN NOT NULL,
-		is_used BOOLEAN NOT NULL DEFAULT FALSE
+		is_used BOOLEAN NOT NULL DEFAULT FALSE,
+		expires_at INTEGER NOT NULL DEFAULT 0,
+		expired BOOLEAN NOT NULL DEFAULT FALSE
 	)`
-	_, err := db.Exec(query)
-	return err
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	// 旧版本创建的表缺少到期字段，补充列
+	return ensureApiKeysExpiryColumns()
+}
+
+// ensureApiKeysExpiryColumns 为旧版本的apikeys表添加到期相关的列
+func ensureApiKeysExpiryColumns() error {
+	rows, err := db.Query("PRAGMA table_info(" + apikeysTableName + ")")
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal interface{}
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	columns := []struct {
+		name       string
+		definition string
+	}{
+		{"expires_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"expired", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	}
+	for _, col := range columns {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE " + apikeysTableName + " ADD COLUMN " + col.name + " " + col.definition); err != nil {
+			return fmt.Errorf("添加列%s失败: %w", col.name, err)
+		}
+		logger.Info("已为API密钥表添加列: %s", col.name)
+	}
+	return nil
 }
 
 // LoadApiKeysFromDB 从数据库加载API密钥
@@ -102,12 +152,15 @@ func LoadApiKeysFromDB() error {
 		if err := InitApiKeysDB(); err != nil {
 			return fmt.Errorf("创建API密钥表失败: %w", err)
 		}
+	} else if err := ensureApiKeysExpiryColumns(); err != nil {
+		return fmt.Errorf("升级API密钥表失败: %w", err)
 	}
 
 	// 查询所有密钥，包括被逻辑删除的密钥
 	rows, err := db.Query(`SELECT 
 		key, balance, last_used, total_calls, success_calls, success_rate, 
-		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used 
+		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used,
+		expires_at, expired 
 		FROM ` + apikeysTableName)
 	if err != nil {
 		// 如果是因为表不存在，尝试重新创建表
@@ -127,8 +180,12 @@ func LoadApiKeysFromDB() error {
 	}
 	defer rows.Close()
 
+	logKeyEncryptionState()
+
 	// 临时存储加载的密钥
 	var loadedKeys []ApiKey
+	var decryptErr error
+	var failedKeys, plaintextKeys int
 
 	// 处理查询结果
 	for rows.Next() {
@@ -149,10 +206,22 @@ func LoadApiKeysFromDB() error {
 			&key.Score,
 			&key.Delete,
 			&key.IsUsed,
+			&key.ExpiresAt,
+			&key.Expired,
 		); err != nil {
 			logger.Error("扫描API密钥数据失败: %v", err)
 			continue
 		}
+		apiKey, plaintext, err := decryptApiKey(key.Key)
+		if err != nil {
+			decryptErr = err
+			failedKeys++
+			continue
+		}
+		key.Key = apiKey
+		if plaintext {
+			plaintextKeys++
+		}
 
 		// 添加到加载的密钥列表，包括被标记为删除的密钥
 		loadedKeys = append(loadedKeys, key)
@@ -163,9 +232,15 @@ func LoadApiKeysFromDB() error {
 		return fmt.Errorf("处理API密钥数据时发生错误: %w", err)
 	}
 
+	// 有无法解密的密钥时不更新内存中的密钥，并拒绝写入密钥表，直到提供正确的主密钥后重新加载
+	if decryptErr != nil {
+		setKeyStoreError(decryptErr)
+		return fmt.Errorf("有%d个API密钥无法解密: %w", failedKeys, decryptErr)
+	}
+	setKeyStoreError(nil)
+
 	// 更新全局密钥列表
 	keysMutex.Lock()
-	defer keysMutex.Unlock()
 
 	// 分配新的切片
 	apiKeys = make([]ApiKey, len(loadedKeys))
@@ -181,6 +256,20 @@ func LoadApiKeysFromDB() error {
 	logger.Info("已从数据库加载 %d 个API密钥（包括 %d 个逻辑删除的密钥）",
 		len(apiKeys),
 		countDeletedKeys(apiKeys))
+	keysMutex.Unlock()
+
+	// 配置主密钥后，将旧版本保存的明文密钥重新加密保存
+	if plaintextKeys > 0 && KeyEncryptionEnabled() {
+		if err := SaveApiKeysToDB(); err != nil {
+			return fmt.Errorf("加密保存明文API密钥失败: %w", err)
+		}
+		logger.Info("已将 %d 个明文API密钥加密保存", plaintextKeys)
+	}
+
+	// 同一配置数据库中的虚拟密钥随API密钥一起加载
+	if err := LoadVirtualKeysFromDB(); err != nil {
+		logger.Error("加载虚拟密钥失败: %v", err)
+	}
 	return nil
 }
 
@@ -202,6 +291,10 @@ func SaveApiKeysToDB() error {
 		return errors.New("数据库连接未初始化")
 	}
 
+	if err := checkKeyStoreWritable(); err != nil {
+		return err
+	}
+
 	keysMutex.RLock()
 	defer keysMutex.RUnlock()
 
@@ -221,8 +314,9 @@ func SaveApiKeysToDB() error {
 	// 准备插入语句
 	stmt, err := tx.Prepare(`INSERT INTO ` + apikeysTableName + ` 
 		(key, balance, last_used, total_calls, success_calls, success_rate, 
-		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used,
+		expires_at, expired) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return err
 	}
@@ -238,7 +332,7 @@ func SaveApiKeysToDB() error {
 
 		// 插入数据库
 		_, err = stmt.Exec(
-			keyCopy.Key,
+			storedApiKey(keyCopy.Key),
 			keyCopy.Balance,
 			keyCopy.LastUsed,
 			keyCopy.TotalCalls,
@@ -253,6 +347,8 @@ func SaveApiKeysToDB() error {
 			keyCopy.Score,
 			keyCopy.Delete,
 			keyCopy.IsUsed,
+			keyCopy.ExpiresAt,
+			keyCopy.Expired,
 		)
 		if err != nil {
 			logger.Error("插入API密钥失败: %v", err)
@@ -277,6 +373,10 @@ func AddApiKeyToDB(key ApiKey) error {
 		return errors.New("数据库连接未初始化")
 	}
 
+	if err := checkKeyStoreWritable(); err != nil {
+		return err
+	}
+
 	// 清空RecentRequests数组，不需要存储到数据库
 	keyCopy := key
 	keyCopy.RecentRequests = nil
@@ -284,9 +384,10 @@ func AddApiKeyToDB(key ApiKey) error {
 	// 插入到数据库
 	_, err := db.Exec(`INSERT OR REPLACE INTO `+apikeysTableName+` 
 		(key, balance, last_used, total_calls, success_calls, success_rate, 
-		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		keyCopy.Key,
+		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used,
+		expires_at, expired) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		storedApiKey(keyCopy.Key),
 		keyCopy.Balance,
 		keyCopy.LastUsed,
 		keyCopy.TotalCalls,
@@ -301,6 +402,8 @@ func AddApiKeyToDB(key ApiKey) error {
 		keyCopy.Score,
 		keyCopy.Delete,
 		keyCopy.IsUsed,
+		keyCopy.ExpiresAt,
+		keyCopy.Expired,
 	)
 
 	if err != nil {
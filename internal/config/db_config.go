@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	_ "modernc.org/sqlite"
 )
@@ -28,6 +29,8 @@ const (
 var (
 	// 数据库实例
 	db *sql.DB
+	// configSaveMutex 串行化配置的保存，避免并发保存时后生成的配置被先生成的配置覆盖
+	configSaveMutex sync.Mutex
 )
 
 // InitConfigDB 初始化配置数据库
@@ -213,10 +216,34 @@ func LoadConfigFromDB() (*Config, error) {
 
 // SaveConfigToDB 将当前配置保存到数据库
 func SaveConfigToDB() error {
+	configSaveMutex.Lock()
+	defer configSaveMutex.Unlock()
+
 	cfg := GetConfig()
 	if cfg == nil {
 		return nil
 	}
+	return writeConfigToDB(cfg)
+}
+
+// ApplyConfig 先将新配置写入数据库，写入成功后再替换内存中的配置
+// 写入失败时内存和数据库中均保持原配置，避免两者不一致
+func ApplyConfig(newConfig *Config) error {
+	configSaveMutex.Lock()
+	defer configSaveMutex.Unlock()
+
+	if err := writeConfigToDB(newConfig); err != nil {
+		return err
+	}
+	UpdateConfig(newConfig)
+	return nil
+}
+
+// writeConfigToDB 将配置作为一行写入数据库，单条语句的写入由SQLite保证原子性
+func writeConfigToDB(cfg *Config) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
 
 	// 将配置转换为JSON
 	configJSON, err := json.Marshal(cfg)
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// initConfigDBForTest 在临时目录中创建配置数据库，测试结束后关闭
+func initConfigDBForTest(t *testing.T) {
+	t.Helper()
+	if err := InitConfigDB(filepath.Join(t.TempDir(), "config.db")); err != nil {
+		t.Fatalf("InitConfigDB() = %v", err)
+	}
+	t.Cleanup(func() { CloseConfigDB() })
+}
+
+func TestApplyConfigSavesBeforeUpdating(t *testing.T) {
+	initConfigDBForTest(t)
+
+	newConfig := &Config{}
+	newConfig.ApiProxy.BaseURL = "https://example.com"
+	if err := ApplyConfig(newConfig); err != nil {
+		t.Fatalf("ApplyConfig() = %v", err)
+	}
+	if GetConfig().ApiProxy.BaseURL != "https://example.com" {
+		t.Fatal("保存成功后应更新内存中的配置")
+	}
+
+	loaded, err := LoadConfigFromDB()
+	if err != nil {
+		t.Fatalf("LoadConfigFromDB() = %v", err)
+	}
+	if loaded.ApiProxy.BaseURL != "https://example.com" {
+		t.Fatalf("数据库中的BaseURL = %q", loaded.ApiProxy.BaseURL)
+	}
+}
+
+func TestApplyConfigKeepsOldConfigWhenSaveFails(t *testing.T) {
+	initConfigDBForTest(t)
+
+	oldConfig := &Config{}
+	oldConfig.ApiProxy.BaseURL = "https://old.example.com"
+	if err := ApplyConfig(oldConfig); err != nil {
+		t.Fatalf("ApplyConfig() = %v", err)
+	}
+
+	CloseConfigDB()
+	newConfig := &Config{}
+	newConfig.ApiProxy.BaseURL = "https://new.example.com"
+	if err := ApplyConfig(newConfig); err == nil {
+		t.Fatal("数据库已关闭时ApplyConfig应返回错误")
+	}
+	if got := GetConfig().ApiProxy.BaseURL; got != "https://old.example.com" {
+		t.Fatalf("保存失败后内存中的BaseURL = %q，应保持原配置", got)
+	}
+}
@@ -0,0 +1,199 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 19:10:00
+  @desc: 每日统计摘要的配置与内容生成，发送由common包负责
+**/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// digestTopN 摘要中展示的模型和密钥数量
+	digestTopN = 5
+	// defaultDigestTime 默认的每日摘要发送时间
+	defaultDigestTime = "09:00"
+)
+
+// DigestConfig 每日摘要配置
+type DigestConfig struct {
+	Enabled    bool             `mapstructure:"enabled"`     // 是否每天发送前一天的统计摘要
+	Time       string           `mapstructure:"time"`        // 发送时间（本地时间HH:MM），默认09:00
+	WebhookURL string           `mapstructure:"webhook_url"` // 以JSON格式POST摘要的地址，为空时不发送
+	SMTP       DigestSMTPConfig `mapstructure:"smtp"`        // 邮件发送配置，Host为空时不发送
+}
+
+// DigestSMTPConfig 摘要邮件的SMTP配置
+type DigestSMTPConfig struct {
+	Host     string   `mapstructure:"host"`     // SMTP服务器地址
+	Port     int      `mapstructure:"port"`     // 端口，465使用SSL直连，其他端口在服务器支持时使用STARTTLS，默认587
+	Username string   `mapstructure:"username"` // 登录用户名，为空时不认证
+	Password string   `mapstructure:"password"` // 登录密码
+	From     string   `mapstructure:"from"`     // 发件人，为空时使用用户名
+	To       []string `mapstructure:"to"`       // 收件人列表
+}
+
+// DailyDigest 每日统计摘要
+type DailyDigest struct {
+	Date        string              `json:"date"`
+	GeneratedAt string              `json:"generated_at"`
+	Requests    int                 `json:"requests"`     // 客户端请求数，没有客户端统计时为上游请求数
+	Success     int                 `json:"success"`      // 成功请求数
+	Failed      int                 `json:"failed"`       // 失败请求数
+	SuccessRate float64             `json:"success_rate"` // 成功率（百分比）
+	Tokens      DailyTokenStats     `json:"tokens"`
+	TopModels   []DigestModelEntry  `json:"top_models"`
+	TopKeys     []DigestKeyEntry    `json:"top_keys"`
+	Warnings    []string            `json:"warnings"`
+	Timeouts    *StreamTimeoutStats `json:"stream_timeouts,omitempty"`
+}
+
+// DigestModelEntry 摘要中的模型条目
+type DigestModelEntry struct {
+	Model    string `json:"model"`
+	Requests int    `json:"requests"`
+	Tokens   int    `json:"tokens"`
+	Failed   int    `json:"failed"`
+}
+
+// DigestKeyEntry 摘要中的密钥条目
+type DigestKeyEntry struct {
+	KeyID    string `json:"key_id"`
+	Key      string `json:"key"` // 按脱敏策略显示的密钥
+	Requests int    `json:"requests"`
+	Tokens   int    `json:"tokens"`
+}
+
+// GetDigestConfig 获取每日摘要配置
+func GetDigestConfig() DigestConfig {
+	return getStatsConfig().Digest
+}
+
+// NextDigestTime 计算now之后下一次发送摘要的时间，配置的时间格式错误时使用09:00
+func NextDigestTime(now time.Time, hhmm string) time.Time {
+	if hhmm == "" {
+		hhmm = defaultDigestTime
+	}
+	at, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		at, _ = time.Parse("15:04", defaultDigestTime)
+	}
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// BuildDailyDigest 生成指定日期的统计摘要，date为空时使用昨天
+// 数据来自GetDailyStats和GetKeyUsageStats，与管理界面显示的数字一致
+func BuildDailyDigest(date string) (*DailyDigest, error) {
+	if date == "" {
+		date = time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return nil, fmt.Errorf("日期格式错误，应为YYYY-MM-DD: %s", date)
+	}
+
+	stats, _, err := GetDailyStats(date)
+	if err != nil {
+		return nil, err
+	}
+	keysUsage, _, err := GetKeyUsageStats(date)
+	if err != nil && !errors.Is(err, ErrStatsNotInitialized) {
+		return nil, err
+	}
+
+	digest := &DailyDigest{
+		Date:        date,
+		GeneratedAt: time.Now().Format(time.RFC3339),
+		Tokens:      stats.Tokens,
+		TopModels:   make([]DigestModelEntry, 0, digestTopN),
+		TopKeys:     make([]DigestKeyEntry, 0, digestTopN),
+		Warnings:    make([]string, 0),
+	}
+
+	// 与每日报表一致，有客户端统计时使用客户端视角
+	if stats.Client.Total > 0 {
+		digest.Requests = stats.Client.Total
+		digest.Success = stats.Client.Success
+		digest.Failed = stats.Client.Failed
+	} else {
+		digest.Requests = stats.Requests.Total
+		digest.Success = stats.Requests.Success
+		digest.Failed = stats.Requests.Failed
+	}
+	if digest.Requests > 0 {
+		digest.SuccessRate = float64(digest.Success) / float64(digest.Requests) * 100
+	}
+
+	for _, m := range topModelsByRequests(stats.Models, digestTopN) {
+		digest.TopModels = append(digest.TopModels, DigestModelEntry{
+			Model:    m.name,
+			Requests: m.stats.Requests,
+			Tokens:   m.stats.Tokens,
+			Failed:   m.stats.Failed,
+		})
+	}
+
+	keyIDs := make([]string, 0, len(keysUsage))
+	for keyID := range keysUsage {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Slice(keyIDs, func(i, j int) bool {
+		a, b := keysUsage[keyIDs[i]], keysUsage[keyIDs[j]]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return keyIDs[i] < keyIDs[j]
+	})
+	if len(keyIDs) > digestTopN {
+		keyIDs = keyIDs[:digestTopN]
+	}
+	for _, keyID := range keyIDs {
+		usage := keysUsage[keyID]
+		digest.TopKeys = append(digest.TopKeys, DigestKeyEntry{
+			KeyID:    keyID,
+			Key:      DisplayKeyID(keyID, false),
+			Requests: usage.Requests,
+			Tokens:   usage.Tokens,
+		})
+	}
+
+	if stats.StreamTimeouts.FirstByte > 0 || stats.StreamTimeouts.Idle > 0 {
+		digest.Timeouts = &stats.StreamTimeouts
+	}
+	digest.Warnings = digestWarnings(date)
+	return digest, nil
+}
+
+// digestWarnings 收集摘要中的警告：密钥到期提醒和该日期的统计不一致记录
+func digestWarnings(date string) []string {
+	warnings := make([]string, 0)
+
+	for _, w := range GetKeyExpiryWarnings(false) {
+		if w.Expired {
+			warnings = append(warnings, fmt.Sprintf("密钥 %s 已过期", w.MaskedKey))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("密钥 %s 将在 %.1f 天后到期", w.MaskedKey, w.DaysLeft))
+		}
+	}
+
+	if report := GetLastConsistencyReport(); report != nil {
+		for _, issue := range report.Issues {
+			if issue.Date != date {
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("统计不一致: %s.%s 汇总 %d，明细 %d，差值 %d",
+				issue.Source, issue.Field, issue.Total, issue.Detail, issue.Delta))
+		}
+	}
+
+	return warnings
+}
@@ -0,0 +1,189 @@
+//go:build !windows
+// +build !windows
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// holdInstanceLock 模拟另一个实例持有统计文件的实例锁
+// flock按打开的文件加锁，同一进程中再次打开锁文件同样会发生冲突
+func holdInstanceLock(t *testing.T, path string) {
+	t.Helper()
+	lock, err := tryAcquireFileLock(path+dailyInstanceLockSuffix, true)
+	if err != nil {
+		t.Fatalf("获取实例锁失败: %v", err)
+	}
+	t.Cleanup(lock.release)
+}
+
+func TestAcquireStatsFileLockRefuseWhenLocked(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{FileLockMode: FileLockModeRefuse})
+	holdInstanceLock(t, path)
+
+	err := AcquireStatsFileLock()
+	if !errors.Is(err, ErrStatsFileLocked) {
+		t.Fatalf("AcquireStatsFileLock() = %v, want ErrStatsFileLocked", err)
+	}
+	if IsDailyStatsReadOnly() {
+		t.Fatal("refuse模式下不应进入只读模式")
+	}
+}
+
+func TestAcquireStatsFileLockReadOnlyBeforeLoad(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{FileLockMode: FileLockModeReadOnly})
+	holdInstanceLock(t, path)
+
+	if err := AcquireStatsFileLock(); err != nil {
+		t.Fatalf("AcquireStatsFileLock() = %v", err)
+	}
+	if !IsDailyStatsReadOnly() {
+		t.Fatal("统计文件被锁定时应进入只读模式")
+	}
+
+	// 加锁后再初始化，只读模式下不应创建统计文件
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("只读模式下不应写入统计文件: %v", err)
+	}
+}
+
+func TestAcquireStatsFileLockCreatesDataDir(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{FileLockMode: FileLockModeRefuse})
+	dailyFilePath = t.TempDir() + "/data/daily.json"
+
+	if err := AcquireStatsFileLock(); err != nil {
+		t.Fatalf("AcquireStatsFileLock() = %v", err)
+	}
+	if dailyInstanceLock == nil {
+		t.Fatal("数据目录不存在时应创建目录并获取实例锁")
+	}
+
+	// 持有锁期间，另一个实例无法获取
+	if _, err := tryAcquireFileLock(dailyFilePath+dailyInstanceLockSuffix, true); !errors.Is(err, errFileLocked) {
+		t.Fatalf("tryAcquireFileLock() = %v, want errFileLocked", err)
+	}
+}
+
+// holdIOLock 模拟另一个实例正在读写统计文件，返回释放锁的函数
+func holdIOLock(t *testing.T, path string) func() {
+	t.Helper()
+	lock, err := tryAcquireFileLock(path+dailyIOLockSuffix, true)
+	if err != nil {
+		t.Fatalf("获取读写锁失败: %v", err)
+	}
+	t.Cleanup(lock.release)
+	return lock.release
+}
+
+func TestDailyIOLockSerializesAccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daily.json")
+	release := holdIOLock(t, path)
+
+	var mu sync.Mutex
+	var order []string
+	record := func(event string) {
+		mu.Lock()
+		order = append(order, event)
+		mu.Unlock()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- withDailyIOLock(path, true, func() error {
+			record("second")
+			return nil
+		})
+	}()
+
+	// 持有锁期间第二个写入者一直等待
+	select {
+	case err := <-done:
+		t.Fatalf("持有读写锁期间 withDailyIOLock() 不应返回: %v", err)
+	case <-time.After(5 * dailyIOLockRetryInterval):
+	}
+	record("first")
+	release()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("withDailyIOLock() = %v", err)
+		}
+	case <-time.After(dailyIOLockTimeout):
+		t.Fatal("释放读写锁后 withDailyIOLock() 应获取到锁")
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Fatalf("执行顺序 = %v, want [first second]", order)
+	}
+}
+
+func TestDailyIOLockTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daily.json")
+	holdIOLock(t, path)
+	oldTimeout := dailyIOLockTimeout
+	dailyIOLockTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { dailyIOLockTimeout = oldTimeout })
+
+	called := false
+	start := time.Now()
+	err := withDailyIOLock(path, false, func() error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, errFileLocked) {
+		t.Fatalf("withDailyIOLock() = %v, want errFileLocked", err)
+	}
+	if called {
+		t.Fatal("等待超时时不应执行fn")
+	}
+	if elapsed := time.Since(start); elapsed < dailyIOLockTimeout {
+		t.Fatalf("应等待到超时后才返回, 实际等待 %v", elapsed)
+	}
+}
+
+func TestFlushEveryNRequestsDoesNotWaitForIOLock(t *testing.T) {
+	path := resetDailyStatsForTest(t, StatsConfig{FlushEveryNRequests: 1})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	saves := countDailySaves(t)
+	release := holdIOLock(t, path)
+
+	// 其他实例持有读写锁时，记录请求不应等待读写锁
+	start := time.Now()
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 10, 5, true)
+	if elapsed := time.Since(start); elapsed >= dailyIOLockTimeout/2 {
+		t.Fatalf("记录请求等待了 %v", elapsed)
+	}
+	dailyDataLock.RLock()
+	dirty, saveErr, timer := dailyDirty, lastSaveErr, dailySaveTimer
+	dailyDataLock.RUnlock()
+	if !dirty || saveErr != nil || timer == nil {
+		t.Fatalf("读写锁被占用时应改为防抖保存: dirty=%v, lastSaveErr=%v, timer=%v", dirty, saveErr, timer != nil)
+	}
+
+	// 防抖保存到期时读写锁仍被占用，继续推迟
+	if err := flushScheduledDailyStats(); err != nil {
+		t.Fatalf("flushScheduledDailyStats() = %v", err)
+	}
+	if saves() != 0 {
+		t.Fatal("读写锁被占用时不应写入统计文件")
+	}
+
+	release()
+	if err := flushScheduledDailyStats(); err != nil {
+		t.Fatalf("flushScheduledDailyStats() = %v", err)
+	}
+	if saves() != 1 {
+		t.Fatalf("释放读写锁后保存次数 = %d, want 1", saves())
+	}
+}
@@ -0,0 +1,112 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/6 17:25:00
+  @desc: 根据近期统计数据计算网关健康分
+**/
+
+package config
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// 默认健康分权重
+const (
+	defaultHealthSuccessWeight = 60
+	defaultHealthTrendWeight   = 25
+	defaultHealthSaveWeight    = 15
+)
+
+// HealthScoreWeights 健康分各项权重，全部为0时使用默认值60/25/15
+type HealthScoreWeights struct {
+	SuccessRate float64 `mapstructure:"success_rate"` // 今日成功率的权重
+	ErrorTrend  float64 `mapstructure:"error_trend"`  // 错误率趋势（今日相对昨日）的权重
+	SaveStatus  float64 `mapstructure:"save_status"`  // 统计数据保存状态的权重
+}
+
+// getHealthScoreWeights 获取健康分权重，未配置时使用默认值
+func getHealthScoreWeights() (HealthScoreWeights, error) {
+	weights := getStatsConfig().HealthScore
+	if weights.SuccessRate < 0 || weights.ErrorTrend < 0 || weights.SaveStatus < 0 {
+		return weights, errors.New("健康分权重不能为负数")
+	}
+	if weights.SuccessRate+weights.ErrorTrend+weights.SaveStatus == 0 {
+		weights = HealthScoreWeights{
+			SuccessRate: defaultHealthSuccessWeight,
+			ErrorTrend:  defaultHealthTrendWeight,
+			SaveStatus:  defaultHealthSaveWeight,
+		}
+	}
+	return weights, nil
+}
+
+// ComputeHealthScore 计算网关健康分，范围0-100
+//
+// 计算公式：score = 100 * (Ws*S + Wt*T + Wv*V) / (Ws + Wt + Wv)
+//   - S 今日成功率 success/total，今日无请求时为1
+//   - T 错误率趋势 1 - 2*max(0, 今日错误率-昨日错误率)，限制在[0,1]，错误率上升越多得分越低
+//   - V 保存状态，最近一次保存成功（或尚未保存、只读模式）为1，失败为0
+//
+// 权重 Ws/Wt/Wv 由 stats.health_score 配置
+func ComputeHealthScore() (score int, err error) {
+	weights, err := getHealthScoreWeights()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	today := now.Format("2006-01-02")
+	yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
+
+	dailyDataLock.RLock()
+	if dailyData == nil {
+		dailyDataLock.RUnlock()
+		return 0, ErrStatsNotInitialized
+	}
+	var todayReq, yesterdayReq DailyRequestStats
+	for _, stats := range dailyData.DailyStats {
+		switch stats.Date {
+		case today:
+			todayReq = stats.Requests
+		case yesterday:
+			yesterdayReq = stats.Requests
+		}
+	}
+	saveOK := dailyReadOnly || lastSaveErr == nil
+	dailyDataLock.RUnlock()
+
+	successScore := 1.0
+	if todayReq.Total > 0 {
+		successScore = float64(todayReq.Success) / float64(todayReq.Total)
+	}
+
+	trendScore := 1.0
+	if todayReq.Total > 0 {
+		delta := errorRate(todayReq) - errorRate(yesterdayReq)
+		trendScore = clampUnit(1 - 2*math.Max(0, delta))
+	}
+
+	saveScore := 0.0
+	if saveOK {
+		saveScore = 1
+	}
+
+	total := weights.SuccessRate + weights.ErrorTrend + weights.SaveStatus
+	weighted := weights.SuccessRate*successScore + weights.ErrorTrend*trendScore + weights.SaveStatus*saveScore
+	return int(math.Round(100 * weighted / total)), nil
+}
+
+// errorRate 计算请求失败率，无请求时为0
+func errorRate(req DailyRequestStats) float64 {
+	if req.Total <= 0 {
+		return 0
+	}
+	return float64(req.Failed) / float64(req.Total)
+}
+
+// clampUnit 将数值限制在[0,1]
+func clampUnit(v float64) float64 {
+	return math.Min(1, math.Max(0, v))
+}
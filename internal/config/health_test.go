@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestComputeHealthScore(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+
+	score, err := ComputeHealthScore()
+	if err != nil || score != 100 {
+		t.Fatalf("没有请求时 ComputeHealthScore() = %d, %v, want 100", score, err)
+	}
+
+	// 全部成功
+	AddDailyRequestStat("sk-test", "model-a", "", "", 100, 0, 0, true)
+	high, err := ComputeHealthScore()
+	if err != nil || high != 100 {
+		t.Fatalf("全部成功时 ComputeHealthScore() = %d, %v, want 100", high, err)
+	}
+
+	// 大量失败：成功率约0.1，错误率较昨日大幅上升，趋势分为0
+	AddDailyRequestStat("sk-test", "model-a", "", "", 900, 0, 0, false)
+	low, err := ComputeHealthScore()
+	if err != nil {
+		t.Fatalf("ComputeHealthScore() = %v", err)
+	}
+	if want := 21; low != want {
+		t.Fatalf("大量失败时 ComputeHealthScore() = %d, want %d", low, want)
+	}
+
+	// 保存失败时保存状态一项不得分
+	dailyDataLock.Lock()
+	lastSaveErr = errors.New("磁盘已满")
+	dailyDataLock.Unlock()
+	if failed, _ := ComputeHealthScore(); failed != low-defaultHealthSaveWeight {
+		t.Fatalf("保存失败时 ComputeHealthScore() = %d, want %d", failed, low-defaultHealthSaveWeight)
+	}
+}
+
+func TestComputeHealthScoreRejectsNegativeWeights(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{HealthScore: HealthScoreWeights{SuccessRate: -1}})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	if _, err := ComputeHealthScore(); err == nil {
+		t.Fatal("权重为负数时应返回错误")
+	}
+}
@@ -0,0 +1,286 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 00:25:00
+  @desc: 密钥熔断：窗口内连续失败达到阈值时断开密钥，间隔一段时间后半开试探，试探成功后恢复
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// BreakerClosed 熔断器关闭，密钥正常参与选择
+	BreakerClosed = "closed"
+	// BreakerOpen 熔断器断开，密钥不参与选择
+	BreakerOpen = "open"
+	// BreakerHalfOpen 熔断器半开，密钥重新参与选择，下一次请求的结果决定恢复还是再次断开
+	BreakerHalfOpen = "half_open"
+
+	// defaultBreakerFailureThreshold 未配置failure_threshold时触发熔断的连续失败次数
+	defaultBreakerFailureThreshold = 5
+	// defaultBreakerWindowSeconds 未配置window_seconds时统计连续失败的时间窗口
+	defaultBreakerWindowSeconds = 60
+	// defaultBreakerOpenSeconds 未配置open_seconds时断开到半开的间隔
+	defaultBreakerOpenSeconds = 120
+)
+
+// KeyBreakerConfig 密钥熔断配置
+type KeyBreakerConfig struct {
+	Enabled          bool `mapstructure:"enabled"`           // 是否启用密钥熔断
+	FailureThreshold int  `mapstructure:"failure_threshold"` // 窗口内连续失败多少次后断开，0表示使用默认值5
+	WindowSeconds    int  `mapstructure:"window_seconds"`    // 连续失败的统计窗口（秒），从第一次失败开始计算，0表示使用默认值60
+	OpenSeconds      int  `mapstructure:"open_seconds"`      // 断开多少秒后进入半开状态，0表示使用默认值120
+}
+
+// KeyBreakerState 密钥熔断器状态
+type KeyBreakerState struct {
+	KeyID        string `json:"key_id"`
+	MaskedKey    string `json:"masked_key"`               // 按脱敏策略显示的密钥
+	State        string `json:"state"`                    // closed、open、half_open
+	Failures     int    `json:"failures"`                 // 当前窗口内的连续失败次数
+	Trips        int    `json:"trips"`                    // 启动以来断开的次数
+	OpenedAt     int64  `json:"opened_at,omitempty"`      // 最近一次断开的时间戳
+	HalfOpenAt   int64  `json:"half_open_at,omitempty"`   // 断开状态下进入半开的时间戳
+	LastFailedAt int64  `json:"last_failed_at,omitempty"` // 最近一次失败的时间戳
+}
+
+// keyBreaker 密钥熔断器的内部状态
+type keyBreaker struct {
+	state        string
+	failures     int
+	windowStart  time.Time // 本轮连续失败中第一次失败的时间
+	openedAt     time.Time
+	lastFailedAt time.Time
+	trips        int
+}
+
+var (
+	// keyBreakers 按稳定密钥标识记录的熔断器，只保存在内存中
+	keyBreakers = make(map[string]*keyBreaker)
+	// keyBreakerMutex 保护keyBreakers
+	keyBreakerMutex sync.Mutex
+)
+
+// keyBreakerSettings 获取熔断配置，未配置的项使用默认值，未启用时enabled为false
+func keyBreakerSettings() (enabled bool, threshold int, window, open time.Duration) {
+	threshold = defaultBreakerFailureThreshold
+	windowSeconds, openSeconds := defaultBreakerWindowSeconds, defaultBreakerOpenSeconds
+	if cfg := GetConfig(); cfg != nil {
+		breaker := cfg.App.KeyBreaker
+		enabled = breaker.Enabled
+		if breaker.FailureThreshold > 0 {
+			threshold = breaker.FailureThreshold
+		}
+		if breaker.WindowSeconds > 0 {
+			windowSeconds = breaker.WindowSeconds
+		}
+		if breaker.OpenSeconds > 0 {
+			openSeconds = breaker.OpenSeconds
+		}
+	}
+	return enabled, threshold, time.Duration(windowSeconds) * time.Second, time.Duration(openSeconds) * time.Second
+}
+
+// refreshBreakerLocked 断开时间已超过间隔时转为半开，调用方需持有写锁
+func refreshBreakerLocked(b *keyBreaker, open time.Duration, now time.Time) {
+	if b.state == BreakerOpen && !now.Before(b.openedAt.Add(open)) {
+		b.state = BreakerHalfOpen
+	}
+}
+
+// RecordKeyBreakerSuccess 密钥请求成功，关闭熔断器并清零连续失败次数，返回状态是否改变
+func RecordKeyBreakerSuccess(apiKey string) bool {
+	if apiKey == "" {
+		return false
+	}
+	keyID := KeyID(apiKey)
+
+	keyBreakerMutex.Lock()
+	b, ok := keyBreakers[keyID]
+	if !ok {
+		keyBreakerMutex.Unlock()
+		return false
+	}
+	changed := b.state != BreakerClosed
+	b.state = BreakerClosed
+	b.failures = 0
+	keyBreakerMutex.Unlock()
+
+	if changed {
+		logger.Info("API密钥 %s 试探请求成功，熔断器已关闭", DisplayKeyID(keyID, false))
+	}
+	return changed
+}
+
+// RecordKeyBreakerFailure 密钥请求失败，窗口内连续失败达到阈值或半开试探失败时断开熔断器
+// 未启用熔断时不记录，返回熔断器是否因本次失败断开
+func RecordKeyBreakerFailure(apiKey string) bool {
+	enabled, threshold, window, open := keyBreakerSettings()
+	if !enabled || apiKey == "" {
+		return false
+	}
+	keyID := KeyID(apiKey)
+	now := time.Now()
+
+	keyBreakerMutex.Lock()
+	b, ok := keyBreakers[keyID]
+	if !ok {
+		b = &keyBreaker{state: BreakerClosed}
+		keyBreakers[keyID] = b
+	}
+	refreshBreakerLocked(b, open, now)
+	b.lastFailedAt = now
+
+	switch b.state {
+	case BreakerOpen:
+		// 断开前已发出的请求返回的失败不再计数
+		keyBreakerMutex.Unlock()
+		return false
+	case BreakerHalfOpen:
+		b.failures++
+	default:
+		if b.failures == 0 || now.Sub(b.windowStart) > window {
+			b.failures = 0
+			b.windowStart = now
+		}
+		b.failures++
+		if b.failures < threshold {
+			keyBreakerMutex.Unlock()
+			return false
+		}
+	}
+	halfOpen := b.state == BreakerHalfOpen
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.trips++
+	failures := b.failures
+	keyBreakerMutex.Unlock()
+
+	if halfOpen {
+		logger.Warn("API密钥 %s 半开试探失败，熔断器再次断开 %v", DisplayKeyID(keyID, false), open)
+	} else {
+		logger.Warn("API密钥 %s 在%v内连续失败%d次，熔断器断开 %v", DisplayKeyID(keyID, false), window, failures, open)
+	}
+	return true
+}
+
+// ResetKeyBreaker 手动关闭密钥的熔断器，密钥没有熔断记录时返回false
+func ResetKeyBreaker(apiKey string) bool {
+	keyID := KeyID(apiKey)
+
+	keyBreakerMutex.Lock()
+	defer keyBreakerMutex.Unlock()
+	if _, ok := keyBreakers[keyID]; !ok {
+		return false
+	}
+	delete(keyBreakers, keyID)
+	return true
+}
+
+// GetKeyBreakerState 获取密钥的熔断器状态，没有记录的密钥为关闭状态
+func GetKeyBreakerState(apiKey string) string {
+	_, _, _, open := keyBreakerSettings()
+	keyBreakerMutex.Lock()
+	defer keyBreakerMutex.Unlock()
+	b, ok := keyBreakers[KeyID(apiKey)]
+	if !ok {
+		return BreakerClosed
+	}
+	refreshBreakerLocked(b, open, time.Now())
+	return b.state
+}
+
+// GetKeyBreakerStates 获取所有有熔断记录的密钥的熔断器状态，断开的排在前面
+func GetKeyBreakerStates(admin bool) []KeyBreakerState {
+	_, _, _, open := keyBreakerSettings()
+	now := time.Now()
+
+	keyBreakerMutex.Lock()
+	result := make([]KeyBreakerState, 0, len(keyBreakers))
+	for keyID, b := range keyBreakers {
+		refreshBreakerLocked(b, open, now)
+		state := KeyBreakerState{
+			KeyID:    keyID,
+			State:    b.state,
+			Failures: b.failures,
+			Trips:    b.trips,
+		}
+		if !b.openedAt.IsZero() {
+			state.OpenedAt = b.openedAt.Unix()
+			if b.state == BreakerOpen {
+				state.HalfOpenAt = b.openedAt.Add(open).Unix()
+			}
+		}
+		if !b.lastFailedAt.IsZero() {
+			state.LastFailedAt = b.lastFailedAt.Unix()
+		}
+		result = append(result, state)
+	}
+	keyBreakerMutex.Unlock()
+
+	for i := range result {
+		result[i].MaskedKey = DisplayKeyID(result[i].KeyID, admin)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if (result[i].State == BreakerOpen) != (result[j].State == BreakerOpen) {
+			return result[i].State == BreakerOpen
+		}
+		return result[i].KeyID < result[j].KeyID
+	})
+	return result
+}
+
+// NextKeyBreakerHalfOpen 获取断开中的密钥数和最早进入半开的时间，未启用熔断或没有断开的密钥时返回零值
+func NextKeyBreakerHalfOpen() (openKeys int, earliest time.Time) {
+	enabled, _, _, open := keyBreakerSettings()
+	if !enabled {
+		return 0, time.Time{}
+	}
+	now := time.Now()
+	keyBreakerMutex.Lock()
+	defer keyBreakerMutex.Unlock()
+	for _, b := range keyBreakers {
+		refreshBreakerLocked(b, open, now)
+		if b.state != BreakerOpen {
+			continue
+		}
+		openKeys++
+		if at := b.openedAt.Add(open); earliest.IsZero() || at.Before(earliest) {
+			earliest = at
+		}
+	}
+	return openKeys, earliest
+}
+
+// keysBreakerAllowed 去掉熔断器断开的密钥，半开的密钥保留用于试探
+// 关闭熔断配置后已断开的密钥不再被过滤
+func keysBreakerAllowed(keys []ApiKey) []ApiKey {
+	enabled, _, _, open := keyBreakerSettings()
+	if !enabled {
+		return keys
+	}
+
+	keyBreakerMutex.Lock()
+	defer keyBreakerMutex.Unlock()
+	if len(keyBreakers) == 0 {
+		return keys
+	}
+
+	now := time.Now()
+	result := make([]ApiKey, 0, len(keys))
+	for _, k := range keys {
+		if b, ok := keyBreakers[KeyID(k.Key)]; ok {
+			refreshBreakerLocked(b, open, now)
+			if b.state == BreakerOpen {
+				continue
+			}
+		}
+		result = append(result, k)
+	}
+	return result
+}
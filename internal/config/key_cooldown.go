@@ -0,0 +1,147 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 00:15:00
+  @desc: 上游返回429或额度错误时密钥的临时冷却，冷却时间按连续次数指数增长
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultKeyCooldownSeconds 未配置app.key_cooldown_seconds时首次冷却的时间
+	defaultKeyCooldownSeconds = 30
+	// defaultKeyCooldownMaxSeconds 未配置app.key_cooldown_max_seconds时冷却时间的上限
+	defaultKeyCooldownMaxSeconds = 600
+)
+
+// keyCooldown 密钥的冷却状态
+type keyCooldown struct {
+	until  time.Time // 冷却结束时间
+	strike int       // 连续触发冷却的次数，请求成功后清零
+}
+
+var (
+	// keyCooldowns 按稳定密钥标识记录的冷却状态，只保存在内存中
+	keyCooldowns = make(map[string]*keyCooldown)
+	// keyCooldownMutex 保护keyCooldowns
+	keyCooldownMutex sync.RWMutex
+)
+
+// keyCooldownBounds 获取首次冷却时间和冷却时间上限
+func keyCooldownBounds() (base, max time.Duration) {
+	baseSeconds, maxSeconds := defaultKeyCooldownSeconds, defaultKeyCooldownMaxSeconds
+	if cfg := GetConfig(); cfg != nil {
+		if cfg.App.KeyCooldownSeconds > 0 {
+			baseSeconds = cfg.App.KeyCooldownSeconds
+		}
+		if cfg.App.KeyCooldownMaxSeconds > 0 {
+			maxSeconds = cfg.App.KeyCooldownMaxSeconds
+		}
+	}
+	if maxSeconds < baseSeconds {
+		maxSeconds = baseSeconds
+	}
+	return time.Duration(baseSeconds) * time.Second, time.Duration(maxSeconds) * time.Second
+}
+
+// StartKeyCooldown 上游返回429或额度错误时让密钥进入冷却，冷却期间不参与密钥选择
+// 冷却时间从app.key_cooldown_seconds开始，冷却结束前再次触发不延长，结束后再次触发时翻倍，
+// 最长为app.key_cooldown_max_seconds；返回本次冷却的时间，仍在冷却中时返回0
+func StartKeyCooldown(apiKey string) time.Duration {
+	if apiKey == "" {
+		return 0
+	}
+	keyID := KeyID(apiKey)
+	base, max := keyCooldownBounds()
+	now := time.Now()
+
+	keyCooldownMutex.Lock()
+	state, ok := keyCooldowns[keyID]
+	if !ok {
+		state = &keyCooldown{}
+		keyCooldowns[keyID] = state
+	}
+	// 并发请求在同一次冷却中收到的429只计一次
+	if now.Before(state.until) {
+		keyCooldownMutex.Unlock()
+		return 0
+	}
+	duration := base
+	for i := 0; i < state.strike && duration < max; i++ {
+		duration *= 2
+	}
+	if duration > max {
+		duration = max
+	}
+	state.strike++
+	state.until = now.Add(duration)
+	strike := state.strike
+	keyCooldownMutex.Unlock()
+
+	logger.Warn("API密钥 %s 被上游限流，冷却 %v（连续第%d次）", DisplayKeyID(keyID, false), duration, strike)
+	addKeyCooldownStat(keyID)
+	return duration
+}
+
+// ResetKeyCooldown 密钥请求成功后清除冷却记录，下次触发冷却时从首次冷却时间开始
+func ResetKeyCooldown(apiKey string) {
+	keyID := KeyID(apiKey)
+
+	keyCooldownMutex.Lock()
+	defer keyCooldownMutex.Unlock()
+	if state, ok := keyCooldowns[keyID]; ok && !time.Now().Before(state.until) {
+		delete(keyCooldowns, keyID)
+	}
+}
+
+// GetKeyCooldownUntil 获取密钥的冷却结束时间，不在冷却中时ok为false
+func GetKeyCooldownUntil(apiKey string) (until time.Time, ok bool) {
+	keyCooldownMutex.RLock()
+	defer keyCooldownMutex.RUnlock()
+	state, exists := keyCooldowns[KeyID(apiKey)]
+	if !exists || !time.Now().Before(state.until) {
+		return time.Time{}, false
+	}
+	return state.until, true
+}
+
+// NextKeyCooldownExpiry 获取冷却中的密钥数和最早的冷却结束时间，没有冷却中的密钥时返回零值
+func NextKeyCooldownExpiry() (coolingKeys int, earliest time.Time) {
+	now := time.Now()
+	keyCooldownMutex.RLock()
+	defer keyCooldownMutex.RUnlock()
+	for _, state := range keyCooldowns {
+		if !now.Before(state.until) {
+			continue
+		}
+		coolingKeys++
+		if earliest.IsZero() || state.until.Before(earliest) {
+			earliest = state.until
+		}
+	}
+	return coolingKeys, earliest
+}
+
+// keysNotCoolingDown 去掉冷却中的密钥
+func keysNotCoolingDown(keys []ApiKey) []ApiKey {
+	keyCooldownMutex.RLock()
+	defer keyCooldownMutex.RUnlock()
+	if len(keyCooldowns) == 0 {
+		return keys
+	}
+
+	now := time.Now()
+	result := make([]ApiKey, 0, len(keys))
+	for _, k := range keys {
+		if state, ok := keyCooldowns[KeyID(k.Key)]; ok && now.Before(state.until) {
+			continue
+		}
+		result = append(result, k)
+	}
+	return result
+}
@@ -0,0 +1,215 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 01:15:00
+  @desc: API密钥落盘加密：使用环境变量或系统钥匙串中的主密钥对数据库中的密钥做AES-GCM加密，加载时透明解密
+**/
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const (
+	// MasterKeyEnv 主密钥环境变量，值为base64编码的32字节密钥，其他值按口令经SHA-256派生
+	MasterKeyEnv = "FLOWSILICON_MASTER_KEY"
+	// keyringService 系统钥匙串中主密钥的服务名
+	keyringService = "FlowSilicon"
+	// keyringAccount 系统钥匙串中主密钥的账户名
+	keyringAccount = "master-key"
+	// encryptedKeyPrefix 加密后密钥的前缀，没有前缀的按明文处理
+	encryptedKeyPrefix = "enc:v1:"
+)
+
+// ErrMasterKeyMissing 数据库中有加密的密钥但未提供主密钥
+var ErrMasterKeyMissing = errors.New("数据库中的API密钥已加密，请通过环境变量" + MasterKeyEnv + "或系统钥匙串提供主密钥")
+
+var (
+	// keyAEAD 加密密钥使用的AES-GCM，未配置主密钥时为nil
+	keyAEAD cipher.AEAD
+	// keyNonceKey 派生随机数使用的HMAC密钥
+	keyNonceKey []byte
+	// keyCipherSource 主密钥来源，用于日志
+	keyCipherSource string
+	// keyCipherErr 读取主密钥的错误
+	keyCipherErr  error
+	keyCipherOnce sync.Once
+
+	// keyStoreErr 加载时无法解密密钥的原因，非nil时拒绝写入密钥表，避免覆盖无法解密的数据
+	keyStoreErr   error
+	keyStoreMutex sync.RWMutex
+)
+
+// loadMasterKey 按环境变量、系统钥匙串的顺序读取主密钥，都没有时返回nil
+func loadMasterKey() ([]byte, string, error) {
+	if value := strings.TrimSpace(os.Getenv(MasterKeyEnv)); value != "" {
+		return parseMasterKey(value), "环境变量" + MasterKeyEnv, nil
+	}
+	value, err := readKeyringMasterKey()
+	if err != nil {
+		return nil, "", err
+	}
+	if value != "" {
+		return parseMasterKey(value), "系统钥匙串", nil
+	}
+	return nil, "", nil
+}
+
+// parseMasterKey 解析主密钥，base64编码的32字节直接使用，否则作为口令经SHA-256派生
+func parseMasterKey(value string) []byte {
+	if raw, err := base64.StdEncoding.DecodeString(value); err == nil && len(raw) == 32 {
+		return raw
+	}
+	sum := sha256.Sum256([]byte(value))
+	return sum[:]
+}
+
+// readKeyringMasterKey 从系统钥匙串读取主密钥，macOS使用security命令，Linux使用secret-tool命令
+// Windows和未安装对应命令的系统不支持，返回空字符串
+func readKeyringMasterKey() (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", keyringAccount, "-w")
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "account", keyringAccount)
+	default:
+		return "", nil
+	}
+	if _, err := exec.LookPath(cmd.Path); err != nil {
+		return "", nil
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		// 钥匙串中没有对应条目时命令返回非0，视为未配置
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", nil
+		}
+		return "", fmt.Errorf("读取系统钥匙串失败: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// deriveKeyMaterial 从主密钥派生用途不同的子密钥
+func deriveKeyMaterial(master []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// initKeyCipher 读取主密钥并初始化加密器，只执行一次
+func initKeyCipher() {
+	keyCipherOnce.Do(func() {
+		master, source, err := loadMasterKey()
+		if err != nil {
+			keyCipherErr = err
+			return
+		}
+		if master == nil {
+			return
+		}
+		block, err := aes.NewCipher(deriveKeyMaterial(master, "flowsilicon/apikey/encryption"))
+		if err != nil {
+			keyCipherErr = err
+			return
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			keyCipherErr = err
+			return
+		}
+		keyAEAD = aead
+		keyNonceKey = deriveKeyMaterial(master, "flowsilicon/apikey/nonce")
+		keyCipherSource = source
+	})
+}
+
+// KeyEncryptionEnabled 判断是否已配置主密钥，配置后保存到数据库的密钥会被加密
+func KeyEncryptionEnabled() bool {
+	initKeyCipher()
+	return keyAEAD != nil
+}
+
+// decryptApiKey 解密数据库中的密钥，明文密钥原样返回并将plaintext置为true
+func decryptApiKey(stored string) (apiKey string, plaintext bool, err error) {
+	if !strings.HasPrefix(stored, encryptedKeyPrefix) {
+		return stored, true, nil
+	}
+	initKeyCipher()
+	if keyAEAD == nil {
+		if keyCipherErr != nil {
+			return "", false, fmt.Errorf("%w: %v", ErrMasterKeyMissing, keyCipherErr)
+		}
+		return "", false, ErrMasterKeyMissing
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedKeyPrefix))
+	if err != nil || len(sealed) < keyAEAD.NonceSize() {
+		return "", false, errors.New("加密的API密钥格式无效")
+	}
+	nonce, ciphertext := sealed[:keyAEAD.NonceSize()], sealed[keyAEAD.NonceSize():]
+	plain, err := keyAEAD.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", false, errors.New("解密API密钥失败，主密钥可能不正确")
+	}
+	return string(plain), false, nil
+}
+
+// storedApiKey 获取密钥在数据库中的存储形式：配置主密钥时为加密后的密钥，否则为原文
+// 随机数由密钥明文的HMAC派生，同一密钥每次加密结果相同，数据库可以继续按密文唯一约束和查找
+func storedApiKey(apiKey string) string {
+	if !KeyEncryptionEnabled() || apiKey == "" {
+		return apiKey
+	}
+	mac := hmac.New(sha256.New, keyNonceKey)
+	mac.Write([]byte(apiKey))
+	nonce := mac.Sum(nil)[:keyAEAD.NonceSize()]
+	sealed := keyAEAD.Seal(nonce, nonce, []byte(apiKey), nil)
+	return encryptedKeyPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// setKeyStoreError 记录加载密钥时的解密错误，nil表示密钥表可以正常写入
+func setKeyStoreError(err error) {
+	keyStoreMutex.Lock()
+	keyStoreErr = err
+	keyStoreMutex.Unlock()
+}
+
+// checkKeyStoreWritable 密钥表中有无法解密的密钥时返回错误，避免保存时覆盖这些密钥
+// 配置了主密钥但读取失败时同样返回错误，避免本应加密的密钥以明文写入
+func checkKeyStoreWritable() error {
+	initKeyCipher()
+	if keyCipherErr != nil {
+		return fmt.Errorf("读取主密钥失败，已拒绝写入API密钥: %w", keyCipherErr)
+	}
+
+	keyStoreMutex.RLock()
+	defer keyStoreMutex.RUnlock()
+	if keyStoreErr != nil {
+		return fmt.Errorf("API密钥表中有无法解密的密钥，已拒绝写入: %w", keyStoreErr)
+	}
+	return nil
+}
+
+// logKeyEncryptionState 在加载密钥时记录加密状态
+func logKeyEncryptionState() {
+	initKeyCipher()
+	switch {
+	case keyCipherErr != nil:
+		logger.Error("读取主密钥失败，在提供可用的主密钥前将拒绝写入API密钥: %v", keyCipherErr)
+	case keyAEAD != nil:
+		logger.Info("已从%s读取主密钥，API密钥将加密保存", keyCipherSource)
+	}
+}
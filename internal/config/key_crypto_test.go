@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// resetKeyCipherForTest 使用指定的主密钥重新初始化加密器，master为空时不加密
+func resetKeyCipherForTest(t *testing.T, master string) {
+	t.Helper()
+	t.Setenv(MasterKeyEnv, master)
+	reset := func() {
+		keyCipherOnce = sync.Once{}
+		keyAEAD = nil
+		keyNonceKey = nil
+		keyCipherSource = ""
+		keyCipherErr = nil
+		setKeyStoreError(nil)
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// storedKeysForTest 读取密钥表中保存的原始密钥
+func storedKeysForTest(t *testing.T) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT key FROM " + apikeysTableName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestApiKeyEncryptRoundTrip(t *testing.T) {
+	resetKeyCipherForTest(t, "test-master-key")
+
+	stored := storedApiKey("sk-roundtrip")
+	if !strings.HasPrefix(stored, encryptedKeyPrefix) || strings.Contains(stored, "sk-roundtrip") {
+		t.Fatalf("storedApiKey() = %q, 应为加密后的密钥", stored)
+	}
+	if again := storedApiKey("sk-roundtrip"); again != stored {
+		t.Fatal("同一密钥每次加密的结果应相同，以便按密文查找")
+	}
+
+	apiKey, plaintext, err := decryptApiKey(stored)
+	if err != nil || plaintext || apiKey != "sk-roundtrip" {
+		t.Fatalf("decryptApiKey() = %q, %v, %v", apiKey, plaintext, err)
+	}
+
+	// 换用其他主密钥后无法解密
+	resetKeyCipherForTest(t, "other-master-key")
+	if _, _, err := decryptApiKey(stored); err == nil {
+		t.Fatal("主密钥不正确时应解密失败")
+	}
+	resetKeyCipherForTest(t, "")
+	if _, _, err := decryptApiKey(stored); !errors.Is(err, ErrMasterKeyMissing) {
+		t.Fatalf("decryptApiKey() = %v, want ErrMasterKeyMissing", err)
+	}
+}
+
+func TestPlaintextApiKeysMigrateToEncrypted(t *testing.T) {
+	initConfigDBForTest(t)
+	if err := InitApiKeysDB(); err != nil {
+		t.Fatalf("InitApiKeysDB() = %v", err)
+	}
+
+	// 未配置主密钥时以明文保存
+	resetKeyCipherForTest(t, "")
+	if err := AddApiKeyToDB(ApiKey{Key: "sk-plaintext", Balance: 1}); err != nil {
+		t.Fatalf("AddApiKeyToDB() = %v", err)
+	}
+	if keys := storedKeysForTest(t); len(keys) != 1 || keys[0] != "sk-plaintext" {
+		t.Fatalf("密钥表 = %v", keys)
+	}
+
+	// 配置主密钥后加载时将明文密钥加密保存
+	resetKeyCipherForTest(t, "test-master-key")
+	if err := LoadApiKeysFromDB(); err != nil {
+		t.Fatalf("LoadApiKeysFromDB() = %v", err)
+	}
+	keys := storedKeysForTest(t)
+	if len(keys) != 1 || !strings.HasPrefix(keys[0], encryptedKeyPrefix) {
+		t.Fatalf("迁移后的密钥表 = %v", keys)
+	}
+	loaded := GetApiKeys()
+	if len(loaded) != 1 || loaded[0].Key != "sk-plaintext" {
+		t.Fatalf("加载的密钥 = %+v", loaded)
+	}
+
+	// 重新加载时透明解密
+	if err := LoadApiKeysFromDB(); err != nil {
+		t.Fatalf("LoadApiKeysFromDB() = %v", err)
+	}
+	if loaded := GetApiKeys(); len(loaded) != 1 || loaded[0].Key != "sk-plaintext" {
+		t.Fatalf("重新加载的密钥 = %+v", loaded)
+	}
+}
+
+func TestApiKeyWritesRefusedWhenMasterKeyUnavailable(t *testing.T) {
+	initConfigDBForTest(t)
+	if err := InitApiKeysDB(); err != nil {
+		t.Fatalf("InitApiKeysDB() = %v", err)
+	}
+
+	// 模拟配置了主密钥但读取系统钥匙串失败
+	resetKeyCipherForTest(t, "")
+	keyCipherOnce.Do(func() {
+		keyCipherErr = errors.New("读取系统钥匙串失败")
+	})
+
+	if err := AddApiKeyToDB(ApiKey{Key: "sk-refused"}); err == nil {
+		t.Fatal("主密钥无法读取时应拒绝写入密钥")
+	}
+	if err := SaveApiKeysToDB(); err == nil {
+		t.Fatal("主密钥无法读取时应拒绝保存密钥")
+	}
+	if keys := storedKeysForTest(t); len(keys) != 0 {
+		t.Fatalf("不应以明文写入密钥: %v", keys)
+	}
+}
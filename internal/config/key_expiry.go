@@ -0,0 +1,136 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 16:10:00
+  @desc: API密钥到期管理，到期的密钥进入独立的过期状态，不计为失败
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"sort"
+	"time"
+)
+
+// KeyExpiryWarning 密钥到期提醒
+type KeyExpiryWarning struct {
+	KeyID     string  `json:"key_id"`     // 稳定密钥标识
+	MaskedKey string  `json:"masked_key"` // 按脱敏策略显示的密钥
+	ExpiresAt int64   `json:"expires_at"` // 到期时间戳
+	DaysLeft  float64 `json:"days_left"`  // 剩余天数，已过期时为0
+	Balance   float64 `json:"balance"`    // 当前余额
+	Expired   bool    `json:"expired"`    // 是否已过期
+}
+
+// IsExpiredAt 判断密钥在指定时间是否已过期
+func (k ApiKey) IsExpiredAt(now int64) bool {
+	return k.Expired || (k.ExpiresAt > 0 && now >= k.ExpiresAt)
+}
+
+// SetApiKeyExpiry 设置API密钥的到期时间，expiresAt为0表示不过期
+// 到期时间设置到未来时会清除过期状态
+func SetApiKeyExpiry(key string, expiresAt int64) bool {
+	keysMutex.Lock()
+
+	found := false
+	var expired bool
+	for i, k := range apiKeys {
+		if k.Key == key {
+			found = true
+			apiKeys[i].ExpiresAt = expiresAt
+			apiKeys[i].Expired = expiresAt > 0 && time.Now().Unix() >= expiresAt
+			expired = apiKeys[i].Expired
+			break
+		}
+	}
+
+	keysMutex.Unlock()
+
+	if !found {
+		return false
+	}
+
+	if db != nil {
+		_, err := db.Exec(`UPDATE `+apikeysTableName+`
+			SET expires_at = ?, expired = ?
+			WHERE key = ?`,
+			expiresAt, expired, storedApiKey(key))
+		if err != nil {
+			logger.Error("更新API密钥到期时间到数据库失败: %v", err)
+		}
+	}
+
+	logger.Info("已设置API密钥到期时间: %s, 到期时间=%d", MaskKey(key), expiresAt)
+	return true
+}
+
+// MarkExpiredApiKeys 将已到期的密钥标记为过期状态，不修改失败计数和禁用状态
+// 返回本次新标记的密钥数量
+func MarkExpiredApiKeys() int {
+	now := time.Now().Unix()
+
+	keysMutex.Lock()
+	var newlyExpired []string
+	for i, k := range apiKeys {
+		if !k.Expired && k.ExpiresAt > 0 && now >= k.ExpiresAt {
+			apiKeys[i].Expired = true
+			newlyExpired = append(newlyExpired, k.Key)
+		}
+	}
+	keysMutex.Unlock()
+
+	for _, key := range newlyExpired {
+		if db != nil {
+			_, err := db.Exec(`UPDATE `+apikeysTableName+` SET expired = ? WHERE key = ?`, true, storedApiKey(key))
+			if err != nil {
+				logger.Error("更新API密钥过期状态到数据库失败: %v", err)
+			}
+		}
+		logger.Info("API密钥已到期，转为过期状态: %s", MaskKey(key))
+	}
+
+	return len(newlyExpired)
+}
+
+// GetKeyExpiryWarnings 获取即将到期和已过期的密钥，按到期时间升序排列
+// 提前提醒的天数由 App.ExpiryWarningDays 配置，为0时只返回已过期的密钥
+func GetKeyExpiryWarnings(admin bool) []KeyExpiryWarning {
+	warningDays := 0
+	if cfg := GetConfig(); cfg != nil {
+		warningDays = cfg.App.ExpiryWarningDays
+	}
+
+	now := time.Now().Unix()
+	warnBefore := int64(warningDays) * 24 * 3600
+
+	warnings := make([]KeyExpiryWarning, 0)
+	for _, k := range GetApiKeys() {
+		if k.ExpiresAt <= 0 && !k.Expired {
+			continue
+		}
+
+		expired := k.IsExpiredAt(now)
+		if !expired && k.ExpiresAt-now > warnBefore {
+			continue
+		}
+
+		daysLeft := 0.0
+		if !expired {
+			daysLeft = float64(k.ExpiresAt-now) / (24 * 3600)
+		}
+
+		warnings = append(warnings, KeyExpiryWarning{
+			KeyID:     KeyID(k.Key),
+			MaskedKey: MaskKeyWithPolicy(k.Key, admin),
+			ExpiresAt: k.ExpiresAt,
+			DaysLeft:  daysLeft,
+			Balance:   k.Balance,
+			Expired:   expired,
+		})
+	}
+
+	sort.Slice(warnings, func(i, j int) bool {
+		return warnings[i].ExpiresAt < warnings[j].ExpiresAt
+	})
+	return warnings
+}
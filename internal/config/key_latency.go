@@ -0,0 +1,43 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 00:05:00
+  @desc: 按密钥记录的请求耗时滑动平均，供最低延迟密钥选择使用
+**/
+
+package config
+
+import "sync"
+
+// keyLatencyAlpha 耗时指数移动平均中新样本的权重
+const keyLatencyAlpha = 0.2
+
+var (
+	// keyLatencyEWMA 每个密钥标识的请求耗时指数移动平均（毫秒），只保存在内存中
+	keyLatencyEWMA = make(map[string]float64)
+	// keyLatencyMutex 保护keyLatencyEWMA
+	keyLatencyMutex sync.RWMutex
+)
+
+// recordKeyLatency 记录一次请求耗时，只统计成功的请求，失败请求的耗时不代表密钥的响应速度
+func recordKeyLatency(record DailyRequestRecord) {
+	if record.ApiKey == "" || record.LatencyMs <= 0 || !record.IsSuccess {
+		return
+	}
+	keyID := KeyID(record.ApiKey)
+
+	keyLatencyMutex.Lock()
+	defer keyLatencyMutex.Unlock()
+	if avg, ok := keyLatencyEWMA[keyID]; ok {
+		keyLatencyEWMA[keyID] = avg + keyLatencyAlpha*(float64(record.LatencyMs)-avg)
+	} else {
+		keyLatencyEWMA[keyID] = float64(record.LatencyMs)
+	}
+}
+
+// GetKeyLatency 获取密钥最近成功请求耗时的指数移动平均（毫秒），本次运行中没有记录时ok为false
+func GetKeyLatency(apiKey string) (avgMs float64, ok bool) {
+	keyLatencyMutex.RLock()
+	defer keyLatencyMutex.RUnlock()
+	avgMs, ok = keyLatencyEWMA[KeyID(apiKey)]
+	return avgMs, ok
+}
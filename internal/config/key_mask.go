@@ -0,0 +1,206 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 15:20:00
+  @desc: API密钥脱敏策略与统计数据使用的稳定密钥标识
+**/
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flowsilicon/internal/logger"
+	"strings"
+)
+
+// 密钥脱敏策略
+const (
+	KeyMaskPrefix6        = "prefix6"         // 显示前6位
+	KeyMaskPrefix8Suffix4 = "prefix8-suffix4" // 显示前8位和后4位
+	KeyMaskHashOnly       = "hash-only"       // 只显示不可逆的密钥标识
+	KeyMaskRevealToAdmin  = "reveal-to-admin" // 管理界面显示完整密钥，其他场景按prefix6处理
+)
+
+// keyIDPrefix 稳定密钥标识的前缀
+const keyIDPrefix = "kid_"
+
+// KeyID 获取密钥的稳定标识，统计数据以该标识存储，与脱敏策略无关
+func KeyID(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return keyIDPrefix + hex.EncodeToString(sum[:8])
+}
+
+// isKeyID 判断字符串是否为稳定密钥标识
+func isKeyID(s string) bool {
+	return strings.HasPrefix(s, keyIDPrefix) && len(s) == len(keyIDPrefix)+16
+}
+
+// GetKeyMaskPolicy 获取当前密钥脱敏策略，未配置或无法识别时使用prefix6
+func GetKeyMaskPolicy() string {
+	cfg := GetConfig()
+	if cfg == nil {
+		return KeyMaskPrefix6
+	}
+	switch cfg.App.KeyMaskPolicy {
+	case KeyMaskPrefix8Suffix4, KeyMaskHashOnly, KeyMaskRevealToAdmin:
+		return cfg.App.KeyMaskPolicy
+	default:
+		return KeyMaskPrefix6
+	}
+}
+
+// MaskKeyWithPolicy 按当前脱敏策略显示密钥
+// admin 表示是否为管理界面，仅reveal-to-admin策略下对管理界面显示完整密钥
+// 日志、导出、通知等场景应传入false
+func MaskKeyWithPolicy(apiKey string, admin bool) string {
+	switch GetKeyMaskPolicy() {
+	case KeyMaskPrefix8Suffix4:
+		if len(apiKey) <= 12 {
+			return "******"
+		}
+		return apiKey[:8] + "******" + apiKey[len(apiKey)-4:]
+	case KeyMaskHashOnly:
+		return KeyID(apiKey)
+	case KeyMaskRevealToAdmin:
+		if admin {
+			return apiKey
+		}
+	}
+
+	if len(apiKey) <= 6 {
+		return "******"
+	}
+	return apiKey[:6] + "******"
+}
+
+// DisplayKeyID 将统计数据中的密钥标识按脱敏策略转换为显示文本
+// 找不到对应密钥（已删除）时返回标识本身，迁移前的旧掩码原样返回
+func DisplayKeyID(id string, admin bool) string {
+	if !isKeyID(id) {
+		return id
+	}
+	if apiKey, ok := resolveKeyID(id); ok {
+		return MaskKeyWithPolicy(apiKey, admin)
+	}
+	return id
+}
+
+// resolveKeyID 根据稳定标识查找原始密钥
+func resolveKeyID(id string) (string, bool) {
+	for _, k := range GetApiKeys() {
+		if KeyID(k.Key) == id {
+			return k.Key, true
+		}
+	}
+	return "", false
+}
+
+// ResolveKeyID 根据稳定标识查找当前配置中的原始密钥
+func ResolveKeyID(id string) (string, bool) {
+	return resolveKeyID(id)
+}
+
+// legacyMaskAPIKey 旧版本统计数据使用的密钥掩码（前6位+***），仅用于迁移
+func legacyMaskAPIKey(apiKey string) string {
+	if len(apiKey) <= 6 {
+		return "***"
+	}
+	return apiKey[:6] + "***"
+}
+
+// MigrateKeyUsageIdentifiers 将旧版本以掩码存储的密钥统计关联到稳定标识
+// 需要在密钥加载后调用；掩码只能唯一对应一个现有密钥时才迁移，无法确定的记录保持原样
+// 返回迁移的记录数
+func MigrateKeyUsageIdentifiers() int {
+	// 旧掩码到现有密钥标识的唯一映射
+	legacyToID := make(map[string]string)
+	ambiguous := make(map[string]bool)
+	for _, k := range GetApiKeys() {
+		legacy := legacyMaskAPIKey(k.Key)
+		if existing, ok := legacyToID[legacy]; ok && existing != KeyID(k.Key) {
+			ambiguous[legacy] = true
+			continue
+		}
+		legacyToID[legacy] = KeyID(k.Key)
+	}
+	for legacy := range ambiguous {
+		delete(legacyToID, legacy)
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if dailyData == nil {
+		return 0
+	}
+
+	migrated := migrateKeysUsageLocked(dailyData.KeysUsage, legacyToID)
+	migrated += migrateAttemptKeysLocked(dailyData.DailyStats, legacyToID)
+	for _, envStats := range dailyData.Environments {
+		if envStats == nil {
+			continue
+		}
+		migrated += migrateKeysUsageLocked(envStats.KeysUsage, legacyToID)
+		migrated += migrateAttemptKeysLocked(envStats.DailyStats, legacyToID)
+	}
+
+	if len(ambiguous) > 0 {
+		logger.Warn("有 %d 个旧密钥掩码对应多个密钥，无法迁移到稳定标识", len(ambiguous))
+	}
+	if migrated > 0 {
+		logger.Info("已将 %d 条密钥统计迁移到稳定标识", migrated)
+		dailyDirty = true
+		if err := saveDailyDataLocked(); err != nil {
+			logger.Error("保存迁移后的统计数据失败: %v", err)
+		}
+	}
+	return migrated
+}
+
+// migrateKeysUsageLocked 迁移密钥使用统计的键（已加锁）
+func migrateKeysUsageLocked(keysUsage map[string]map[string]KeyUsage, legacyToID map[string]string) int {
+	migrated := 0
+	for legacy, usageByDate := range keysUsage {
+		id, ok := legacyToID[legacy]
+		if !ok {
+			continue
+		}
+		target := keysUsage[id]
+		if target == nil {
+			target = make(map[string]KeyUsage, len(usageByDate))
+			keysUsage[id] = target
+		}
+		for date, usage := range usageByDate {
+			merged := target[date]
+			merged.Requests += usage.Requests
+			merged.Tokens += usage.Tokens
+			merged.Cost += usage.Cost
+			target[date] = merged
+		}
+		delete(keysUsage, legacy)
+		migrated++
+	}
+	return migrated
+}
+
+// migrateAttemptKeysLocked 迁移上游尝试统计中按密钥记录的键（已加锁）
+func migrateAttemptKeysLocked(statsList []DailyStats, legacyToID map[string]string) int {
+	migrated := 0
+	for i := range statsList {
+		byKey := statsList[i].Attempts.ByKey
+		for legacy, keyStats := range byKey {
+			id, ok := legacyToID[legacy]
+			if !ok {
+				continue
+			}
+			merged := byKey[id]
+			merged.Total += keyStats.Total
+			merged.Success += keyStats.Success
+			merged.Failed += keyStats.Failed
+			byKey[id] = merged
+			delete(byKey, legacy)
+			migrated++
+		}
+	}
+	return migrated
+}
@@ -0,0 +1,36 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 01:05:00
+  @desc: 密钥定时校验配置，定期向上游发送低成本请求，禁用已失效的密钥
+**/
+
+package config
+
+const (
+	// defaultKeyValidationIntervalMinutes 未配置interval_minutes时的校验间隔
+	defaultKeyValidationIntervalMinutes = 360
+	// minKeyValidationIntervalMinutes 校验间隔下限，避免频繁请求上游
+	minKeyValidationIntervalMinutes = 10
+)
+
+// KeyValidationConfig 密钥定时校验配置
+type KeyValidationConfig struct {
+	Enabled         bool `mapstructure:"enabled"`          // 是否定时校验密钥
+	IntervalMinutes int  `mapstructure:"interval_minutes"` // 校验间隔（分钟），0表示使用默认值360，最小10，修改后重启生效
+	Notify          bool `mapstructure:"notify"`           // 有密钥校验失败时是否通过告警通知渠道发送汇总
+}
+
+// GetKeyValidationConfig 获取密钥定时校验配置，未配置的项使用默认值
+func GetKeyValidationConfig() KeyValidationConfig {
+	var cfg KeyValidationConfig
+	if c := GetConfig(); c != nil {
+		cfg = c.App.KeyValidation
+	}
+	if cfg.IntervalMinutes <= 0 {
+		cfg.IntervalMinutes = defaultKeyValidationIntervalMinutes
+	}
+	if cfg.IntervalMinutes < minKeyValidationIntervalMinutes {
+		cfg.IntervalMinutes = minKeyValidationIntervalMinutes
+	}
+	return cfg
+}
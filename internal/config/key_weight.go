@@ -0,0 +1,26 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 23:55:00
+  @desc: 加权轮询使用的密钥权重配置
+**/
+
+package config
+
+// defaultKeyWeight 未单独设置权重的密钥的权重
+const defaultKeyWeight = 1
+
+// GetKeyWeight 获取密钥在加权轮询中的权重，可按密钥标识或旧版掩码设置
+// 未设置的密钥权重为1，设置为0或负数的密钥不参与加权轮询
+func GetKeyWeight(apiKey string) int {
+	cfg := GetConfig()
+	if cfg == nil || len(cfg.App.KeyWeights) == 0 {
+		return defaultKeyWeight
+	}
+	if weight, ok := cfg.App.KeyWeights[KeyID(apiKey)]; ok {
+		return weight
+	}
+	if weight, ok := cfg.App.KeyWeights[legacyMaskAPIKey(apiKey)]; ok {
+		return weight
+	}
+	return defaultKeyWeight
+}
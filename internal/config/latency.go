@@ -0,0 +1,152 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 20:30:00
+  @desc: 按模型记录请求耗时直方图，用于估算每日的p50/p95/p99延迟
+**/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// latencyBucketGrowth 相邻桶上界的倍数，估算值的相对误差约为该值的一半
+	latencyBucketGrowth = 1.1
+	// maxLatencyBucket 最大桶下标，约对应1.1^200毫秒（远超实际请求耗时），超过的耗时计入最后一个桶
+	maxLatencyBucket = 200
+)
+
+// ErrNoLatencyData 指定日期和模型没有耗时记录
+var ErrNoLatencyData = errors.New("没有耗时记录")
+
+// LatencyHistogram 请求耗时直方图，按对数划分的桶稀疏存储，内存和文件大小有上限
+// 桶i覆盖 (1.1^(i-1), 1.1^i] 毫秒，桶0覆盖不超过1毫秒的耗时
+type LatencyHistogram struct {
+	Count   int         `json:"count"`
+	Buckets map[int]int `json:"buckets"` // 桶下标 -> 次数，只保存有记录的桶
+}
+
+// latencyBucket 计算耗时所在的桶
+func latencyBucket(ms int64) int {
+	if ms <= 1 {
+		return 0
+	}
+	idx := int(math.Ceil(math.Log(float64(ms)) / math.Log(latencyBucketGrowth)))
+	if idx > maxLatencyBucket {
+		idx = maxLatencyBucket
+	}
+	return idx
+}
+
+// latencyBucketValue 桶的代表值（上下界的几何平均数，毫秒）
+func latencyBucketValue(idx int) float64 {
+	if idx <= 0 {
+		return 1
+	}
+	return math.Pow(latencyBucketGrowth, float64(idx)-0.5)
+}
+
+// add 记录一次耗时
+func (h *LatencyHistogram) add(ms int64) {
+	if h.Buckets == nil {
+		h.Buckets = make(map[int]int)
+	}
+	h.Buckets[latencyBucket(ms)]++
+	h.Count++
+}
+
+// merge 合并另一个直方图
+func (h *LatencyHistogram) merge(other *LatencyHistogram) {
+	if other == nil {
+		return
+	}
+	if h.Buckets == nil {
+		h.Buckets = make(map[int]int, len(other.Buckets))
+	}
+	for idx, n := range other.Buckets {
+		h.Buckets[idx] += n
+	}
+	h.Count += other.Count
+}
+
+// mergeLatency 将src合并到dst，dst为nil时新建，返回合并后的直方图，不修改src
+func mergeLatency(dst, src *LatencyHistogram) *LatencyHistogram {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		dst = &LatencyHistogram{}
+	}
+	dst.merge(src)
+	return dst
+}
+
+// clone 深拷贝直方图
+func (h *LatencyHistogram) clone() *LatencyHistogram {
+	if h == nil {
+		return nil
+	}
+	c := &LatencyHistogram{Count: h.Count, Buckets: make(map[int]int, len(h.Buckets))}
+	for idx, n := range h.Buckets {
+		c.Buckets[idx] = n
+	}
+	return c
+}
+
+// Percentile 估算第p百分位（0-100）的耗时（毫秒），没有记录时返回0
+func (h *LatencyHistogram) Percentile(p float64) float64 {
+	if h == nil || h.Count == 0 {
+		return 0
+	}
+
+	indexes := make([]int, 0, len(h.Buckets))
+	for idx := range h.Buckets {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	rank := int(math.Ceil(p / 100 * float64(h.Count)))
+	if rank < 1 {
+		rank = 1
+	}
+	seen := 0
+	for _, idx := range indexes {
+		seen += h.Buckets[idx]
+		if seen >= rank {
+			return latencyBucketValue(idx)
+		}
+	}
+	return latencyBucketValue(indexes[len(indexes)-1])
+}
+
+// GetModelLatencyPercentiles 获取模型在指定日期的p50/p95/p99耗时估算（毫秒），date为空时使用今天，model可以是别名
+func GetModelLatencyPercentiles(model, date string) (p50, p95, p99 float64, err error) {
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	model = normalizeModelName(ResolveModelAlias(model))
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return 0, 0, 0, ErrStatsNotInitialized
+	}
+
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date != date {
+			continue
+		}
+		h := stats.Models[model].Latency
+		if h == nil || h.Count == 0 {
+			return 0, 0, 0, fmt.Errorf("%w: %s %s", ErrNoLatencyData, date, model)
+		}
+		return h.Percentile(50), h.Percentile(95), h.Percentile(99), nil
+	}
+	return 0, 0, 0, fmt.Errorf("%w: %s", ErrNoLatencyData, date)
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// withinTolerance 估算值与精确值的相对误差是否在tolerance以内
+func withinTolerance(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= want*tolerance
+}
+
+func TestGetModelLatencyPercentiles(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+
+	// 1-1000毫秒均匀分布，精确的p50/p95/p99为500/950/990
+	for ms := int64(1); ms <= 1000; ms++ {
+		AddDailyRequestRecord(DailyRequestRecord{
+			ApiKey:       "sk-test",
+			Model:        "model-a",
+			RequestCount: 1,
+			IsSuccess:    true,
+			LatencyMs:    ms,
+		})
+	}
+
+	p50, p95, p99, err := GetModelLatencyPercentiles("model-a", "")
+	if err != nil {
+		t.Fatalf("GetModelLatencyPercentiles() = %v", err)
+	}
+	// 桶上界按1.1倍增长，估算值的相对误差不超过约5%
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{{"p50", p50, 500}, {"p95", p95, 950}, {"p99", p99, 990}} {
+		if !withinTolerance(c.got, c.want, 0.06) {
+			t.Fatalf("%s = %.1f, want %.0f±6%%", c.name, c.got, c.want)
+		}
+	}
+
+	if _, _, _, err := GetModelLatencyPercentiles("model-b", ""); !errors.Is(err, ErrNoLatencyData) {
+		t.Fatalf("没有耗时记录的模型 err = %v, want ErrNoLatencyData", err)
+	}
+}
+
+func TestLatencyHistogramPercentile(t *testing.T) {
+	var h LatencyHistogram
+	if h.Percentile(99) != 0 {
+		t.Fatal("没有记录时应返回0")
+	}
+	// 90次100毫秒，10次2000毫秒
+	for i := 0; i < 90; i++ {
+		h.add(100)
+	}
+	for i := 0; i < 10; i++ {
+		h.add(2000)
+	}
+	if got := h.Percentile(90); !withinTolerance(got, 100, 0.06) {
+		t.Fatalf("p90 = %.1f, want 约100", got)
+	}
+	if got := h.Percentile(91); !withinTolerance(got, 2000, 0.06) {
+		t.Fatalf("p91 = %.1f, want 约2000", got)
+	}
+
+	// 合并后次数累加，不修改被合并的直方图
+	merged := mergeLatency(nil, &h)
+	merged.add(100)
+	if merged.Count != 101 || h.Count != 100 {
+		t.Fatalf("合并后次数 = %d, 原直方图次数 = %d", merged.Count, h.Count)
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testdataDir 测试数据目录，TestMain切换工作目录前记录其绝对路径
+var testdataDir string
+
+// TestMain 在临时目录中运行测试，日志写入临时目录且不输出到控制台
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "flowsilicon-config-test-*")
+	if err != nil {
+		panic(err)
+	}
+	wd, _ := os.Getwd()
+	testdataDir = filepath.Join(wd, "testdata")
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	logger.SetGuiMode(true)
+	if err := logger.Init(); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+
+	logger.CloseLogger()
+	os.Chdir(wd)
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// resetDailyStatsForTest 将统计数据恢复为未初始化状态，统计文件使用临时目录，返回统计文件路径
+func resetDailyStatsForTest(t *testing.T, stats StatsConfig) string {
+	t.Helper()
+
+	UpdateConfig(&Config{Stats: stats})
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+	dailyInstanceLock.release()
+	dailyInstanceLock = nil
+	dailyData = nil
+	dailyFilePath = filepath.Join(t.TempDir(), "daily.json")
+	dailyReadOnly = false
+	dailyDirty = false
+	dailyPending = 0
+	lastSaveErr = nil
+	trimPauses = 0
+	lastRequestTime = time.Time{}
+	streamingRequests = make(map[string]*streamingRequest)
+	statsEnvironment = DefaultStatsEnvironment
+	// 之前测试安排的防抖保存不应在本测试中触发
+	if dailySaveTimer != nil {
+		dailySaveTimer.Stop()
+	}
+	dailySaveScheduled = false
+
+	t.Cleanup(func() {
+		dailyDataLock.Lock()
+		defer dailyDataLock.Unlock()
+		dailyInstanceLock.release()
+		dailyInstanceLock = nil
+	})
+	return dailyFilePath
+}
+
+// seedDailyStatsForTest 将content写入临时统计文件并加载，返回统计文件路径
+func seedDailyStatsForTest(t *testing.T, stats StatsConfig, content string) string {
+	t.Helper()
+	path := resetDailyStatsForTest(t, stats)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	return path
+}
+
+// fakeStatsClock 将统计使用的当前时间固定为now，通过返回的指针调整时间
+func fakeStatsClock(t *testing.T, now time.Time) *time.Time {
+	t.Helper()
+	clock := now
+	statsNow = func() time.Time { return clock }
+	t.Cleanup(func() { statsNow = time.Now })
+	return &clock
+}
+
+// mustGetDailyStats 获取指定日期的统计数据，出错时结束测试
+func mustGetDailyStats(t *testing.T, date string) *DailyStats {
+	t.Helper()
+	stats, _, err := GetDailyStats(date)
+	if err != nil {
+		t.Fatalf("GetDailyStats(%q) = %v", date, err)
+	}
+	return stats
+}
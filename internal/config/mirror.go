@@ -0,0 +1,20 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/4 10:30:00
+  @desc: 影子流量（镜像）配置相关结构体
+**/
+
+package config
+
+// MirrorConfig 影子流量配置，将部分非流式请求复制到备用上游用于对比
+type MirrorConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`         // 是否启用镜像
+	BaseURL        string   `mapstructure:"base_url"`        // 备用上游地址
+	ApiKey         string   `mapstructure:"api_key"`         // 备用上游使用的API密钥
+	SamplePercent  float64  `mapstructure:"sample_percent"`  // 镜像采样比例（0-100）
+	Categories     []string `mapstructure:"categories"`      // 启用镜像的接口类别：chat, completions, embeddings, rerank, images
+	StripHeaders   []string `mapstructure:"strip_headers"`   // 转发到备用上游前移除的请求头
+	ReplaceUser    string   `mapstructure:"replace_user"`    // 替换请求体中的user字段，为空时直接删除该字段
+	TimeoutSeconds int      `mapstructure:"timeout_seconds"` // 镜像请求超时（秒）
+	MaxConcurrent  int      `mapstructure:"max_concurrent"`  // 最大并发镜像请求数，超过时丢弃采样
+}
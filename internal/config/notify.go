@@ -0,0 +1,88 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 21:10:00
+  @desc: 告警通知渠道配置，支持Webhook、Bark、Server酱和Telegram机器人
+**/
+
+package config
+
+// 通知级别，从低到高
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// 通知渠道名称
+const (
+	NotifyChannelWebhook    = "webhook"
+	NotifyChannelBark       = "bark"
+	NotifyChannelServerChan = "serverchan"
+	NotifyChannelTelegram   = "telegram"
+)
+
+// NotifyConfig 告警通知配置，多个渠道可同时启用
+type NotifyConfig struct {
+	Webhook    WebhookNotifyConfig    `mapstructure:"webhook"`
+	Bark       BarkNotifyConfig       `mapstructure:"bark"`
+	ServerChan ServerChanNotifyConfig `mapstructure:"serverchan"`
+	Telegram   TelegramNotifyConfig   `mapstructure:"telegram"`
+}
+
+// WebhookNotifyConfig 通用Webhook渠道，以JSON格式POST通知
+type WebhookNotifyConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	URL         string `mapstructure:"url"`
+	MinSeverity string `mapstructure:"min_severity"` // 最低通知级别：info、warning、critical，默认info
+}
+
+// BarkNotifyConfig Bark推送渠道
+type BarkNotifyConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Server      string `mapstructure:"server"`     // Bark服务地址，默认https://api.day.app
+	DeviceKey   string `mapstructure:"device_key"` // 设备密钥
+	Group       string `mapstructure:"group"`      // 通知分组，默认FlowSilicon
+	MinSeverity string `mapstructure:"min_severity"`
+}
+
+// ServerChanNotifyConfig Server酱推送渠道
+type ServerChanNotifyConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	SendKey     string `mapstructure:"send_key"` // SendKey，以sctp开头时使用Server酱³的地址
+	MinSeverity string `mapstructure:"min_severity"`
+}
+
+// TelegramNotifyConfig Telegram机器人渠道
+type TelegramNotifyConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	BotToken    string `mapstructure:"bot_token"`
+	ChatID      string `mapstructure:"chat_id"`
+	APIBase     string `mapstructure:"api_base"` // Bot API地址，默认https://api.telegram.org，可填写反向代理地址
+	MinSeverity string `mapstructure:"min_severity"`
+}
+
+// GetNotifyConfig 获取告警通知配置，配置未加载时所有渠道均未启用
+func GetNotifyConfig() NotifyConfig {
+	cfg := GetConfig()
+	if cfg == nil {
+		return NotifyConfig{}
+	}
+	return cfg.Notify
+}
+
+// severityRank 获取通知级别的顺序，无法识别的级别视为info
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityWarning:
+		return 1
+	case SeverityCritical:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// SeverityAtLeast 判断通知级别是否不低于渠道的最低级别，最低级别为空时不过滤
+func SeverityAtLeast(severity, minSeverity string) bool {
+	return severityRank(severity) >= severityRank(minSeverity)
+}
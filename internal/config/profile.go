@@ -0,0 +1,331 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 21:50:00
+  @desc: 配置档案：每个档案有独立的配置数据库（含密钥）和统计文件，用于在不同密钥池之间切换
+**/
+
+package config
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultProfile 默认档案，使用程序目录下原有的data目录，兼容没有档案的旧版本
+	DefaultProfile = "default"
+	// profilesDirName 档案目录，每个档案一个子目录
+	profilesDirName = "profiles"
+	// activeProfileFileName 记录上次使用的档案的文件，位于档案目录中
+	activeProfileFileName = "active"
+)
+
+// profileNamePattern 档案名称只允许字母、数字、下划线和短横线
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ProfilePaths 档案的数据文件路径
+type ProfilePaths struct {
+	Name          string `json:"name"`
+	Dir           string `json:"dir"`
+	DBPath        string `json:"db_path"`         // 配置数据库，同时保存API密钥和模型列表
+	DailyFilePath string `json:"daily_file_path"` // 每日统计文件
+}
+
+var (
+	// profileBaseDir 程序所在目录，档案目录位于其下
+	profileBaseDir string
+	// activeProfile 当前使用的档案
+	activeProfile = DefaultProfile
+	// profileListeners 档案切换后的回调，如更新托盘菜单
+	profileListeners []func(name string)
+	// profileMutex 保护以上变量
+	profileMutex sync.RWMutex
+)
+
+// InitProfile 启动时设置程序目录和使用的档案，确保档案目录存在，返回档案的数据文件路径
+func InitProfile(baseDir, name string) (ProfilePaths, error) {
+	paths, err := resolveProfilePaths(baseDir, name)
+	if err != nil {
+		return ProfilePaths{}, err
+	}
+	if err := os.MkdirAll(paths.Dir, 0755); err != nil {
+		return ProfilePaths{}, fmt.Errorf("创建档案目录失败: %w", err)
+	}
+
+	profileMutex.Lock()
+	profileBaseDir = baseDir
+	profileMutex.Unlock()
+	SetActiveProfile(paths.Name)
+	return paths, nil
+}
+
+// ResolveProfilePaths 获取档案的数据文件路径
+// 默认档案使用程序目录下的data，其他档案使用程序目录下的profiles/<name>
+func ResolveProfilePaths(name string) (ProfilePaths, error) {
+	return resolveProfilePaths(getProfileBaseDir(), name)
+}
+
+// getProfileBaseDir 获取程序所在目录
+func getProfileBaseDir() string {
+	profileMutex.RLock()
+	defer profileMutex.RUnlock()
+	return profileBaseDir
+}
+
+// resolveProfilePaths 获取baseDir下档案的数据文件路径
+func resolveProfilePaths(baseDir, name string) (ProfilePaths, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	if !profileNamePattern.MatchString(name) {
+		return ProfilePaths{}, fmt.Errorf("档案名称无效: %s（只允许字母、数字、下划线和短横线，最长32个字符）", name)
+	}
+
+	dir := filepath.Join(baseDir, "data")
+	if name != DefaultProfile {
+		dir = filepath.Join(baseDir, profilesDirName, name)
+	}
+	return ProfilePaths{
+		Name:          name,
+		Dir:           dir,
+		DBPath:        filepath.Join(dir, dbFileName),
+		DailyFilePath: filepath.Join(dir, "daily.json"),
+	}, nil
+}
+
+// LoadProfileStats 以只读方式加载档案的统计数据，用于stats等命令行工具
+// 与服务启动时相同：使用档案的统计文件，按档案配置中的stats.environment选择统计环境，env非空时优先
+// 不打开全局配置数据库，不记录当前档案，也不写入统计文件
+func LoadProfileStats(baseDir, name, env string) (ProfilePaths, error) {
+	paths, err := resolveProfilePaths(baseDir, name)
+	if err != nil {
+		return ProfilePaths{}, err
+	}
+	cfg, err := readProfileConfig(paths)
+	if err != nil {
+		return paths, err
+	}
+	if cfg != nil {
+		UpdateConfig(cfg)
+		if env == "" {
+			env = cfg.Stats.Environment
+		}
+	}
+
+	SetDailyStatsReadOnly(true)
+	SetDailyFilePath(paths.DailyFilePath)
+	if err := SetStatsEnvironment(env); err != nil {
+		return paths, err
+	}
+	return paths, InitDailyStats()
+}
+
+// readProfileConfig 以只读方式读取档案配置数据库中的配置，配置数据库不存在或没有配置时返回nil
+func readProfileConfig(paths ProfilePaths) (*Config, error) {
+	if _, err := os.Stat(paths.DBPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	profileDB, err := sql.Open("sqlite", "file:"+filepath.ToSlash(paths.DBPath)+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("打开配置数据库失败: %w", err)
+	}
+	defer profileDB.Close()
+
+	var configJSON string
+	if err := profileDB.QueryRow("SELECT value FROM " + configTableName + " WHERE key = 'config'").Scan(&configJSON); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取配置失败: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return nil, fmt.Errorf("解析配置失败: %w", err)
+	}
+	return &cfg, nil
+}
+
+// ProfileFromArgs 从命令行参数中获取--profile指定的档案，未指定时返回空字符串
+// 支持--profile name、--profile=name及单短横线形式，不影响其他参数
+func ProfileFromArgs(args []string) string {
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if name == "profile" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, "profile=") {
+			return strings.TrimPrefix(name, "profile=")
+		}
+	}
+	return ""
+}
+
+// SelectStartupProfile 选择启动时使用的档案：命令行指定的档案优先，其次是上次切换到的档案，最后是默认档案
+func SelectStartupProfile(baseDir, flagProfile string) string {
+	if flagProfile != "" {
+		return flagProfile
+	}
+	data, err := os.ReadFile(filepath.Join(baseDir, profilesDirName, activeProfileFileName))
+	if err != nil {
+		return DefaultProfile
+	}
+	if name := strings.TrimSpace(string(data)); profileNamePattern.MatchString(name) {
+		return name
+	}
+	return DefaultProfile
+}
+
+// saveActiveProfile 记录当前档案，下次未指定--profile启动时使用
+func saveActiveProfile(baseDir, name string) error {
+	dir := filepath.Join(baseDir, profilesDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, activeProfileFileName), []byte(name+"\n"), 0644)
+}
+
+// ListProfiles 列出默认档案和档案目录中的所有档案
+func ListProfiles() []string {
+	profiles := []string{DefaultProfile}
+	entries, err := os.ReadDir(filepath.Join(getProfileBaseDir(), profilesDirName))
+	if err != nil {
+		return profiles
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != DefaultProfile && profileNamePattern.MatchString(entry.Name()) {
+			profiles = append(profiles, entry.Name())
+		}
+	}
+	sort.Strings(profiles[1:])
+	return profiles
+}
+
+// ValidateProfile 检查档案能否使用：配置数据库存在且配置可解析、上游地址已配置、密钥表可读取，
+// 统计文件存在时必须能解析。只读取，不修改档案中的文件
+func ValidateProfile(paths ProfilePaths) error {
+	if _, err := os.Stat(paths.DBPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("档案 %s 缺少配置数据库 %s，可使用 --profile %s 启动一次以创建", paths.Name, paths.DBPath, paths.Name)
+		}
+		return err
+	}
+
+	profileDB, err := sql.Open("sqlite", "file:"+filepath.ToSlash(paths.DBPath)+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("打开配置数据库失败: %w", err)
+	}
+	defer profileDB.Close()
+
+	var configJSON string
+	if err := profileDB.QueryRow("SELECT value FROM " + configTableName + " WHERE key = 'config'").Scan(&configJSON); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("配置数据库中没有配置")
+		}
+		return fmt.Errorf("读取配置失败: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return fmt.Errorf("解析配置失败: %w", err)
+	}
+	if strings.TrimSpace(cfg.ApiProxy.BaseURL) == "" {
+		return errors.New("配置中未设置上游地址(api_proxy.base_url)")
+	}
+
+	var keyCount int
+	if err := profileDB.QueryRow("SELECT count(*) FROM " + apikeysTableName).Scan(&keyCount); err != nil {
+		return fmt.Errorf("读取API密钥表失败: %w", err)
+	}
+	if keyCount == 0 {
+		logger.Warn("档案 %s 中没有API密钥", paths.Name)
+	}
+
+	if data, err := os.ReadFile(paths.DailyFilePath); err == nil {
+		if _, err := decodeDailyData(data, normalizeStatsEnvironment(cfg.Stats.Environment)); err != nil {
+			return fmt.Errorf("解析统计文件失败: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("读取统计文件失败: %w", err)
+	}
+	return nil
+}
+
+// GetActiveProfile 获取当前使用的档案名称
+func GetActiveProfile() string {
+	profileMutex.RLock()
+	defer profileMutex.RUnlock()
+	return activeProfile
+}
+
+// SetActiveProfile 设置当前档案并记录到档案目录，通知已注册的回调
+func SetActiveProfile(name string) {
+	profileMutex.Lock()
+	activeProfile = name
+	baseDir := profileBaseDir
+	listeners := append([]func(string){}, profileListeners...)
+	profileMutex.Unlock()
+
+	if err := saveActiveProfile(baseDir, name); err != nil {
+		logger.Warn("记录当前档案失败: %v", err)
+	}
+	for _, listener := range listeners {
+		listener(name)
+	}
+}
+
+// OnProfileChanged 注册档案切换后的回调
+func OnProfileChanged(listener func(name string)) {
+	profileMutex.Lock()
+	defer profileMutex.Unlock()
+	profileListeners = append(profileListeners, listener)
+}
+
+// SwitchDailyStatsFile 保存当前统计数据后改为使用另一个统计文件，文件不存在时创建
+// 新文件正被其他实例使用或加载失败时恢复原来的文件和数据
+func SwitchDailyStatsFile(path string) error {
+	if err := FlushDailyStats(); err != nil {
+		return fmt.Errorf("保存当前统计数据失败: %w", err)
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	oldPath, oldData := dailyFilePath, dailyData
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := switchDailyInstanceLockLocked(path); err != nil {
+		return err
+	}
+	dailyFilePath = path
+	if err := loadDailyDataLocked(); err != nil {
+		if !os.IsNotExist(err) {
+			dailyFilePath, dailyData = oldPath, oldData
+			if lockErr := switchDailyInstanceLockLocked(oldPath); lockErr != nil {
+				logger.Warn("恢复统计文件锁失败: %v", lockErr)
+			}
+			return fmt.Errorf("加载统计文件失败: %w", err)
+		}
+		dailyData = createDefaultDailyData()
+	}
+	dailyDirty = false
+	dailyPending = 0
+	ensureTodayDataExistsLocked()
+	if err := saveDailyDataLocked(); err != nil {
+		logger.Error("保存统计文件失败: %v", err)
+	}
+	logger.Info("每日统计数据文件已切换为: %s", path)
+	return nil
+}
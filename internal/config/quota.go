@@ -0,0 +1,205 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/3 16:05:00
+  @desc: API密钥每日配额配置与用量检查
+**/
+
+package config
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// KeyQuotaConfig 密钥每日配额配置
+type KeyQuotaConfig struct {
+	DailyRequestLimit int                      `mapstructure:"daily_request_limit"` // 每个密钥每日请求上限，0表示不限制
+	DailyTokenLimit   int                      `mapstructure:"daily_token_limit"`   // 每个密钥每日令牌上限，0表示不限制
+	Overrides         map[string]KeyQuotaLimit `mapstructure:"overrides"`           // 按密钥标识或旧版掩码（前6位+***）单独设置的配额，覆盖默认值
+	Enforce           bool                     `mapstructure:"enforce"`             // 选择密钥时跳过今日用量已达到配额的密钥，次日自动恢复；关闭时配额只用于提醒
+}
+
+// KeyQuotaLimit 单个密钥的每日配额
+type KeyQuotaLimit struct {
+	DailyRequestLimit int `mapstructure:"daily_request_limit"` // 每日请求上限，0表示不限制
+	DailyTokenLimit   int `mapstructure:"daily_token_limit"`   // 每日令牌上限，0表示不限制
+}
+
+// KeyQuotaStatus 密钥当日配额使用情况
+type KeyQuotaStatus struct {
+	KeyID        string  `json:"key_id"`
+	MaskedKey    string  `json:"masked_key"` // 按脱敏策略显示的密钥
+	Requests     int     `json:"requests"`
+	Tokens       int     `json:"tokens"`
+	RequestLimit int     `json:"request_limit"`
+	TokenLimit   int     `json:"token_limit"`
+	UsedFraction float64 `json:"used_fraction"` // 请求和令牌两项中较高的使用比例
+}
+
+// Unlimited 是否没有任何配额限制
+func (l KeyQuotaLimit) Unlimited() bool {
+	return l.DailyRequestLimit <= 0 && l.DailyTokenLimit <= 0
+}
+
+// GetKeyQuotaLimit 获取指定密钥标识的每日配额
+// 单独配置的配额可以用密钥标识或旧版掩码作为键
+func GetKeyQuotaLimit(keyID string) KeyQuotaLimit {
+	cfg := GetConfig()
+	if cfg == nil {
+		return KeyQuotaLimit{}
+	}
+
+	quota := cfg.App.KeyQuota
+	if override, ok := quota.Overrides[keyID]; ok {
+		return override
+	}
+	if len(quota.Overrides) > 0 {
+		if apiKey, ok := resolveKeyID(keyID); ok {
+			if override, ok := quota.Overrides[legacyMaskAPIKey(apiKey)]; ok {
+				return override
+			}
+		}
+	}
+	return KeyQuotaLimit{
+		DailyRequestLimit: quota.DailyRequestLimit,
+		DailyTokenLimit:   quota.DailyTokenLimit,
+	}
+}
+
+// keysWithinQuota 开启配额强制时去掉今日请求数或令牌数已达到配额的密钥
+// 用量按日期统计，次日用量从0开始，超额的密钥无需恢复操作即可重新参与选择
+func keysWithinQuota(keys []ApiKey) []ApiKey {
+	cfg := GetConfig()
+	if cfg == nil || !cfg.App.KeyQuota.Enforce || len(keys) == 0 {
+		return keys
+	}
+	quota := cfg.App.KeyQuota
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return keys
+	}
+
+	today := time.Now().Format("2006-01-02")
+	result := make([]ApiKey, 0, len(keys))
+	for _, k := range keys {
+		keyID := KeyID(k.Key)
+		// 已知原始密钥，直接按标识或旧版掩码查找单独配置的配额，不需要反查密钥列表
+		limit, ok := quota.Overrides[keyID]
+		if !ok {
+			if limit, ok = quota.Overrides[legacyMaskAPIKey(k.Key)]; !ok {
+				limit = KeyQuotaLimit{DailyRequestLimit: quota.DailyRequestLimit, DailyTokenLimit: quota.DailyTokenLimit}
+			}
+		}
+		usage := dailyData.KeysUsage[keyID][today]
+		if (limit.DailyRequestLimit > 0 && usage.Requests >= limit.DailyRequestLimit) ||
+			(limit.DailyTokenLimit > 0 && usage.Tokens >= limit.DailyTokenLimit) {
+			continue
+		}
+		result = append(result, k)
+	}
+	return result
+}
+
+// quotaUsedFraction 计算用量占配额的比例，取请求和令牌中较高者
+func quotaUsedFraction(usage KeyUsage, limit KeyQuotaLimit) float64 {
+	fraction := 0.0
+	if limit.DailyRequestLimit > 0 {
+		fraction = float64(usage.Requests) / float64(limit.DailyRequestLimit)
+	}
+	if limit.DailyTokenLimit > 0 {
+		if f := float64(usage.Tokens) / float64(limit.DailyTokenLimit); f > fraction {
+			fraction = f
+		}
+	}
+	return fraction
+}
+
+// GetKeysNearQuota 获取今日用量达到配额指定比例的密钥，按使用比例从高到低排序
+// threshold 为比例，例如0.8表示80%，未配置配额的密钥不参与统计
+func GetKeysNearQuota(threshold float64) ([]KeyQuotaStatus, error) {
+	if threshold < 0 {
+		return nil, errors.New("阈值不能为负数")
+	}
+
+	today := time.Now().Format("2006-01-02")
+	dailyDataLock.RLock()
+	if dailyData == nil {
+		dailyDataLock.RUnlock()
+		return nil, ErrStatsNotInitialized
+	}
+	todayUsage := make(map[string]KeyUsage, len(dailyData.KeysUsage))
+	for keyID, usageByDate := range dailyData.KeysUsage {
+		todayUsage[keyID] = usageByDate[today]
+	}
+	dailyDataLock.RUnlock()
+
+	// 在统计锁之外查找配额和原始密钥，避免与密钥配置的锁嵌套
+	result := make([]KeyQuotaStatus, 0)
+	for keyID, usage := range todayUsage {
+		limit := GetKeyQuotaLimit(keyID)
+		if limit.Unlimited() {
+			continue
+		}
+
+		fraction := quotaUsedFraction(usage, limit)
+		if fraction < threshold {
+			continue
+		}
+
+		result = append(result, KeyQuotaStatus{
+			KeyID:        keyID,
+			MaskedKey:    DisplayKeyID(keyID, false),
+			Requests:     usage.Requests,
+			Tokens:       usage.Tokens,
+			RequestLimit: limit.DailyRequestLimit,
+			TokenLimit:   limit.DailyTokenLimit,
+			UsedFraction: fraction,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].UsedFraction != result[j].UsedFraction {
+			return result[i].UsedFraction > result[j].UsedFraction
+		}
+		return result[i].KeyID < result[j].KeyID
+	})
+
+	return result, nil
+}
+
+var (
+	// quotaExceededCallback 密钥当日令牌用量首次达到配额时的回调，受dailyDataLock保护
+	quotaExceededCallback func(maskedKey string, usedTokens, limit int)
+	// quotaNotifiedDate 每个密钥最近一次触发回调的日期，同一天只触发一次，只保存在内存中
+	quotaNotifiedDate = make(map[string]string)
+)
+
+// SetQuotaExceededCallback 设置密钥当日令牌用量首次达到每日令牌配额时的回调，传nil取消
+// 每个密钥每天只触发一次，回调在统计锁之外执行；程序重启后当天已触发的密钥会再触发一次
+func SetQuotaExceededCallback(callback func(maskedKey string, usedTokens, limit int)) {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+	quotaExceededCallback = callback
+}
+
+// checkQuotaExceededLocked 检查密钥当日令牌用量是否首次达到配额（已加锁）
+// 需要触发回调时返回调用函数，由调用方在释放统计锁后执行，否则返回nil
+func checkQuotaExceededLocked(keyID, date string, usedTokens int) func() {
+	callback := quotaExceededCallback
+	if callback == nil || quotaNotifiedDate[keyID] == date {
+		return nil
+	}
+	limit := GetKeyQuotaLimit(keyID).DailyTokenLimit
+	if limit <= 0 || usedTokens < limit {
+		return nil
+	}
+
+	quotaNotifiedDate[keyID] = date
+	return func() {
+		callback(DisplayKeyID(keyID, false), usedTokens, limit)
+	}
+}
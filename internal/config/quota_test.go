@@ -0,0 +1,76 @@
+package config
+
+import "testing"
+
+// setKeyQuotaForTest 设置密钥每日配额，其余配置使用默认值
+func setKeyQuotaForTest(quota KeyQuotaConfig) {
+	cfg := &Config{}
+	cfg.App.KeyQuota = quota
+	UpdateConfig(cfg)
+}
+
+func TestGetKeysNearQuota(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	setKeyQuotaForTest(KeyQuotaConfig{Overrides: map[string]KeyQuotaLimit{
+		KeyID("sk-half"): {DailyRequestLimit: 100},
+		KeyID("sk-near"): {DailyRequestLimit: 100},
+	}})
+
+	AddDailyRequestStat("sk-half", "model-a", "", "", 50, 0, 0, true)
+	AddDailyRequestStat("sk-near", "model-a", "", "", 85, 0, 0, true)
+	AddDailyRequestStat("sk-unlimited", "model-a", "", "", 1000, 0, 0, true)
+
+	near, err := GetKeysNearQuota(0.8)
+	if err != nil {
+		t.Fatalf("GetKeysNearQuota() = %v", err)
+	}
+	if len(near) != 1 || near[0].KeyID != KeyID("sk-near") {
+		t.Fatalf("GetKeysNearQuota(0.8) = %+v, want 只有sk-near", near)
+	}
+	if near[0].Requests != 85 || near[0].RequestLimit != 100 || near[0].UsedFraction != 0.85 {
+		t.Fatalf("sk-near配额状态 = %+v", near[0])
+	}
+
+	// 阈值降低后按使用比例从高到低排序，未配置配额的密钥仍不出现
+	all, err := GetKeysNearQuota(0.5)
+	if err != nil || len(all) != 2 || all[0].KeyID != KeyID("sk-near") || all[1].KeyID != KeyID("sk-half") {
+		t.Fatalf("GetKeysNearQuota(0.5) = %+v, %v", all, err)
+	}
+	if _, err := GetKeysNearQuota(-1); err == nil {
+		t.Fatal("阈值为负数时应返回错误")
+	}
+}
+
+func TestQuotaExceededCallbackFiresOnce(t *testing.T) {
+	resetDailyStatsForTest(t, StatsConfig{})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+	setKeyQuotaForTest(KeyQuotaConfig{Overrides: map[string]KeyQuotaLimit{
+		KeyID("sk-limited"): {DailyTokenLimit: 100},
+	}})
+	quotaNotifiedDate = make(map[string]string)
+
+	type call struct{ used, limit int }
+	var calls []call
+	SetQuotaExceededCallback(func(maskedKey string, usedTokens, limit int) {
+		calls = append(calls, call{usedTokens, limit})
+	})
+	t.Cleanup(func() { SetQuotaExceededCallback(nil) })
+
+	AddDailyRequestStat("sk-limited", "model-a", "", "", 1, 60, 30, true)
+	if len(calls) != 0 {
+		t.Fatalf("未达到配额时不应触发回调: %+v", calls)
+	}
+	AddDailyRequestStat("sk-limited", "model-a", "", "", 1, 10, 5, true)
+	AddDailyRequestStat("sk-limited", "model-a", "", "", 1, 50, 0, true)
+	AddStreamingTokenDelta("req-1", "sk-limited", "model-a", 20, 0)
+	AddDailyRequestStat("sk-unlimited", "model-a", "", "", 1, 500, 0, true)
+
+	if len(calls) != 1 || calls[0] != (call{105, 100}) {
+		t.Fatalf("回调调用 = %+v, want 只有一次 {105 100}", calls)
+	}
+}
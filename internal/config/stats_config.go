@@ -0,0 +1,90 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/5 09:40:00
+  @desc: 每日统计数据相关配置
+**/
+
+package config
+
+import "math"
+
+// StatsConfig 统计数据配置
+type StatsConfig struct {
+	ReadOnlyReplica      bool                  `mapstructure:"read_only_replica"`      // 只读副本模式：不写入统计文件，监听文件变化并自动重新加载
+	CompactHourly        bool                  `mapstructure:"compact_hourly"`         // 保存时省略请求数和令牌数均为0的小时统计
+	Environment          string                `mapstructure:"environment"`            // 统计环境标签，不同环境的数据分开存储，为空时使用default
+	HealthScore          HealthScoreWeights    `mapstructure:"health_score"`           // 健康分权重
+	FlushEveryNRequests  int                   `mapstructure:"flush_every_n_requests"` // 累计记录N个请求后立即保存，0表示只按时间保存
+	HourlyByModel        bool                  `mapstructure:"hourly_by_model"`        // 按模型记录小时统计，会增大统计文件
+	ConsistencyCheck     bool                  `mapstructure:"consistency_check"`      // 每晚检查汇总值与密钥、模型、小时明细是否一致
+	ConsistencyRepair    bool                  `mapstructure:"consistency_repair"`     // 每晚检查发现不一致时按小时统计修复汇总值
+	ConsistencyTolerance float64               `mapstructure:"consistency_tolerance"`  // 一致性检查的相对容差，如0.01表示1%，0表示必须完全一致
+	MonthlyArchive       bool                  `mapstructure:"monthly_archive"`        // 新月份开始时将上月汇总写入archive/YYYY-MM.json，清理保留期前的数据时同样归档
+	Digest               DigestConfig          `mapstructure:"digest"`                 // 每日统计摘要推送
+	Anomaly              AnomalyConfig         `mapstructure:"anomaly"`                // 用量异常检测与自动保护
+	ModelAliases         map[string]string     `mapstructure:"model_aliases"`          // 模型别名到实际模型名的映射，记录统计前解析，使别名与实际模型合并统计
+	AsyncRecording       bool                  `mapstructure:"async_recording"`        // 异步记录请求统计：请求处理中只放入队列，由后台协程按顺序写入
+	AsyncBufferSize      int                   `mapstructure:"async_buffer_size"`      // 异步记录队列长度，队列满时丢弃记录并计数，0表示使用默认值4096
+	TokenRounding        string                `mapstructure:"token_rounding"`         // 小数令牌数取整方式：round（四舍五入，默认）、floor、ceil
+	FileLockMode         string                `mapstructure:"file_lock_mode"`         // 统计文件被其他实例使用时的处理方式：readonly（只读运行，默认）、refuse（拒绝启动）
+	HourlyRetentionDays  int                   `mapstructure:"hourly_retention_days"`  // 小时明细保留天数，更早的日期只保留每日汇总，0表示不清除
+	StatsD               StatsDConfig          `mapstructure:"statsd"`                 // 将请求统计发送到StatsD/DogStatsD
+	RetentionDays        int                   `mapstructure:"retention_days"`         // 每日统计保留天数，0表示使用默认值30，配合monthly_archive可将更早的日期归档为月度汇总
+	FlushIntervalSeconds int                   `mapstructure:"flush_interval_seconds"` // 两次保存统计文件的最短间隔（秒），期间的记录合并为一次写入，0表示记录后防抖2秒保存
+	Pricing              map[string]ModelPrice `mapstructure:"pricing"`                // 按模型设置的每1K令牌单价，用于估算费用，"*"适用于未单独配置的模型
+}
+
+// 小数令牌数的取整方式
+const (
+	TokenRoundingRound = "round" // 四舍五入，0.5向远离0的方向进位
+	TokenRoundingFloor = "floor" // 向下取整
+	TokenRoundingCeil  = "ceil"  // 向上取整
+)
+
+// getStatsConfig 获取统计数据配置，配置未加载时返回默认值
+func getStatsConfig() StatsConfig {
+	cfg := GetConfig()
+	if cfg == nil {
+		return StatsConfig{}
+	}
+	return cfg.Stats
+}
+
+// statsRetentionDays 获取每日统计保留的天数，未配置或配置无效时使用默认值
+func statsRetentionDays() int {
+	if days := getStatsConfig().RetentionDays; days > 0 {
+		return days
+	}
+	return defaultDailyStatsRetentionDays
+}
+
+// roundTokens 按配置的取整方式将小数令牌数转换为整数
+// 提示词和补全令牌分别取整后再累加，负数、NaN和无穷大按0计，超出int范围时按math.MaxInt计
+func roundTokens(tokens float64) int {
+	if math.IsNaN(tokens) || math.IsInf(tokens, 0) || tokens <= 0 {
+		return 0
+	}
+	var rounded float64
+	switch getStatsConfig().TokenRounding {
+	case TokenRoundingFloor:
+		rounded = math.Floor(tokens)
+	case TokenRoundingCeil:
+		rounded = math.Ceil(tokens)
+	default:
+		rounded = math.Round(tokens)
+	}
+	// 超出int范围的浮点数转换结果由实现决定，可能为负数
+	if rounded >= float64(math.MaxInt) {
+		return math.MaxInt
+	}
+	return int(rounded)
+}
+
+// ResolveModelAlias 将模型别名解析为配置的实际模型名，不是别名时原样返回
+// 只解析一层，避免配置成环时无限循环
+func ResolveModelAlias(model string) string {
+	if canonical, ok := getStatsConfig().ModelAliases[model]; ok && canonical != "" {
+		return canonical
+	}
+	return model
+}
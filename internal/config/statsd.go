@@ -0,0 +1,142 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 23:00:00
+  @desc: 将请求统计以UDP发送到StatsD/DogStatsD，发送失败不影响请求处理
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+const (
+	// defaultStatsDPrefix 指标名默认前缀
+	defaultStatsDPrefix = "flowsilicon."
+	// statsdQueueSize 待发送指标队列长度，队列满时丢弃
+	statsdQueueSize = 1000
+)
+
+// StatsDConfig StatsD指标发送配置
+type StatsDConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Address   string `mapstructure:"address"`   // 收集端地址，如127.0.0.1:8125
+	Prefix    string `mapstructure:"prefix"`    // 指标名前缀，默认flowsilicon.
+	DogStatsD bool   `mapstructure:"dogstatsd"` // 使用DogStatsD标签格式，否则将结果和模型写入指标名
+}
+
+// statsdPacket 一次请求的指标，address为生成时配置的收集端地址
+type statsdPacket struct {
+	address string
+	payload string
+}
+
+var (
+	// statsdQueue 待发送的指标
+	statsdQueue = make(chan statsdPacket, statsdQueueSize)
+	// statsdSenderOnce 保证发送协程只启动一次
+	statsdSenderOnce sync.Once
+)
+
+// emitStatsD 按配置发送请求的计数指标：请求数（按结果和模型）和令牌数（按模型）
+// 只放入队列，不等待发送，未开启或未配置地址时不处理
+func emitStatsD(record DailyRequestRecord) {
+	cfg := getStatsConfig().StatsD
+	if !cfg.Enabled || cfg.Address == "" {
+		return
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = defaultStatsDPrefix
+	}
+	status := "fail"
+	if record.IsSuccess {
+		status = "success"
+	}
+	model := normalizeModelName(ResolveModelAlias(record.Model))
+	if model == "" {
+		model = "unknown"
+	}
+	tokens := record.PromptTokens + record.CompletionTokens
+
+	var lines []string
+	if cfg.DogStatsD {
+		tags := "#status:" + status + ",model:" + sanitizeStatsDTag(model)
+		lines = append(lines, fmt.Sprintf("%srequests:%d|c|%s", prefix, record.RequestCount, tags))
+		if tokens > 0 {
+			lines = append(lines, fmt.Sprintf("%stokens:%d|c|#model:%s", prefix, tokens, sanitizeStatsDTag(model)))
+		}
+	} else {
+		name := sanitizeStatsDName(model)
+		lines = append(lines, fmt.Sprintf("%srequests.%s.%s:%d|c", prefix, status, name, record.RequestCount))
+		if tokens > 0 {
+			lines = append(lines, fmt.Sprintf("%stokens.%s:%d|c", prefix, name, tokens))
+		}
+	}
+
+	statsdSenderOnce.Do(func() {
+		go runStatsDSender()
+	})
+	select {
+	case statsdQueue <- statsdPacket{address: cfg.Address, payload: strings.Join(lines, "\n")}:
+	default:
+		// 队列满说明收集端或网络异常，丢弃指标，不影响请求处理
+	}
+}
+
+// runStatsDSender 发送队列中的指标，地址变化时重新连接
+// UDP发送不等待收集端响应，收集端不存在时写入错误只记录一次日志
+func runStatsDSender() {
+	var conn net.Conn
+	var connAddress string
+	warned := false
+
+	for packet := range statsdQueue {
+		if conn == nil || connAddress != packet.address {
+			if conn != nil {
+				conn.Close()
+				conn = nil
+			}
+			c, err := net.Dial("udp", packet.address)
+			if err != nil {
+				if !warned {
+					logger.Warn("连接StatsD收集端 %s 失败: %v", packet.address, err)
+					warned = true
+				}
+				continue
+			}
+			conn, connAddress, warned = c, packet.address, false
+		}
+		if _, err := conn.Write([]byte(packet.payload)); err != nil && !warned {
+			logger.Warn("发送StatsD指标到 %s 失败: %v", packet.address, err)
+			warned = true
+		}
+	}
+}
+
+// sanitizeStatsDName 将模型名转换为可用于StatsD指标名的片段，点、冒号、竖线等分隔符替换为下划线
+func sanitizeStatsDName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ':', '|', '@', '#', ',', '/', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// sanitizeStatsDTag 将模型名转换为可用于DogStatsD标签值的文本，保留斜杠和点
+func sanitizeStatsDTag(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// listenStatsD 在本机随机端口监听UDP，作为StatsD收集端
+func listenStatsD(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("监听UDP失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readStatsDPacket 读取收集端收到的一个数据包
+func readStatsDPacket(t *testing.T, conn *net.UDPConn) string {
+	t.Helper()
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("读取StatsD指标失败: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestEmitStatsD(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     StatsDConfig
+		success bool
+		want    string
+	}{
+		{
+			name:    "statsd",
+			cfg:     StatsDConfig{Prefix: "fs."},
+			success: true,
+			want:    "fs.requests.success.org_model_v1:2|c\nfs.tokens.org_model_v1:15|c",
+		},
+		{
+			name:    "dogstatsd",
+			cfg:     StatsDConfig{DogStatsD: true},
+			success: false,
+			want:    "flowsilicon.requests:2|c|#status:fail,model:org/model.v1\nflowsilicon.tokens:15|c|#model:org/model.v1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := listenStatsD(t)
+			tt.cfg.Enabled = true
+			tt.cfg.Address = conn.LocalAddr().String()
+			resetDailyStatsForTest(t, StatsConfig{StatsD: tt.cfg})
+			if err := InitDailyStats(); err != nil {
+				t.Fatalf("InitDailyStats() = %v", err)
+			}
+
+			AddDailyRequestStat("sk-test", "org/model.v1", "", "", 2, 10, 5, tt.success)
+			if got := readStatsDPacket(t, conn); got != tt.want {
+				t.Fatalf("收到的指标 = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmitStatsDDisabled(t *testing.T) {
+	conn := listenStatsD(t)
+	resetDailyStatsForTest(t, StatsConfig{StatsD: StatsDConfig{Address: conn.LocalAddr().String()}})
+	if err := InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+
+	AddDailyRequestStat("sk-test", "model-a", "", "", 1, 10, 5, true)
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, _, err := conn.ReadFromUDP(make([]byte, 1024)); err == nil {
+		t.Fatalf("未开启时不应发送指标，收到 %d 字节", n)
+	}
+}
@@ -0,0 +1,100 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 18:20:00
+  @desc: 流式请求的首字节超时与数据块空闲超时配置及统计
+**/
+
+package config
+
+import (
+	"path"
+	"time"
+)
+
+// 流式请求超时类型
+const (
+	StreamTimeoutFirstByte = "first_byte" // 首字节超时，尚未向客户端发送数据，可换密钥重试
+	StreamTimeoutIdle      = "idle"       // 数据块之间的空闲超时，流已开始，直接结束
+)
+
+// StreamTimeoutConfig 流式请求超时配置
+type StreamTimeoutConfig struct {
+	FirstByteSeconds int                 `mapstructure:"first_byte_seconds"` // 发出请求到收到首个数据的最长等待时间（秒），0表示不限制
+	IdleSeconds      int                 `mapstructure:"idle_seconds"`       // 两个数据块之间的最长间隔（秒），0表示不限制
+	Rules            []StreamTimeoutRule `mapstructure:"rules"`              // 按模型覆盖的规则，按顺序取第一条匹配的规则
+}
+
+// StreamTimeoutRule 按模型通配符覆盖流式超时，值为0时沿用全局配置，小于0表示该模型不限制
+type StreamTimeoutRule struct {
+	Pattern          string `mapstructure:"pattern"`            // 模型通配符，语法与path.Match一致
+	FirstByteSeconds int    `mapstructure:"first_byte_seconds"` // 首字节超时（秒）
+	IdleSeconds      int    `mapstructure:"idle_seconds"`       // 空闲超时（秒）
+}
+
+// StreamTimeoutStats 流式请求超时次数统计
+type StreamTimeoutStats struct {
+	FirstByte int            `json:"first_byte"`       // 首字节超时次数
+	Idle      int            `json:"idle"`             // 空闲超时次数
+	ByKey     map[string]int `json:"by_key,omitempty"` // 按稳定密钥标识统计的超时次数
+}
+
+// GetStreamTimeouts 获取模型的首字节超时和空闲超时，返回0表示不限制
+func GetStreamTimeouts(model string) (firstByte, idle time.Duration) {
+	cfg := GetConfig()
+	if cfg == nil {
+		return 0, 0
+	}
+	timeouts := cfg.ApiProxy.StreamTimeout
+
+	firstByteSeconds := timeouts.FirstByteSeconds
+	idleSeconds := timeouts.IdleSeconds
+	for _, rule := range timeouts.Rules {
+		if rule.Pattern == "" {
+			continue
+		}
+		if matched, _ := path.Match(rule.Pattern, model); !matched {
+			continue
+		}
+		if rule.FirstByteSeconds != 0 {
+			firstByteSeconds = rule.FirstByteSeconds
+		}
+		if rule.IdleSeconds != 0 {
+			idleSeconds = rule.IdleSeconds
+		}
+		break
+	}
+
+	if firstByteSeconds > 0 {
+		firstByte = time.Duration(firstByteSeconds) * time.Second
+	}
+	if idleSeconds > 0 {
+		idle = time.Duration(idleSeconds) * time.Second
+	}
+	return firstByte, idle
+}
+
+// AddStreamTimeout 记录一次流式请求超时，kind为StreamTimeoutFirstByte或StreamTimeoutIdle
+func AddStreamTimeout(kind, apiKey string) {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	timeouts := &todayStatsLocked().StreamTimeouts
+	switch kind {
+	case StreamTimeoutFirstByte:
+		timeouts.FirstByte++
+	case StreamTimeoutIdle:
+		timeouts.Idle++
+	default:
+		return
+	}
+
+	if apiKey != "" {
+		if timeouts.ByKey == nil {
+			timeouts.ByKey = make(map[string]int)
+		}
+		timeouts.ByKey[KeyID(apiKey)]++
+	}
+
+	dailyDirty = true
+	scheduleDailySaveLocked()
+}
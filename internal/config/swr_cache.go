@@ -0,0 +1,191 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 20:50:00
+  @desc: 带持久化的stale-while-revalidate缓存，用于余额、模型列表等较慢的上游查询
+**/
+
+package config
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/logger"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SWRCache stale-while-revalidate缓存：有缓存时立即返回并在过期后后台刷新，
+// 只有从未成功获取过时才返回错误；缓存保存在数据目录的cache子目录，重启后仍可使用
+type SWRCache struct {
+	name       string
+	ttl        time.Duration
+	mu         sync.Mutex
+	saveMu     sync.Mutex
+	loaded     bool
+	version    int // 每次写入递增，避免较旧的快照覆盖较新的文件
+	saved      int // 已保存到文件的版本，由saveMu保护
+	entries    map[string]swrEntry
+	refreshing map[string]bool
+}
+
+// swrEntry 缓存条目
+type swrEntry struct {
+	Value     string    `json:"value"`
+	FetchedAt time.Time `json:"fetched_at"`
+	LastError string    `json:"last_error,omitempty"` // 最近一次后台刷新失败的原因
+}
+
+var (
+	// swrCaches 所有已创建的缓存，切换数据目录时需要重置
+	swrCaches      []*SWRCache
+	swrCachesMutex sync.Mutex
+)
+
+// NewSWRCache 创建缓存，name同时作为持久化文件名，ttl为缓存值被视为新鲜的时长
+func NewSWRCache(name string, ttl time.Duration) *SWRCache {
+	c := &SWRCache{
+		name:       name,
+		ttl:        ttl,
+		entries:    make(map[string]swrEntry),
+		refreshing: make(map[string]bool),
+	}
+	swrCachesMutex.Lock()
+	swrCaches = append(swrCaches, c)
+	swrCachesMutex.Unlock()
+	return c
+}
+
+// ResetSWRCaches 清空所有缓存的内存数据，下次使用时从当前数据目录重新加载
+// 在切换统计文件（如切换配置档案）后调用
+func ResetSWRCaches() {
+	swrCachesMutex.Lock()
+	defer swrCachesMutex.Unlock()
+	for _, c := range swrCaches {
+		c.mu.Lock()
+		c.loaded = false
+		c.entries = make(map[string]swrEntry)
+		c.mu.Unlock()
+	}
+}
+
+// cacheFilePath 获取缓存文件路径，与每日统计文件位于同一数据目录
+func (c *SWRCache) cacheFilePath() string {
+	dailyDataLock.RLock()
+	path := dailyFilePath
+	dailyDataLock.RUnlock()
+	if path == "" {
+		path = "data/daily.json"
+	}
+	return filepath.Join(filepath.Dir(path), "cache", c.name+".json")
+}
+
+// loadLocked 首次使用时从文件加载缓存（已加锁）
+func (c *SWRCache) loadLocked() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+
+	data, err := os.ReadFile(c.cacheFilePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("读取缓存 %s 失败: %v", c.name, err)
+		}
+		return
+	}
+	var entries map[string]swrEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		logger.Warn("解析缓存 %s 失败: %v", c.name, err)
+		return
+	}
+	for k, e := range entries {
+		c.entries[k] = e
+	}
+}
+
+// Get 获取缓存值和缓存时长
+// force为true时忽略缓存同步获取，失败时返回错误；否则有缓存时立即返回，超过ttl时在后台刷新，
+// 没有缓存时同步获取
+func (c *SWRCache) Get(key string, force bool, fetch func() ([]byte, error)) ([]byte, time.Duration, error) {
+	c.mu.Lock()
+	c.loadLocked()
+	entry, ok := c.entries[key]
+	if ok && !force {
+		age := time.Since(entry.FetchedAt)
+		if age > c.ttl && !c.refreshing[key] {
+			c.refreshing[key] = true
+			go c.refresh(key, fetch)
+		}
+		c.mu.Unlock()
+		return []byte(entry.Value), age, nil
+	}
+	c.mu.Unlock()
+
+	value, err := fetch()
+	if err != nil {
+		return nil, 0, err
+	}
+	c.Set(key, value)
+	return value, 0, nil
+}
+
+// refresh 后台刷新缓存，失败时保留旧值并记录原因
+func (c *SWRCache) refresh(key string, fetch func() ([]byte, error)) {
+	value, err := fetch()
+
+	c.mu.Lock()
+	delete(c.refreshing, key)
+	if err != nil {
+		if entry, ok := c.entries[key]; ok {
+			entry.LastError = err.Error()
+			c.entries[key] = entry
+		}
+		c.mu.Unlock()
+		logger.Warn("后台刷新缓存 %s 失败，继续使用旧值: %v", c.name, err)
+		return
+	}
+	c.mu.Unlock()
+
+	c.Set(key, value)
+}
+
+// Set 写入缓存并保存到文件
+func (c *SWRCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	c.loadLocked()
+	c.entries[key] = swrEntry{Value: string(value), FetchedAt: time.Now()}
+	c.version++
+	version := c.version
+	snapshot := make(map[string]swrEntry, len(c.entries))
+	for k, e := range c.entries {
+		snapshot[k] = e
+	}
+	c.mu.Unlock()
+
+	c.save(snapshot, version)
+}
+
+// save 保存缓存快照，已有更新的快照保存过时跳过，保存失败只记录日志
+func (c *SWRCache) save(entries map[string]swrEntry, version int) {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	if version <= c.saved {
+		return
+	}
+
+	path := c.cacheFilePath()
+	data, err := json.Marshal(entries)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		err = writeFileAtomic(path, data, 0644)
+	}
+	if err != nil {
+		logger.Warn("保存缓存 %s 失败: %v", c.name, err)
+		return
+	}
+	c.saved = version
+}
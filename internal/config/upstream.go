@@ -0,0 +1,83 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 19:30:00
+  @desc: 上游基础URL的切换记录，探测与切换流程由common包负责
+**/
+
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+// UpstreamStatus 上游基础URL的当前状态
+type UpstreamStatus struct {
+	BaseURL        string `json:"base_url"`                   // 当前生效的上游地址
+	PreviousURL    string `json:"previous_url,omitempty"`     // 上一次切换前的地址
+	SwitchedAt     string `json:"switched_at,omitempty"`      // 最近一次切换（含回滚）的时间
+	RolledBack     bool   `json:"rolled_back"`                // 最近一次切换是否为自动回滚
+	LastProbeURL   string `json:"last_probe_url,omitempty"`   // 最近一次探测的地址
+	LastProbeAt    string `json:"last_probe_at,omitempty"`    // 最近一次探测的时间
+	LastProbeError string `json:"last_probe_error,omitempty"` // 最近一次探测失败的原因，成功时为空
+}
+
+var (
+	// upstreamStatus 上游地址切换与探测记录，BaseURL字段以配置为准
+	upstreamStatus UpstreamStatus
+	// upstreamMutex 保护upstreamStatus，同时保证同一时间只有一次切换
+	upstreamMutex sync.RWMutex
+)
+
+// GetUpstreamStatus 获取上游基础URL的当前状态
+func GetUpstreamStatus() UpstreamStatus {
+	upstreamMutex.RLock()
+	status := upstreamStatus
+	upstreamMutex.RUnlock()
+
+	if cfg := GetConfig(); cfg != nil {
+		status.BaseURL = cfg.ApiProxy.BaseURL
+	}
+	return status
+}
+
+// RecordUpstreamProbe 记录一次上游探测结果
+func RecordUpstreamProbe(url string, probeErr error) {
+	upstreamMutex.Lock()
+	defer upstreamMutex.Unlock()
+
+	upstreamStatus.LastProbeURL = url
+	upstreamStatus.LastProbeAt = time.Now().Format(time.RFC3339)
+	upstreamStatus.LastProbeError = ""
+	if probeErr != nil {
+		upstreamStatus.LastProbeError = probeErr.Error()
+	}
+}
+
+// SetUpstreamBaseURL 切换上游基础URL并保存配置，expected非空时仅在当前地址仍为expected时切换
+// 返回是否实际发生了切换，保存配置失败时不切换；rollback表示本次切换是否为自动回滚
+func SetUpstreamBaseURL(url, expected string, rollback bool) (bool, error) {
+	upstreamMutex.Lock()
+	defer upstreamMutex.Unlock()
+
+	cfg := GetConfig()
+	if cfg == nil {
+		return false, nil
+	}
+	current := cfg.ApiProxy.BaseURL
+	if current == url || (expected != "" && current != expected) {
+		return false, nil
+	}
+
+	newConfig := *cfg
+	newConfig.ApiProxy.BaseURL = url
+	if err := ApplyConfig(&newConfig); err != nil {
+		return false, err
+	}
+
+	upstreamStatus.PreviousURL = current
+	upstreamStatus.SwitchedAt = time.Now().Format(time.RFC3339)
+	upstreamStatus.RolledBack = rollback
+
+	return true, nil
+}
@@ -0,0 +1,441 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 01:25:00
+  @desc: 虚拟密钥：下游用户使用的密钥，共用上游密钥池，各自有速率限制、每日配额、模型白名单和独立的用量统计
+**/
+
+package config
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// virtualKeysTableName 虚拟密钥表名，与API密钥在同一个配置数据库中
+	virtualKeysTableName = "virtual_keys"
+	// virtualKeyIDPrefix 虚拟密钥标识前缀
+	virtualKeyIDPrefix = "vk_"
+	// virtualKeySecretPrefix 虚拟密钥前缀，便于与上游密钥区分
+	virtualKeySecretPrefix = "fs-"
+	// virtualKeyDisplayLen 列表中显示的虚拟密钥前缀长度
+	virtualKeyDisplayLen = 8
+)
+
+var (
+	// ErrVirtualKeyNotFound 虚拟密钥不存在
+	ErrVirtualKeyNotFound = errors.New("虚拟密钥不存在")
+	// ErrVirtualKeyInvalid 虚拟密钥的设置无效
+	ErrVirtualKeyInvalid = errors.New("虚拟密钥设置无效")
+	// ErrVirtualKeyQuotaExceeded 虚拟密钥今天的用量已达到每日配额
+	ErrVirtualKeyQuotaExceeded = errors.New("虚拟密钥已达到每日配额")
+)
+
+// VirtualKeysConfig 虚拟密钥配置
+type VirtualKeysConfig struct {
+	Require bool `mapstructure:"require"` // 是否要求所有代理请求使用有效的虚拟密钥；关闭时只对使用虚拟密钥的请求应用其限制
+}
+
+// VirtualKey 虚拟密钥，只保存密钥的SHA-256，原始密钥只在创建时返回一次
+type VirtualKey struct {
+	ID                string   `json:"id"`
+	Name              string   `json:"name"`
+	Prefix            string   `json:"prefix"`              // 密钥的前几位，用于辨认
+	RateLimitRPM      int      `json:"rate_limit_rpm"`      // 每分钟请求上限，0表示不限制
+	DailyRequestLimit int      `json:"daily_request_limit"` // 每日请求上限，0表示不限制
+	DailyTokenLimit   int      `json:"daily_token_limit"`   // 每日令牌上限，0表示不限制
+	AllowedModels     []string `json:"allowed_models"`      // 允许使用的模型，为空表示不限制，以*结尾表示前缀匹配
+	Disabled          bool     `json:"disabled"`
+	CreatedAt         int64    `json:"created_at"`
+
+	hash string
+}
+
+// VirtualKeySpec 创建或修改虚拟密钥的设置，修改时只应用非nil的字段
+type VirtualKeySpec struct {
+	Name              *string  `json:"name"`
+	RateLimitRPM      *int     `json:"rate_limit_rpm"`
+	DailyRequestLimit *int     `json:"daily_request_limit"`
+	DailyTokenLimit   *int     `json:"daily_token_limit"`
+	AllowedModels     []string `json:"allowed_models"` // 为nil时不修改，空数组表示取消限制
+	Disabled          *bool    `json:"disabled"`
+}
+
+// VirtualKeyUsage 虚拟密钥某一天的用量
+type VirtualKeyUsage struct {
+	Date     string  `json:"date"`
+	Requests int     `json:"requests"`
+	Tokens   int     `json:"tokens"`
+	Cost     float64 `json:"cost"`
+}
+
+var (
+	// virtualKeys 按标识索引的虚拟密钥
+	virtualKeys = make(map[string]*VirtualKey)
+	// virtualKeysByHash 按密钥SHA-256索引的虚拟密钥
+	virtualKeysByHash = make(map[string]*VirtualKey)
+	// virtualKeysMutex 保护以上两个map
+	virtualKeysMutex sync.RWMutex
+)
+
+// GetVirtualKeysConfig 获取虚拟密钥配置
+func GetVirtualKeysConfig() VirtualKeysConfig {
+	cfg := GetConfig()
+	if cfg == nil {
+		return VirtualKeysConfig{}
+	}
+	return cfg.ApiProxy.VirtualKeys
+}
+
+// hashVirtualKey 计算虚拟密钥的SHA-256
+func hashVirtualKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsVirtualKeyID 判断字符串是否为虚拟密钥标识
+func IsVirtualKeyID(s string) bool {
+	return strings.HasPrefix(s, virtualKeyIDPrefix)
+}
+
+// copyVirtualKey 复制虚拟密钥，避免调用方修改内存中的数据
+func copyVirtualKey(vk *VirtualKey) VirtualKey {
+	result := *vk
+	result.AllowedModels = append([]string{}, vk.AllowedModels...)
+	return result
+}
+
+// AllowsModel 判断虚拟密钥是否允许使用指定模型，模型别名按解析后的名称匹配
+func (vk VirtualKey) AllowsModel(model string) bool {
+	if len(vk.AllowedModels) == 0 || model == "" {
+		return true
+	}
+	resolved := ResolveModelAlias(model)
+	for _, allowed := range vk.AllowedModels {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(model, prefix) || strings.HasPrefix(resolved, prefix) {
+				return true
+			}
+		} else if allowed == model || allowed == resolved {
+			return true
+		}
+	}
+	return false
+}
+
+// applyVirtualKeySpec 将设置应用到虚拟密钥，设置无效时返回错误且不修改
+func applyVirtualKeySpec(vk *VirtualKey, spec VirtualKeySpec) error {
+	for _, limit := range []*int{spec.RateLimitRPM, spec.DailyRequestLimit, spec.DailyTokenLimit} {
+		if limit != nil && *limit < 0 {
+			return fmt.Errorf("%w: 限制不能为负数", ErrVirtualKeyInvalid)
+		}
+	}
+	if spec.Name != nil {
+		vk.Name = strings.TrimSpace(*spec.Name)
+	}
+	if spec.RateLimitRPM != nil {
+		vk.RateLimitRPM = *spec.RateLimitRPM
+	}
+	if spec.DailyRequestLimit != nil {
+		vk.DailyRequestLimit = *spec.DailyRequestLimit
+	}
+	if spec.DailyTokenLimit != nil {
+		vk.DailyTokenLimit = *spec.DailyTokenLimit
+	}
+	if spec.AllowedModels != nil {
+		models := make([]string, 0, len(spec.AllowedModels))
+		for _, m := range spec.AllowedModels {
+			if m = strings.TrimSpace(m); m != "" {
+				models = append(models, m)
+			}
+		}
+		vk.AllowedModels = models
+	}
+	if spec.Disabled != nil {
+		vk.Disabled = *spec.Disabled
+	}
+	return nil
+}
+
+// ensureVirtualKeysTable 确保虚拟密钥表已创建
+func ensureVirtualKeysTable() error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + virtualKeysTableName + ` (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL DEFAULT '',
+		key_hash TEXT UNIQUE NOT NULL,
+		prefix TEXT NOT NULL DEFAULT '',
+		rate_limit_rpm INTEGER NOT NULL DEFAULT 0,
+		daily_request_limit INTEGER NOT NULL DEFAULT 0,
+		daily_token_limit INTEGER NOT NULL DEFAULT 0,
+		allowed_models TEXT NOT NULL DEFAULT '[]',
+		disabled BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at INTEGER NOT NULL DEFAULT 0
+	)`)
+	return err
+}
+
+// LoadVirtualKeysFromDB 从当前配置数据库加载虚拟密钥，表不存在时创建
+func LoadVirtualKeysFromDB() error {
+	if err := ensureVirtualKeysTable(); err != nil {
+		return fmt.Errorf("创建虚拟密钥表失败: %w", err)
+	}
+
+	rows, err := db.Query(`SELECT id, name, key_hash, prefix, rate_limit_rpm, daily_request_limit,
+		daily_token_limit, allowed_models, disabled, created_at FROM ` + virtualKeysTableName)
+	if err != nil {
+		return fmt.Errorf("查询虚拟密钥失败: %w", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[string]*VirtualKey)
+	byHash := make(map[string]*VirtualKey)
+	for rows.Next() {
+		vk := &VirtualKey{}
+		var models string
+		if err := rows.Scan(&vk.ID, &vk.Name, &vk.hash, &vk.Prefix, &vk.RateLimitRPM, &vk.DailyRequestLimit,
+			&vk.DailyTokenLimit, &models, &vk.Disabled, &vk.CreatedAt); err != nil {
+			logger.Error("扫描虚拟密钥数据失败: %v", err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(models), &vk.AllowedModels); err != nil {
+			logger.Warn("虚拟密钥 %s 的模型白名单无效，已忽略: %v", vk.ID, err)
+		}
+		byID[vk.ID] = vk
+		byHash[vk.hash] = vk
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("处理虚拟密钥数据时发生错误: %w", err)
+	}
+
+	virtualKeysMutex.Lock()
+	virtualKeys = byID
+	virtualKeysByHash = byHash
+	virtualKeysMutex.Unlock()
+
+	if len(byID) > 0 {
+		logger.Info("已从数据库加载 %d 个虚拟密钥", len(byID))
+	}
+	return nil
+}
+
+// saveVirtualKeyToDB 插入或更新一个虚拟密钥
+func saveVirtualKeyToDB(vk *VirtualKey) error {
+	if err := ensureVirtualKeysTable(); err != nil {
+		return err
+	}
+	models, err := json.Marshal(vk.AllowedModels)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT OR REPLACE INTO `+virtualKeysTableName+`
+		(id, name, key_hash, prefix, rate_limit_rpm, daily_request_limit, daily_token_limit, allowed_models, disabled, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		vk.ID, vk.Name, vk.hash, vk.Prefix, vk.RateLimitRPM, vk.DailyRequestLimit,
+		vk.DailyTokenLimit, string(models), vk.Disabled, vk.CreatedAt)
+	return err
+}
+
+// CreateVirtualKey 创建虚拟密钥并保存，返回虚拟密钥信息和原始密钥，原始密钥不会再次返回
+func CreateVirtualKey(spec VirtualKeySpec) (VirtualKey, string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return VirtualKey{}, "", fmt.Errorf("生成虚拟密钥失败: %w", err)
+	}
+	secret := virtualKeySecretPrefix + hex.EncodeToString(buf)
+	hash := hashVirtualKey(secret)
+
+	vk := &VirtualKey{
+		ID:            virtualKeyIDPrefix + hash[:16],
+		Prefix:        secret[:virtualKeyDisplayLen],
+		AllowedModels: []string{},
+		CreatedAt:     time.Now().Unix(),
+		hash:          hash,
+	}
+	if err := applyVirtualKeySpec(vk, spec); err != nil {
+		return VirtualKey{}, "", err
+	}
+	if err := saveVirtualKeyToDB(vk); err != nil {
+		return VirtualKey{}, "", fmt.Errorf("保存虚拟密钥失败: %w", err)
+	}
+
+	virtualKeysMutex.Lock()
+	virtualKeys[vk.ID] = vk
+	virtualKeysByHash[hash] = vk
+	result := copyVirtualKey(vk)
+	virtualKeysMutex.Unlock()
+
+	logger.Info("已创建虚拟密钥 %s（%s）", vk.ID, vk.Name)
+	return result, secret, nil
+}
+
+// UpdateVirtualKey 修改虚拟密钥的设置并保存
+func UpdateVirtualKey(id string, spec VirtualKeySpec) (VirtualKey, error) {
+	virtualKeysMutex.Lock()
+	defer virtualKeysMutex.Unlock()
+
+	vk, ok := virtualKeys[id]
+	if !ok {
+		return VirtualKey{}, ErrVirtualKeyNotFound
+	}
+	updated := copyVirtualKey(vk)
+	updated.hash = vk.hash
+	if err := applyVirtualKeySpec(&updated, spec); err != nil {
+		return VirtualKey{}, err
+	}
+	if err := saveVirtualKeyToDB(&updated); err != nil {
+		return VirtualKey{}, fmt.Errorf("保存虚拟密钥失败: %w", err)
+	}
+	*vk = updated
+	return copyVirtualKey(vk), nil
+}
+
+// DeleteVirtualKey 删除虚拟密钥，已记录的用量统计保留
+func DeleteVirtualKey(id string) error {
+	virtualKeysMutex.Lock()
+	defer virtualKeysMutex.Unlock()
+
+	vk, ok := virtualKeys[id]
+	if !ok {
+		return ErrVirtualKeyNotFound
+	}
+	if db != nil {
+		if _, err := db.Exec(`DELETE FROM `+virtualKeysTableName+` WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("删除虚拟密钥失败: %w", err)
+		}
+	}
+	delete(virtualKeys, id)
+	delete(virtualKeysByHash, vk.hash)
+	logger.Info("已删除虚拟密钥 %s（%s）", vk.ID, vk.Name)
+	return nil
+}
+
+// GetVirtualKey 按标识获取虚拟密钥
+func GetVirtualKey(id string) (VirtualKey, bool) {
+	virtualKeysMutex.RLock()
+	defer virtualKeysMutex.RUnlock()
+	vk, ok := virtualKeys[id]
+	if !ok {
+		return VirtualKey{}, false
+	}
+	return copyVirtualKey(vk), true
+}
+
+// LookupVirtualKey 按原始密钥查找虚拟密钥
+func LookupVirtualKey(secret string) (VirtualKey, bool) {
+	if secret == "" {
+		return VirtualKey{}, false
+	}
+	hash := hashVirtualKey(secret)
+	virtualKeysMutex.RLock()
+	defer virtualKeysMutex.RUnlock()
+	vk, ok := virtualKeysByHash[hash]
+	if !ok {
+		return VirtualKey{}, false
+	}
+	return copyVirtualKey(vk), true
+}
+
+// ListVirtualKeys 获取所有虚拟密钥，按创建时间排序
+func ListVirtualKeys() []VirtualKey {
+	virtualKeysMutex.RLock()
+	result := make([]VirtualKey, 0, len(virtualKeys))
+	for _, vk := range virtualKeys {
+		result = append(result, copyVirtualKey(vk))
+	}
+	virtualKeysMutex.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreatedAt != result[j].CreatedAt {
+			return result[i].CreatedAt < result[j].CreatedAt
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// addVirtualKeyUsageLocked 累加虚拟密钥当天的用量（已加锁）
+func addVirtualKeyUsageLocked(id, date string, requests, tokens int, cost float64) {
+	if dailyData.VirtualKeysUsage == nil {
+		dailyData.VirtualKeysUsage = make(map[string]map[string]KeyUsage)
+	}
+	if dailyData.VirtualKeysUsage[id] == nil {
+		dailyData.VirtualKeysUsage[id] = make(map[string]KeyUsage)
+	}
+	usage := dailyData.VirtualKeysUsage[id][date]
+	usage.Requests += requests
+	usage.Tokens += tokens
+	usage.Cost += cost
+	dailyData.VirtualKeysUsage[id][date] = usage
+}
+
+// GetVirtualKeyTodayUsage 获取虚拟密钥今天的用量
+func GetVirtualKeyTodayUsage(id string) VirtualKeyUsage {
+	today := time.Now().Format("2006-01-02")
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+	if dailyData == nil {
+		return VirtualKeyUsage{Date: today}
+	}
+	usage := dailyData.VirtualKeysUsage[id][today]
+	return VirtualKeyUsage{Date: today, Requests: usage.Requests, Tokens: usage.Tokens, Cost: usage.Cost}
+}
+
+// GetVirtualKeyUsage 获取虚拟密钥最近days天（含今天）每天的用量，按日期升序，没有数据的日期为0
+func GetVirtualKeyUsage(id string, days int) ([]VirtualKeyUsage, error) {
+	if days <= 0 {
+		days = statsRetentionDays()
+	}
+
+	dailyDataLock.RLock()
+	if dailyData == nil {
+		dailyDataLock.RUnlock()
+		return []VirtualKeyUsage{}, ErrStatsNotInitialized
+	}
+	byDate := make(map[string]KeyUsage, len(dailyData.VirtualKeysUsage[id]))
+	for date, usage := range dailyData.VirtualKeysUsage[id] {
+		byDate[date] = usage
+	}
+	dailyDataLock.RUnlock()
+
+	now := time.Now()
+	result := make([]VirtualKeyUsage, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		date := now.AddDate(0, 0, -i).Format("2006-01-02")
+		usage := byDate[date]
+		result = append(result, VirtualKeyUsage{Date: date, Requests: usage.Requests, Tokens: usage.Tokens, Cost: usage.Cost})
+	}
+	return result, nil
+}
+
+// CheckVirtualKeyQuota 检查虚拟密钥今天的请求数和令牌数是否已达到每日配额，未达到时返回nil
+// 达到配额时返回的错误包装ErrVirtualKeyQuotaExceeded，配额在VirtualKeyQuotaResetAt时重置
+func CheckVirtualKeyQuota(vk VirtualKey) error {
+	if vk.DailyRequestLimit <= 0 && vk.DailyTokenLimit <= 0 {
+		return nil
+	}
+	usage := GetVirtualKeyTodayUsage(vk.ID)
+	if vk.DailyRequestLimit > 0 && usage.Requests >= vk.DailyRequestLimit {
+		return fmt.Errorf("%w: 今日请求数已达到上限 %d", ErrVirtualKeyQuotaExceeded, vk.DailyRequestLimit)
+	}
+	if vk.DailyTokenLimit > 0 && usage.Tokens >= vk.DailyTokenLimit {
+		return fmt.Errorf("%w: 今日令牌数已达到上限 %d", ErrVirtualKeyQuotaExceeded, vk.DailyTokenLimit)
+	}
+	return nil
+}
+
+// VirtualKeyQuotaResetAt 获取每日配额的重置时间，即now之后的本地零点，与按日期统计用量一致
+func VirtualKeyQuotaResetAt(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+}
@@ -0,0 +1,62 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 20:50:00
+  @desc: 密钥余额查询的stale-while-revalidate缓存，管理界面先显示上次的余额再后台刷新
+**/
+
+package key
+
+import (
+	"strconv"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+// balanceCacheTTL 余额缓存的新鲜期，超过后下次读取时在后台刷新
+const balanceCacheTTL = 5 * time.Minute
+
+// balanceCache 按稳定密钥标识缓存的余额，不保存原始密钥
+var balanceCache = config.NewSWRCache("balance", balanceCacheTTL)
+
+// GetKeyBalanceCached 获取密钥余额和缓存时长，force为true时跳过缓存直接查询上游
+// 后台刷新成功后同时更新密钥记录中的余额
+func GetKeyBalanceCached(apiKey string, force bool) (float64, time.Duration, error) {
+	data, age, err := balanceCache.Get(config.KeyID(apiKey), force, func() ([]byte, error) {
+		balance, err := queryKeyBalance(apiKey)
+		if err != nil {
+			return nil, err
+		}
+		config.UpdateApiKeyBalance(apiKey, balance)
+		return []byte(strconv.FormatFloat(balance, 'f', -1, 64)), nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	balance, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return balance, age, nil
+}
+
+// RefreshAllKeysBalanceCached 读取所有密钥的缓存余额，过期的在后台刷新，不等待上游
+// 返回最旧的缓存时长和从未成功查询过余额的密钥数
+func RefreshAllKeysBalanceCached() (time.Duration, int) {
+	var oldest time.Duration
+	failed := 0
+	for _, k := range config.GetApiKeys() {
+		_, age, err := GetKeyBalanceCached(k.Key, false)
+		if err != nil {
+			failed++
+			logger.Error("查询API密钥 %s 余额失败: %v", MaskKey(k.Key), err)
+			continue
+		}
+		if age > oldest {
+			oldest = age
+		}
+	}
+	return oldest, failed
+}
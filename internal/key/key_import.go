@@ -0,0 +1,177 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 00:55:00
+  @desc: 从每行一个密钥的文本批量导入API密钥，支持去重和只校验不保存的演练模式
+**/
+
+package key
+
+import (
+	"bufio"
+	"strings"
+	"sync"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+// importCheckWorkers 导入时同时向上游查询余额的密钥数
+const importCheckWorkers = 8
+
+// 导入结果中单个密钥的状态
+const (
+	ImportStatusAdded          = "added"           // 已添加
+	ImportStatusValid          = "valid"           // 演练模式下校验通过，未保存
+	ImportStatusExists         = "exists"          // 密钥已在密钥池中
+	ImportStatusDuplicateInput = "duplicate_input" // 与导入内容中前面的密钥重复
+	ImportStatusInvalid        = "invalid"         // 上游校验失败或余额不大于0
+)
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	DryRun  bool    // 只校验不保存
+	Balance float64 // 大于0时作为所有密钥的余额且不向上游校验，演练模式下忽略
+}
+
+// ImportItem 单个密钥的导入结果
+type ImportItem struct {
+	Line      int     `json:"line"` // 在导入内容中的行号，从1开始
+	KeyID     string  `json:"key_id"`
+	MaskedKey string  `json:"masked_key"`
+	Status    string  `json:"status"`
+	Balance   float64 `json:"balance,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	DryRun     bool         `json:"dry_run"`
+	Total      int          `json:"total"`      // 导入内容中的密钥数，不含空行和注释
+	Added      int          `json:"added"`      // 已添加的密钥数
+	Valid      int          `json:"valid"`      // 演练模式下校验通过的密钥数
+	Duplicates int          `json:"duplicates"` // 已存在或在导入内容中重复的密钥数
+	Invalid    int          `json:"invalid"`    // 校验失败的密钥数
+	Items      []ImportItem `json:"items"`
+}
+
+// ParseKeyList 解析每行一个密钥的文本，忽略空行和#开头的注释行，返回密钥及其行号
+func ParseKeyList(text string) (keys []string, lines []int) {
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+		lines = append(lines, lineNo)
+	}
+	return keys, lines
+}
+
+// ImportKeys 批量导入密钥：跳过已存在和重复的密钥，其余密钥向上游查询余额校验，
+// 余额大于0的密钥在非演练模式下添加到密钥池并保存
+func ImportKeys(text string, opts ImportOptions) ImportResult {
+	keys, lines := ParseKeyList(text)
+	result := ImportResult{
+		DryRun: opts.DryRun,
+		Total:  len(keys),
+		Items:  make([]ImportItem, len(keys)),
+	}
+
+	existing := make(map[string]bool)
+	for _, k := range config.GetApiKeys() {
+		existing[k.Key] = true
+	}
+	seen := make(map[string]bool, len(keys))
+	var toCheck []int
+	for i, apiKey := range keys {
+		result.Items[i] = ImportItem{
+			Line:      lines[i],
+			KeyID:     config.KeyID(apiKey),
+			MaskedKey: config.MaskKeyWithPolicy(apiKey, true),
+		}
+		switch {
+		case seen[apiKey]:
+			result.Items[i].Status = ImportStatusDuplicateInput
+		case existing[apiKey]:
+			result.Items[i].Status = ImportStatusExists
+		default:
+			toCheck = append(toCheck, i)
+		}
+		seen[apiKey] = true
+	}
+
+	// 指定余额时直接使用，否则并发向上游查询余额
+	if opts.Balance > 0 && !opts.DryRun {
+		for _, i := range toCheck {
+			result.Items[i].Balance = opts.Balance
+		}
+	} else {
+		var wg sync.WaitGroup
+		jobs := make(chan int)
+		for w := 0; w < importCheckWorkers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					balance, err := CheckKeyBalance(keys[i])
+					if err != nil {
+						result.Items[i].Status = ImportStatusInvalid
+						result.Items[i].Error = err.Error()
+						continue
+					}
+					result.Items[i].Balance = balance
+				}
+			}()
+		}
+		for _, i := range toCheck {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+	}
+
+	added := false
+	for _, i := range toCheck {
+		item := &result.Items[i]
+		if item.Status == "" && item.Balance <= 0 {
+			item.Status = ImportStatusInvalid
+			item.Error = "余额小于或等于0"
+		}
+		if item.Status != "" {
+			continue
+		}
+		if opts.DryRun {
+			item.Status = ImportStatusValid
+			continue
+		}
+		config.AddApiKey(keys[i], item.Balance)
+		item.Status = ImportStatusAdded
+		added = true
+	}
+
+	for _, item := range result.Items {
+		switch item.Status {
+		case ImportStatusAdded:
+			result.Added++
+		case ImportStatusValid:
+			result.Valid++
+		case ImportStatusExists, ImportStatusDuplicateInput:
+			result.Duplicates++
+		case ImportStatusInvalid:
+			result.Invalid++
+		}
+	}
+
+	if added {
+		config.SortApiKeysByBalance()
+		if err := config.SaveApiKeys(); err != nil {
+			logger.Error("保存导入的API密钥失败: %v", err)
+		}
+		InvalidatePoolState()
+	}
+	logger.Info("导入API密钥：共%d个，添加%d个，校验通过%d个，重复%d个，无效%d个（演练: %v）",
+		result.Total, result.Added, result.Valid, result.Duplicates, result.Invalid, opts.DryRun)
+	return result
+}
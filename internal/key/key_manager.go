@@ -36,6 +36,9 @@ const (
 	// 新增常量
 	MaxConsecutiveFailures = 5  // 最大连续失败次数，超过此值将禁用密钥
 	RecoveryInterval       = 10 // 恢复检查间隔（分钟）
+
+	// keyExpirySpec 检查密钥到期的定时任务
+	keyExpirySpec = "@every 10m"
 )
 
 var (
@@ -96,10 +99,30 @@ func StartKeyManager() {
 	refreshUsedKeysSpec := fmt.Sprintf("@every %dm", refreshUsedKeysInterval)
 	cronScheduler.AddFunc(refreshUsedKeysSpec, RefreshUsedKeysBalance)
 
+	// 添加定时任务，定时获取各密钥可用的模型列表
+	cronScheduler.AddFunc(keyModelsDiscoverySpec, discoverAllKeyModels)
+	go discoverAllKeyModels()
+
+	// 添加定时任务，将已到期的密钥转为过期状态
+	cronScheduler.AddFunc(keyExpirySpec, markExpiredKeys)
+	markExpiredKeys()
+
+	// 添加定时任务，定时向上游校验密钥并禁用已失效的密钥
+	validationSpec := fmt.Sprintf("@every %dm", config.GetKeyValidationConfig().IntervalMinutes)
+	cronScheduler.AddFunc(validationSpec, scheduledKeyValidation)
+
 	// 启动定时任务
 	cronScheduler.Start()
 }
 
+// markExpiredKeys 检查密钥到期时间，到期的密钥转为过期状态
+func markExpiredKeys() {
+	if count := config.MarkExpiredApiKeys(); count > 0 {
+		logger.Info("本次有 %d 个API密钥到期", count)
+		InvalidatePoolState()
+	}
+}
+
 // StopKeyManager 停止API密钥管理器
 func StopKeyManager() {
 	if cronScheduler != nil {
@@ -148,6 +171,7 @@ func checkAllKeysBalance() {
 			if balance < config.GetConfig().App.MinBalanceThreshold && !key.Disabled {
 				logger.Info("API密钥 %s 余额 %.2f 低于阈值 %.2f，禁用该密钥",
 					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
+				config.UpdateApiKeyBalance(key.Key, balance)
 				config.DisableApiKey(key.Key)
 				return
 			}
@@ -182,9 +206,19 @@ func checkAllKeysBalance() {
 	logger.Info("API密钥余额检查完成")
 }
 
-// CheckKeyBalance 检查 API 密钥余额
-// TODO 等待优化
+// CheckKeyBalance 检查 API 密钥余额，查询成功时同时更新余额缓存
 func CheckKeyBalance(key string) (float64, error) {
+	balance, err := queryKeyBalance(key)
+	if err != nil {
+		return 0, err
+	}
+	balanceCache.Set(config.KeyID(key), []byte(strconv.FormatFloat(balance, 'f', -1, 64)))
+	return balance, nil
+}
+
+// queryKeyBalance 向上游查询 API 密钥余额
+// TODO 等待优化
+func queryKeyBalance(key string) (float64, error) {
 
 	// 使用硅基流动 API 的用户信息接口
 	userInfoURL := "https://api.siliconflow.cn/v1/user/info"
@@ -383,10 +417,7 @@ func ResetCurrentKeyIndex() {
 
 // MaskKey 掩盖 API 密钥（用于日志）
 func MaskKey(key string) string {
-	if len(key) <= 6 {
-		return "******"
-	}
-	return key[:6] + "******"
+	return config.MaskKeyWithPolicy(key, false)
 }
 
 // CheckKeyBalanceManually 手动检查API密钥的余额
@@ -412,6 +443,11 @@ func tryRecoverDisabledKeys() {
 		go func(key config.ApiKey) {
 			defer wg.Done()
 
+			// 因用量异常禁用的密钥需要手动启用
+			if config.IsKeyAnomalyProtected(key.Key) {
+				return
+			}
+
 			// 检查是否已经过了足够的时间
 			now := time.Now().Unix()
 			if now-key.DisabledAt < int64(config.GetConfig().App.RecoveryInterval*60) {
@@ -456,6 +492,7 @@ func tryRecoverDisabledKeys() {
 			// 更新密钥余额并启用
 			config.UpdateApiKeyBalance(key.Key, balance)
 			config.EnableApiKey(key.Key)
+			InvalidatePoolState()
 		}(disabledKeys[i])
 	}
 
@@ -485,6 +522,7 @@ func UpdateApiKeyStatus(key string, success bool) {
 				if k.ConsecutiveFailures >= config.GetConfig().App.MaxConsecutiveFailures {
 					// 禁用密钥
 					config.DisableApiKey(key)
+					InvalidatePoolState()
 				}
 				break
 			}
@@ -561,6 +599,7 @@ func ForceRefreshAllKeysBalance() error {
 			if balance < config.GetConfig().App.MinBalanceThreshold && !key.Disabled {
 				logger.Info("强制刷新: API密钥 %s 余额 %.2f 低于阈值 %.2f，禁用该密钥",
 					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
+				config.UpdateApiKeyBalance(key.Key, balance)
 				config.DisableApiKey(key.Key)
 				return
 			}
@@ -686,6 +725,7 @@ func RefreshUsedKeysBalance() {
 			if balance < config.GetConfig().App.MinBalanceThreshold && !key.Disabled {
 				logger.Info("刷新已使用密钥: API密钥 %s 余额 %.2f 低于阈值 %.2f，禁用该密钥",
 					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
+				config.UpdateApiKeyBalance(key.Key, balance)
 				config.DisableApiKey(key.Key)
 				return
 			}
@@ -0,0 +1,251 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/6 19:05:00
+  @desc: 按密钥发现可用模型，选择密钥时跳过不支持请求模型的密钥
+**/
+
+package key
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+)
+
+const (
+	// keyModelsTTL 模型列表的缓存有效期，超过后定时任务会重新获取
+	keyModelsTTL = 6 * time.Hour
+	// keyModelsStaleAfter 超过该时间未刷新的模型列表视为未知，不再用于过滤密钥
+	keyModelsStaleAfter = 2 * keyModelsTTL
+	// keyModelsMinInterval 同一密钥两次获取模型列表的最小间隔
+	keyModelsMinInterval = 5 * time.Minute
+	// keyModelsStagger 批量获取时每个密钥之间的间隔，避免集中请求
+	keyModelsStagger = 2 * time.Second
+	// keyModelsDiscoverySpec 定时发现任务的执行间隔
+	keyModelsDiscoverySpec = "@every 1h"
+)
+
+// KeyModels 单个密钥的可用模型信息
+type KeyModels struct {
+	Models    []string `json:"models"`               // 当前可用的模型
+	Added     []string `json:"added"`                // 相比上次新出现的模型
+	Removed   []string `json:"removed"`              // 相比上次消失的模型
+	FetchedAt int64    `json:"fetched_at"`           // 最近一次成功获取的时间
+	LastError string   `json:"last_error,omitempty"` // 最近一次获取失败的原因
+
+	modelSet    map[string]bool
+	lastAttempt time.Time
+}
+
+// ErrKeyModelsTooFrequent 同一密钥获取模型列表过于频繁
+var ErrKeyModelsTooFrequent = errors.New("获取模型列表过于频繁")
+
+var (
+	keyModels      = make(map[string]*KeyModels)
+	keyModelsMutex sync.RWMutex
+
+	// 批量发现任务是否正在执行
+	keyModelsDiscovering atomic.Bool
+)
+
+// KeyServesModel 判断密钥是否支持指定模型
+// 尚未获取到模型列表或列表已过期的密钥视为未知，按支持处理
+func KeyServesModel(apiKey, modelName string) bool {
+	if modelName == "" {
+		return true
+	}
+
+	keyModelsMutex.RLock()
+	defer keyModelsMutex.RUnlock()
+
+	info, ok := keyModels[apiKey]
+	if !ok || info.modelSet == nil {
+		return true
+	}
+	if time.Since(time.Unix(info.FetchedAt, 0)) > keyModelsStaleAfter {
+		return true
+	}
+	return info.modelSet[modelName]
+}
+
+// GetKeyModels 获取密钥的可用模型信息，found为false表示尚未获取过
+func GetKeyModels(apiKey string) (KeyModels, bool) {
+	keyModelsMutex.RLock()
+	defer keyModelsMutex.RUnlock()
+
+	info, ok := keyModels[apiKey]
+	if !ok {
+		return KeyModels{Models: []string{}, Added: []string{}, Removed: []string{}}, false
+	}
+	return copyKeyModels(info), info.modelSet != nil
+}
+
+// DiscoverKeyModels 立即获取指定密钥的可用模型
+// 同一密钥在keyModelsMinInterval内只会请求一次，期间返回缓存结果和错误
+func DiscoverKeyModels(apiKey string) (KeyModels, error) {
+	keyModelsMutex.Lock()
+	info, ok := keyModels[apiKey]
+	if !ok {
+		info = &KeyModels{}
+		keyModels[apiKey] = info
+	}
+	if wait := keyModelsMinInterval - time.Since(info.lastAttempt); wait > 0 {
+		result := copyKeyModels(info)
+		keyModelsMutex.Unlock()
+		return result, fmt.Errorf("%w，请在%d秒后重试", ErrKeyModelsTooFrequent, int(wait.Seconds())+1)
+	}
+	info.lastAttempt = time.Now()
+	keyModelsMutex.Unlock()
+
+	models, err := fetchKeyModels(apiKey)
+
+	keyModelsMutex.Lock()
+	defer keyModelsMutex.Unlock()
+
+	if err != nil {
+		info.LastError = err.Error()
+		logger.Warn("获取密钥 %s 的模型列表失败: %v", utils.MaskKey(apiKey), err)
+		return copyKeyModels(info), err
+	}
+
+	newSet := make(map[string]bool, len(models))
+	for _, m := range models {
+		newSet[m] = true
+	}
+
+	// 与上次结果对比，首次获取不标记变化
+	info.Added = []string{}
+	info.Removed = []string{}
+	if info.modelSet != nil {
+		for m := range newSet {
+			if !info.modelSet[m] {
+				info.Added = append(info.Added, m)
+			}
+		}
+		for m := range info.modelSet {
+			if !newSet[m] {
+				info.Removed = append(info.Removed, m)
+			}
+		}
+		sort.Strings(info.Added)
+		sort.Strings(info.Removed)
+		if len(info.Added) > 0 || len(info.Removed) > 0 {
+			logger.Info("密钥 %s 的可用模型发生变化: 新增%d个, 移除%d个",
+				utils.MaskKey(apiKey), len(info.Added), len(info.Removed))
+		}
+	}
+
+	sort.Strings(models)
+	info.Models = models
+	info.modelSet = newSet
+	info.FetchedAt = time.Now().Unix()
+	info.LastError = ""
+
+	return copyKeyModels(info), nil
+}
+
+// discoverAllKeyModels 依次获取所有密钥的可用模型，跳过缓存未过期的密钥
+func discoverAllKeyModels() {
+	if !keyModelsDiscovering.CompareAndSwap(false, true) {
+		return
+	}
+	defer keyModelsDiscovering.Store(false)
+
+	keys := config.GetApiKeys()
+	discovered := 0
+	for _, k := range keys {
+		keyModelsMutex.RLock()
+		info, ok := keyModels[k.Key]
+		fresh := ok && info.modelSet != nil && time.Since(time.Unix(info.FetchedAt, 0)) < keyModelsTTL
+		keyModelsMutex.RUnlock()
+		if fresh {
+			continue
+		}
+
+		// 错开请求时间
+		if discovered > 0 {
+			time.Sleep(keyModelsStagger)
+		}
+		discovered++
+
+		DiscoverKeyModels(k.Key)
+	}
+
+	if discovered > 0 {
+		logger.Info("已更新 %d 个密钥的可用模型列表", discovered)
+	}
+}
+
+// fetchKeyModels 使用指定密钥请求/v1/models
+func fetchKeyModels(apiKey string) ([]string, error) {
+	cfg := config.GetConfig()
+	if cfg == nil || cfg.ApiProxy.BaseURL == "" {
+		return nil, errors.New("未配置API基础URL")
+	}
+	url := strings.TrimRight(cfg.ApiProxy.BaseURL, "/") + "/v1/models"
+
+	resp, err := client.R().
+		SetHeader("Authorization", fmt.Sprintf("Bearer %s", apiKey)).
+		SetHeader("Accept-Encoding", "identity").
+		Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("API 返回状态码 %d", resp.StatusCode())
+	}
+
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+
+	models := make([]string, 0, len(result.Data))
+	for _, item := range result.Data {
+		if item.ID != "" {
+			models = append(models, item.ID)
+		}
+	}
+	return models, nil
+}
+
+// copyKeyModels 复制模型信息，避免调用方修改缓存
+func copyKeyModels(info *KeyModels) KeyModels {
+	return KeyModels{
+		Models:    append([]string{}, info.Models...),
+		Added:     append([]string{}, info.Added...),
+		Removed:   append([]string{}, info.Removed...),
+		FetchedAt: info.FetchedAt,
+		LastError: info.LastError,
+	}
+}
+
+// getRoundRobinKeyForModel 从支持指定模型的可用密钥中轮询选择
+func getRoundRobinKeyForModel(modelName string) (string, bool) {
+	var candidates []config.ApiKey
+	for _, k := range config.GetActiveApiKeys() {
+		if KeyServesModel(k.Key, modelName) {
+			candidates = append(candidates, k)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	selectedKey := selectKeyByRoundRobin(candidates, "model:"+modelName)
+	config.UpdateApiKeyLastUsed(selectedKey, time.Now().Unix())
+	return selectedKey, true
+}
@@ -0,0 +1,101 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/3 11:20:00
+  @desc: 密钥池状态缓存，供请求路径快速读取可用密钥数和冷却信息
+**/
+
+package key
+
+import (
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+// poolStateTTL 密钥池状态缓存有效期
+const poolStateTTL = 2 * time.Second
+
+// PoolState 密钥池状态快照
+type PoolState struct {
+	AvailableKeys  int       // 可用密钥数
+	DisabledKeys   int       // 已禁用或限流冷却中的密钥数
+	NextRecoveryAt int64     // 最近一个禁用密钥可参与恢复检查的时间（Unix秒），0表示没有
+	UpdatedAt      time.Time // 快照时间
+}
+
+var (
+	poolState      PoolState
+	poolStateMutex sync.RWMutex
+)
+
+// GetPoolState 获取密钥池状态，缓存过期时才重新统计
+func GetPoolState() PoolState {
+	poolStateMutex.RLock()
+	state := poolState
+	poolStateMutex.RUnlock()
+
+	if !state.UpdatedAt.IsZero() && time.Since(state.UpdatedAt) < poolStateTTL {
+		return state
+	}
+
+	return refreshPoolState()
+}
+
+// InvalidatePoolState 使密钥池状态缓存失效，在密钥状态变化后调用
+func InvalidatePoolState() {
+	poolStateMutex.Lock()
+	poolState.UpdatedAt = time.Time{}
+	poolStateMutex.Unlock()
+}
+
+// refreshPoolState 重新统计密钥池状态并更新缓存
+func refreshPoolState() PoolState {
+	cfg := config.GetConfig()
+	recoveryInterval := int64(RecoveryInterval)
+	if cfg != nil && cfg.App.RecoveryInterval > 0 {
+		recoveryInterval = int64(cfg.App.RecoveryInterval)
+	}
+
+	state := PoolState{
+		AvailableKeys: len(config.GetActiveApiKeys()),
+		UpdatedAt:     time.Now(),
+	}
+	for _, k := range config.GetDisabledApiKeys() {
+		state.DisabledKeys++
+		recoverAt := k.DisabledAt + recoveryInterval*60
+		if state.NextRecoveryAt == 0 || recoverAt < state.NextRecoveryAt {
+			state.NextRecoveryAt = recoverAt
+		}
+	}
+	coolingKeys, earliest := config.NextKeyCooldownExpiry()
+	state.DisabledKeys += coolingKeys
+	if coolingKeys > 0 && (state.NextRecoveryAt == 0 || earliest.Unix() < state.NextRecoveryAt) {
+		state.NextRecoveryAt = earliest.Unix()
+	}
+	openKeys, halfOpenAt := config.NextKeyBreakerHalfOpen()
+	state.DisabledKeys += openKeys
+	if openKeys > 0 && (state.NextRecoveryAt == 0 || halfOpenAt.Unix() < state.NextRecoveryAt) {
+		state.NextRecoveryAt = halfOpenAt.Unix()
+	}
+
+	poolStateMutex.Lock()
+	poolState = state
+	poolStateMutex.Unlock()
+
+	return state
+}
+
+// RetryAfterSeconds 根据最近的密钥冷却到期时间估算客户端应等待的秒数
+// 没有冷却中的密钥时返回0
+func (s PoolState) RetryAfterSeconds() int {
+	if s.NextRecoveryAt == 0 {
+		return 0
+	}
+	wait := s.NextRecoveryAt - time.Now().Unix()
+	// 冷却已到期但尚未被恢复任务处理，建议短暂等待后重试
+	if wait < 1 {
+		wait = 1
+	}
+	return int(wait)
+}
@@ -333,11 +333,34 @@ func getLowTPMKey() (string, error) {
 }
 
 // GetBestKeyForRequest 根据请求类型选择最佳密钥
+// 选中的密钥已知不支持请求的模型时，改为从支持该模型的密钥中轮询选择
 func GetBestKeyForRequest(requestType string, modelName string, tokenEstimate int) (string, error) {
+	key, err := selectKeyForRequest(requestType, modelName, tokenEstimate)
+	if err != nil || KeyServesModel(key, modelName) {
+		return key, err
+	}
+
+	if fallback, ok := getRoundRobinKeyForModel(modelName); ok {
+		logger.Info("密钥%s不支持模型%s，改用密钥%s", utils.MaskKey(key), modelName, utils.MaskKey(fallback))
+		return fallback, nil
+	}
+
+	// 没有已知支持该模型的密钥时仍使用原选择
+	return key, err
+}
+
+// selectKeyForRequest 按模型策略和请求类型选择密钥
+func selectKeyForRequest(requestType string, modelName string, tokenEstimate int) (string, error) {
 
 	// 添加调试日志
 	logger.Info("GetBestKeyForRequest被调用: 模型=%s, 请求类型=%s, 预估token=%d", modelName, requestType, tokenEstimate)
 
+	// 按模型配置的密钥选择器优先于模型策略
+	modelSelector, globalSelector := configuredKeySelectors(modelName)
+	if key, found, err := selectKeyWithSelector(modelSelector, modelName); found {
+		return key, err
+	}
+
 	// 检查是否有针对该模型的特定策略配置
 	key, found, err := GetModelSpecificKey(modelName)
 	logger.Info("模型特定策略查找结果: 模型=%s, 找到策略=%v", modelName, found)
@@ -347,6 +370,21 @@ func GetBestKeyForRequest(requestType string, modelName string, tokenEstimate in
 		return key, err
 	}
 
+	// 配置了全局密钥选择器时代替内置的选择规则
+	if key, found, err := selectKeyWithSelector(globalSelector, modelName); found {
+		return key, err
+	}
+
+	// 开启临期优先时，优先消耗即将到期的额度
+	if cfg := config.GetConfig(); cfg != nil && cfg.App.PreferExpiringKeys {
+		return getExpiringFirstKey()
+	}
+
+	// 开启加权轮询时，所有请求按密钥权重分配
+	if cfg := config.GetConfig(); cfg != nil && cfg.App.WeightedRoundRobin {
+		return getWeightedRoundRobinKey()
+	}
+
 	// 对于大型请求，选择余额高的密钥
 	if tokenEstimate > 5000 {
 		return getHighestBalanceKey()
@@ -591,6 +629,53 @@ func getLowestBalanceKey() (string, error) {
 	return getLowestBalanceKeyWithRoundRobin()
 }
 
+// getExpiringFirstKey 在同等健康的密钥中优先选择即将到期的密钥，让短期额度先被用完
+// 健康程度以连续失败次数衡量；到期紧迫度按余额除以剩余小时数计算，余额越多、越快到期越优先
+// 没有设置到期时间的健康密钥时回退到普通轮询
+func getExpiringFirstKey() (string, error) {
+	activeKeys := config.GetActiveApiKeys()
+	if len(activeKeys) == 0 {
+		return "", common.ErrNoActiveKeys
+	}
+
+	// 找出最少的连续失败次数，作为最健康的一档
+	minFailures := activeKeys[0].ConsecutiveFailures
+	for _, key := range activeKeys {
+		if key.ConsecutiveFailures < minFailures {
+			minFailures = key.ConsecutiveFailures
+		}
+	}
+
+	now := time.Now().Unix()
+	selectedKey := ""
+	var bestUrgency float64 = -1
+	for _, key := range activeKeys {
+		if key.ConsecutiveFailures != minFailures || key.ExpiresAt <= 0 {
+			continue
+		}
+
+		hoursLeft := float64(key.ExpiresAt-now) / 3600
+		if hoursLeft < 1 {
+			hoursLeft = 1
+		}
+		urgency := key.Balance / hoursLeft
+		if urgency > bestUrgency {
+			bestUrgency = urgency
+			selectedKey = key.Key
+		}
+	}
+
+	if selectedKey == "" {
+		logger.Info("临期优先策略: 没有设置到期时间的健康密钥，回退到普通轮询")
+		return getRoundRobinKey()
+	}
+
+	logger.Info("临期优先策略: 选择密钥=%s, 紧迫度=%.4f", utils.MaskKey(selectedKey), bestUrgency)
+
+	config.UpdateApiKeyLastUsed(selectedKey, now)
+	return selectedKey, nil
+}
+
 // getFreeModelKey 实现免费模型的策略
 // 先轮询is_delete为1的密钥，再轮询disabled为1的密钥，再轮询is_used为0的密钥，最后使用低余额策略
 func getFreeModelKey() (string, error) {
@@ -6,5 +6,212 @@
 
 package key
 
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/common"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+)
+
 // KeySelectionStrategy 定义密钥选择策略类型
 type KeySelectionStrategy int
+
+// 内置密钥选择器名称
+const (
+	SelectorRoundRobin        = "round_robin"         // 轮询所有可用密钥
+	SelectorRandom            = "random"              // 随机选择
+	SelectorLeastUsedToday    = "least_used_today"    // 今日请求数最少，按每日统计
+	SelectorLeastRecentlyUsed = "least_recently_used" // 最久未使用
+	SelectorLowestLatency     = "lowest_latency"      // 最近成功请求耗时最短，没有耗时记录的密钥优先
+	SelectorHighestBalance    = "highest_balance"     // 剩余余额最高，余额相同时最久未使用
+)
+
+// KeySelector 密钥选择器，可通过RegisterKeySelector注册自定义实现
+type KeySelector interface {
+	// Name 选择器名称，用于app.key_selector和app.model_key_selectors配置
+	Name() string
+	// Select 从可用密钥中选择一个，keys至少包含一个密钥
+	Select(modelName string, keys []config.ApiKey) (string, error)
+}
+
+var (
+	// keySelectors 已注册的密钥选择器
+	keySelectors = make(map[string]KeySelector)
+	// keySelectorsMutex 保护keySelectors
+	keySelectorsMutex sync.RWMutex
+)
+
+func init() {
+	RegisterKeySelector(roundRobinSelector{})
+	RegisterKeySelector(randomSelector{})
+	RegisterKeySelector(leastUsedTodaySelector{})
+	RegisterKeySelector(leastRecentlyUsedSelector{})
+	RegisterKeySelector(lowestLatencySelector{})
+	RegisterKeySelector(highestBalanceSelector{})
+}
+
+// RegisterKeySelector 注册密钥选择器，同名的选择器会被替换
+func RegisterKeySelector(selector KeySelector) {
+	keySelectorsMutex.Lock()
+	defer keySelectorsMutex.Unlock()
+	keySelectors[selector.Name()] = selector
+}
+
+// GetKeySelector 按名称获取已注册的密钥选择器
+func GetKeySelector(name string) (KeySelector, bool) {
+	keySelectorsMutex.RLock()
+	defer keySelectorsMutex.RUnlock()
+	selector, ok := keySelectors[name]
+	return selector, ok
+}
+
+// ListKeySelectors 列出已注册的密钥选择器名称
+func ListKeySelectors() []string {
+	keySelectorsMutex.RLock()
+	defer keySelectorsMutex.RUnlock()
+	names := make([]string, 0, len(keySelectors))
+	for name := range keySelectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configuredKeySelectors 获取模型配置的密钥选择器和全局密钥选择器名称，未配置时为空
+func configuredKeySelectors(modelName string) (modelSelector, globalSelector string) {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return "", ""
+	}
+	return cfg.App.ModelKeySelectors[modelName], cfg.App.KeySelector
+}
+
+// selectKeyWithSelector 使用指定名称的密钥选择器选择密钥
+// 名称为空或选择器不存在时found为false，由调用方继续使用内置规则
+func selectKeyWithSelector(name, modelName string) (key string, found bool, err error) {
+	if name == "" {
+		return "", false, nil
+	}
+
+	selector, ok := GetKeySelector(name)
+	if !ok {
+		logger.Warn("未知的密钥选择器: %s，使用内置的选择规则", name)
+		return "", false, nil
+	}
+
+	activeKeys := config.GetActiveApiKeys()
+	if len(activeKeys) == 0 {
+		return "", true, common.ErrNoActiveKeys
+	}
+	key, err = selector.Select(modelName, activeKeys)
+	if err != nil {
+		return "", true, err
+	}
+
+	logger.Info("密钥选择器%s: 模型=%s, 选择密钥=%s", name, modelName, utils.MaskKey(key))
+	config.UpdateApiKeyLastUsed(key, time.Now().Unix())
+	return key, true, nil
+}
+
+// roundRobinSelector 轮询所有可用密钥
+type roundRobinSelector struct{}
+
+func (roundRobinSelector) Name() string { return SelectorRoundRobin }
+
+func (roundRobinSelector) Select(_ string, keys []config.ApiKey) (string, error) {
+	return selectKeyByRoundRobin(keys, "selector:"+SelectorRoundRobin), nil
+}
+
+// randomSelector 随机选择可用密钥
+type randomSelector struct{}
+
+func (randomSelector) Name() string { return SelectorRandom }
+
+func (randomSelector) Select(_ string, keys []config.ApiKey) (string, error) {
+	return keys[rand.Intn(len(keys))].Key, nil
+}
+
+// leastUsedTodaySelector 选择今日请求数最少的密钥，请求数相同时选择令牌数少、更久未使用的密钥
+type leastUsedTodaySelector struct{}
+
+func (leastUsedTodaySelector) Name() string { return SelectorLeastUsedToday }
+
+func (leastUsedTodaySelector) Select(_ string, keys []config.ApiKey) (string, error) {
+	usage, _, err := config.GetKeyUsageStats("")
+	if err != nil {
+		return "", err
+	}
+
+	best := keys[0]
+	bestUsage := usage[config.KeyID(best.Key)]
+	for _, k := range keys[1:] {
+		u := usage[config.KeyID(k.Key)]
+		if u.Requests != bestUsage.Requests {
+			if u.Requests < bestUsage.Requests {
+				best, bestUsage = k, u
+			}
+			continue
+		}
+		if u.Tokens < bestUsage.Tokens || (u.Tokens == bestUsage.Tokens && k.LastUsed < best.LastUsed) {
+			best, bestUsage = k, u
+		}
+	}
+	return best.Key, nil
+}
+
+// leastRecentlyUsedSelector 选择最久未使用的密钥
+type leastRecentlyUsedSelector struct{}
+
+func (leastRecentlyUsedSelector) Name() string { return SelectorLeastRecentlyUsed }
+
+func (leastRecentlyUsedSelector) Select(_ string, keys []config.ApiKey) (string, error) {
+	best := keys[0]
+	for _, k := range keys[1:] {
+		if k.LastUsed < best.LastUsed {
+			best = k
+		}
+	}
+	return best.Key, nil
+}
+
+// lowestLatencySelector 选择最近成功请求耗时最短的密钥
+// 本次运行中还没有耗时记录的密钥优先，以便获得耗时数据
+type lowestLatencySelector struct{}
+
+func (lowestLatencySelector) Name() string { return SelectorLowestLatency }
+
+func (lowestLatencySelector) Select(_ string, keys []config.ApiKey) (string, error) {
+	best := ""
+	bestLatency := 0.0
+	for _, k := range keys {
+		latency, ok := config.GetKeyLatency(k.Key)
+		if !ok {
+			return k.Key, nil
+		}
+		if best == "" || latency < bestLatency {
+			best, bestLatency = k.Key, latency
+		}
+	}
+	return best, nil
+}
+
+// highestBalanceSelector 选择剩余余额最高的密钥，余额由定时余额检查更新
+// 余额相同时选择最久未使用的密钥，避免总是命中同一个密钥
+type highestBalanceSelector struct{}
+
+func (highestBalanceSelector) Name() string { return SelectorHighestBalance }
+
+func (highestBalanceSelector) Select(_ string, keys []config.ApiKey) (string, error) {
+	best := keys[0]
+	for _, k := range keys[1:] {
+		if k.Balance > best.Balance || (k.Balance == best.Balance && k.LastUsed < best.LastUsed) {
+			best = k
+		}
+	}
+	return best.Key, nil
+}
@@ -0,0 +1,209 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 01:05:00
+  @desc: 定时使用每个密钥请求/v1/models校验密钥，禁用上游判定无效或余额耗尽的密钥并发送汇总告警
+**/
+
+package key
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"flowsilicon/internal/common"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+// keyValidationWorkers 校验时同时请求上游的密钥数
+const keyValidationWorkers = 4
+
+// ErrKeyValidationRunning 上一次校验尚未完成
+var ErrKeyValidationRunning = errors.New("密钥校验正在进行中")
+
+// KeyValidationFailure 单个校验失败并被禁用的密钥
+type KeyValidationFailure struct {
+	KeyID      string `json:"key_id"`
+	MaskedKey  string `json:"masked_key"`
+	StatusCode int    `json:"status_code"`
+	Reason     string `json:"reason"`
+}
+
+// KeyValidationResult 一次密钥校验的结果
+type KeyValidationResult struct {
+	StartedAt  int64                  `json:"started_at"`
+	FinishedAt int64                  `json:"finished_at"`
+	Checked    int                    `json:"checked"` // 校验的密钥数，不含已禁用和已过期的密钥
+	Valid      int                    `json:"valid"`
+	Errors     int                    `json:"errors"` // 网络错误或上游异常，无法判断密钥是否有效，不禁用
+	Failed     []KeyValidationFailure `json:"failed"` // 本次校验失败并被禁用的密钥
+}
+
+var (
+	// lastKeyValidation 最近一次完成的校验结果
+	lastKeyValidation      *KeyValidationResult
+	lastKeyValidationMutex sync.RWMutex
+
+	// keyValidationRunning 校验是否正在执行
+	keyValidationRunning atomic.Bool
+)
+
+// GetLastKeyValidation 获取最近一次完成的校验结果，尚未校验过时ok为false
+func GetLastKeyValidation() (result KeyValidationResult, ok bool) {
+	lastKeyValidationMutex.RLock()
+	defer lastKeyValidationMutex.RUnlock()
+	if lastKeyValidation == nil {
+		return KeyValidationResult{Failed: []KeyValidationFailure{}}, false
+	}
+	result = *lastKeyValidation
+	result.Failed = append([]KeyValidationFailure{}, lastKeyValidation.Failed...)
+	return result, true
+}
+
+// scheduledKeyValidation 定时任务入口，是否校验在每次执行时按配置决定
+func scheduledKeyValidation() {
+	if !config.GetKeyValidationConfig().Enabled {
+		return
+	}
+	if _, err := RunKeyValidation(); err != nil && !errors.Is(err, ErrKeyValidationRunning) {
+		logger.Error("定时校验API密钥失败: %v", err)
+	}
+}
+
+// RunKeyValidation 立即校验所有未禁用且未过期的密钥，上游返回401、402或403时禁用该密钥
+// 有密钥被禁用且启用了通知时，通过告警通知渠道发送一条汇总
+func RunKeyValidation() (KeyValidationResult, error) {
+	if !keyValidationRunning.CompareAndSwap(false, true) {
+		return KeyValidationResult{}, ErrKeyValidationRunning
+	}
+	defer keyValidationRunning.Store(false)
+
+	result := KeyValidationResult{
+		StartedAt: time.Now().Unix(),
+		Failed:    []KeyValidationFailure{},
+	}
+
+	var keys []string
+	for _, k := range config.GetApiKeys() {
+		if !k.Disabled && !k.Expired {
+			keys = append(keys, k.Key)
+		}
+	}
+	result.Checked = len(keys)
+
+	statuses := make([]int, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for w := 0; w < keyValidationWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				statuses[i], errs[i] = probeKey(keys[i])
+			}
+		}()
+	}
+	for i := range keys {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	now := time.Now().Unix()
+	for i, apiKey := range keys {
+		config.UpdateApiKeyLastTested(apiKey, now)
+		reason := keyValidationFailureReason(statuses[i])
+		switch {
+		case errs[i] != nil:
+			result.Errors++
+			logger.Warn("校验API密钥 %s 失败，暂不处理: %v", MaskKey(apiKey), errs[i])
+		case reason == "":
+			result.Valid++
+		default:
+			keyID := config.KeyID(apiKey)
+			config.DisableApiKey(apiKey)
+			result.Failed = append(result.Failed, KeyValidationFailure{
+				KeyID:      keyID,
+				MaskedKey:  config.DisplayKeyID(keyID, true),
+				StatusCode: statuses[i],
+				Reason:     reason,
+			})
+			logger.Warn("API密钥 %s 校验失败（%s，状态码 %d），已禁用", MaskKey(apiKey), reason, statuses[i])
+		}
+	}
+	result.FinishedAt = time.Now().Unix()
+
+	if err := config.SaveApiKeys(); err != nil {
+		logger.Error("保存API密钥状态失败: %v", err)
+	}
+	if len(result.Failed) > 0 {
+		InvalidatePoolState()
+		if config.GetKeyValidationConfig().Notify {
+			notifyKeyValidationFailures(result.Failed)
+		}
+	}
+
+	lastKeyValidationMutex.Lock()
+	saved := result
+	lastKeyValidation = &saved
+	lastKeyValidationMutex.Unlock()
+
+	logger.Info("API密钥校验完成：校验%d个，有效%d个，禁用%d个，无法判断%d个",
+		result.Checked, result.Valid, len(result.Failed), result.Errors)
+	return result, nil
+}
+
+// probeKey 使用密钥请求/v1/models，返回上游状态码，请求未完成或上游服务异常时返回错误
+func probeKey(apiKey string) (int, error) {
+	cfg := config.GetConfig()
+	if cfg == nil || cfg.ApiProxy.BaseURL == "" {
+		return 0, errors.New("未配置API基础URL")
+	}
+	url := strings.TrimRight(cfg.ApiProxy.BaseURL, "/") + "/v1/models"
+
+	resp, err := client.R().
+		SetHeader("Authorization", fmt.Sprintf("Bearer %s", apiKey)).
+		SetHeader("Accept-Encoding", "identity").
+		Get(url)
+	if err != nil {
+		return 0, fmt.Errorf("请求失败: %w", err)
+	}
+	if resp.StatusCode() >= http.StatusInternalServerError || resp.StatusCode() == http.StatusTooManyRequests {
+		return resp.StatusCode(), fmt.Errorf("API 返回状态码 %d", resp.StatusCode())
+	}
+	return resp.StatusCode(), nil
+}
+
+// keyValidationFailureReason 根据上游状态码判断密钥是否失效，有效时返回空字符串
+func keyValidationFailureReason(statusCode int) string {
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return "密钥无效或已吊销"
+	case http.StatusPaymentRequired:
+		return "余额不足"
+	case http.StatusForbidden:
+		return "密钥无权限或已过期"
+	default:
+		return ""
+	}
+}
+
+// notifyKeyValidationFailures 发送本次校验中新禁用密钥的汇总告警
+func notifyKeyValidationFailures(failed []KeyValidationFailure) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "定时校验发现 %d 个API密钥失效，已自动禁用：", len(failed))
+	for _, f := range failed {
+		fmt.Fprintf(&b, "\n%s：%s（状态码 %d）", config.DisplayKeyID(f.KeyID, false), f.Reason, f.StatusCode)
+	}
+	common.Notify(common.Notification{
+		Title:    "API密钥校验失败",
+		Content:  b.String(),
+		Severity: config.SeverityWarning,
+	})
+}
@@ -0,0 +1,64 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 23:55:00
+  @desc: 按密钥权重的平滑加权轮询选择
+**/
+
+package key
+
+import (
+	"time"
+
+	"flowsilicon/internal/common"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+)
+
+// weightedCurrent 平滑加权轮询中每个密钥的当前权重，受rrMutex保护
+var weightedCurrent = make(map[string]int)
+
+// getWeightedRoundRobinKey 按权重在可用密钥中轮询，每个密钥被选中的比例与权重成正比
+// 使用平滑加权轮询，高权重密钥的请求分散在整个周期中，不会连续集中到同一个密钥
+func getWeightedRoundRobinKey() (string, error) {
+	activeKeys := config.GetActiveApiKeys()
+	if len(activeKeys) == 0 {
+		return "", common.ErrNoActiveKeys
+	}
+
+	rrMutex.Lock()
+	total := 0
+	selected := ""
+	active := make(map[string]bool, len(activeKeys))
+	for _, k := range activeKeys {
+		weight := config.GetKeyWeight(k.Key)
+		if weight <= 0 {
+			continue
+		}
+		active[k.Key] = true
+		total += weight
+		weightedCurrent[k.Key] += weight
+		if selected == "" || weightedCurrent[k.Key] > weightedCurrent[selected] {
+			selected = k.Key
+		}
+	}
+	if selected != "" {
+		weightedCurrent[selected] -= total
+	}
+	// 不再可用的密钥重新可用时从0开始，避免积累的权重导致集中选择
+	for k := range weightedCurrent {
+		if !active[k] {
+			delete(weightedCurrent, k)
+		}
+	}
+	rrMutex.Unlock()
+
+	if selected == "" {
+		logger.Warn("加权轮询: 所有可用密钥的权重都不大于0，回退到普通轮询")
+		return getRoundRobinKey()
+	}
+
+	logger.Info("加权轮询: 选择密钥=%s, 权重=%d, 总权重=%d", utils.MaskKey(selected), config.GetKeyWeight(selected), total)
+	config.UpdateApiKeyLastUsed(selected, time.Now().Unix())
+	return selected, nil
+}
@@ -115,6 +115,14 @@ func applyModelStrategy(modelName string, strategyID int) (string, bool, error)
 		logger.Info("使用免费模型策略选择密钥: 模型=%s", modelName)
 		key, err := getFreeModelKey()
 		return key, true, err
+	case 9: // 临期优先策略
+		logger.Info("使用临期优先策略选择密钥: 模型=%s", modelName)
+		key, err := getExpiringFirstKey()
+		return key, true, err
+	case 10: // 加权轮询策略
+		logger.Info("使用加权轮询策略选择密钥: 模型=%s", modelName)
+		key, err := getWeightedRoundRobinKey()
+		return key, true, err
 	default:
 		logger.Info("使用默认策略(普通轮询)选择密钥: 模型=%s", modelName)
 		key, err := getRoundRobinKey()
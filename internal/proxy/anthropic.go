@@ -0,0 +1,481 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 01:35:00
+  @desc: Anthropic Messages API兼容层，将/v1/messages请求转换为OpenAI格式后按chat/completions转发
+**/
+
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/logger"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// anthropicMessagesPath Anthropic Messages API在/v1下的路径
+	anthropicMessagesPath = "/messages"
+	// anthropicCountTokensPath Anthropic计算输入令牌数接口在/v1下的路径
+	anthropicCountTokensPath = "/messages/count_tokens"
+)
+
+// Anthropic错误类型
+const (
+	anthropicErrorInvalidRequest  = "invalid_request_error"
+	anthropicErrorAuthentication  = "authentication_error"
+	anthropicErrorPermission      = "permission_error"
+	anthropicErrorNotFound        = "not_found_error"
+	anthropicErrorRequestTooLarge = "request_too_large"
+	anthropicErrorRateLimit       = "rate_limit_error"
+	anthropicErrorAPI             = "api_error"
+	anthropicErrorOverloaded      = "overloaded_error"
+)
+
+// anthropicRequest Anthropic Messages API的请求
+type anthropicRequest struct {
+	Model         string               `json:"model"`
+	MaxTokens     int                  `json:"max_tokens"`
+	System        json.RawMessage      `json:"system"`
+	Messages      []anthropicMessage   `json:"messages"`
+	StopSequences []string             `json:"stop_sequences"`
+	Stream        bool                 `json:"stream"`
+	Temperature   *float64             `json:"temperature"`
+	TopP          *float64             `json:"top_p"`
+	TopK          *int                 `json:"top_k"`
+	Tools         []anthropicTool      `json:"tools"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice"`
+	Thinking      *anthropicThinking   `json:"thinking"`
+	Metadata      *anthropicMetadata   `json:"metadata"`
+}
+
+// anthropicMessage Anthropic格式的消息，content为字符串或内容块数组
+type anthropicMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// anthropicContentBlock Anthropic格式的内容块
+type anthropicContentBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text"`
+	Source    *anthropicImageSource `json:"source"`
+	ID        string                `json:"id"`
+	Name      string                `json:"name"`
+	Input     json.RawMessage       `json:"input"`
+	ToolUseID string                `json:"tool_use_id"`
+	Content   json.RawMessage       `json:"content"`
+	IsError   bool                  `json:"is_error"`
+}
+
+// anthropicImageSource 图片内容块的来源，base64数据或URL
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+	URL       string `json:"url"`
+}
+
+// anthropicTool Anthropic格式的工具定义
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// anthropicToolChoice Anthropic格式的工具选择方式
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// anthropicThinking Anthropic格式的深度思考设置
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// anthropicMetadata Anthropic请求的元数据
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+// thinkingEnabled 请求是否开启了深度思考
+func (r *anthropicRequest) thinkingEnabled() bool {
+	return r.Thinking != nil && r.Thinking.Type == "enabled"
+}
+
+// openAIChatMessage 转换后的OpenAI格式消息
+type openAIChatMessage struct {
+	Role       string           `json:"role"`
+	Content    interface{}      `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// openAIToolCall OpenAI格式的工具调用
+type openAIToolCall struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+// openAIFunctionCall OpenAI格式工具调用中的函数名和参数
+type openAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// handleAnthropicMessages 处理/v1/messages和/v1/messages/count_tokens，返回false表示不是Anthropic接口，继续代理
+// 请求转换为OpenAI格式后交给HandleOpenAIProxy处理，响应和错误再转换回Anthropic格式
+func handleAnthropicMessages(c *gin.Context) bool {
+	path := c.Param("path")
+	if !strings.HasPrefix(c.Request.URL.Path, "/v1/") || (path != anthropicMessagesPath && path != anthropicCountTokensPath) {
+		return false
+	}
+
+	if c.Request.Method != http.MethodPost {
+		respondAnthropicError(c, http.StatusMethodNotAllowed, anthropicErrorInvalidRequest, "只支持POST请求")
+		return true
+	}
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		logger.Error("读取请求体失败: %v", err)
+		respondAnthropicError(c, http.StatusBadRequest, anthropicErrorInvalidRequest, "无法读取请求体")
+		return true
+	}
+
+	var req anthropicRequest
+	if err := json.Unmarshal(bodyBytes, &req); err != nil {
+		respondAnthropicError(c, http.StatusBadRequest, anthropicErrorInvalidRequest, "无法解析请求体: "+err.Error())
+		return true
+	}
+	if err := validateAnthropicRequest(&req, path == anthropicCountTokensPath); err != nil {
+		respondAnthropicError(c, http.StatusBadRequest, anthropicErrorInvalidRequest, err.Error())
+		return true
+	}
+
+	messages, err := convertAnthropicMessages(&req)
+	if err != nil {
+		respondAnthropicError(c, http.StatusBadRequest, anthropicErrorInvalidRequest, err.Error())
+		return true
+	}
+
+	// 计算输入令牌数只在本地估算，不请求上游
+	inputTokens := estimateChatInputTokens(messages, req.Tools)
+	if path == anthropicCountTokensPath {
+		c.JSON(http.StatusOK, gin.H{"input_tokens": inputTokens})
+		return true
+	}
+
+	transformedBody, err := json.Marshal(buildOpenAIChatRequest(&req, messages))
+	if err != nil {
+		logger.Error("转换Anthropic请求失败: %v", err)
+		respondAnthropicError(c, http.StatusInternalServerError, anthropicErrorAPI, "无法转换请求体")
+		return true
+	}
+
+	// 按chat/completions请求继续处理
+	useAnthropicAuthHeader(c)
+	rewriteAsChatCompletions(c, transformedBody)
+
+	// 演练模式直接返回转换后的请求描述
+	if isDryRunRequest(c) {
+		HandleOpenAIProxy(c)
+		return true
+	}
+
+	writer := newChatConvertWriter(c.Writer, req.Stream, func(write func([]byte)) chatResponseConverter {
+		return newAnthropicConverter(req.Model, req.thinkingEnabled(), inputTokens, write)
+	})
+	c.Writer = writer
+	HandleOpenAIProxy(c)
+	writer.finish(c)
+	return true
+}
+
+// validateAnthropicRequest 检查Anthropic请求的必填字段，计算令牌数接口不要求max_tokens
+func validateAnthropicRequest(req *anthropicRequest, countTokens bool) error {
+	if req.Model == "" {
+		return errors.New("model: Field required")
+	}
+	if !countTokens && req.MaxTokens <= 0 {
+		return errors.New("max_tokens: Field required")
+	}
+	if len(req.Messages) == 0 {
+		return errors.New("messages: at least one message is required")
+	}
+	for i, msg := range req.Messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return errors.New("messages." + strconv.Itoa(i) + ".role: Input should be 'user' or 'assistant'")
+		}
+	}
+	return nil
+}
+
+// useAnthropicAuthHeader Anthropic客户端通过x-api-key传入密钥，转换为Authorization以便校验虚拟密钥
+// Anthropic专用的请求头不转发给上游
+func useAnthropicAuthHeader(c *gin.Context) {
+	if apiKey := c.GetHeader("x-api-key"); apiKey != "" && c.GetHeader("Authorization") == "" {
+		c.Request.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	c.Request.Header.Del("x-api-key")
+	c.Request.Header.Del("anthropic-version")
+	c.Request.Header.Del("anthropic-beta")
+}
+
+// buildOpenAIChatRequest 构建转换后的chat/completions请求体
+func buildOpenAIChatRequest(req *anthropicRequest, messages []openAIChatMessage) map[string]interface{} {
+	body := map[string]interface{}{
+		"model":      req.Model,
+		"messages":   messages,
+		"max_tokens": req.MaxTokens,
+		"stream":     req.Stream,
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		body["top_p"] = *req.TopP
+	}
+	if req.TopK != nil {
+		body["top_k"] = *req.TopK
+	}
+	if len(req.StopSequences) > 0 {
+		body["stop"] = req.StopSequences
+	}
+	if req.Metadata != nil && req.Metadata.UserID != "" {
+		body["user"] = req.Metadata.UserID
+	}
+
+	// 深度思考对应硅基流动的enable_thinking和thinking_budget参数
+	if req.Thinking != nil {
+		body["enable_thinking"] = req.thinkingEnabled()
+		if req.thinkingEnabled() && req.Thinking.BudgetTokens > 0 {
+			body["thinking_budget"] = req.Thinking.BudgetTokens
+		}
+	}
+
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]interface{}, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			function := map[string]interface{}{
+				"name":        tool.Name,
+				"description": tool.Description,
+			}
+			if len(tool.InputSchema) > 0 {
+				function["parameters"] = tool.InputSchema
+			}
+			tools = append(tools, map[string]interface{}{"type": "function", "function": function})
+		}
+		body["tools"] = tools
+	}
+
+	if req.ToolChoice != nil {
+		switch req.ToolChoice.Type {
+		case "auto":
+			body["tool_choice"] = "auto"
+		case "any":
+			body["tool_choice"] = "required"
+		case "none":
+			body["tool_choice"] = "none"
+		case "tool":
+			body["tool_choice"] = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]string{"name": req.ToolChoice.Name},
+			}
+		}
+	}
+
+	return body
+}
+
+// convertAnthropicMessages 将system和messages转换为OpenAI格式的消息列表
+// tool_result内容块转换为role为tool的消息，放在同一条用户消息的其余内容之前
+func convertAnthropicMessages(req *anthropicRequest) ([]openAIChatMessage, error) {
+	var messages []openAIChatMessage
+
+	if len(req.System) > 0 && string(req.System) != "null" {
+		blocks, err := parseAnthropicContent(req.System)
+		if err != nil {
+			return nil, errors.New("system: " + err.Error())
+		}
+		if system := joinAnthropicText(blocks); system != "" {
+			messages = append(messages, openAIChatMessage{Role: "system", Content: system})
+		}
+	}
+
+	for i, msg := range req.Messages {
+		blocks, err := parseAnthropicContent(msg.Content)
+		if err != nil {
+			return nil, errors.New("messages." + strconv.Itoa(i) + ".content: " + err.Error())
+		}
+
+		var parts []map[string]interface{}
+		var toolCalls []openAIToolCall
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				parts = append(parts, map[string]interface{}{"type": "text", "text": block.Text})
+			case "image":
+				if url := anthropicImageURL(block.Source); url != "" {
+					parts = append(parts, map[string]interface{}{
+						"type":      "image_url",
+						"image_url": map[string]string{"url": url},
+					})
+				}
+			case "tool_use":
+				arguments := "{}"
+				if len(block.Input) > 0 && string(block.Input) != "null" {
+					arguments = string(block.Input)
+				}
+				toolCalls = append(toolCalls, openAIToolCall{
+					ID:       block.ID,
+					Type:     "function",
+					Function: openAIFunctionCall{Name: block.Name, Arguments: arguments},
+				})
+			case "tool_result":
+				content, err := anthropicToolResultText(block)
+				if err != nil {
+					return nil, errors.New("messages." + strconv.Itoa(i) + ".content: " + err.Error())
+				}
+				messages = append(messages, openAIChatMessage{Role: "tool", Content: content, ToolCallID: block.ToolUseID})
+			default:
+				// 历史消息中的thinking等内容块上游无法使用，直接忽略
+			}
+		}
+
+		if len(parts) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		converted := openAIChatMessage{Role: msg.Role, ToolCalls: toolCalls}
+		if len(parts) > 0 {
+			converted.Content = simplifyContentParts(parts)
+		}
+		messages = append(messages, converted)
+	}
+
+	return messages, nil
+}
+
+// parseAnthropicContent 解析字符串或内容块数组形式的content
+func parseAnthropicContent(raw json.RawMessage) ([]anthropicContentBlock, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []anthropicContentBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []anthropicContentBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, errors.New("Input should be a valid string or list of content blocks")
+	}
+	return blocks, nil
+}
+
+// joinAnthropicText 拼接内容块中的文本
+func joinAnthropicText(blocks []anthropicContentBlock) string {
+	texts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		if block.Type == "text" && block.Text != "" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// anthropicToolResultText 将tool_result的内容转换为文本，出错的工具结果加上标记
+func anthropicToolResultText(block anthropicContentBlock) (string, error) {
+	var text string
+	if len(block.Content) > 0 && string(block.Content) != "null" {
+		blocks, err := parseAnthropicContent(block.Content)
+		if err != nil {
+			return "", err
+		}
+		text = joinAnthropicText(blocks)
+	}
+	if block.IsError {
+		text = "Error: " + text
+	}
+	return text, nil
+}
+
+// anthropicImageURL 将图片来源转换为image_url可用的地址
+func anthropicImageURL(source *anthropicImageSource) string {
+	if source == nil {
+		return ""
+	}
+	switch source.Type {
+	case "base64":
+		return "data:" + source.MediaType + ";base64," + source.Data
+	case "url":
+		return source.URL
+	}
+	return ""
+}
+
+// simplifyContentParts 只有文本时合并为字符串，兼容不支持多模态content数组的模型
+func simplifyContentParts(parts []map[string]interface{}) interface{} {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part["type"] != "text" {
+			return parts
+		}
+		texts = append(texts, part["text"].(string))
+	}
+	return strings.Join(texts, "\n")
+}
+
+// respondAnthropicError 以Anthropic错误格式返回错误并中止请求
+func respondAnthropicError(c *gin.Context, status int, errType, message string) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.AbortWithStatusJSON(status, anthropicErrorPayload(c, errType, message))
+}
+
+// anthropicErrorPayload 构建Anthropic格式的错误内容
+func anthropicErrorPayload(c *gin.Context, errType, message string) gin.H {
+	return gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    errType,
+			"message": scrubSecrets(message),
+		},
+		"request_id": RequestID(c),
+	}
+}
+
+// anthropicErrorTypeForStatus 根据状态码确定Anthropic错误类型
+func anthropicErrorTypeForStatus(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return anthropicErrorAuthentication
+	case status == http.StatusForbidden:
+		return anthropicErrorPermission
+	case status == http.StatusNotFound:
+		return anthropicErrorNotFound
+	case status == http.StatusRequestEntityTooLarge:
+		return anthropicErrorRequestTooLarge
+	case status == http.StatusTooManyRequests:
+		return anthropicErrorRateLimit
+	case status == http.StatusServiceUnavailable || status == 529:
+		return anthropicErrorOverloaded
+	case status >= 400 && status < 500:
+		return anthropicErrorInvalidRequest
+	default:
+		return anthropicErrorAPI
+	}
+}
+
+// anthropicErrorTypeForOpenAI 将OpenAI错误类型转换为Anthropic错误类型
+func anthropicErrorTypeForOpenAI(errType string) string {
+	switch errType {
+	case ErrorTypeInvalidRequest, ErrorTypeAuthentication, ErrorTypePermission, ErrorTypeRateLimit:
+		return errType
+	default:
+		return anthropicErrorAPI
+	}
+}
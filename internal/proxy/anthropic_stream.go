@@ -0,0 +1,313 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 01:40:00
+  @desc: 将chat/completions的响应、流式事件和错误转换为Anthropic Messages API格式的转换器
+**/
+
+package proxy
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/logger"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// anthropicBlock 正在生成的Anthropic内容块
+type anthropicBlock struct {
+	Type string
+	ID   string
+	Name string
+	Text strings.Builder
+}
+
+// anthropicConverter 按顺序接收chat/completions的响应内容，生成Anthropic格式的消息
+// 设置write时每次变化都写出对应的流式事件，否则只在最后生成完整消息
+type anthropicConverter struct {
+	model        string
+	thinking     bool
+	write        func([]byte)
+	id           string
+	started      bool
+	finished     bool
+	blocks       []*anthropicBlock
+	toolBlocks   map[int]int
+	stopReason   string
+	inputTokens  int
+	outputTokens int
+}
+
+// newAnthropicConverter 创建响应转换器，inputTokens为上游未返回用量时使用的估算值，write为nil时不输出流式事件
+func newAnthropicConverter(model string, thinking bool, inputTokens int, write func([]byte)) *anthropicConverter {
+	return &anthropicConverter{
+		model:       model,
+		thinking:    thinking,
+		write:       write,
+		toolBlocks:  make(map[int]int),
+		inputTokens: inputTokens,
+	}
+}
+
+// emit 写出一个Anthropic流式事件
+func (a *anthropicConverter) emit(event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logger.Error("序列化Anthropic流式事件失败: %v", err)
+		return
+	}
+	a.write([]byte("event: " + event + "\ndata: " + string(payload) + "\n\n"))
+}
+
+// streamContentType 流式响应使用SSE
+func (a *anthropicConverter) streamContentType() string {
+	return "text/event-stream"
+}
+
+// comment 注释行原样写出，客户端会忽略
+func (a *anthropicConverter) comment(line []byte) {
+	if a.write != nil {
+		a.write(append(line, '\n', '\n'))
+	}
+}
+
+// hasStarted 是否已开始消息
+func (a *anthropicConverter) hasStarted() bool {
+	return a.started
+}
+
+// streamError 将流式响应中的错误转换为error事件
+func (a *anthropicConverter) streamError(body *OpenAIErrorBody) {
+	if a.finished {
+		return
+	}
+	a.finished = true
+	if a.write != nil {
+		a.emit("error", gin.H{
+			"type":  "error",
+			"error": gin.H{"type": anthropicErrorTypeForOpenAI(body.Type), "message": body.Message},
+		})
+	}
+}
+
+// errorResponse 返回Anthropic格式的错误
+func (a *anthropicConverter) errorResponse(c *gin.Context, status int, message string) interface{} {
+	return anthropicErrorPayload(c, anthropicErrorTypeForStatus(status), message)
+}
+
+// start 开始消息，流式时输出message_start
+func (a *anthropicConverter) start(id string) {
+	if a.started {
+		return
+	}
+	a.started = true
+	a.id = "msg_" + strings.TrimPrefix(id, "chatcmpl-")
+	if id == "" {
+		a.id = "msg_" + strings.TrimPrefix(newRequestID(), "req_")
+	}
+	if a.write != nil {
+		a.emit("message_start", gin.H{
+			"type": "message_start",
+			"message": gin.H{
+				"id":            a.id,
+				"type":          "message",
+				"role":          "assistant",
+				"model":         a.model,
+				"content":       []interface{}{},
+				"stop_reason":   nil,
+				"stop_sequence": nil,
+				"usage":         gin.H{"input_tokens": a.inputTokens, "output_tokens": 0},
+			},
+		})
+	}
+}
+
+// add 处理一个非流式响应或流式事件
+func (a *anthropicConverter) add(chunk *openAIChatChunk) {
+	if a.finished {
+		return
+	}
+	a.start(chunk.ID)
+
+	for _, choice := range chunk.Choices {
+		delta := choice.Delta
+		if delta == nil {
+			delta = choice.Message
+		}
+		if delta != nil {
+			if a.thinking && delta.ReasoningContent != "" {
+				a.appendText("thinking", delta.ReasoningContent)
+			}
+			if delta.Content != "" {
+				a.appendText("text", delta.Content)
+			}
+			for i, call := range delta.ToolCalls {
+				index := call.Index
+				if choice.Message != nil {
+					index = i
+				}
+				a.appendToolCall(index, call.ID, call.Function.Name, call.Function.Arguments)
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			a.stopReason = anthropicStopReason(*choice.FinishReason)
+		}
+	}
+
+	if chunk.Usage != nil {
+		if chunk.Usage.PromptTokens > 0 {
+			a.inputTokens = chunk.Usage.PromptTokens
+		}
+		a.outputTokens = chunk.Usage.CompletionTokens
+	}
+}
+
+// appendText 追加文本或思考内容，类型变化时开始新的内容块
+func (a *anthropicConverter) appendText(blockType, text string) {
+	block := a.currentBlock()
+	if block == nil || block.Type != blockType {
+		block = a.startBlock(&anthropicBlock{Type: blockType})
+	}
+	block.Text.WriteString(text)
+
+	if a.write != nil {
+		delta := gin.H{"type": "text_delta", "text": text}
+		if blockType == "thinking" {
+			delta = gin.H{"type": "thinking_delta", "thinking": text}
+		}
+		a.emit("content_block_delta", gin.H{"type": "content_block_delta", "index": len(a.blocks) - 1, "delta": delta})
+	}
+}
+
+// appendToolCall 追加工具调用，首次出现的工具调用开始新的tool_use内容块，参数按片段追加
+func (a *anthropicConverter) appendToolCall(index int, id, name, arguments string) {
+	blockIndex, ok := a.toolBlocks[index]
+	if !ok {
+		if id == "" {
+			id = "toolu_" + strings.TrimPrefix(newRequestID(), "req_")
+		}
+		a.startBlock(&anthropicBlock{Type: "tool_use", ID: id, Name: name})
+		blockIndex = len(a.blocks) - 1
+		a.toolBlocks[index] = blockIndex
+	}
+	if arguments == "" {
+		return
+	}
+
+	a.blocks[blockIndex].Text.WriteString(arguments)
+	if a.write != nil {
+		a.emit("content_block_delta", gin.H{
+			"type":  "content_block_delta",
+			"index": blockIndex,
+			"delta": gin.H{"type": "input_json_delta", "partial_json": arguments},
+		})
+	}
+}
+
+// currentBlock 返回最后一个内容块
+func (a *anthropicConverter) currentBlock() *anthropicBlock {
+	if len(a.blocks) == 0 {
+		return nil
+	}
+	return a.blocks[len(a.blocks)-1]
+}
+
+// startBlock 结束当前内容块并开始新的内容块
+func (a *anthropicConverter) startBlock(block *anthropicBlock) *anthropicBlock {
+	a.stopBlock()
+	a.blocks = append(a.blocks, block)
+	if a.write != nil {
+		var content gin.H
+		switch block.Type {
+		case "thinking":
+			content = gin.H{"type": "thinking", "thinking": ""}
+		case "tool_use":
+			content = gin.H{"type": "tool_use", "id": block.ID, "name": block.Name, "input": gin.H{}}
+		default:
+			content = gin.H{"type": "text", "text": ""}
+		}
+		a.emit("content_block_start", gin.H{"type": "content_block_start", "index": len(a.blocks) - 1, "content_block": content})
+	}
+	return block
+}
+
+// stopBlock 流式时输出当前内容块的content_block_stop
+func (a *anthropicConverter) stopBlock() {
+	if a.write == nil || len(a.blocks) == 0 {
+		return
+	}
+	index := len(a.blocks) - 1
+	if a.blocks[index].Type == "thinking" {
+		a.emit("content_block_delta", gin.H{
+			"type":  "content_block_delta",
+			"index": index,
+			"delta": gin.H{"type": "signature_delta", "signature": ""},
+		})
+	}
+	a.emit("content_block_stop", gin.H{"type": "content_block_stop", "index": index})
+}
+
+// finish 结束消息，流式时输出message_delta和message_stop
+func (a *anthropicConverter) finish() {
+	if a.finished {
+		return
+	}
+	a.start("")
+	a.finished = true
+	if a.stopReason == "" {
+		a.stopReason = "end_turn"
+	}
+	if a.write != nil {
+		a.stopBlock()
+		a.emit("message_delta", gin.H{
+			"type":  "message_delta",
+			"delta": gin.H{"stop_reason": a.stopReason, "stop_sequence": nil},
+			"usage": gin.H{"input_tokens": a.inputTokens, "output_tokens": a.outputTokens},
+		})
+		a.emit("message_stop", gin.H{"type": "message_stop"})
+	}
+}
+
+// response 返回完整的Anthropic消息
+func (a *anthropicConverter) response() interface{} {
+	a.finish()
+	content := make([]gin.H, 0, len(a.blocks))
+	for _, block := range a.blocks {
+		switch block.Type {
+		case "thinking":
+			content = append(content, gin.H{"type": "thinking", "thinking": block.Text.String(), "signature": ""})
+		case "tool_use":
+			input := json.RawMessage(block.Text.String())
+			if len(input) == 0 || !json.Valid(input) {
+				input = json.RawMessage("{}")
+			}
+			content = append(content, gin.H{"type": "tool_use", "id": block.ID, "name": block.Name, "input": input})
+		default:
+			content = append(content, gin.H{"type": "text", "text": block.Text.String()})
+		}
+	}
+	return gin.H{
+		"id":            a.id,
+		"type":          "message",
+		"role":          "assistant",
+		"model":         a.model,
+		"content":       content,
+		"stop_reason":   a.stopReason,
+		"stop_sequence": nil,
+		"usage":         gin.H{"input_tokens": a.inputTokens, "output_tokens": a.outputTokens},
+	}
+}
+
+// anthropicStopReason 将OpenAI的finish_reason转换为Anthropic的stop_reason
+func anthropicStopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
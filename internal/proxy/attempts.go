@@ -0,0 +1,92 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 11:50:00
+  @desc: 记录上游尝试和客户端请求结果，避免重试导致请求数虚高
+**/
+
+package proxy
+
+import (
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientSucceededKey 上下文中标记客户端请求已有尝试成功的键
+const clientSucceededKey = "client_request_succeeded"
+
+// classifyAttemptError 根据状态码和错误判断上游尝试的错误分类，成功时返回空字符串
+func classifyAttemptError(statusCode int, err error) string {
+	if err != nil {
+		msg := err.Error()
+		switch {
+		case errors.Is(err, errStreamFirstByteTimeout):
+			return config.AttemptErrorTimeout
+		case strings.Contains(msg, "context deadline exceeded") || strings.Contains(msg, "timeout"):
+			return config.AttemptErrorTimeout
+		case statusCode > 0:
+			return config.AttemptErrorRead
+		default:
+			return config.AttemptErrorNetwork
+		}
+	}
+
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return ""
+	case statusCode == http.StatusTooManyRequests:
+		return config.AttemptErrorRateLimit
+	case statusCode >= 400 && statusCode < 500:
+		return config.AttemptErrorClient
+	case statusCode >= 500:
+		return config.AttemptErrorServer
+	default:
+		return config.AttemptErrorOther
+	}
+}
+
+// recordUpstreamAttempt 记录一次上游尝试，成功时在上下文中标记客户端请求成功，并记录所用密钥供失败请求保存
+// 发送失败时statusCode为0，读取响应失败时传入已收到的状态码和读取错误
+func recordUpstreamAttempt(c *gin.Context, apiKey string, statusCode int, err error) {
+	errorClass := classifyAttemptError(statusCode, err)
+	c.Set(lastAttemptKeyKey, apiKey)
+	if errorClass == "" {
+		c.Set(clientSucceededKey, true)
+		config.ResetKeyCooldown(apiKey)
+		if config.RecordKeyBreakerSuccess(apiKey) {
+			key.InvalidatePoolState()
+		}
+	} else if isKeyCooldownStatus(statusCode) {
+		// 限流或额度不足时让密钥冷却，重试会选择其他密钥
+		if config.StartKeyCooldown(apiKey) > 0 {
+			key.InvalidatePoolState()
+		}
+	} else if isKeyBreakerFailure(errorClass) {
+		if config.RecordKeyBreakerFailure(apiKey) {
+			key.InvalidatePoolState()
+		}
+	}
+	config.AddUpstreamAttempt(apiKey, errorClass)
+}
+
+// errKeyCoolingDown 上游返回限流或额度错误，所用密钥已进入冷却
+var errKeyCoolingDown = errors.New("密钥被上游限流，已进入冷却")
+
+// isKeyCooldownStatus 上游状态码是否表示密钥被限流或额度不足，需要让密钥冷却
+func isKeyCooldownStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusPaymentRequired
+}
+
+// isKeyBreakerFailure 尝试失败是否计入密钥熔断，请求本身有误导致的4xx错误与密钥无关，不计入
+func isKeyBreakerFailure(errorClass string) bool {
+	return errorClass != "" && errorClass != config.AttemptErrorClient
+}
+
+// recordClientOutcome 记录客户端请求的最终结果，任一次尝试成功即为成功
+func recordClientOutcome(c *gin.Context) {
+	config.AddClientRequestOutcome(c.GetBool(clientSucceededKey))
+}
@@ -0,0 +1,320 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 01:45:00
+  @desc: 将HandleOpenAIProxy写出的chat/completions响应转换为其他API格式的写入器，供各API兼容接口使用
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chatCompletionsPath 兼容接口转换后的请求在/v1下的路径
+const chatCompletionsPath = "/chat/completions"
+
+// rewriteAsChatCompletions 将请求改写为使用body的/v1/chat/completions请求，之后交给HandleOpenAIProxy处理
+func rewriteAsChatCompletions(c *gin.Context, body []byte) {
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	c.Request.URL.Path = "/v1" + chatCompletionsPath
+	for i := range c.Params {
+		if c.Params[i].Key == "path" {
+			c.Params[i].Value = chatCompletionsPath
+		}
+	}
+}
+
+// estimateChatInputTokens 估算转换后请求的输入令牌数，tools为请求中的工具定义
+func estimateChatInputTokens(messages []openAIChatMessage, tools interface{}) int {
+	var sb strings.Builder
+	for _, msg := range messages {
+		switch content := msg.Content.(type) {
+		case string:
+			sb.WriteString(content)
+		case []map[string]interface{}:
+			for _, part := range content {
+				if text, ok := part["text"].(string); ok {
+					sb.WriteString(text)
+				}
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			sb.WriteString(call.Function.Name)
+			sb.WriteString(call.Function.Arguments)
+		}
+	}
+	if data, err := json.Marshal(tools); err == nil && string(data) != "null" {
+		sb.Write(data)
+	}
+	return utils.EstimateStringTokens(sb.String())
+}
+
+// openAIChatChunk chat/completions的响应或流式事件，非流式响应使用message，流式事件使用delta
+type openAIChatChunk struct {
+	ID      string `json:"id"`
+	Choices []struct {
+		Message      *openAIChatDelta `json:"message"`
+		Delta        *openAIChatDelta `json:"delta"`
+		FinishReason *string          `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// openAIChatDelta 响应消息或增量中的内容
+type openAIChatDelta struct {
+	Content          string `json:"content"`
+	ReasoningContent string `json:"reasoning_content"`
+	ToolCalls        []struct {
+		Index    int                `json:"index"`
+		ID       string             `json:"id"`
+		Function openAIFunctionCall `json:"function"`
+	} `json:"tool_calls"`
+}
+
+// chatResponseConverter 将chat/completions的响应转换为其他API格式
+// 流式时转换结果通过创建时传入的写出函数立即写出，非流式时由response返回完整响应
+type chatResponseConverter interface {
+	// streamContentType 流式响应的Content-Type
+	streamContentType() string
+	// comment 处理流式响应中的注释行（心跳等）
+	comment(line []byte)
+	// add 处理一个非流式响应或流式事件
+	add(chunk *openAIChatChunk)
+	// streamError 处理流式响应中的错误事件，之后不再处理其他事件
+	streamError(body *OpenAIErrorBody)
+	// finish 结束流式响应
+	finish()
+	// hasStarted 是否已处理过响应内容
+	hasStarted() bool
+	// response 返回完整的非流式响应
+	response() interface{}
+	// errorResponse 返回错误响应的内容
+	errorResponse(c *gin.Context, status int, message string) interface{}
+}
+
+// chatConvertWriter 替换gin的响应写入器，将HandleOpenAIProxy写出的响应交给转换器
+// 流式响应逐行转换后立即写出，非流式响应和错误响应先缓存，在finish时转换
+// 流式处理会在多个协程中写入，写入操作需要加锁
+type chatConvertWriter struct {
+	gin.ResponseWriter
+	mu        sync.Mutex
+	stream    bool
+	converter chatResponseConverter
+	buf       bytes.Buffer
+	pending   []byte
+	writeErr  error
+}
+
+// newChatConvertWriter 创建转换响应的写入器，newConverter的参数在非流式时为nil
+func newChatConvertWriter(w gin.ResponseWriter, stream bool, newConverter func(write func([]byte)) chatResponseConverter) *chatConvertWriter {
+	writer := &chatConvertWriter{ResponseWriter: w, stream: stream}
+	var write func([]byte)
+	if stream {
+		write = writer.writeRaw
+	}
+	writer.converter = newConverter(write)
+	return writer
+}
+
+// buffered 是否缓存响应，非流式请求和错误响应在结束时统一转换
+func (w *chatConvertWriter) buffered() bool {
+	return !w.stream || w.ResponseWriter.Status() >= http.StatusBadRequest
+}
+
+// Write 缓存响应或转换流式事件
+func (w *chatConvertWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buffered() {
+		return w.buf.Write(data)
+	}
+
+	w.pending = append(w.pending, data...)
+	for {
+		end := bytes.IndexByte(w.pending, '\n')
+		if end < 0 {
+			break
+		}
+		line := bytes.TrimRight(w.pending[:end], "\r")
+		w.pending = w.pending[end+1:]
+		w.handleStreamLine(line)
+	}
+	if w.writeErr != nil {
+		return 0, w.writeErr
+	}
+	return len(data), nil
+}
+
+// WriteString 同Write
+func (w *chatConvertWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written 缓存了响应时同样视为已写入，避免重复写入错误响应
+func (w *chatConvertWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// Flush 只在转换流式响应时刷新
+func (w *chatConvertWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.buffered() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// handleStreamLine 转换一行流式响应，[DONE]结束响应
+func (w *chatConvertWriter) handleStreamLine(line []byte) {
+	switch {
+	case len(line) == 0:
+		return
+	case line[0] == ':':
+		w.converter.comment(line)
+		return
+	case !bytes.HasPrefix(line, []byte("data:")):
+		return
+	}
+
+	data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+	if bytes.Equal(data, []byte("[DONE]")) {
+		w.converter.finish()
+		return
+	}
+
+	var errEvent struct {
+		Error *OpenAIErrorBody `json:"error"`
+	}
+	if err := json.Unmarshal(data, &errEvent); err == nil && errEvent.Error != nil {
+		w.converter.streamError(errEvent.Error)
+		return
+	}
+
+	var chunk openAIChatChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		logger.Warn("无法解析流式事件，已跳过: %v", err)
+		return
+	}
+	w.converter.add(&chunk)
+}
+
+// writeRaw 写出到原始响应，记录写入错误以便流式处理发现客户端断开
+func (w *chatConvertWriter) writeRaw(data []byte) {
+	if !w.ResponseWriter.Written() {
+		w.ResponseWriter.Header().Set("Content-Type", w.converter.streamContentType())
+	}
+	if _, err := w.ResponseWriter.Write(data); err != nil && w.writeErr == nil {
+		w.writeErr = err
+	}
+}
+
+// finish HandleOpenAIProxy返回后调用，转换缓存的响应，或补齐未正常结束的流式响应
+func (w *chatConvertWriter) finish(c *gin.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.buffered() {
+		if len(w.pending) > 0 {
+			w.handleStreamLine(bytes.TrimRight(w.pending, "\r"))
+			w.pending = nil
+		}
+		if w.converter.hasStarted() {
+			w.converter.finish()
+			w.ResponseWriter.Flush()
+		}
+		return
+	}
+
+	if w.buf.Len() == 0 {
+		return
+	}
+	status := w.ResponseWriter.Status()
+	var payload interface{}
+	if status >= http.StatusBadRequest {
+		payload = w.converter.errorResponse(c, status, upstreamErrorMessage(status, w.buf.Bytes()))
+	} else if w.convertBufferedResponse() {
+		payload = w.converter.response()
+	} else {
+		status = http.StatusBadGateway
+		payload = w.converter.errorResponse(c, status, "无法解析上游响应")
+	}
+
+	body, _ := json.Marshal(payload)
+	header := w.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	header.Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(status)
+	w.ResponseWriter.Write(body)
+}
+
+// convertBufferedResponse 将缓存的非流式响应交给转换器，上游强制返回流式响应时按事件依次转换
+func (w *chatConvertWriter) convertBufferedResponse() bool {
+	body := bytes.TrimSpace(w.buf.Bytes())
+	if bytes.HasPrefix(body, []byte("data:")) {
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+			if !bytes.HasPrefix(line, []byte("data:")) || bytes.Equal(data, []byte("[DONE]")) {
+				continue
+			}
+			var chunk openAIChatChunk
+			if err := json.Unmarshal(data, &chunk); err == nil {
+				w.converter.add(&chunk)
+			}
+		}
+		return w.converter.hasStarted()
+	}
+
+	var chunk openAIChatChunk
+	if err := json.Unmarshal(body, &chunk); err != nil {
+		logger.Error("解析上游响应失败: %v", err)
+		return false
+	}
+	w.converter.add(&chunk)
+	return true
+}
+
+// upstreamErrorMessage 从OpenAI格式或其他格式的错误响应中提取错误信息
+func upstreamErrorMessage(status int, body []byte) string {
+	var parsed struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		var errObj struct {
+			Message string `json:"message"`
+		}
+		var errText string
+		switch {
+		case json.Unmarshal(parsed.Error, &errObj) == nil && errObj.Message != "":
+			return errObj.Message
+		case json.Unmarshal(parsed.Error, &errText) == nil && errText != "":
+			return errText
+		case parsed.Message != "":
+			return parsed.Message
+		}
+	}
+
+	message := strings.TrimSpace(string(body))
+	if message == "" || json.Valid(body) {
+		message = http.StatusText(status)
+	}
+	return truncateMessage(message, maxUpstreamErrorMessage)
+}
@@ -0,0 +1,288 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 19:50:00
+  @desc: 代理请求的并发限制，按优先级排队，排队时间越长优先级越高
+**/
+
+package proxy
+
+import (
+	"context"
+	"flowsilicon/internal/config"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// priorityClasses 按从高到低排列的优先级，下标即优先级顺序
+var priorityClasses = [...]string{config.PriorityHigh, config.PriorityNormal, config.PriorityLow}
+
+// slotWaiter 排队等待并发名额的请求
+type slotWaiter struct {
+	class    int
+	enqueued time.Time
+	ready    chan struct{}
+	granted  bool
+}
+
+// holdAverageWeight 名额平均占用时间的平滑系数，每次释放名额时新样本占1/holdAverageWeight
+const holdAverageWeight = 8
+
+// requestLimiter 并发限制器，每个优先级一个先进先出队列
+type requestLimiter struct {
+	mu          sync.Mutex
+	inFlight    int
+	lowInFlight int
+	queues      [len(priorityClasses)][]*slotWaiter
+	// avgHold 名额的平均占用时间（指数加权），用于估算排队超时后的重试时间
+	avgHold time.Duration
+}
+
+// limiter 全局并发限制器，未配置并发上限时只计数不排队
+var limiter = &requestLimiter{}
+
+// priorityIndex 获取优先级对应的下标
+func priorityIndex(priority string) int {
+	for i, p := range priorityClasses {
+		if p == priority {
+			return i
+		}
+	}
+	return 1
+}
+
+// lowClass 判断是否为低优先级
+func lowClass(class int) bool {
+	return class == len(priorityClasses)-1
+}
+
+// acquire 获取一个并发名额，返回释放函数、排队时间和是否排过队
+// 排队超时或ctx结束时返回ctx的错误或context.DeadlineExceeded
+func (l *requestLimiter) acquire(ctx context.Context, class int, cfg config.ConcurrencyConfig) (func(), time.Duration, bool, error) {
+	start := time.Now()
+
+	l.mu.Lock()
+	if l.queuesEmptyLocked() && l.canGrantLocked(class, cfg) {
+		l.grantLocked(class)
+		l.mu.Unlock()
+		return l.releaseFunc(class), 0, false, nil
+	}
+
+	w := &slotWaiter{class: class, enqueued: start, ready: make(chan struct{})}
+	l.queues[class] = append(l.queues[class], w)
+	// 低优先级的队首可能因占用比例受限，其他优先级仍可能有空闲名额
+	l.dispatchLocked(cfg)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(cfg.QueueTimeout())
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.ready:
+		return l.releaseFunc(class), time.Since(start), true, nil
+	case <-timer.C:
+		err = context.DeadlineExceeded
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.granted {
+		// 超时与分配同时发生时以分配为准
+		return l.releaseFunc(class), time.Since(start), true, nil
+	}
+	l.removeLocked(w)
+	return nil, time.Since(start), true, err
+}
+
+// releaseFunc 生成只会生效一次的释放函数，释放时记录名额的占用时间
+func (l *requestLimiter) releaseFunc(class int) func() {
+	var once sync.Once
+	granted := time.Now()
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.inFlight--
+			if lowClass(class) {
+				l.lowInFlight--
+			}
+			l.recordHoldLocked(time.Since(granted))
+			l.dispatchLocked(config.GetConcurrencyConfig())
+		})
+	}
+}
+
+// recordHoldLocked 将一次名额占用时间计入平均占用时间（已加锁）
+func (l *requestLimiter) recordHoldLocked(hold time.Duration) {
+	if l.avgHold == 0 {
+		l.avgHold = hold
+		return
+	}
+	l.avgHold += (hold - l.avgHold) / holdAverageWeight
+}
+
+// retryAfter 估算排队中的请求全部获得名额所需的时间，作为排队超时后建议的重试时间
+// 每批最多MaxInFlight个请求，每批按名额的平均占用时间计算，尚无占用记录时使用排队超时时间
+func (l *requestLimiter) retryAfter(cfg config.ConcurrencyConfig) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hold := l.avgHold
+	if hold <= 0 {
+		hold = cfg.QueueTimeout()
+	}
+	if cfg.MaxInFlight <= 0 {
+		return hold
+	}
+	queued := 0
+	for _, q := range l.queues {
+		queued += len(q)
+	}
+	return time.Duration(queued/cfg.MaxInFlight+1) * hold
+}
+
+// queuesEmptyLocked 判断是否没有排队的请求（已加锁）
+func (l *requestLimiter) queuesEmptyLocked() bool {
+	for _, q := range l.queues {
+		if len(q) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// canGrantLocked 判断当前是否能给指定优先级分配名额（已加锁）
+// 上限为0时不限制，低优先级还受占用比例限制
+func (l *requestLimiter) canGrantLocked(class int, cfg config.ConcurrencyConfig) bool {
+	if cfg.MaxInFlight <= 0 {
+		return true
+	}
+	if l.inFlight >= cfg.MaxInFlight {
+		return false
+	}
+	if lowClass(class) {
+		if limit := cfg.LowPriorityCap(); limit > 0 && l.lowInFlight >= limit {
+			return false
+		}
+	}
+	return true
+}
+
+// grantLocked 占用一个名额（已加锁）
+func (l *requestLimiter) grantLocked(class int) {
+	l.inFlight++
+	if lowClass(class) {
+		l.lowInFlight++
+	}
+}
+
+// dispatchLocked 按有效优先级依次唤醒队首请求，直到没有空闲名额（已加锁）
+// 有效优先级为原优先级减去排队时长包含的aging周期数，相同时先排队的优先
+func (l *requestLimiter) dispatchLocked(cfg config.ConcurrencyConfig) {
+	aging := cfg.Aging()
+	for {
+		now := time.Now()
+		best := -1
+		bestRank := 0
+		for class, q := range l.queues {
+			if len(q) == 0 || !l.canGrantLocked(class, cfg) {
+				continue
+			}
+			w := q[0]
+			rank := class - int(now.Sub(w.enqueued)/aging)
+			if rank < 0 {
+				rank = 0
+			}
+			if best < 0 || rank < bestRank || (rank == bestRank && w.enqueued.Before(l.queues[best][0].enqueued)) {
+				best, bestRank = class, rank
+			}
+		}
+		if best < 0 {
+			return
+		}
+
+		w := l.queues[best][0]
+		l.queues[best] = l.queues[best][1:]
+		l.grantLocked(best)
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// removeLocked 将放弃等待的请求移出队列（已加锁）
+func (l *requestLimiter) removeLocked(w *slotWaiter) {
+	q := l.queues[w.class]
+	for i, item := range q {
+		if item == w {
+			l.queues[w.class] = append(q[:i], q[i+1:]...)
+			return
+		}
+	}
+}
+
+// clientKeyFromRequest 获取客户端请求中的Bearer令牌，用于匹配按客户端配置的优先级
+func clientKeyFromRequest(c *gin.Context) string {
+	auth := c.GetHeader("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// acquireRequestSlot 按请求优先级获取并发名额，开启并发限制时记录排队时间
+// 返回false表示排队超时或客户端已断开，超时时已写入错误响应
+func acquireRequestSlot(c *gin.Context) (func(), bool) {
+	cfg := config.GetConcurrencyConfig()
+	priority := cfg.ResolvePriority(clientKeyFromRequest(c), c.GetHeader)
+
+	release, wait, queued, err := limiter.acquire(c.Request.Context(), priorityIndex(priority), cfg)
+	timedOut := err == context.DeadlineExceeded
+	if cfg.MaxInFlight > 0 {
+		config.AddQueueWait(priority, wait, queued, timedOut)
+	}
+	if err == nil {
+		return release, true
+	}
+
+	if timedOut {
+		// 排队超时的请求未发送到上游，按本地拒绝统计
+		config.AddRejectedRequest(ErrorCodeQueueTimeout)
+		retryAfter := setRetryAfter(c, limiter.retryAfter(cfg))
+		respondOpenAIErrorWithFields(c, http.StatusServiceUnavailable, ErrorTypeTimeout, ErrorCodeQueueTimeout,
+			"排队等待超过"+cfg.QueueTimeout().String()+"，请稍后重试", gin.H{
+				"limit":       "concurrency",
+				"retry_after": retryAfter,
+			})
+	} else {
+		c.Abort()
+	}
+	return nil, false
+}
+
+// InFlightRequests 获取正在处理的代理请求数（不含演练请求）
+func InFlightRequests() int {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	return limiter.inFlight
+}
+
+// WaitForIdle 等待正在处理的代理请求全部结束，用于切换配置档案前排空请求
+// ctx结束时返回ctx的错误
+func WaitForIdle(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for InFlightRequests() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"context"
+	"flowsilicon/internal/config"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRequestLimiterRetryAfterFromQueue(t *testing.T) {
+	l := &requestLimiter{avgHold: 2 * time.Second}
+	cfg := config.ConcurrencyConfig{MaxInFlight: 2, QueueTimeoutSeconds: 30}
+
+	if got := l.retryAfter(cfg); got != 2*time.Second {
+		t.Fatalf("队列为空时 retryAfter() = %v, want 2s", got)
+	}
+	for i := 0; i < 5; i++ {
+		l.queues[1] = append(l.queues[1], &slotWaiter{class: 1})
+	}
+	// 5个排队请求、每批2个，排队的请求全部获得名额约需3批
+	if got := l.retryAfter(cfg); got != 6*time.Second {
+		t.Fatalf("retryAfter() = %v, want 6s", got)
+	}
+
+	// 尚无占用记录时使用排队超时时间
+	if got := (&requestLimiter{}).retryAfter(cfg); got != 30*time.Second {
+		t.Fatalf("无占用记录时 retryAfter() = %v, want 30s", got)
+	}
+}
+
+func TestRequestLimiterRecordsHoldTime(t *testing.T) {
+	l := &requestLimiter{}
+	l.recordHoldLocked(8 * time.Second)
+	if l.avgHold != 8*time.Second {
+		t.Fatalf("avgHold = %v, want 8s", l.avgHold)
+	}
+	l.recordHoldLocked(0)
+	if l.avgHold != 7*time.Second {
+		t.Fatalf("avgHold = %v, want 7s", l.avgHold)
+	}
+}
+
+func TestQueueTimeoutSetsRetryAfter(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.ApiProxy.Concurrency = config.ConcurrencyConfig{MaxInFlight: 1, QueueTimeoutSeconds: 1}
+	setupProxyTest(t, cfg)
+
+	oldLimiter := limiter
+	limiter = &requestLimiter{avgHold: 3 * time.Second}
+	t.Cleanup(func() { limiter = oldLimiter })
+
+	// 占用唯一的名额，后续请求只能排队直到超时
+	release, _, _, err := limiter.acquire(context.Background(), 1, cfg.ApiProxy.Concurrency)
+	if err != nil {
+		t.Fatalf("acquire() = %v", err)
+	}
+	defer release()
+
+	c, w := newTestContext(http.MethodPost, "/v1/chat/completions", "")
+	if _, ok := acquireRequestSlot(c); ok {
+		t.Fatal("名额已被占用时应排队超时")
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("状态码 = %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "3" {
+		t.Fatalf("Retry-After = %q, want 3", got)
+	}
+	if fields := decodeErrorFields(t, w.Body.Bytes()); fields["limit"] != "concurrency" {
+		t.Fatalf("limit = %v, want concurrency", fields["limit"])
+	}
+
+	reasons, err := config.GetRejectedReasons("")
+	if err != nil || reasons[ErrorCodeQueueTimeout] != 1 {
+		t.Fatalf("排队超时应按本地拒绝统计: %v, %v", reasons, err)
+	}
+}
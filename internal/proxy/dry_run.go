@@ -0,0 +1,123 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 17:40:00
+  @desc: 演练模式，完成密钥选择和请求体转换后返回将要发往上游的请求描述，不实际转发
+**/
+
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/pkg/utils"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// dryRunHeader 按请求开启演练模式的请求头，值为1或true
+	dryRunHeader = "X-FS-Dry-Run"
+	// adminTokenHeader 传入管理令牌的请求头
+	adminTokenHeader = "X-FS-Admin-Token"
+)
+
+// DryRunRequest 演练模式下返回的上游请求描述
+type DryRunRequest struct {
+	DryRun        bool              `json:"dry_run"`
+	RequestID     string            `json:"request_id"`
+	Method        string            `json:"method"`
+	URL           string            `json:"url"`
+	Headers       map[string]string `json:"headers"` // Authorization中的密钥已脱敏
+	Body          json.RawMessage   `json:"body,omitempty"`
+	RequestType   string            `json:"request_type"`
+	Model         string            `json:"model"`
+	TokenEstimate int               `json:"token_estimate"`
+	Stream        bool              `json:"stream"`
+	KeyID         string            `json:"key_id,omitempty"`    // 选中密钥的稳定标识
+	KeyError      string            `json:"key_error,omitempty"` // 没有可用密钥时的原因
+}
+
+// isDryRunRequest 判断请求是否处于演练模式，请求头或全局配置任一开启即可
+func isDryRunRequest(c *gin.Context) bool {
+	switch strings.ToLower(strings.TrimSpace(c.GetHeader(dryRunHeader))) {
+	case "1", "true":
+		return true
+	}
+	cfg := config.GetConfig()
+	return cfg != nil && cfg.ApiProxy.DryRun
+}
+
+// isAdminRequest 判断请求是否具有管理权限
+// 配置了管理令牌时需要通过X-FS-Admin-Token传入相同的令牌，未配置时只允许本机请求
+func isAdminRequest(c *gin.Context) bool {
+	cfg := config.GetConfig()
+	if cfg != nil && cfg.ApiProxy.AdminToken != "" {
+		token := c.GetHeader(adminTokenHeader)
+		return subtle.ConstantTimeCompare([]byte(token), []byte(cfg.ApiProxy.AdminToken)) == 1
+	}
+	ip := net.ParseIP(c.ClientIP())
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkDryRunAccess 演练请求需要管理权限，无权限时返回403
+// 返回false表示已写入错误响应
+func checkDryRunAccess(c *gin.Context) bool {
+	if isAdminRequest(c) {
+		return true
+	}
+	RespondOpenAIError(c, http.StatusForbidden, ErrorTypePermission, ErrorCodeAdminRequired,
+		"演练模式需要管理权限")
+	return false
+}
+
+// respondDryRun 选择密钥并返回将要发往上游的请求描述，不访问上游也不记录统计
+// 流式请求同样返回JSON描述而不是SSE流
+func respondDryRun(c *gin.Context, targetURL string, body []byte, requestType, modelName string, tokenEstimate int) {
+	desc := DryRunRequest{
+		DryRun:        true,
+		RequestID:     RequestID(c),
+		Method:        c.Request.Method,
+		URL:           targetURL,
+		Headers:       make(map[string]string),
+		RequestType:   requestType,
+		Model:         modelName,
+		TokenEstimate: tokenEstimate,
+		Stream:        isStreamRequestBody(body),
+	}
+
+	// 与实际转发相同的请求头处理，去掉网关自身使用的请求头
+	for name, values := range c.Request.Header {
+		if isGatewayOnlyHeader(name) || len(values) == 0 {
+			continue
+		}
+		desc.Headers[name] = strings.Join(values, ", ")
+	}
+	desc.Headers["Content-Type"] = "application/json"
+	desc.Headers["Accept-Encoding"] = "identity"
+
+	apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
+	if err != nil {
+		desc.KeyError = err.Error()
+	} else {
+		desc.KeyID = config.KeyID(apiKey)
+		desc.Headers["Authorization"] = "Bearer " + utils.MaskKey(apiKey)
+	}
+
+	if len(body) > 0 {
+		if json.Valid(body) {
+			desc.Body = json.RawMessage(body)
+		} else {
+			quoted, _ := json.Marshal(string(body))
+			desc.Body = json.RawMessage(quoted)
+		}
+	}
+
+	// 流式请求可能已设置event-stream，描述统一使用JSON
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.AbortWithStatusJSON(http.StatusOK, desc)
+}
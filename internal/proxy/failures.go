@@ -0,0 +1,291 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 21:30:00
+  @desc: 最近失败请求的保存与重放，重放结果不计入统计
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxFailedRequests 保留的最近失败请求数
+	maxFailedRequests = 100
+	// maxFailedBodyBytes 保存的请求体上限，超过时只记录失败信息，不能重放
+	maxFailedBodyBytes = 256 * 1024
+	// maxFailureErrorBytes 保存的错误响应长度上限
+	maxFailureErrorBytes = 2048
+	// maxReplayResponseBytes 重放结果中返回的响应长度上限
+	maxReplayResponseBytes = 8 * 1024
+	// lastAttemptKeyKey 上下文中记录最近一次上游尝试所用密钥的键
+	lastAttemptKeyKey = "last_attempt_key"
+	// failuresPathPrefix 失败请求管理接口在/api下的路径前缀
+	failuresPathPrefix = "/failures"
+)
+
+// FailedRequest 一次最终失败的客户端请求
+type FailedRequest struct {
+	ID         string `json:"id"`
+	RequestID  string `json:"request_id"`
+	Time       string `json:"time"`
+	Method     string `json:"method"`
+	Path       string `json:"path"` // 上游路径（含查询参数），重放时使用当前的上游地址
+	Model      string `json:"model,omitempty"`
+	KeyID      string `json:"key_id,omitempty"` // 最近一次尝试所用密钥的稳定标识
+	Stream     bool   `json:"stream"`
+	Status     int    `json:"status"` // 返回给客户端的状态码
+	Error      string `json:"error,omitempty"`
+	BodyBytes  int    `json:"body_bytes"`
+	Replayable bool   `json:"replayable"` // 请求体过大未保存时不能重放
+	body       []byte
+}
+
+// ReplayResult 重放结果
+type ReplayResult struct {
+	KeyID             string `json:"key_id,omitempty"`
+	Status            int    `json:"status"` // 发送失败时为0
+	LatencyMs         int64  `json:"latency_ms"`
+	StreamDowngraded  bool   `json:"stream_downgraded"` // 原请求为流式，重放时改为非流式
+	Response          string `json:"response,omitempty"`
+	ResponseTruncated bool   `json:"response_truncated"`
+	Error             string `json:"error,omitempty"`
+}
+
+var (
+	// failedRequests 最近的失败请求，按时间升序
+	failedRequests []FailedRequest
+	// failedRequestSeq 失败请求编号
+	failedRequestSeq int
+	// failedRequestsMutex 保护以上变量
+	failedRequestsMutex sync.RWMutex
+)
+
+// recordFailedRequest 客户端请求最终失败时保存请求，供管理员查看和重放
+func recordFailedRequest(c *gin.Context, targetURL string, body []byte, modelName string) {
+	if c.GetBool(clientSucceededKey) {
+		return
+	}
+
+	path := targetURL
+	if u, err := url.Parse(targetURL); err == nil {
+		path = u.RequestURI()
+	}
+
+	record := FailedRequest{
+		RequestID:  RequestID(c),
+		Time:       time.Now().Format(time.RFC3339),
+		Method:     c.Request.Method,
+		Path:       path,
+		Model:      modelName,
+		Stream:     isStreamRequestBody(body),
+		Status:     c.Writer.Status(),
+		BodyBytes:  len(body),
+		Replayable: len(body) <= maxFailedBodyBytes,
+	}
+	if apiKey := c.GetString(lastAttemptKeyKey); apiKey != "" {
+		record.KeyID = config.KeyID(apiKey)
+	}
+	if value, ok := c.Get(lastUpstreamErrorKey); ok {
+		switch last := value.(type) {
+		case *upstreamError:
+			record.Error = fmt.Sprintf("上游状态码 %d: %s", last.status, truncateString(string(last.body), maxFailureErrorBytes))
+		case error:
+			record.Error = last.Error()
+		}
+	}
+	if record.Replayable {
+		record.body = append([]byte(nil), body...)
+	}
+
+	failedRequestsMutex.Lock()
+	defer failedRequestsMutex.Unlock()
+	failedRequestSeq++
+	record.ID = fmt.Sprintf("f%d", failedRequestSeq)
+	failedRequests = append(failedRequests, record)
+	if len(failedRequests) > maxFailedRequests {
+		failedRequests = failedRequests[len(failedRequests)-maxFailedRequests:]
+	}
+}
+
+// truncateString 截断字符串，超过上限时去掉不完整的UTF-8字符
+func truncateString(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return strings.ToValidUTF8(s[:limit], "")
+}
+
+// GetFailedRequests 获取最近的失败请求，按时间升序，不含请求体
+func GetFailedRequests() []FailedRequest {
+	failedRequestsMutex.RLock()
+	defer failedRequestsMutex.RUnlock()
+
+	result := make([]FailedRequest, len(failedRequests))
+	copy(result, failedRequests)
+	for i := range result {
+		result[i].body = nil
+	}
+	return result
+}
+
+// getFailedRequest 按编号获取失败请求（含请求体）
+func getFailedRequest(id string) (FailedRequest, bool) {
+	failedRequestsMutex.RLock()
+	defer failedRequestsMutex.RUnlock()
+
+	for _, record := range failedRequests {
+		if record.ID == id {
+			return record, true
+		}
+	}
+	return FailedRequest{}, false
+}
+
+// handleFailuresAdmin 处理/api/failures下的管理接口，返回false表示不是管理接口，继续代理
+// GET /api/failures 列出最近的失败请求
+// POST /api/failures/{id}/replay 重放失败请求，same_key=true时使用原密钥
+func handleFailuresAdmin(c *gin.Context) bool {
+	path := c.Param("path")
+	if path != failuresPathPrefix && !strings.HasPrefix(path, failuresPathPrefix+"/") {
+		return false
+	}
+
+	if !isAdminRequest(c) {
+		RespondOpenAIError(c, http.StatusForbidden, ErrorTypePermission, ErrorCodeAdminRequired,
+			"失败请求管理需要管理权限")
+		return true
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, failuresPathPrefix), "/"), "/")
+	switch {
+	case c.Request.Method == http.MethodGet && len(parts) == 1 && parts[0] == "":
+		c.JSON(http.StatusOK, gin.H{"failures": GetFailedRequests()})
+	case c.Request.Method == http.MethodPost && len(parts) == 2 && parts[1] == "replay":
+		handleReplayFailure(c, parts[0])
+	default:
+		RespondOpenAIError(c, http.StatusNotFound, ErrorTypeInvalidRequest, ErrorCodeFailureNotFound,
+			"未知的失败请求管理接口")
+	}
+	return true
+}
+
+// handleReplayFailure 重放失败请求，返回原请求与重放结果
+func handleReplayFailure(c *gin.Context, id string) {
+	record, ok := getFailedRequest(id)
+	if !ok {
+		RespondOpenAIError(c, http.StatusNotFound, ErrorTypeInvalidRequest, ErrorCodeFailureNotFound,
+			"失败请求不存在或已被清理: "+id)
+		return
+	}
+	if !record.Replayable {
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeRequestTooLarge,
+			"请求体过大未保存，不能重放")
+		return
+	}
+
+	// 重放同样受暂停状态和并发限制约束
+	if !checkProxyPaused(c) {
+		return
+	}
+	release, ok := acquireRequestSlot(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	original := record
+	original.body = nil
+	c.JSON(http.StatusOK, gin.H{
+		"original": original,
+		"replay":   replayFailedRequest(record, c.Query("same_key") == "true"),
+	})
+}
+
+// replayFailedRequest 重新发送保存的请求，流式请求改为非流式
+// 重放不更新密钥状态，也不计入每日统计和上游尝试统计
+func replayFailedRequest(record FailedRequest, sameKey bool) ReplayResult {
+	var result ReplayResult
+
+	body := record.body
+	if record.Stream {
+		var data map[string]interface{}
+		if err := json.Unmarshal(body, &data); err == nil {
+			data["stream"] = false
+			if converted, err := json.Marshal(data); err == nil {
+				body = converted
+				result.StreamDowngraded = true
+			}
+		}
+	}
+
+	var apiKey string
+	if sameKey {
+		if record.KeyID == "" {
+			result.Error = "原请求没有使用密钥"
+			return result
+		}
+		var ok bool
+		if apiKey, ok = config.ResolveKeyID(record.KeyID); !ok {
+			result.Error = "原密钥已不存在"
+			return result
+		}
+	} else {
+		requestType, modelName, tokenEstimate := AnalyzeRequest(record.Path, body)
+		var err error
+		if apiKey, err = key.GetBestKeyForRequest(requestType, modelName, tokenEstimate); err != nil {
+			result.Error = "没有可用的API密钥: " + err.Error()
+			return result
+		}
+	}
+	result.KeyID = config.KeyID(apiKey)
+
+	targetURL := config.GetConfig().ApiProxy.BaseURL + record.Path
+	req, err := http.NewRequest(record.Method, targetURL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Accept-Encoding", "identity")
+
+	start := time.Now()
+	resp, err := utils.CreateClient().Do(req)
+	if err != nil {
+		result.LatencyMs = time.Since(start).Milliseconds()
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxReplayResponseBytes+1))
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.Status = resp.StatusCode
+	if err != nil {
+		result.Error = "读取响应失败: " + err.Error()
+	}
+	if len(respBody) > maxReplayResponseBytes {
+		respBody = respBody[:maxReplayResponseBytes]
+		result.ResponseTruncated = true
+	}
+	result.Response = strings.ToValidUTF8(string(respBody), "")
+
+	logger.Info("已重放失败请求 %s（%s %s），状态码: %d", record.ID, record.Method, record.Path, resp.StatusCode)
+	return result
+}
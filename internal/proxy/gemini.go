@@ -0,0 +1,713 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 01:50:00
+  @desc: Google Gemini API兼容层，将/v1beta/models/{model}:generateContent请求转换为chat/completions转发，响应转换回Gemini格式
+**/
+
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/logger"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gemini接口的方法名
+const (
+	geminiMethodGenerate       = "generateContent"
+	geminiMethodStreamGenerate = "streamGenerateContent"
+	geminiMethodCountTokens    = "countTokens"
+)
+
+// geminiRequest Gemini generateContent的请求
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig"`
+	Tools             []geminiTool            `json:"tools"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig"`
+}
+
+// geminiContent Gemini格式的消息，role为user或model
+type geminiContent struct {
+	Role  string       `json:"role"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiPart Gemini格式消息中的一部分内容
+type geminiPart struct {
+	Text             string                  `json:"text"`
+	Thought          bool                    `json:"thought"`
+	InlineData       *geminiBlob             `json:"inlineData"`
+	FileData         *geminiFileData         `json:"fileData"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse"`
+}
+
+// geminiBlob 内联的图片等二进制数据，data为base64编码
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// geminiFileData 通过URI引用的文件
+type geminiFileData struct {
+	MimeType string `json:"mimeType"`
+	FileURI  string `json:"fileUri"`
+}
+
+// geminiFunctionCall 模型发起的函数调用
+type geminiFunctionCall struct {
+	ID   string          `json:"id"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args"`
+}
+
+// geminiFunctionResponse 函数调用的结果
+type geminiFunctionResponse struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+// geminiGenerationConfig Gemini的生成参数
+type geminiGenerationConfig struct {
+	Temperature      *float64              `json:"temperature"`
+	TopP             *float64              `json:"topP"`
+	TopK             *int                  `json:"topK"`
+	MaxOutputTokens  int                   `json:"maxOutputTokens"`
+	StopSequences    []string              `json:"stopSequences"`
+	ResponseMimeType string                `json:"responseMimeType"`
+	ThinkingConfig   *geminiThinkingConfig `json:"thinkingConfig"`
+}
+
+// geminiThinkingConfig Gemini的思考设置，thinkingBudget为0时关闭思考
+type geminiThinkingConfig struct {
+	ThinkingBudget  *int `json:"thinkingBudget"`
+	IncludeThoughts bool `json:"includeThoughts"`
+}
+
+// geminiTool Gemini格式的工具定义
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// geminiFunctionDeclaration Gemini格式的函数声明
+type geminiFunctionDeclaration struct {
+	Name                 string          `json:"name"`
+	Description          string          `json:"description"`
+	Parameters           json.RawMessage `json:"parameters"`
+	ParametersJSONSchema json.RawMessage `json:"parametersJsonSchema"`
+}
+
+// geminiToolConfig Gemini的函数调用方式
+type geminiToolConfig struct {
+	FunctionCallingConfig *struct {
+		Mode                 string   `json:"mode"`
+		AllowedFunctionNames []string `json:"allowedFunctionNames"`
+	} `json:"functionCallingConfig"`
+}
+
+// includeThoughts 响应中是否需要返回思考内容
+func (r *geminiRequest) includeThoughts() bool {
+	return r.GenerationConfig != nil && r.GenerationConfig.ThinkingConfig != nil &&
+		r.GenerationConfig.ThinkingConfig.IncludeThoughts
+}
+
+// HandleGeminiProxy 处理Gemini格式的请求
+// POST /v1beta/models/{model}:generateContent 生成内容
+// POST /v1beta/models/{model}:streamGenerateContent 流式生成内容，alt=sse时使用SSE，否则返回JSON数组
+// POST /v1beta/models/{model}:countTokens 在本地估算输入令牌数
+func HandleGeminiProxy(c *gin.Context) {
+	model, method, ok := parseGeminiPath(c.Param("path"))
+	if !ok {
+		respondGeminiError(c, http.StatusNotFound, "未知的Gemini接口: "+c.Request.URL.Path)
+		return
+	}
+	if c.Request.Method != http.MethodPost {
+		respondGeminiError(c, http.StatusMethodNotAllowed, "只支持POST请求")
+		return
+	}
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		logger.Error("读取请求体失败: %v", err)
+		respondGeminiError(c, http.StatusBadRequest, "无法读取请求体")
+		return
+	}
+
+	var req geminiRequest
+	if err := json.Unmarshal(bodyBytes, &req); err != nil {
+		respondGeminiError(c, http.StatusBadRequest, "无法解析请求体: "+err.Error())
+		return
+	}
+	if len(req.Contents) == 0 {
+		respondGeminiError(c, http.StatusBadRequest, "contents is not specified")
+		return
+	}
+
+	messages, err := convertGeminiContents(&req)
+	if err != nil {
+		respondGeminiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 计算输入令牌数只在本地估算，不请求上游
+	inputTokens := estimateChatInputTokens(messages, req.Tools)
+	if method == geminiMethodCountTokens {
+		c.JSON(http.StatusOK, gin.H{"totalTokens": inputTokens})
+		return
+	}
+
+	stream := method == geminiMethodStreamGenerate
+	transformedBody, err := json.Marshal(buildGeminiChatRequest(&req, model, messages, stream))
+	if err != nil {
+		logger.Error("转换Gemini请求失败: %v", err)
+		respondGeminiError(c, http.StatusInternalServerError, "无法转换请求体")
+		return
+	}
+
+	// 按chat/completions请求继续处理，查询参数中的密钥不再保留
+	sse := c.Query("alt") == "sse"
+	useGeminiAuthHeader(c)
+	c.Request.URL.RawQuery = ""
+	rewriteAsChatCompletions(c, transformedBody)
+
+	// 演练模式直接返回转换后的请求描述
+	if isDryRunRequest(c) {
+		HandleOpenAIProxy(c)
+		return
+	}
+
+	writer := newChatConvertWriter(c.Writer, stream, func(write func([]byte)) chatResponseConverter {
+		return newGeminiConverter(model, req.includeThoughts(), sse, inputTokens, write)
+	})
+	c.Writer = writer
+	HandleOpenAIProxy(c)
+	writer.finish(c)
+}
+
+// parseGeminiPath 从/models/{model}:{method}中解析模型和方法，模型名可以包含斜杠
+func parseGeminiPath(path string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(path, "/models/")
+	if !ok {
+		return "", "", false
+	}
+	sep := strings.LastIndex(rest, ":")
+	if sep <= 0 {
+		return "", "", false
+	}
+	model, method := rest[:sep], rest[sep+1:]
+	switch method {
+	case geminiMethodGenerate, geminiMethodStreamGenerate, geminiMethodCountTokens:
+		return model, method, true
+	}
+	return "", "", false
+}
+
+// useGeminiAuthHeader Gemini客户端通过x-goog-api-key或key查询参数传入密钥，转换为Authorization以便校验虚拟密钥
+func useGeminiAuthHeader(c *gin.Context) {
+	apiKey := c.GetHeader("x-goog-api-key")
+	if apiKey == "" {
+		apiKey = c.Query("key")
+	}
+	if apiKey != "" && c.GetHeader("Authorization") == "" {
+		c.Request.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	c.Request.Header.Del("x-goog-api-key")
+	c.Request.Header.Del("x-goog-api-client")
+}
+
+// buildGeminiChatRequest 构建转换后的chat/completions请求体
+func buildGeminiChatRequest(req *geminiRequest, model string, messages []openAIChatMessage, stream bool) map[string]interface{} {
+	body := map[string]interface{}{
+		"model":    model,
+		"messages": messages,
+		"stream":   stream,
+	}
+
+	if cfg := req.GenerationConfig; cfg != nil {
+		if cfg.Temperature != nil {
+			body["temperature"] = *cfg.Temperature
+		}
+		if cfg.TopP != nil {
+			body["top_p"] = *cfg.TopP
+		}
+		if cfg.TopK != nil {
+			body["top_k"] = *cfg.TopK
+		}
+		if cfg.MaxOutputTokens > 0 {
+			body["max_tokens"] = cfg.MaxOutputTokens
+		}
+		if len(cfg.StopSequences) > 0 {
+			body["stop"] = cfg.StopSequences
+		}
+		if cfg.ResponseMimeType == "application/json" {
+			body["response_format"] = map[string]string{"type": "json_object"}
+		}
+		// 思考预算对应硅基流动的enable_thinking和thinking_budget参数
+		if cfg.ThinkingConfig != nil && cfg.ThinkingConfig.ThinkingBudget != nil {
+			budget := *cfg.ThinkingConfig.ThinkingBudget
+			body["enable_thinking"] = budget != 0
+			if budget > 0 {
+				body["thinking_budget"] = budget
+			}
+		}
+	}
+
+	var tools []map[string]interface{}
+	for _, tool := range req.Tools {
+		for _, decl := range tool.FunctionDeclarations {
+			function := map[string]interface{}{
+				"name":        decl.Name,
+				"description": decl.Description,
+			}
+			if len(decl.ParametersJSONSchema) > 0 {
+				function["parameters"] = decl.ParametersJSONSchema
+			} else if len(decl.Parameters) > 0 {
+				function["parameters"] = normalizeGeminiSchema(decl.Parameters)
+			}
+			tools = append(tools, map[string]interface{}{"type": "function", "function": function})
+		}
+	}
+	if len(tools) > 0 {
+		body["tools"] = tools
+	}
+
+	if req.ToolConfig != nil && req.ToolConfig.FunctionCallingConfig != nil {
+		callCfg := req.ToolConfig.FunctionCallingConfig
+		switch strings.ToUpper(callCfg.Mode) {
+		case "AUTO":
+			body["tool_choice"] = "auto"
+		case "NONE":
+			body["tool_choice"] = "none"
+		case "ANY":
+			body["tool_choice"] = "required"
+			if len(callCfg.AllowedFunctionNames) == 1 {
+				body["tool_choice"] = map[string]interface{}{
+					"type":     "function",
+					"function": map[string]string{"name": callCfg.AllowedFunctionNames[0]},
+				}
+			}
+		}
+	}
+
+	return body
+}
+
+// normalizeGeminiSchema Gemini的参数schema中类型使用大写（如OBJECT），转换为JSON Schema的小写类型
+func normalizeGeminiSchema(raw json.RawMessage) interface{} {
+	var schema interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return raw
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			for k, child := range node {
+				if s, ok := child.(string); ok && k == "type" {
+					node[k] = strings.ToLower(s)
+					continue
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range node {
+				walk(child)
+			}
+		}
+	}
+	walk(schema)
+	return schema
+}
+
+// convertGeminiContents 将systemInstruction和contents转换为OpenAI格式的消息列表
+// functionResponse转换为role为tool的消息，没有id时按函数名对应之前的functionCall
+func convertGeminiContents(req *geminiRequest) ([]openAIChatMessage, error) {
+	var messages []openAIChatMessage
+
+	if req.SystemInstruction != nil {
+		if system := joinGeminiText(req.SystemInstruction.Parts); system != "" {
+			messages = append(messages, openAIChatMessage{Role: "system", Content: system})
+		}
+	}
+
+	pendingCalls := make(map[string][]string)
+	callCount := 0
+	for i, content := range req.Contents {
+		role := "user"
+		switch content.Role {
+		case "", "user", "function", "tool":
+		case "model":
+			role = "assistant"
+		default:
+			return nil, errors.New("contents[" + strconv.Itoa(i) + "].role: 只支持user和model")
+		}
+
+		var parts []map[string]interface{}
+		var toolCalls []openAIToolCall
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				id := part.FunctionCall.ID
+				if id == "" {
+					callCount++
+					id = "call_" + strconv.Itoa(callCount)
+				}
+				arguments := "{}"
+				if len(part.FunctionCall.Args) > 0 && string(part.FunctionCall.Args) != "null" {
+					arguments = string(part.FunctionCall.Args)
+				}
+				pendingCalls[part.FunctionCall.Name] = append(pendingCalls[part.FunctionCall.Name], id)
+				toolCalls = append(toolCalls, openAIToolCall{
+					ID:       id,
+					Type:     "function",
+					Function: openAIFunctionCall{Name: part.FunctionCall.Name, Arguments: arguments},
+				})
+			case part.FunctionResponse != nil:
+				id := part.FunctionResponse.ID
+				if queue := pendingCalls[part.FunctionResponse.Name]; id == "" && len(queue) > 0 {
+					id = queue[0]
+					pendingCalls[part.FunctionResponse.Name] = queue[1:]
+				}
+				result := "{}"
+				if len(part.FunctionResponse.Response) > 0 {
+					result = string(part.FunctionResponse.Response)
+				}
+				messages = append(messages, openAIChatMessage{Role: "tool", Content: result, ToolCallID: id})
+			case part.InlineData != nil:
+				parts = append(parts, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]string{"url": "data:" + part.InlineData.MimeType + ";base64," + part.InlineData.Data},
+				})
+			case part.FileData != nil:
+				parts = append(parts, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]string{"url": part.FileData.FileURI},
+				})
+			case part.Thought:
+				// 历史消息中的思考内容上游无法使用，直接忽略
+			case part.Text != "":
+				parts = append(parts, map[string]interface{}{"type": "text", "text": part.Text})
+			}
+		}
+
+		if len(parts) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		converted := openAIChatMessage{Role: role, ToolCalls: toolCalls}
+		if len(parts) > 0 {
+			converted.Content = simplifyContentParts(parts)
+		}
+		messages = append(messages, converted)
+	}
+
+	return messages, nil
+}
+
+// joinGeminiText 拼接各部分中的文本
+func joinGeminiText(parts []geminiPart) string {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Text != "" && !part.Thought {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// respondGeminiError 以Gemini错误格式返回错误并中止请求
+func respondGeminiError(c *gin.Context, status int, message string) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.AbortWithStatusJSON(status, geminiErrorPayload(status, message))
+}
+
+// geminiErrorPayload 构建Gemini格式的错误内容
+func geminiErrorPayload(status int, message string) gin.H {
+	return gin.H{
+		"error": gin.H{
+			"code":    status,
+			"message": scrubSecrets(message),
+			"status":  geminiErrorStatus(status),
+		},
+	}
+}
+
+// geminiErrorStatus 根据状态码确定Gemini错误状态
+func geminiErrorStatus(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case status == http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case status == http.StatusNotFound:
+		return "NOT_FOUND"
+	case status == http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case status == http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case status == http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	case status >= 400 && status < 500:
+		return "INVALID_ARGUMENT"
+	default:
+		return "INTERNAL"
+	}
+}
+
+// geminiToolCall 正在生成的函数调用
+type geminiToolCall struct {
+	id   string
+	name string
+	args strings.Builder
+}
+
+// geminiConverter 将chat/completions的响应转换为Gemini的GenerateContentResponse
+// 流式时文本增量逐个写出，函数调用参数拼接完整后在最后一个响应中写出
+type geminiConverter struct {
+	model           string
+	includeThoughts bool
+	sse             bool
+	write           func([]byte)
+	responseID      string
+	started         bool
+	finished        bool
+	written         int
+	thought         strings.Builder
+	text            strings.Builder
+	toolCalls       map[int]*geminiToolCall
+	toolOrder       []int
+	finishReason    string
+	promptTokens    int
+	outputTokens    int
+}
+
+// newGeminiConverter 创建响应转换器，sse为false时流式响应以JSON数组返回，write为nil时不输出流式响应
+func newGeminiConverter(model string, includeThoughts, sse bool, inputTokens int, write func([]byte)) *geminiConverter {
+	return &geminiConverter{
+		model:           model,
+		includeThoughts: includeThoughts,
+		sse:             sse,
+		write:           write,
+		toolCalls:       make(map[int]*geminiToolCall),
+		promptTokens:    inputTokens,
+	}
+}
+
+// streamContentType alt=sse时使用SSE，否则为JSON数组
+func (g *geminiConverter) streamContentType() string {
+	if g.sse {
+		return "text/event-stream"
+	}
+	return "application/json"
+}
+
+// comment SSE时原样写出注释，JSON数组中不能插入注释
+func (g *geminiConverter) comment(line []byte) {
+	if g.write != nil && g.sse {
+		g.write(append(line, '\n', '\n'))
+	}
+}
+
+// hasStarted 是否已处理过响应内容
+func (g *geminiConverter) hasStarted() bool {
+	return g.started
+}
+
+// add 处理一个非流式响应或流式事件
+func (g *geminiConverter) add(chunk *openAIChatChunk) {
+	if g.finished {
+		return
+	}
+	g.started = true
+	if g.responseID == "" {
+		g.responseID = chunk.ID
+	}
+
+	var parts []gin.H
+	for _, choice := range chunk.Choices {
+		delta := choice.Delta
+		if delta == nil {
+			delta = choice.Message
+		}
+		if delta != nil {
+			if g.includeThoughts && delta.ReasoningContent != "" {
+				g.thought.WriteString(delta.ReasoningContent)
+				parts = append(parts, gin.H{"text": delta.ReasoningContent, "thought": true})
+			}
+			if delta.Content != "" {
+				g.text.WriteString(delta.Content)
+				parts = append(parts, gin.H{"text": delta.Content})
+			}
+			for i, call := range delta.ToolCalls {
+				index := call.Index
+				if choice.Message != nil {
+					index = i
+				}
+				g.appendToolCall(index, call.ID, call.Function.Name, call.Function.Arguments)
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			g.finishReason = geminiFinishReason(*choice.FinishReason)
+		}
+	}
+
+	if chunk.Usage != nil {
+		if chunk.Usage.PromptTokens > 0 {
+			g.promptTokens = chunk.Usage.PromptTokens
+		}
+		g.outputTokens = chunk.Usage.CompletionTokens
+	}
+
+	if g.write != nil && len(parts) > 0 {
+		g.emit(g.buildResponse(parts, ""))
+	}
+}
+
+// appendToolCall 追加函数调用，参数按片段拼接
+func (g *geminiConverter) appendToolCall(index int, id, name, arguments string) {
+	call, ok := g.toolCalls[index]
+	if !ok {
+		call = &geminiToolCall{id: id, name: name}
+		g.toolCalls[index] = call
+		g.toolOrder = append(g.toolOrder, index)
+	}
+	if call.name == "" {
+		call.name = name
+	}
+	call.args.WriteString(arguments)
+}
+
+// functionCallParts 将拼接完整的函数调用转换为functionCall
+func (g *geminiConverter) functionCallParts() []gin.H {
+	parts := make([]gin.H, 0, len(g.toolOrder))
+	for _, index := range g.toolOrder {
+		call := g.toolCalls[index]
+		args := json.RawMessage(call.args.String())
+		if len(args) == 0 || !json.Valid(args) {
+			args = json.RawMessage("{}")
+		}
+		functionCall := gin.H{"name": call.name, "args": args}
+		if call.id != "" {
+			functionCall["id"] = call.id
+		}
+		parts = append(parts, gin.H{"functionCall": functionCall})
+	}
+	return parts
+}
+
+// buildResponse 构建GenerateContentResponse，finishReason为空表示尚未结束
+func (g *geminiConverter) buildResponse(parts []gin.H, finishReason string) gin.H {
+	if len(parts) == 0 {
+		parts = []gin.H{{"text": ""}}
+	}
+	candidate := gin.H{
+		"content": gin.H{"role": "model", "parts": parts},
+		"index":   0,
+	}
+	if finishReason != "" {
+		candidate["finishReason"] = finishReason
+	}
+	response := gin.H{
+		"candidates":   []gin.H{candidate},
+		"modelVersion": g.model,
+		"usageMetadata": gin.H{
+			"promptTokenCount":     g.promptTokens,
+			"candidatesTokenCount": g.outputTokens,
+			"totalTokenCount":      g.promptTokens + g.outputTokens,
+		},
+	}
+	if g.responseID != "" {
+		response["responseId"] = g.responseID
+	}
+	return response
+}
+
+// emit 写出一个流式响应，SSE为一个data事件，否则为JSON数组中的一个元素
+func (g *geminiConverter) emit(data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logger.Error("序列化Gemini流式响应失败: %v", err)
+		return
+	}
+	switch {
+	case g.sse:
+		g.write([]byte("data: " + string(payload) + "\r\n\r\n"))
+	case g.written == 0:
+		g.write(append([]byte("["), payload...))
+	default:
+		g.write(append([]byte(",\r\n"), payload...))
+	}
+	g.written++
+}
+
+// streamError 将流式响应中的错误转换为Gemini格式的错误并结束响应
+func (g *geminiConverter) streamError(body *OpenAIErrorBody) {
+	if g.finished {
+		return
+	}
+	g.finished = true
+	if g.write == nil {
+		return
+	}
+	g.emit(geminiErrorPayload(http.StatusInternalServerError, body.Message))
+	if !g.sse {
+		g.write([]byte("]"))
+	}
+}
+
+// finish 结束流式响应，写出包含函数调用、结束原因和用量的最后一个响应
+func (g *geminiConverter) finish() {
+	if g.finished {
+		return
+	}
+	g.finished = true
+	if g.finishReason == "" {
+		g.finishReason = "STOP"
+	}
+	if g.write == nil {
+		return
+	}
+	g.emit(g.buildResponse(g.functionCallParts(), g.finishReason))
+	if !g.sse {
+		g.write([]byte("]"))
+	}
+}
+
+// response 返回完整的非流式响应
+func (g *geminiConverter) response() interface{} {
+	g.finish()
+	var parts []gin.H
+	if g.thought.Len() > 0 {
+		parts = append(parts, gin.H{"text": g.thought.String(), "thought": true})
+	}
+	if g.text.Len() > 0 {
+		parts = append(parts, gin.H{"text": g.text.String()})
+	}
+	parts = append(parts, g.functionCallParts()...)
+	return g.buildResponse(parts, g.finishReason)
+}
+
+// errorResponse 返回Gemini格式的错误
+func (g *geminiConverter) errorResponse(c *gin.Context, status int, message string) interface{} {
+	return geminiErrorPayload(status, message)
+}
+
+// geminiFinishReason 将OpenAI的finish_reason转换为Gemini的finishReason
+func geminiFinishReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
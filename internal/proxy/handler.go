@@ -11,6 +11,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/key"
 	"flowsilicon/internal/logger"
@@ -19,6 +20,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -35,6 +37,39 @@ func HandleApiProxy(c *gin.Context) {
 		return
 	}
 
+	// 失败请求的查看与重放接口
+	if handleFailuresAdmin(c) {
+		return
+	}
+
+	// 密钥的增删改查接口
+	if handleKeysAdmin(c) {
+		return
+	}
+
+	// 虚拟密钥的管理接口
+	if handleVirtualKeysAdmin(c) {
+		return
+	}
+
+	// 演练模式需要管理权限
+	dryRun := isDryRunRequest(c)
+	if dryRun && !checkDryRunAccess(c) {
+		return
+	}
+
+	// 校验虚拟密钥，暂停时拒绝请求，再按优先级获取并发名额，未配置并发上限时不排队
+	if !dryRun {
+		if !checkVirtualKey(c) || !checkProxyPaused(c) {
+			return
+		}
+		release, ok := acquireRequestSlot(c)
+		if !ok {
+			return
+		}
+		defer release()
+	}
+
 	// 获取配置
 	cfg := config.GetConfig()
 	baseURL := cfg.ApiProxy.BaseURL
@@ -44,35 +79,48 @@ func HandleApiProxy(c *gin.Context) {
 
 	// 构建目标 URL
 	targetURL := fmt.Sprintf("%s%s", baseURL, path)
+	c.Set(statsEndpointKey, path)
 
 	// 读取请求体
 	bodyBytes, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to read request body: %v", err),
-		})
+		logger.Error("读取请求体失败: %v", err)
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidBody, "无法读取请求体")
 		return
 	}
 
 	// 分析请求类型和估计token数量
 	requestType, modelName, tokenEstimate := AnalyzeRequest(path, bodyBytes)
 
-	// 检查模型是否被禁用
+	// 检查模型是否被禁用，以及虚拟密钥是否允许使用该模型
 	if modelName != "" && isModelDisabled(modelName) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": map[string]interface{}{
-				"message": fmt.Sprintf("模型 %s 已被禁用", modelName),
-				"type":    "invalid_request_error",
-				"code":    403,
-			},
-		})
+		respondModelDisabled(c, modelName)
+		return
+	}
+	if !checkVirtualKeyModel(c, modelName) {
 		return
 	}
 
+	// 演练模式只返回请求描述
+	if dryRun {
+		respondDryRun(c, targetURL, bodyBytes, requestType, modelName, tokenEstimate)
+		return
+	}
+
+	// 附加密钥池状态头
+	setPoolHeaders(c)
+
 	// 调用处理请求的函数，包含重试逻辑
 	handleApiProxyWithRetry(c, targetURL, bodyBytes, requestType, modelName, tokenEstimate)
 }
 
+// isGatewayOnlyHeader 判断请求头是否只供网关使用、不应转发到上游
+// Host和Authorization由网关重新设置，X-FS-开头的请求头（管理令牌、优先级、试运行等）只在网关内使用
+func isGatewayOnlyHeader(name string) bool {
+	lower := strings.ToLower(name)
+	return lower == "host" || lower == "authorization" || strings.HasPrefix(lower, "x-fs-")
+}
+
 // isModelDisabled 检查模型是否被禁用
 func isModelDisabled(modelName string) bool {
 	cfg := config.GetConfig()
@@ -88,15 +136,31 @@ func isModelDisabled(modelName string) bool {
 	return false
 }
 
+// isStreamRequestBody 根据请求体中的stream字段判断是否为流式请求
+func isStreamRequestBody(body []byte) bool {
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return false
+	}
+	stream, ok := requestData["stream"].(bool)
+	return ok && stream
+}
+
 // 添加带重试逻辑的API代理处理函数
 func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte, requestType string, modelName string, tokenEstimate int) {
+	// 请求结束时记录客户端视角的结果，最终失败时保存请求供重放
+	defer recordClientOutcome(c)
+	defer recordFailedRequest(c, targetURL, bodyBytes, modelName)
+
 	// 获取配置
 	cfg := config.GetConfig()
 	retryConfig := cfg.ApiProxy.Retry
 
 	// 如果最大重试次数为0，直接处理一次请求
 	if retryConfig.MaxRetries <= 0 {
-		processApiRequest(c, targetURL, bodyBytes, requestType, modelName, tokenEstimate)
+		if ok, _ := processApiRequest(c, targetURL, bodyBytes, requestType, modelName, tokenEstimate); !ok {
+			respondUpstreamFailure(c)
+		}
 		return
 	}
 
@@ -107,8 +171,14 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 		return
 	}
 
+	// 已经返回错误响应（如没有可用密钥）时不再重试
+	if c.IsAborted() {
+		return
+	}
+
 	// 检查是否需要重试
 	if !shouldRetry(err, retryConfig) {
+		respondUpstreamFailure(c)
 		return
 	}
 
@@ -125,9 +195,7 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 		// 获取另一个API密钥进行重试
 		apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "No suitable API keys available for retry",
-			})
+			respondNoAvailableKeys(c, "No suitable API keys available for retry")
 			return
 		}
 
@@ -138,16 +206,15 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 		// 创建新的请求
 		req, err := http.NewRequest(c.Request.Method, targetURL, bytes.NewBuffer(bodyBytes))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("Failed to create request for retry: %v", err),
-			})
+			logger.Error("创建上游请求失败: %v", err)
+			respondInternalError(c, "创建上游请求失败")
 			return
 		}
 
 		// 复制原始请求的 headers
 		for name, values := range c.Request.Header {
 			// 跳过一些特定的 headers
-			if strings.ToLower(name) == "host" || strings.ToLower(name) == "authorization" {
+			if isGatewayOnlyHeader(name) {
 				continue
 			}
 			for _, value := range values {
@@ -165,8 +232,11 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 		client := utils.CreateClient()
 
 		// 发送请求
+		requestStart := time.Now()
 		resp, err := client.Do(req)
 		if err != nil {
+			recordUpstreamAttempt(c, apiKey, 0, err)
+			rememberSendError(c, err)
 			// 更新密钥失败记录
 			key.UpdateApiKeyStatus(apiKey, false)
 
@@ -182,6 +252,8 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 		// 读取响应体
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
+			recordUpstreamAttempt(c, apiKey, resp.StatusCode, err)
+			rememberReadError(c, err)
 			// 更新密钥失败记录
 			key.UpdateApiKeyStatus(apiKey, false)
 			continue
@@ -189,6 +261,7 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 
 		// 检查响应状态码
 		success := resp.StatusCode >= 200 && resp.StatusCode < 300
+		recordUpstreamAttempt(c, apiKey, resp.StatusCode, nil)
 
 		// 更新密钥状态
 		key.UpdateApiKeyStatus(apiKey, success)
@@ -204,7 +277,24 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 			promptTokensCount = tokenCount / 2
 			completionTokensCount = tokenCount - promptTokensCount
 		}
-		config.AddDailyRequestStat(apiKey, modelNameForStats, 1, promptTokensCount, completionTokensCount, success)
+		config.AddDailyRequestRecord(config.DailyRequestRecord{
+			ApiKey:           apiKey,
+			Model:            modelNameForStats,
+			RequestCount:     1,
+			PromptTokens:     promptTokensCount,
+			CompletionTokens: completionTokensCount,
+			IsSuccess:        success,
+			IsStream:         isStreamRequestBody(bodyBytes),
+			LatencyMs:        time.Since(requestStart).Milliseconds(),
+			Endpoint:         c.GetString(statsEndpointKey),
+			VirtualKey:       c.GetString(virtualKeyContextKey),
+		})
+
+		// 失败的响应留待重试结束后返回，避免多次写入响应
+		if !success {
+			rememberUpstreamError(c, resp, respBody)
+			continue
+		}
 
 		// 复制响应 headers
 		for name, values := range resp.Header {
@@ -218,17 +308,11 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 
 		// 写入响应体
 		c.Writer.Write(respBody)
-
-		// 如果请求成功，返回
-		if success {
-			return
-		}
+		return
 	}
 
 	// 所有重试都失败，返回错误
-	c.JSON(http.StatusInternalServerError, gin.H{
-		"error": "All retry attempts failed",
-	})
+	respondUpstreamFailure(c)
 }
 
 // 处理API请求，返回是否成功处理和可能的错误
@@ -244,25 +328,22 @@ func processApiRequest(c *gin.Context, targetURL string, bodyBytes []byte, reque
 	// 根据请求类型选择最佳的API密钥
 	apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "No suitable API keys available",
-		})
+		rejectNoAvailableKeys(c, "No suitable API keys available")
 		return false, err
 	}
 
 	// 创建新的请求
 	req, err := http.NewRequest(c.Request.Method, targetURL, bytes.NewBuffer(bodyBytes))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to create request: %v", err),
-		})
+		logger.Error("创建上游请求失败: %v", err)
+		respondInternalError(c, "创建上游请求失败")
 		return false, err
 	}
 
 	// 复制原始请求的 headers
 	for name, values := range c.Request.Header {
 		// 跳过一些特定的 headers
-		if strings.ToLower(name) == "host" || strings.ToLower(name) == "authorization" {
+		if isGatewayOnlyHeader(name) {
 			continue
 		}
 		for _, value := range values {
@@ -280,9 +361,12 @@ func processApiRequest(c *gin.Context, targetURL string, bodyBytes []byte, reque
 	client := utils.CreateClient()
 
 	// 发送请求
+	requestStart := time.Now()
 	resp, err := client.Do(req)
 
 	if err != nil {
+		recordUpstreamAttempt(c, apiKey, 0, err)
+		rememberSendError(c, err)
 		// 更新密钥失败记录
 		key.UpdateApiKeyStatus(apiKey, false)
 		return false, err
@@ -296,22 +380,32 @@ func processApiRequest(c *gin.Context, targetURL string, bodyBytes []byte, reque
 	// 读取响应体
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
+		recordUpstreamAttempt(c, apiKey, resp.StatusCode, err)
+		rememberReadError(c, err)
 		// 更新密钥失败记录
 		key.UpdateApiKeyStatus(apiKey, false)
 
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to read response body: %v", err),
-		})
+		logger.Error("读取上游响应失败: %v", err)
 		return false, err
 	}
 
 	// 检查响应状态码
 	success := resp.StatusCode >= 200 && resp.StatusCode < 300
+	recordUpstreamAttempt(c, apiKey, resp.StatusCode, nil)
+
+	// 按配置将非流式请求镜像到备用上游，不影响主请求
+	if !isStreamRequestBody(bodyBytes) {
+		mirrorRequest(c.Request, targetURL, bodyBytes, modelName, success, time.Since(requestStart), respBody)
+	}
 
 	// 如果请求失败，返回错误
 	if !success {
+		rememberUpstreamError(c, resp, respBody)
 		// 更新密钥失败记录
 		key.UpdateApiKeyStatus(apiKey, false)
+		if isKeyCooldownStatus(resp.StatusCode) {
+			return false, fmt.Errorf("API请求失败，状态码: %d: %w", resp.StatusCode, errKeyCoolingDown)
+		}
 		return false, fmt.Errorf("API请求失败，状态码: %d", resp.StatusCode)
 	}
 
@@ -333,7 +427,18 @@ func processApiRequest(c *gin.Context, targetURL string, bodyBytes []byte, reque
 		completionTokensCount = tokenCount - promptTokensCount
 	}
 	// 添加到每日统计
-	config.AddDailyRequestStat(apiKey, modelNameForStats, 1, promptTokensCount, completionTokensCount, success)
+	config.AddDailyRequestRecord(config.DailyRequestRecord{
+		ApiKey:           apiKey,
+		Model:            modelNameForStats,
+		RequestCount:     1,
+		PromptTokens:     promptTokensCount,
+		CompletionTokens: completionTokensCount,
+		IsSuccess:        success,
+		IsStream:         isStreamRequestBody(bodyBytes),
+		LatencyMs:        time.Since(requestStart).Milliseconds(),
+		Endpoint:         c.GetString(statsEndpointKey),
+		VirtualKey:       c.GetString(virtualKeyContextKey),
+	})
 
 	// 复制响应 headers
 	for name, values := range resp.Header {
@@ -360,8 +465,31 @@ func HandleOpenAIProxy(c *gin.Context) {
 		return
 	}
 
-	// 对于流式请求，设置较长的超时时间
-	if strings.Contains(c.Request.URL.Path, "/chat/completions") || strings.Contains(c.Request.URL.Path, "/completions") {
+	// Anthropic Messages API格式的请求转换后重新进入本函数
+	if handleAnthropicMessages(c) {
+		return
+	}
+
+	// 演练模式需要管理权限
+	dryRun := isDryRunRequest(c)
+	if dryRun && !checkDryRunAccess(c) {
+		return
+	}
+
+	// 校验虚拟密钥，暂停时拒绝请求，再按优先级获取并发名额，未配置并发上限时不排队
+	if !dryRun {
+		if !checkVirtualKey(c) || !checkProxyPaused(c) {
+			return
+		}
+		release, ok := acquireRequestSlot(c)
+		if !ok {
+			return
+		}
+		defer release()
+	}
+
+	// 对于流式请求，设置较长的超时时间（演练模式不会建立流式连接）
+	if !dryRun && (strings.Contains(c.Request.URL.Path, "/chat/completions") || strings.Contains(c.Request.URL.Path, "/completions")) {
 		// 检查是否可能是流式请求
 		var requestData map[string]interface{}
 		bodyBytes, _ := io.ReadAll(c.Request.Body)
@@ -407,13 +535,7 @@ func HandleOpenAIProxy(c *gin.Context) {
 
 			// 检查模型是否被禁用
 			if model, ok := requestData["model"].(string); ok && isModelDisabled(model) {
-				c.JSON(http.StatusForbidden, gin.H{
-					"error": map[string]interface{}{
-						"message": fmt.Sprintf("模型 %s 已被禁用", model),
-						"type":    "invalid_request_error",
-						"code":    403,
-					},
-				})
+				respondModelDisabled(c, model)
 				return
 			}
 		}
@@ -447,6 +569,13 @@ func HandleOpenAIProxy(c *gin.Context) {
 		targetURL = fmt.Sprintf("%s/v1%s", baseURL, path)
 		logger.Info("检测到标准版本号路径请求: %s，转发到: %s", "/v1"+path, targetURL)
 	}
+	c.Set(statsEndpointKey, strings.TrimPrefix(targetURL, baseURL))
+
+	// 演练模式下模型列表和用户信息请求同样只返回请求描述
+	if dryRun && (strings.HasSuffix(fullPath, "/models") || strings.HasSuffix(fullPath, "/user/info")) {
+		respondDryRun(c, targetURL, nil, "", "", 0)
+		return
+	}
 
 	// 如果是 /models 请求，使用特殊处理
 	if strings.HasSuffix(fullPath, "/models") {
@@ -467,22 +596,15 @@ func HandleOpenAIProxy(c *gin.Context) {
 	// 读取请求体
 	bodyBytes, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to read request body: %v", err),
-		})
+		logger.Error("读取请求体失败: %v", err)
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidBody, "无法读取请求体")
 		return
 	}
 
 	// 检查请求体是否为空或者无效JSON，除了GET请求
 	if c.Request.Method != http.MethodGet && (len(bodyBytes) == 0 || !json.Valid(bodyBytes)) {
 		// 仅当不是GET请求时才进行此检查
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": map[string]interface{}{
-				"message": "Request body is empty or invalid JSON",
-				"type":    "invalid_request_error",
-				"code":    400,
-			},
-		})
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidBody, "Request body is empty or invalid JSON")
 		return
 	}
 
@@ -491,13 +613,7 @@ func HandleOpenAIProxy(c *gin.Context) {
 		var requestData map[string]interface{}
 		if err := json.Unmarshal(bodyBytes, &requestData); err == nil {
 			if model, ok := requestData["model"].(string); ok && isModelDisabled(model) {
-				c.JSON(http.StatusForbidden, gin.H{
-					"error": map[string]interface{}{
-						"message": fmt.Sprintf("模型 %s 已被禁用", model),
-						"type":    "invalid_request_error",
-						"code":    403,
-					},
-				})
+				respondModelDisabled(c, model)
 				return
 			}
 		}
@@ -509,25 +625,13 @@ func HandleOpenAIProxy(c *gin.Context) {
 		if err := json.Unmarshal(bodyBytes, &requestData); err == nil {
 			// 检查是否存在messages字段
 			if messages, hasMessages := requestData["messages"]; !hasMessages {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": map[string]interface{}{
-						"message": "Message field is required for chat completions requests",
-						"type":    "invalid_request_error",
-						"code":    400,
-					},
-				})
+				RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeMissingField, "Message field is required for chat completions requests")
 				return
 			} else {
 				// 确保messages是一个数组
 				messagesArray, isArray := messages.([]interface{})
 				if !isArray || len(messagesArray) == 0 {
-					c.JSON(http.StatusBadRequest, gin.H{
-						"error": map[string]interface{}{
-							"message": "Messages must be a non-empty array",
-							"type":    "invalid_request_error",
-							"code":    400,
-						},
-					})
+					RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeMissingField, "Messages must be a non-empty array")
 					return
 				}
 			}
@@ -540,13 +644,7 @@ func HandleOpenAIProxy(c *gin.Context) {
 		if err := json.Unmarshal(bodyBytes, &requestData); err == nil {
 			// 检查是否存在prompt字段
 			if _, hasPrompt := requestData["prompt"]; !hasPrompt {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": map[string]interface{}{
-						"message": "Prompt field is required for completions requests",
-						"type":    "invalid_request_error",
-						"code":    400,
-					},
-				})
+				RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeMissingField, "Prompt field is required for completions requests")
 				return
 			}
 		}
@@ -560,13 +658,7 @@ func HandleOpenAIProxy(c *gin.Context) {
 			_, hasInput := requestData["input"]
 			_, hasModel := requestData["model"]
 			if !hasInput || !hasModel {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": map[string]interface{}{
-						"message": "Input field is required for embeddings requests",
-						"type":    "invalid_request_error",
-						"code":    400,
-					},
-				})
+				RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeMissingField, "Input field is required for embeddings requests")
 				return
 			}
 		}
@@ -578,24 +670,12 @@ func HandleOpenAIProxy(c *gin.Context) {
 		if err := json.Unmarshal(bodyBytes, &requestData); err == nil {
 			// 检查是否存在query字段
 			if _, hasQuery := requestData["query"]; !hasQuery {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": map[string]interface{}{
-						"message": "Query field is required for rerank requests",
-						"type":    "invalid_request_error",
-						"code":    400,
-					},
-				})
+				RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeMissingField, "Query field is required for rerank requests")
 				return
 			}
 			// 检查是否存在documents字段
 			if _, hasDocuments := requestData["documents"]; !hasDocuments {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": map[string]interface{}{
-						"message": "Documents field is required for rerank requests",
-						"type":    "invalid_request_error",
-						"code":    400,
-					},
-				})
+				RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeMissingField, "Documents field is required for rerank requests")
 				return
 			}
 		}
@@ -607,13 +687,7 @@ func HandleOpenAIProxy(c *gin.Context) {
 		if err := json.Unmarshal(bodyBytes, &requestData); err == nil {
 			// 检查是否存在prompt字段
 			if _, hasPrompt := requestData["prompt"]; !hasPrompt {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": map[string]interface{}{
-						"message": "Prompt field is required for image generation requests",
-						"type":    "invalid_request_error",
-						"code":    400,
-					},
-				})
+				RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeMissingField, "Prompt field is required for image generation requests")
 				return
 			}
 		}
@@ -628,16 +702,27 @@ func HandleOpenAIProxy(c *gin.Context) {
 		requestPath = path
 	}
 	requestType, modelName, tokenEstimate := AnalyzeOpenAIRequest(requestPath, bodyBytes)
+	if !checkVirtualKeyModel(c, modelName) {
+		return
+	}
 
 	// 转换请求体为硅基流动格式
 	transformedBody, err := TransformRequestBody(bodyBytes, requestPath)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to transform request body: %v", err),
-		})
+		logger.Error("转换请求体失败: %v", err)
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidBody, "无法转换请求体")
+		return
+	}
+
+	// 演练模式只返回请求描述
+	if dryRun {
+		respondDryRun(c, targetURL, transformedBody, requestType, modelName, tokenEstimate)
 		return
 	}
 
+	// 附加密钥池状态头
+	setPoolHeaders(c)
+
 	// 调用带重试逻辑的函数处理OpenAI格式请求
 	handleOpenAIProxyWithRetry(c, targetURL, transformedBody, bodyBytes, requestType, modelName, tokenEstimate, requestPath)
 }
@@ -651,6 +736,10 @@ func handleOpenAIProxyWithRetry(c *gin.Context, targetURL string, transformedBod
 		return
 	}
 
+	// 请求结束时记录客户端视角的结果，最终失败时保存请求供重放
+	defer recordClientOutcome(c)
+	defer recordFailedRequest(c, targetURL, transformedBody, modelName)
+
 	// 获取配置
 	cfg := config.GetConfig()
 	retryConfig := cfg.ApiProxy.Retry
@@ -674,7 +763,9 @@ func handleOpenAIProxyWithRetry(c *gin.Context, targetURL string, transformedBod
 
 	// 如果最大重试次数为0，直接处理一次请求
 	if retryConfig.MaxRetries <= 0 {
-		processOpenAIRequest(c, targetURL, transformedBody, originalBody, requestType, modelName, tokenEstimate, path)
+		if ok, _ := processOpenAIRequest(c, targetURL, transformedBody, originalBody, requestType, modelName, tokenEstimate, path); !ok {
+			respondUpstreamFailure(c)
+		}
 		return
 	}
 
@@ -685,8 +776,14 @@ func handleOpenAIProxyWithRetry(c *gin.Context, targetURL string, transformedBod
 		return
 	}
 
+	// 已经返回错误响应（如没有可用密钥）时不再重试
+	if c.IsAborted() {
+		return
+	}
+
 	// 检查是否需要重试
 	if !shouldRetry(err, retryConfig) {
+		respondUpstreamFailure(c)
 		return
 	}
 
@@ -703,9 +800,7 @@ func handleOpenAIProxyWithRetry(c *gin.Context, targetURL string, transformedBod
 		// 获取另一个API密钥进行重试
 		apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "No suitable API keys available for retry",
-			})
+			respondNoAvailableKeys(c, "No suitable API keys available for retry")
 			return
 		}
 
@@ -716,16 +811,15 @@ func handleOpenAIProxyWithRetry(c *gin.Context, targetURL string, transformedBod
 		// 创建新的请求
 		req, err := http.NewRequest(c.Request.Method, targetURL, bytes.NewBuffer(transformedBody))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("Failed to create request for retry: %v", err),
-			})
+			logger.Error("创建上游请求失败: %v", err)
+			respondInternalError(c, "创建上游请求失败")
 			return
 		}
 
 		// 复制原始请求的 headers
 		for name, values := range c.Request.Header {
 			// 跳过一些特定的 headers
-			if strings.ToLower(name) == "host" || strings.ToLower(name) == "authorization" {
+			if isGatewayOnlyHeader(name) {
 				continue
 			}
 			for _, value := range values {
@@ -746,28 +840,12 @@ func handleOpenAIProxyWithRetry(c *gin.Context, targetURL string, transformedBod
 		client := utils.CreateClient()
 
 		// 发送请求
+		requestStart := time.Now()
 		resp, err := client.Do(req)
 		if err != nil {
-			// 区分连接错误和其他错误类型
-			if strings.Contains(err.Error(), "context deadline exceeded") ||
-				strings.Contains(err.Error(), "timeout") {
-				logger.Error("请求处理超时: %v", err)
-				c.JSON(http.StatusGatewayTimeout, gin.H{
-					"error": gin.H{
-						"message": "请求处理超时，已达到最大响应时间限制",
-						"type":    "timeout_error",
-						"code":    "context_deadline_exceeded",
-					},
-				})
-			} else if strings.Contains(err.Error(), "canceled") {
-				logger.Info("请求被取消: %v", err)
-				// 客户端已断开，不需要返回任何内容
-			} else {
-				logger.Error("发送请求失败: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": fmt.Sprintf("Failed to send request: %v", err),
-				})
-			}
+			recordUpstreamAttempt(c, apiKey, 0, err)
+			logger.Error("发送请求失败: %v", err)
+			respondSendError(c, err)
 
 			// 更新密钥失败记录
 			key.UpdateApiKeyStatus(apiKey, false)
@@ -781,6 +859,8 @@ func handleOpenAIProxyWithRetry(c *gin.Context, targetURL string, transformedBod
 		// 读取响应体
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
+			recordUpstreamAttempt(c, apiKey, resp.StatusCode, err)
+			rememberReadError(c, err)
 			// 更新密钥失败记录
 			key.UpdateApiKeyStatus(apiKey, false)
 			continue
@@ -788,6 +868,7 @@ func handleOpenAIProxyWithRetry(c *gin.Context, targetURL string, transformedBod
 
 		// 检查响应状态码
 		success := resp.StatusCode >= 200 && resp.StatusCode < 300
+		recordUpstreamAttempt(c, apiKey, resp.StatusCode, nil)
 
 		// 更新密钥状态
 		key.UpdateApiKeyStatus(apiKey, success)
@@ -804,11 +885,28 @@ func handleOpenAIProxyWithRetry(c *gin.Context, targetURL string, transformedBod
 		}
 
 		// 添加到每日统计
-		config.AddDailyRequestStat(apiKey, modelName, 1, promptTokensCount, completionTokensCount, success)
+		config.AddDailyRequestRecord(config.DailyRequestRecord{
+			ApiKey:           apiKey,
+			Model:            modelName,
+			RequestCount:     1,
+			PromptTokens:     promptTokensCount,
+			CompletionTokens: completionTokensCount,
+			IsSuccess:        success,
+			LatencyMs:        time.Since(requestStart).Milliseconds(),
+			Endpoint:         c.GetString(statsEndpointKey),
+			VirtualKey:       c.GetString(virtualKeyContextKey),
+		})
+
+		// 失败的响应留待重试结束后返回，避免多次写入响应
+		if !success {
+			rememberUpstreamError(c, resp, respBody)
+			continue
+		}
 
 		// 转换响应为OpenAI格式
 		openAIResponse, err := TransformResponseBody(respBody, path)
 		if err != nil {
+			logger.Error("转换响应体失败: %v", err)
 			continue
 		}
 
@@ -816,21 +914,20 @@ func handleOpenAIProxyWithRetry(c *gin.Context, targetURL string, transformedBod
 		c.Header("Content-Type", "application/json")
 		c.Status(resp.StatusCode)
 		c.Writer.Write(openAIResponse)
-
-		// 如果请求成功，返回
-		if success {
-			return
-		}
+		return
 	}
 
 	// 所有重试都失败，返回错误
-	c.JSON(http.StatusInternalServerError, gin.H{
-		"error": "All retry attempts failed",
-	})
+	respondUpstreamFailure(c)
 }
 
 // shouldRetry 判断是否需要重试
 func shouldRetry(err error, retryConfig config.RetryConfig) bool {
+	// 密钥被限流时已进入冷却，换用其他密钥重试
+	if errors.Is(err, errKeyCoolingDown) {
+		return true
+	}
+
 	// 如果是网络错误且配置允许重试网络错误
 	if err != nil && retryConfig.RetryOnNetworkErrors {
 		return true
@@ -862,22 +959,7 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 
 	// 检查模型是否被禁用
 	if modelName != "" && isModelDisabled(modelName) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": map[string]interface{}{
-				"message": fmt.Sprintf("模型 %s 已被禁用", modelName),
-				"type":    "invalid_request_error",
-				"code":    403,
-			},
-		})
-		return
-	}
-
-	// 根据请求类型选择最佳的API密钥
-	apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "No suitable API keys available",
-		})
+		respondModelDisabled(c, modelName)
 		return
 	}
 
@@ -909,45 +991,6 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
 	defer cancel() // 确保函数结束时取消上下文
 
-	// 创建新的请求，使用我们的超时上下文
-	req, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, bytes.NewBuffer(transformedBody))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to create request: %v", err),
-		})
-		return
-	}
-
-	// 复制原始请求的 headers
-	for name, values := range c.Request.Header {
-		// 跳过一些特定的 headers
-		if strings.ToLower(name) == "host" || strings.ToLower(name) == "authorization" {
-			continue
-		}
-		for _, value := range values {
-			req.Header.Add(name, value)
-		}
-	}
-
-	// 设置 Authorization header
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
-
-	// 设置 Content-Type header
-	req.Header.Set("Content-Type", "application/json")
-
-	// 对Deepseek R1添加特殊请求头
-	if isDeepseekR1 {
-		req.Header.Set("X-Accel-Buffering", "no") // 禁用Nginx缓冲
-		req.Header.Set("Cache-Control", "no-cache, no-transform")
-		req.Header.Set("Connection", "keep-alive")
-		req.Header.Set("Transfer-Encoding", "chunked")
-		req.Header.Set("Keep-Alive", "timeout=600")   // 添加10分钟Keep-Alive超时
-		req.Header.Set("X-DeepSeek-Priority", "high") // 自定义头，可能会被忽略，但不影响
-	}
-
-	// 明确指定不接受压缩响应，避免 Cloudflare 返回 br 压缩格式
-	req.Header.Set("Accept-Encoding", "identity")
-
 	// 创建 HTTP 客户端，根据模型类型选择合适的超时设置
 	var client *http.Client
 	if isDeepseekR1 {
@@ -1011,57 +1054,175 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 	}()
 	defer clientCancel()
 
-	// 发送请求，使用上下文控制超时
-	resp, err := client.Do(req.WithContext(clientCtx))
-	if err != nil {
-		// 区分连接错误和其他错误类型
-		if strings.Contains(err.Error(), "context deadline exceeded") ||
-			strings.Contains(err.Error(), "timeout") {
-			logger.Error("请求处理超时: %v", err)
-			c.JSON(http.StatusGatewayTimeout, gin.H{
-				"error": gin.H{
-					"message": "请求处理超时，已达到最大响应时间限制",
-					"type":    "timeout_error",
-					"code":    "context_deadline_exceeded",
-				},
+	// 首字节超时前尚未向客户端发送任何数据，可以换用其他密钥重试
+	firstByteTimeout, _ := config.GetStreamTimeouts(modelName)
+	maxAttempts := 1
+	if retries := config.GetConfig().ApiProxy.Retry.MaxRetries; firstByteTimeout > 0 && retries > 0 {
+		maxAttempts += retries
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		// 根据请求类型选择最佳的API密钥
+		apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
+		if err != nil {
+			if attempt == 1 {
+				rejectNoAvailableKeys(c, "No suitable API keys available")
+			} else {
+				respondNoAvailableKeys(c, "No suitable API keys available")
+			}
+			return
+		}
+		if attempt > 1 {
+			logger.Info("使用新的API密钥重试流式请求: %s", utils.MaskKey(apiKey))
+		}
+
+		req, err := newStreamUpstreamRequest(ctx, c, targetURL, transformedBody, apiKey, isDeepseekR1)
+		if err != nil {
+			logger.Error("创建上游请求失败: %v", err)
+			respondInternalError(c, "创建上游请求失败")
+			return
+		}
+
+		// 记录请求发出时间，用于计算首字延迟
+		sentAt := time.Now()
+		c.Set(streamStartTimeKey, sentAt)
+
+		// 首字节超时只取消本次尝试
+		// 未进入流式转发的尝试在本轮结束时取消，不保留到处理函数返回
+		attemptCtx, attemptCancel := context.WithCancel(clientCtx)
+		var firstByteTimedOut atomic.Bool
+		var firstByteTimer *time.Timer
+		if firstByteTimeout > 0 {
+			firstByteTimer = time.AfterFunc(firstByteTimeout, func() {
+				firstByteTimedOut.Store(true)
+				attemptCancel()
 			})
-		} else if strings.Contains(err.Error(), "canceled") {
-			logger.Info("请求被取消: %v", err)
-			// 客户端已断开，不需要返回任何内容
-		} else {
+		}
+		stopFirstByteTimer := func() {
+			if firstByteTimer != nil {
+				firstByteTimer.Stop()
+			}
+		}
+
+		// 发送请求，使用上下文控制超时
+		resp, err := client.Do(req.WithContext(attemptCtx))
+		if err != nil {
+			stopFirstByteTimer()
+			attemptCancel()
+			if firstByteTimedOut.Load() {
+				recordFirstByteTimeout(c, apiKey, firstByteTimeout)
+				continue
+			}
+
+			recordUpstreamAttempt(c, apiKey, 0, err)
 			logger.Error("发送请求失败: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("Failed to send request: %v", err),
-			})
+			respondSendError(c, err)
+
+			// 更新密钥失败记录
+			key.UpdateApiKeyStatus(apiKey, false)
+			return
 		}
 
-		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
+		// 检查状态码
+		if resp.StatusCode != http.StatusOK {
+			stopFirstByteTimer()
+			recordUpstreamAttempt(c, apiKey, resp.StatusCode, nil)
+
+			// 更新密钥失败记录
+			key.UpdateApiKeyStatus(apiKey, false)
+
+			// 尝试读取错误消息
+			errBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			attemptCancel()
+
+			// 记录详细的状态码和错误信息
+			logger.Error("流式请求返回非200状态码: %d, 响应: %s", resp.StatusCode, string(errBody))
+
+			respondUpstreamError(c, resp.StatusCode, resp.Header.Get("Content-Type"), errBody)
+			return
+		}
+
+		// 等待首个数据事件，此前不向客户端写入任何内容
+		reader := bufio.NewReaderSize(resp.Body, 65536)
+		head, err := readFirstStreamEvent(reader)
+		stopFirstByteTimer()
+		if firstByteTimedOut.Load() {
+			resp.Body.Close()
+			attemptCancel()
+			recordFirstByteTimeout(c, apiKey, firstByteTimeout)
+			continue
+		}
+		if err != nil && len(head) == 0 {
+			resp.Body.Close()
+			attemptCancel()
+			recordUpstreamAttempt(c, apiKey, resp.StatusCode, err)
+			key.UpdateApiKeyStatus(apiKey, false)
+			logger.Error("读取流式响应失败: %v", err)
+			RespondOpenAIError(c, http.StatusBadGateway, ErrorTypeServer, ErrorCodeUpstreamReadFailed, "读取上游响应失败")
+			return
+		}
+
+		recordUpstreamAttempt(c, apiKey, resp.StatusCode, nil)
+		c.Set(streamFirstByteMsKey, time.Since(sentAt).Milliseconds())
+
+		// 记录成功启动流式响应
+		logger.Info("成功启动流式响应，正在处理响应流...")
+
+		// 处理流式响应，已读取的首个事件放回响应流开头，转发结束后再取消本次尝试
+		defer attemptCancel()
+		body := struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), reader), resp.Body}
+		HandleStreamResponse(c, body, apiKey, originalBody)
 		return
 	}
 
-	// 检查状态码
-	if resp.StatusCode != http.StatusOK {
-		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
+	// 所有尝试均在首字节超时
+	RespondOpenAIError(c, http.StatusGatewayTimeout, ErrorTypeTimeout, ErrorCodeFirstByteTimeout,
+		fmt.Sprintf("上游在%v内未返回数据", firstByteTimeout))
+}
+
+// newStreamUpstreamRequest 创建发往上游的流式请求
+func newStreamUpstreamRequest(ctx context.Context, c *gin.Context, targetURL string, transformedBody []byte, apiKey string, isDeepseekR1 bool) (*http.Request, error) {
+	// 创建新的请求，使用我们的超时上下文
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, bytes.NewBuffer(transformedBody))
+	if err != nil {
+		return nil, err
+	}
+
+	// 复制原始请求的 headers
+	for name, values := range c.Request.Header {
+		// 跳过一些特定的 headers
+		if isGatewayOnlyHeader(name) {
+			continue
+		}
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
 
-		// 尝试读取错误消息
-		errBody, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
+	// 设置 Authorization header
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
 
-		// 记录详细的状态码和错误信息
-		logger.Error("流式请求返回非200状态码: %d, 响应: %s", resp.StatusCode, string(errBody))
+	// 设置 Content-Type header
+	req.Header.Set("Content-Type", "application/json")
 
-		c.Status(resp.StatusCode)
-		c.Writer.Write(errBody)
-		return
+	// 对Deepseek R1添加特殊请求头
+	if isDeepseekR1 {
+		req.Header.Set("X-Accel-Buffering", "no") // 禁用Nginx缓冲
+		req.Header.Set("Cache-Control", "no-cache, no-transform")
+		req.Header.Set("Connection", "keep-alive")
+		req.Header.Set("Transfer-Encoding", "chunked")
+		req.Header.Set("Keep-Alive", "timeout=600")   // 添加10分钟Keep-Alive超时
+		req.Header.Set("X-DeepSeek-Priority", "high") // 自定义头，可能会被忽略，但不影响
 	}
 
-	// 记录成功启动流式响应
-	logger.Info("成功启动流式响应，正在处理响应流...")
+	// 明确指定不接受压缩响应，避免 Cloudflare 返回 br 压缩格式
+	req.Header.Set("Accept-Encoding", "identity")
 
-	// 处理流式响应，传递与当前请求相同的超时上下文
-	HandleStreamResponse(c, resp.Body, apiKey, originalBody)
+	return req, nil
 }
 
 // 处理非流式OpenAI请求，返回是否成功处理和可能的错误
@@ -1076,38 +1237,29 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 
 	// 检查模型是否被禁用
 	if modelName != "" && isModelDisabled(modelName) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": map[string]interface{}{
-				"message": fmt.Sprintf("模型 %s 已被禁用", modelName),
-				"type":    "invalid_request_error",
-				"code":    403,
-			},
-		})
+		respondModelDisabled(c, modelName)
 		return false, fmt.Errorf("模型 %s 已被禁用", modelName)
 	}
 
 	// 根据请求类型选择最佳的API密钥
 	apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "No suitable API keys available",
-		})
+		rejectNoAvailableKeys(c, "No suitable API keys available")
 		return false, err
 	}
 
 	// 创建新的请求
 	req, err := http.NewRequest(c.Request.Method, targetURL, bytes.NewBuffer(transformedBody))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to create request: %v", err),
-		})
+		logger.Error("创建上游请求失败: %v", err)
+		respondInternalError(c, "创建上游请求失败")
 		return false, err
 	}
 
 	// 复制原始请求的 headers
 	for name, values := range c.Request.Header {
 		// 跳过一些特定的 headers
-		if strings.ToLower(name) == "host" || strings.ToLower(name) == "authorization" {
+		if isGatewayOnlyHeader(name) {
 			continue
 		}
 		for _, value := range values {
@@ -1128,9 +1280,12 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 	client := utils.CreateClient()
 
 	// 发送请求
+	requestStart := time.Now()
 	resp, err := client.Do(req)
 
 	if err != nil {
+		recordUpstreamAttempt(c, apiKey, 0, err)
+		rememberSendError(c, err)
 		// 更新密钥失败记录
 		key.UpdateApiKeyStatus(apiKey, false)
 		return false, err
@@ -1144,20 +1299,25 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 	// 读取响应体
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
+		recordUpstreamAttempt(c, apiKey, resp.StatusCode, err)
+		rememberReadError(c, err)
 		// 更新密钥失败记录
 		key.UpdateApiKeyStatus(apiKey, false)
 
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to read response body: %v", err),
-		})
+		logger.Error("读取上游响应失败: %v", err)
 		return false, err
 	}
 
 	// 检查响应状态码
 	success := resp.StatusCode >= 200 && resp.StatusCode < 300
+	recordUpstreamAttempt(c, apiKey, resp.StatusCode, nil)
+
+	// 按配置将请求镜像到备用上游，不影响主请求
+	mirrorRequest(c.Request, targetURL, transformedBody, modelName, success, time.Since(requestStart), respBody)
 
 	// 如果请求失败，返回错误
 	if !success {
+		rememberUpstreamError(c, resp, respBody)
 		// 更新密钥失败记录
 		key.UpdateApiKeyStatus(apiKey, false)
 		return false, fmt.Errorf("OpenAI格式API请求失败，状态码: %d", resp.StatusCode)
@@ -1179,14 +1339,23 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 	}
 
 	// 添加到每日统计
-	config.AddDailyRequestStat(apiKey, modelName, 1, promptTokensCount, completionTokensCount, success)
+	config.AddDailyRequestRecord(config.DailyRequestRecord{
+		ApiKey:           apiKey,
+		Model:            modelName,
+		RequestCount:     1,
+		PromptTokens:     promptTokensCount,
+		CompletionTokens: completionTokensCount,
+		IsSuccess:        success,
+		LatencyMs:        time.Since(requestStart).Milliseconds(),
+		Endpoint:         c.GetString(statsEndpointKey),
+		VirtualKey:       c.GetString(virtualKeyContextKey),
+	})
 
 	// 转换响应为OpenAI格式
 	openAIResponse, err := TransformResponseBody(respBody, path)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to transform response body: %v", err),
-		})
+		logger.Error("转换响应体失败: %v", err)
+		respondInternalError(c, "转换上游响应失败")
 		return false, err
 	}
 
@@ -1198,22 +1367,90 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 	return true, nil
 }
 
+// modelsCache 上游模型列表缓存，超过10分钟后在后台刷新
+var modelsCache = config.NewSWRCache("models", 10*time.Minute)
+
+// errNoKeyForModels 获取模型列表时没有可用的API密钥
+var errNoKeyForModels = errors.New("没有可用的API密钥")
+
 // 处理模型列表请求
+// 上游响应按stale-while-revalidate缓存，返回时在Age响应头中附带缓存时长，force=true时跳过缓存
 func HandleModelsRequest(c *gin.Context, apiKey string) {
+	logger.Info("处理模型列表请求")
+
+	respBody, age, err := modelsCache.Get("models", c.Query("force") == "true", func() ([]byte, error) {
+		return fetchUpstreamModels(apiKey)
+	})
+	if err != nil {
+		var upstreamErr *upstreamError
+		var readErr *upstreamReadError
+		switch {
+		case errors.Is(err, errNoKeyForModels):
+			respondNoAvailableKeys(c, "No suitable API keys available")
+		case errors.As(err, &upstreamErr):
+			respondUpstreamError(c, upstreamErr.status, upstreamErr.contentType, upstreamErr.body)
+		case errors.As(err, &readErr):
+			RespondOpenAIError(c, http.StatusBadGateway, ErrorTypeServer, ErrorCodeUpstreamReadFailed, "读取上游响应失败")
+		default:
+			respondSendError(c, err)
+		}
+		return
+	}
+
+	// 过滤掉被禁用的模型
+	var modelsResponse map[string]interface{}
+	if err := json.Unmarshal(respBody, &modelsResponse); err == nil {
+		if models, ok := modelsResponse["data"].([]interface{}); ok {
+			var filteredModels []interface{}
+			for _, model := range models {
+				if modelObj, ok := model.(map[string]interface{}); ok {
+					if modelID, ok := modelObj["id"].(string); ok && !isModelDisabled(modelID) {
+						filteredModels = append(filteredModels, model)
+					}
+				} else {
+					// 如果无法解析模型对象，保留它
+					filteredModels = append(filteredModels, model)
+				}
+			}
+			modelsResponse["data"] = filteredModels
+
+			// 将过滤后的响应转换回JSON
+			filteredResponse, err := json.Marshal(modelsResponse)
+			if err == nil {
+				respBody = filteredResponse
+			} else {
+				logger.Error("过滤模型列表后转换JSON失败: %v", err)
+				// 出错时使用原始响应
+			}
+		}
+	} else {
+		logger.Error("解析模型列表响应失败: %v", err)
+		// 出错时使用原始响应
+	}
+
+	// 返回API的响应（可能经过过滤）
+	c.Header("Content-Type", "application/json")
+	c.Header("Age", strconv.Itoa(int(age.Seconds())))
+	c.Status(http.StatusOK)
+	c.Writer.Write(respBody)
+
+	// 模型列表请求不消耗令牌，单独计数，不计入请求流量
+	config.AddMetaRequestStat(1)
+	logger.Info("成功返回模型列表")
+}
+
+// fetchUpstreamModels 从上游获取模型列表，apiKey为空时选择一个密钥，只返回状态码200的响应体
+// 可能在后台刷新缓存时调用，不能使用请求上下文
+func fetchUpstreamModels(apiKey string) ([]byte, error) {
 	// 根据请求类型选择最佳的API密钥（如果未提供）
 	if apiKey == "" {
 		var err error
 		apiKey, err = key.GetBestKeyForRequest("completion", "", 100) // 轻量级请求
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "No suitable API keys available",
-			})
-			return
+			return nil, fmt.Errorf("%w: %v", errNoKeyForModels, err)
 		}
 	}
 
-	logger.Info("处理模型列表请求")
-
 	// 获取配置
 	cfg := config.GetConfig()
 	baseURL := cfg.ApiProxy.BaseURL
@@ -1225,10 +1462,7 @@ func HandleModelsRequest(c *gin.Context, apiKey string) {
 	req, err := http.NewRequest("GET", targetURL, nil)
 	if err != nil {
 		logger.Error("创建请求失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("创建请求失败: %v", err),
-		})
-		return
+		return nil, err
 	}
 
 	// 设置请求头
@@ -1237,18 +1471,11 @@ func HandleModelsRequest(c *gin.Context, apiKey string) {
 	// 明确指定不接受压缩响应，避免 Cloudflare 返回 br 压缩格式
 	req.Header.Set("Accept-Encoding", "identity")
 
-	// 创建HTTP客户端
-	client := utils.CreateClient()
-
 	// 发送请求
-	logger.Info("正在发送模型列表请求...")
-	resp, err := client.Do(req)
+	resp, err := utils.CreateClient().Do(req)
 	if err != nil {
 		logger.Error("发送请求失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("发送请求失败: %v", err),
-		})
-		return
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -1258,69 +1485,40 @@ func HandleModelsRequest(c *gin.Context, apiKey string) {
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		logger.Error("读取响应体失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("读取响应体失败: %v", err),
-		})
-		return
+		return nil, &upstreamReadError{err: err}
 	}
 
-	// 如果API返回错误，直接将错误传递给客户端
+	// 如果API返回错误，由调用方将错误传递给客户端
 	if resp.StatusCode != http.StatusOK {
 		logger.Error("API返回错误，状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
-		c.Status(resp.StatusCode)
-		c.Writer.Write(respBody)
-		return
-	}
-
-	// 设置响应头
-	for key, values := range resp.Header {
-		for _, value := range values {
-			c.Header(key, value)
-		}
-	}
-
-	// 过滤掉被禁用的模型
-	var modelsResponse map[string]interface{}
-	if err := json.Unmarshal(respBody, &modelsResponse); err == nil {
-		if models, ok := modelsResponse["data"].([]interface{}); ok {
-			var filteredModels []interface{}
-			for _, model := range models {
-				if modelObj, ok := model.(map[string]interface{}); ok {
-					if modelID, ok := modelObj["id"].(string); ok && !isModelDisabled(modelID) {
-						filteredModels = append(filteredModels, model)
-					}
-				} else {
-					// 如果无法解析模型对象，保留它
-					filteredModels = append(filteredModels, model)
-				}
-			}
-			modelsResponse["data"] = filteredModels
-
-			// 将过滤后的响应转换回JSON
-			filteredResponse, err := json.Marshal(modelsResponse)
-			if err == nil {
-				respBody = filteredResponse
-			} else {
-				logger.Error("过滤模型列表后转换JSON失败: %v", err)
-				// 出错时使用原始响应
-			}
+		return nil, &upstreamError{
+			status:      resp.StatusCode,
+			contentType: resp.Header.Get("Content-Type"),
+			body:        respBody,
 		}
-	} else {
-		logger.Error("解析模型列表响应失败: %v", err)
-		// 出错时使用原始响应
 	}
+	return respBody, nil
+}
 
-	// 返回API的响应（可能经过过滤）
-	c.Status(resp.StatusCode)
-	c.Writer.Write(respBody)
+// streamStartTimeKey 上下文中记录流式请求发出时间的键
+const streamStartTimeKey = "stream_start_time"
 
-	logger.Info("成功返回模型列表")
-}
+// statsEndpointKey 上下文中记录上游接口路径的键，用于按接口统计请求
+const statsEndpointKey = "stats_endpoint"
 
 // 处理流式响应
 func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey string, requestBody []byte) {
 	logger.Info("开始处理流式响应")
 
+	// 首字延迟的计时起点，优先使用请求发出的时间
+	streamStart := time.Now()
+	if startTime, exists := c.Get(streamStartTimeKey); exists {
+		if t, ok := startTime.(time.Time); ok {
+			streamStart = t
+		}
+	}
+	var firstTokenMs atomic.Int64
+
 	// 创建缓冲读取器，增加缓冲区大小以处理大型响应
 	reader := bufio.NewReaderSize(responseBody, 65536) // 增加到64KB的缓冲区
 
@@ -1328,9 +1526,7 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 	flusher, ok := c.Writer.(http.Flusher)
 	if !ok {
 		logger.Error("流式处理失败：响应写入器不支持刷新")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Streaming not supported",
-		})
+		RespondOpenAIError(c, http.StatusInternalServerError, ErrorTypeServer, ErrorCodeStreamingUnsupported, "当前连接不支持流式响应")
 		return
 	}
 
@@ -1347,6 +1543,10 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 		}
 	}
 
+	// 数据块之间的空闲超时，按模型配置
+	modelForTimeout, _ := requestData["model"].(string)
+	_, idleTimeout := config.GetStreamTimeouts(modelForTimeout)
+
 	// 设置合理的超时时间，根据模型类型调整
 	var streamTimeout time.Duration
 	if isDeepseekR1 {
@@ -1514,8 +1714,12 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 				lastProgressTime = time.Now()
 			}
 
-			// 使用带超时的上下文创建一个读取操作
-			readCtx, readCancel := context.WithTimeout(ctx, 5*time.Second)
+			// 使用带超时的上下文创建一个读取操作，配置了空闲超时时按空闲超时等待
+			readWait := 5 * time.Second
+			if idleTimeout > 0 {
+				readWait = idleTimeout
+			}
+			readCtx, readCancel := context.WithTimeout(ctx, readWait)
 
 			// 使用goroutine包装读取操作
 			go func() {
@@ -1539,6 +1743,11 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 					// 解析事件数据
 					data := bytes.TrimPrefix(line, []byte("data: "))
 
+					// 记录首个数据事件的到达时间
+					if eventCount == 1 {
+						firstTokenMs.Store(time.Since(streamStart).Milliseconds())
+					}
+
 					// 检查是否是[DONE]事件
 					if bytes.Equal(bytes.TrimSpace(data), []byte("[DONE]")) {
 						// 发送[DONE]事件
@@ -1757,6 +1966,12 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 			case <-readCtx.Done():
 				readCancel() // 确保取消读取上下文
 
+				// 超过空闲超时仍未收到数据，结束流式响应
+				if idleTimeout > 0 && ctx.Err() == nil {
+					errorChan <- errStreamIdleTimeout
+					return
+				}
+
 				// 读取超时处理
 				if isDeepseekR1 {
 					logger.Info("Deepseek R1读取操作超时，发送保持活动包")
@@ -1825,10 +2040,21 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 	}
 
 	// 处理错误信息
+	streamFailed := false
 	if err == nil || err == io.EOF {
 		logger.Info("流式响应正常完成")
 	} else if err == context.Canceled || connectionClosed.Load() {
 		logger.Info("客户端取消了连接")
+	} else if errors.Is(err, errStreamIdleTimeout) {
+		// 空闲超时计为该密钥的超时失败
+		streamFailed = true
+		logger.Warn("流式响应空闲超时（%v），密钥: %s", idleTimeout, utils.MaskKey(apiKey))
+		config.AddStreamTimeout(config.StreamTimeoutIdle, apiKey)
+		key.UpdateApiKeyStatus(apiKey, false)
+		if !connectionClosed.Load() {
+			c.Writer.Write(streamIdleTimeoutEvent(c, idleTimeout))
+			flusher.Flush()
+		}
 	} else if strings.Contains(err.Error(), "deadline exceeded") {
 		if isDeepseekR1 {
 			// 对于Deepseek R1，超时结束也视为正常
@@ -1875,7 +2101,22 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 	}
 	promptTokensCount := totalTokens / 3                     // 估计输入占1/3
 	completionTokensCount := totalTokens - promptTokensCount // 估计输出占2/3
-	config.AddDailyRequestStat(apiKey, modelNameForStats, 1, promptTokensCount, completionTokensCount, true)
+	firstByteMs, _ := c.Get(streamFirstByteMsKey)
+	firstByteMsValue, _ := firstByteMs.(int64)
+	config.AddDailyRequestRecord(config.DailyRequestRecord{
+		ApiKey:           apiKey,
+		Model:            modelNameForStats,
+		RequestCount:     1,
+		PromptTokens:     promptTokensCount,
+		CompletionTokens: completionTokensCount,
+		IsSuccess:        !streamFailed,
+		IsStream:         true,
+		FirstTokenMs:     firstTokenMs.Load(),
+		FirstByteMs:      firstByteMsValue,
+		LatencyMs:        time.Since(streamStart).Milliseconds(),
+		Endpoint:         c.GetString(statsEndpointKey),
+		VirtualKey:       c.GetString(virtualKeyContextKey),
+	})
 
 	logger.Info("流式响应完成，估计token数: %d，处理了 %d 个事件", totalTokens, eventCount)
 
@@ -1945,25 +2186,22 @@ func forwardUserInfoRequest(c *gin.Context, targetURL string) {
 	// 获取最佳API密钥
 	apiKey, err := key.GetBestKeyForRequest("user_info", "", 0)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "No suitable API keys available",
-		})
+		respondNoAvailableKeys(c, "No suitable API keys available")
 		return
 	}
 
 	// 创建新的请求
 	req, err := http.NewRequest(c.Request.Method, targetURL, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to create request: %v", err),
-		})
+		logger.Error("创建上游请求失败: %v", err)
+		respondInternalError(c, "创建上游请求失败")
 		return
 	}
 
 	// 复制原始请求的 headers
 	for name, values := range c.Request.Header {
 		// 跳过一些特定的 headers
-		if strings.ToLower(name) == "host" || strings.ToLower(name) == "authorization" {
+		if isGatewayOnlyHeader(name) {
 			continue
 		}
 		for _, value := range values {
@@ -1988,9 +2226,8 @@ func forwardUserInfoRequest(c *gin.Context, targetURL string) {
 	if err != nil {
 		// 更新密钥失败记录
 		key.UpdateApiKeyStatus(apiKey, false)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to send request: %v", err),
-		})
+		logger.Error("发送请求失败: %v", err)
+		respondSendError(c, err)
 		return
 	}
 	defer resp.Body.Close()
@@ -2004,9 +2241,8 @@ func forwardUserInfoRequest(c *gin.Context, targetURL string) {
 	if err != nil {
 		// 更新密钥失败记录
 		key.UpdateApiKeyStatus(apiKey, false)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to read response body: %v", err),
-		})
+		logger.Error("读取上游响应失败: %v", err)
+		RespondOpenAIError(c, http.StatusBadGateway, ErrorTypeServer, ErrorCodeUpstreamReadFailed, "读取上游响应失败")
 		return
 	}
 
@@ -2017,9 +2253,7 @@ func forwardUserInfoRequest(c *gin.Context, targetURL string) {
 	if !success {
 		// 更新密钥失败记录
 		key.UpdateApiKeyStatus(apiKey, false)
-		c.JSON(resp.StatusCode, gin.H{
-			"error": fmt.Sprintf("API请求失败，状态码: %d", resp.StatusCode),
-		})
+		respondUpstreamError(c, resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
 		return
 	}
 
@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUpstreamRequestDropsGatewayHeaders(t *testing.T) {
+	c, _ := newTestContext(http.MethodPost, "/v1/chat/completions", "sk-client")
+	c.Request.Header.Set(adminTokenHeader, "admin-secret")
+	c.Request.Header.Set("X-FS-Priority", "high")
+	c.Request.Header.Set(dryRunHeader, "true")
+	c.Request.Header.Set("X-Request-Source", "sdk")
+
+	req, err := newStreamUpstreamRequest(context.Background(), c, "http://upstream.test/v1/chat/completions", []byte(`{}`), "sk-upstream", false)
+	if err != nil {
+		t.Fatalf("newStreamUpstreamRequest() = %v", err)
+	}
+	for name := range req.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-fs-") {
+			t.Fatalf("上游请求不应携带网关请求头 %s", name)
+		}
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer sk-upstream" {
+		t.Fatalf("Authorization = %q, want 上游密钥", got)
+	}
+	if req.Header.Get("X-Request-Source") != "sdk" {
+		t.Fatal("其他请求头应原样转发")
+	}
+}
@@ -0,0 +1,299 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 00:45:00
+  @desc: 运行时增删改查上游密钥的管理接口，修改立即生效并保存到配置数据库
+**/
+
+package proxy
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// keysAdminPathPrefix 密钥管理接口在/api下的路径前缀
+	keysAdminPathPrefix = "/admin/keys"
+	// keysImportID 批量导入接口在密钥管理路径下的名称
+	keysImportID = "import"
+	// maxKeysImportBytes 批量导入内容的大小上限
+	maxKeysImportBytes = 4 * 1024 * 1024
+)
+
+// AdminKey 管理接口返回的密钥信息，不包含原始密钥
+type AdminKey struct {
+	KeyID         string  `json:"key_id"`
+	MaskedKey     string  `json:"masked_key"` // 按脱敏策略显示的密钥
+	Balance       float64 `json:"balance"`
+	Disabled      bool    `json:"disabled"`
+	Expired       bool    `json:"expired"`
+	ExpiresAt     int64   `json:"expires_at,omitempty"`
+	LastUsed      int64   `json:"last_used,omitempty"`
+	TotalCalls    int     `json:"total_calls"`
+	SuccessRate   float64 `json:"success_rate"`
+	Breaker       string  `json:"breaker"`                  // 熔断器状态：closed、open、half_open
+	CooldownUntil int64   `json:"cooldown_until,omitempty"` // 限流冷却结束时间，不在冷却中时为0
+}
+
+// newAdminKey 将密钥转换为管理接口返回的格式
+func newAdminKey(k config.ApiKey) AdminKey {
+	keyID := config.KeyID(k.Key)
+	item := AdminKey{
+		KeyID:       keyID,
+		MaskedKey:   config.DisplayKeyID(keyID, true),
+		Balance:     k.Balance,
+		Disabled:    k.Disabled,
+		Expired:     k.Expired,
+		ExpiresAt:   k.ExpiresAt,
+		LastUsed:    k.LastUsed,
+		TotalCalls:  k.TotalCalls,
+		SuccessRate: k.SuccessRate,
+		Breaker:     config.GetKeyBreakerState(k.Key),
+	}
+	if until, ok := config.GetKeyCooldownUntil(k.Key); ok {
+		item.CooldownUntil = until.Unix()
+	}
+	return item
+}
+
+// findAdminKey 按稳定密钥标识或原始密钥查找密钥
+func findAdminKey(id string) (config.ApiKey, bool) {
+	apiKey := id
+	if resolved, ok := config.ResolveKeyID(id); ok {
+		apiKey = resolved
+	}
+	for _, k := range config.GetApiKeys() {
+		if k.Key == apiKey {
+			return k, true
+		}
+	}
+	return config.ApiKey{}, false
+}
+
+// handleKeysAdmin 处理/api/admin/keys下的管理接口，返回false表示不是管理接口，继续代理
+// GET /api/admin/keys 列出所有密钥
+// POST /api/admin/keys 添加密钥，未提供余额时查询上游余额
+// POST /api/admin/keys/import 从每行一个密钥的文本批量导入，dry_run=true时只校验不保存
+// GET /api/admin/keys/{id} 获取单个密钥
+// PATCH /api/admin/keys/{id} 启用/禁用密钥或修改到期时间
+// DELETE /api/admin/keys/{id} 删除密钥
+// {id}为稳定密钥标识（key_id），也可以是原始密钥
+func handleKeysAdmin(c *gin.Context) bool {
+	path := c.Param("path")
+	if path != keysAdminPathPrefix && !strings.HasPrefix(path, keysAdminPathPrefix+"/") {
+		return false
+	}
+
+	if !isAdminRequest(c) {
+		RespondOpenAIError(c, http.StatusForbidden, ErrorTypePermission, ErrorCodeAdminRequired,
+			"密钥管理需要管理权限")
+		return true
+	}
+
+	id := strings.Trim(strings.TrimPrefix(path, keysAdminPathPrefix), "/")
+	switch {
+	case id == "" && c.Request.Method == http.MethodGet:
+		keys := config.GetApiKeys()
+		result := make([]AdminKey, 0, len(keys))
+		for _, k := range keys {
+			result = append(result, newAdminKey(k))
+		}
+		c.JSON(http.StatusOK, gin.H{"keys": result})
+	case id == "" && c.Request.Method == http.MethodPost:
+		handleAdminAddKey(c)
+	case id == keysImportID && c.Request.Method == http.MethodPost:
+		handleAdminImportKeys(c)
+	case id != "" && !strings.Contains(id, "/") && c.Request.Method == http.MethodGet:
+		k, ok := findAdminKey(id)
+		if !ok {
+			respondAdminKeyNotFound(c, id)
+			return true
+		}
+		c.JSON(http.StatusOK, newAdminKey(k))
+	case id != "" && !strings.Contains(id, "/") && c.Request.Method == http.MethodPatch:
+		handleAdminUpdateKey(c, id)
+	case id != "" && !strings.Contains(id, "/") && c.Request.Method == http.MethodDelete:
+		handleAdminDeleteKey(c, id)
+	default:
+		RespondOpenAIError(c, http.StatusNotFound, ErrorTypeInvalidRequest, ErrorCodeKeyNotFound,
+			"未知的密钥管理接口")
+	}
+	return true
+}
+
+// respondAdminKeyNotFound 返回密钥不存在的错误
+func respondAdminKeyNotFound(c *gin.Context, id string) {
+	RespondOpenAIError(c, http.StatusNotFound, ErrorTypeInvalidRequest, ErrorCodeKeyNotFound,
+		"密钥不存在: "+id)
+}
+
+// handleAdminAddKey 添加密钥，密钥已存在时返回409
+// 未提供余额时查询上游余额，余额不大于0时不添加
+func handleAdminAddKey(c *gin.Context) {
+	var req struct {
+		Key       string   `json:"key"`
+		Balance   *float64 `json:"balance"`
+		ExpiresAt int64    `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Key) == "" {
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeMissingField,
+			"请提供密钥(key)")
+		return
+	}
+	if req.ExpiresAt < 0 {
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidBody,
+			"无效的到期时间")
+		return
+	}
+	apiKey := strings.TrimSpace(req.Key)
+	if _, exists := findAdminKey(apiKey); exists {
+		RespondOpenAIError(c, http.StatusConflict, ErrorTypeInvalidRequest, ErrorCodeKeyExists,
+			"密钥已存在: "+config.KeyID(apiKey))
+		return
+	}
+
+	var balance float64
+	if req.Balance != nil {
+		balance = *req.Balance
+	} else {
+		checked, err := key.CheckKeyBalance(apiKey)
+		if err != nil {
+			RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidAPIKey,
+				"查询密钥余额失败: "+err.Error())
+			return
+		}
+		balance = checked
+	}
+	if balance <= 0 {
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidAPIKey,
+			"无法添加余额小于或等于0的API密钥")
+		return
+	}
+
+	config.AddApiKey(apiKey, balance)
+	if req.ExpiresAt > 0 {
+		config.SetApiKeyExpiry(apiKey, req.ExpiresAt)
+	}
+	config.SortApiKeysByBalance()
+	if err := config.SaveApiKeys(); err != nil {
+		logger.Error("保存API密钥到数据库失败: %v", err)
+	}
+	key.InvalidatePoolState()
+	logger.Info("通过管理接口添加API密钥 %s，余额: %.2f", config.MaskKey(apiKey), balance)
+
+	k, _ := findAdminKey(apiKey)
+	c.JSON(http.StatusCreated, newAdminKey(k))
+}
+
+// handleAdminUpdateKey 启用/禁用密钥或修改到期时间，只修改请求中提供的字段
+func handleAdminUpdateKey(c *gin.Context, id string) {
+	var req struct {
+		Disabled  *bool  `json:"disabled"`
+		ExpiresAt *int64 `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Disabled == nil && req.ExpiresAt == nil) {
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeMissingField,
+			"请提供要修改的字段(disabled、expires_at)")
+		return
+	}
+	if req.ExpiresAt != nil && *req.ExpiresAt < 0 {
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidBody,
+			"无效的到期时间")
+		return
+	}
+	k, ok := findAdminKey(id)
+	if !ok {
+		respondAdminKeyNotFound(c, id)
+		return
+	}
+
+	if req.ExpiresAt != nil {
+		config.SetApiKeyExpiry(k.Key, *req.ExpiresAt)
+	}
+	if req.Disabled != nil && *req.Disabled != k.Disabled {
+		if *req.Disabled {
+			config.DisableApiKey(k.Key)
+		} else {
+			config.EnableApiKey(k.Key)
+		}
+	}
+	if err := config.SaveApiKeys(); err != nil {
+		logger.Error("保存API密钥到数据库失败: %v", err)
+	}
+	key.InvalidatePoolState()
+
+	k, _ = findAdminKey(k.Key)
+	c.JSON(http.StatusOK, newAdminKey(k))
+}
+
+// handleAdminDeleteKey 删除密钥，删除后立即不再参与选择
+func handleAdminDeleteKey(c *gin.Context, id string) {
+	k, ok := findAdminKey(id)
+	if !ok {
+		respondAdminKeyNotFound(c, id)
+		return
+	}
+
+	config.MarkApiKeyForDeletion(k.Key)
+	config.RemoveMarkedApiKeys()
+	if err := config.SaveApiKeys(); err != nil {
+		RespondOpenAIError(c, http.StatusInternalServerError, ErrorTypeServer, ErrorCodeInternal,
+			"保存API密钥状态失败: "+err.Error())
+		return
+	}
+	config.ResetKeyBreaker(k.Key)
+	key.InvalidatePoolState()
+	logger.Info("通过管理接口删除API密钥 %s", config.MaskKey(k.Key))
+
+	c.JSON(http.StatusOK, gin.H{
+		"deleted": true,
+		"key_id":  config.KeyID(k.Key),
+	})
+}
+
+// handleAdminImportKeys 批量导入密钥
+// JSON请求体为{"keys": "每行一个密钥的文本", "dry_run": false, "balance": 0}，
+// 其他请求体按纯文本处理，此时dry_run和balance从查询参数读取
+func handleAdminImportKeys(c *gin.Context) {
+	var req struct {
+		Keys    string  `json:"keys"`
+		DryRun  bool    `json:"dry_run"`
+		Balance float64 `json:"balance"`
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxKeysImportBytes)
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidBody,
+				"无法解析请求体: "+err.Error())
+			return
+		}
+	} else {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			RespondOpenAIError(c, http.StatusRequestEntityTooLarge, ErrorTypeInvalidRequest, ErrorCodeRequestTooLarge,
+				"导入内容过大或读取失败")
+			return
+		}
+		req.Keys = string(body)
+		req.DryRun = c.Query("dry_run") == "true"
+		req.Balance, _ = strconv.ParseFloat(c.Query("balance"), 64)
+	}
+	if strings.TrimSpace(req.Keys) == "" {
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeMissingField,
+			"请提供要导入的密钥(keys)，每行一个")
+		return
+	}
+
+	c.JSON(http.StatusOK, key.ImportKeys(req.Keys, key.ImportOptions{
+		DryRun:  req.DryRun,
+		Balance: req.Balance,
+	}))
+}
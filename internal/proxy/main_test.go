@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMain 在临时目录中运行测试，日志写入临时目录且不输出到控制台
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "flowsilicon-proxy-test-*")
+	if err != nil {
+		panic(err)
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	logger.SetGuiMode(true)
+	if err := logger.Init(); err != nil {
+		panic(err)
+	}
+	gin.SetMode(gin.TestMode)
+
+	code := m.Run()
+
+	logger.CloseLogger()
+	os.Chdir(wd)
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setupProxyTest 使用临时目录中的配置数据库和统计文件，并应用cfg
+func setupProxyTest(t *testing.T, cfg *config.Config) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := config.InitConfigDB(filepath.Join(dir, "config.db")); err != nil {
+		t.Fatalf("InitConfigDB() = %v", err)
+	}
+	t.Cleanup(func() { config.CloseConfigDB() })
+	config.UpdateConfig(cfg)
+	config.SetDailyFilePath(filepath.Join(dir, "daily.json"))
+	if err := config.InitDailyStats(); err != nil {
+		t.Fatalf("InitDailyStats() = %v", err)
+	}
+}
+
+// newTestContext 创建携带请求的gin上下文
+func newTestContext(method, path, auth string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, path, nil)
+	if auth != "" {
+		c.Request.Header.Set("Authorization", "Bearer "+auth)
+	}
+	return c, w
+}
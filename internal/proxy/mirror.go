@@ -0,0 +1,292 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/4 11:10:00
+  @desc: 影子流量：按比例将非流式请求复制到备用上游，记录对比结果，不影响主请求
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MirrorSideStats 主/镜像一侧的统计
+type MirrorSideStats struct {
+	Requests         int     `json:"requests"`
+	Success          int     `json:"success"`
+	SuccessRate      float64 `json:"success_rate"`
+	TotalLatencyMs   int64   `json:"total_latency_ms"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+}
+
+// MirrorModelComparison 单个模型的主上游与镜像上游对比
+type MirrorModelComparison struct {
+	Model   string          `json:"model"`
+	Primary MirrorSideStats `json:"primary"`
+	Mirror  MirrorSideStats `json:"mirror"`
+}
+
+// MirrorReport 镜像对比报告
+type MirrorReport struct {
+	Since   string                  `json:"since"`
+	Dropped int                     `json:"dropped"` // 因并发已满而丢弃的采样数
+	Models  []MirrorModelComparison `json:"models"`
+}
+
+var (
+	mirrorStats   = make(map[string]*MirrorModelComparison)
+	mirrorDropped int
+	mirrorSince   = time.Now()
+	mirrorMutex   sync.Mutex
+
+	// 镜像请求并发控制
+	mirrorSem      chan struct{}
+	mirrorSemSize  int
+	mirrorSemMutex sync.Mutex
+)
+
+// record 累加一次请求结果
+func (s *MirrorSideStats) record(success bool, latency time.Duration, promptTokens, completionTokens int) {
+	s.Requests++
+	if success {
+		s.Success++
+	}
+	s.TotalLatencyMs += latency.Milliseconds()
+	s.PromptTokens += promptTokens
+	s.CompletionTokens += completionTokens
+	s.SuccessRate = float64(s.Success) / float64(s.Requests)
+	s.AvgLatencyMs = float64(s.TotalLatencyMs) / float64(s.Requests)
+}
+
+// mirrorCategory 根据请求路径判断接口类别
+func mirrorCategory(path string) string {
+	switch {
+	case strings.Contains(path, "/chat/completions"):
+		return "chat"
+	case strings.Contains(path, "/completions"):
+		return "completions"
+	case strings.Contains(path, "/embeddings"):
+		return "embeddings"
+	case strings.Contains(path, "/rerank"):
+		return "rerank"
+	case strings.Contains(path, "/images/generations"):
+		return "images"
+	default:
+		return "other"
+	}
+}
+
+// shouldMirror 判断当前请求是否需要镜像
+func shouldMirror(mirrorCfg config.MirrorConfig, path string) bool {
+	if !mirrorCfg.Enabled || mirrorCfg.BaseURL == "" || mirrorCfg.SamplePercent <= 0 {
+		return false
+	}
+
+	category := mirrorCategory(path)
+	enabled := false
+	for _, c := range mirrorCfg.Categories {
+		if strings.EqualFold(c, category) {
+			enabled = true
+			break
+		}
+	}
+	if !enabled {
+		return false
+	}
+
+	return rand.Float64()*100 < mirrorCfg.SamplePercent
+}
+
+// acquireMirrorSlot 获取镜像并发槽位，已满时返回false
+func acquireMirrorSlot(maxConcurrent int) (chan struct{}, bool) {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 4
+	}
+
+	mirrorSemMutex.Lock()
+	if mirrorSem == nil || mirrorSemSize != maxConcurrent {
+		mirrorSem = make(chan struct{}, maxConcurrent)
+		mirrorSemSize = maxConcurrent
+	}
+	sem := mirrorSem
+	mirrorSemMutex.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return sem, true
+	default:
+		return nil, false
+	}
+}
+
+// sanitizeMirrorBody 按配置替换或移除请求体中的客户端标识
+func sanitizeMirrorBody(body []byte, replaceUser string) []byte {
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return body
+	}
+
+	if _, ok := requestData["user"]; !ok {
+		return body
+	}
+	if replaceUser != "" {
+		requestData["user"] = replaceUser
+	} else {
+		delete(requestData, "user")
+	}
+
+	sanitized, err := json.Marshal(requestData)
+	if err != nil {
+		return body
+	}
+	return sanitized
+}
+
+// mirrorRequest 在主请求完成后异步复制请求到备用上游
+// primaryURL 为主请求的完整地址，用于推导镜像地址
+func mirrorRequest(originalReq *http.Request, primaryURL string, body []byte, modelName string,
+	primarySuccess bool, primaryLatency time.Duration, primaryRespBody []byte) {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return
+	}
+	mirrorCfg := cfg.ApiProxy.Mirror
+	if !shouldMirror(mirrorCfg, primaryURL) {
+		return
+	}
+
+	sem, ok := acquireMirrorSlot(mirrorCfg.MaxConcurrent)
+	if !ok {
+		mirrorMutex.Lock()
+		mirrorDropped++
+		mirrorMutex.Unlock()
+		return
+	}
+
+	// 在当前协程内复制所需数据，避免异步读取已结束请求的状态
+	suffix := strings.TrimPrefix(primaryURL, strings.TrimRight(cfg.ApiProxy.BaseURL, "/"))
+	mirrorURL := strings.TrimRight(mirrorCfg.BaseURL, "/") + suffix
+	headers := originalReq.Header.Clone()
+	method := originalReq.Method
+	mirrorBody := sanitizeMirrorBody(body, mirrorCfg.ReplaceUser)
+	primaryPrompt, primaryCompletion := extractTokenCounts(primaryRespBody)
+
+	if modelName == "" {
+		modelName = "unknown"
+	}
+
+	go func() {
+		defer func() { <-sem }()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("镜像请求发生异常: %v", r)
+			}
+		}()
+
+		timeout := time.Duration(mirrorCfg.TimeoutSeconds) * time.Second
+		if timeout <= 0 {
+			timeout = 60 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, method, mirrorURL, bytes.NewBuffer(mirrorBody))
+		if err != nil {
+			logger.Error("创建镜像请求失败: %v", err)
+			return
+		}
+
+		for name, values := range headers {
+			if isGatewayOnlyHeader(name) || strings.EqualFold(name, "content-length") {
+				continue
+			}
+			if isStrippedHeader(name, mirrorCfg.StripHeaders) {
+				continue
+			}
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+		req.Header.Set("Authorization", "Bearer "+mirrorCfg.ApiKey)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Encoding", "identity")
+
+		start := time.Now()
+		resp, err := utils.CreateClientWithTimeout(timeout).Do(req)
+		var mirrorSuccess bool
+		var respBody []byte
+		if err == nil {
+			respBody, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			mirrorSuccess = err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300
+		}
+		mirrorLatency := time.Since(start)
+		if err != nil {
+			logger.Warn("镜像请求失败: %v", err)
+		}
+		mirrorPrompt, mirrorCompletion := extractTokenCounts(respBody)
+
+		mirrorMutex.Lock()
+		defer mirrorMutex.Unlock()
+		comparison, ok := mirrorStats[modelName]
+		if !ok {
+			comparison = &MirrorModelComparison{Model: modelName}
+			mirrorStats[modelName] = comparison
+		}
+		comparison.Primary.record(primarySuccess, primaryLatency, primaryPrompt, primaryCompletion)
+		comparison.Mirror.record(mirrorSuccess, mirrorLatency, mirrorPrompt, mirrorCompletion)
+	}()
+}
+
+// isStrippedHeader 判断请求头是否在移除列表中
+func isStrippedHeader(name string, stripHeaders []string) bool {
+	for _, h := range stripHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMirrorReport 获取镜像对比报告
+func GetMirrorReport() MirrorReport {
+	mirrorMutex.Lock()
+	defer mirrorMutex.Unlock()
+
+	report := MirrorReport{
+		Since:   mirrorSince.Format(time.RFC3339),
+		Dropped: mirrorDropped,
+		Models:  make([]MirrorModelComparison, 0, len(mirrorStats)),
+	}
+	for _, comparison := range mirrorStats {
+		report.Models = append(report.Models, *comparison)
+	}
+	sort.Slice(report.Models, func(i, j int) bool {
+		return report.Models[i].Model < report.Models[j].Model
+	})
+	return report
+}
+
+// ResetMirrorReport 清空镜像对比报告
+func ResetMirrorReport() {
+	mirrorMutex.Lock()
+	defer mirrorMutex.Unlock()
+
+	mirrorStats = make(map[string]*MirrorModelComparison)
+	mirrorDropped = 0
+	mirrorSince = time.Now()
+}
@@ -0,0 +1,308 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 16:40:00
+  @desc: 按OpenAI错误格式返回网关自身产生的错误，并透传或包装上游错误
+**/
+
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAI错误类型
+const (
+	ErrorTypeInvalidRequest = "invalid_request_error" // 请求参数错误
+	ErrorTypeAuthentication = "authentication_error"  // 鉴权失败
+	ErrorTypePermission     = "permission_error"      // 无权访问（如模型被禁用）
+	ErrorTypeRateLimit      = "rate_limit_error"      // 限流或没有可用密钥
+	ErrorTypeTimeout        = "timeout_error"         // 超时
+	ErrorTypeServer         = "server_error"          // 网关内部错误或上游服务错误
+)
+
+// 网关产生的错误代码
+const (
+	ErrorCodeInvalidBody          = "invalid_request_body"
+	ErrorCodeMissingField         = "missing_required_field"
+	ErrorCodeRequestTooLarge      = "request_too_large"
+	ErrorCodeInvalidAPIKey        = "invalid_api_key"
+	ErrorCodeModelDisabled        = "model_disabled"
+	ErrorCodeAdminRequired        = "admin_required"
+	ErrorCodeFailureNotFound      = "failure_not_found"
+	ErrorCodeKeyNotFound          = "key_not_found"
+	ErrorCodeKeyExists            = "key_already_exists"
+	ErrorCodeVirtualKeyNotFound   = "virtual_key_not_found"
+	ErrorCodeModelNotAllowed      = "model_not_allowed"
+	ErrorCodeRateLimitExceeded    = "rate_limit_exceeded"
+	ErrorCodeQuotaExceeded        = "insufficient_quota"
+	ErrorCodeNoAvailableKeys      = "no_available_keys"
+	ErrorCodeAllKeysCoolingDown   = "all_keys_cooling_down"
+	ErrorCodeQueueTimeout         = "queue_timeout"
+	ErrorCodeProxyPaused          = "proxy_paused"
+	ErrorCodeUpstreamTimeout      = "context_deadline_exceeded"
+	ErrorCodeFirstByteTimeout     = "first_byte_timeout"
+	ErrorCodeStreamIdleTimeout    = "stream_idle_timeout"
+	ErrorCodeUpstreamUnreachable  = "upstream_unreachable"
+	ErrorCodeUpstreamReadFailed   = "upstream_read_failed"
+	ErrorCodeAllRetriesFailed     = "all_retries_failed"
+	ErrorCodeStreamingUnsupported = "streaming_unsupported"
+	ErrorCodeInternal             = "internal_error"
+	ErrorCodeUpstreamError        = "upstream_error"
+)
+
+const (
+	// requestIDKey 上下文中保存请求ID的键
+	requestIDKey = "request_id"
+	// requestIDHeader 请求ID的响应头
+	requestIDHeader = "X-Request-ID"
+	// lastUpstreamErrorKey 上下文中保存最近一次上游失败（错误响应或发送错误）的键
+	lastUpstreamErrorKey = "last_upstream_error"
+	// maxUpstreamErrorMessage 包装非JSON上游错误时保留的最大字符数
+	maxUpstreamErrorMessage = 512
+)
+
+// secretPattern 匹配可能出现在错误信息中的密钥
+var secretPattern = regexp.MustCompile(`(?i)(sk-[a-z0-9_\-]{6,}|bearer\s+[a-z0-9_\-\.]+)`)
+
+// OpenAIErrorBody OpenAI格式的错误内容
+type OpenAIErrorBody struct {
+	Message   string  `json:"message"`
+	Type      string  `json:"type"`
+	Param     *string `json:"param"`
+	Code      string  `json:"code"`
+	RequestID string  `json:"request_id,omitempty"`
+}
+
+// upstreamError 上游返回的错误响应
+type upstreamError struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+// Error 实现error接口
+func (e *upstreamError) Error() string {
+	return "上游返回状态码 " + strconv.Itoa(e.status)
+}
+
+// upstreamReadError 读取上游响应失败的错误
+type upstreamReadError struct {
+	err error
+}
+
+// Error 实现error接口
+func (e *upstreamReadError) Error() string {
+	return "读取上游响应失败: " + e.err.Error()
+}
+
+// RequestID 获取当前请求的ID，客户端通过X-Request-ID传入合法值时沿用，否则生成新ID
+// 首次调用时写入响应头
+func RequestID(c *gin.Context) string {
+	if id := c.GetString(requestIDKey); id != "" {
+		return id
+	}
+
+	id := c.GetHeader(requestIDHeader)
+	if !isValidRequestID(id) {
+		id = newRequestID()
+	}
+	c.Set(requestIDKey, id)
+	c.Header(requestIDHeader, id)
+	return id
+}
+
+// isValidRequestID 请求ID只允许字母、数字、下划线和短横线，最长64个字符
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID 生成新的请求ID
+func newRequestID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "req_unknown"
+	}
+	return "req_" + hex.EncodeToString(buf)
+}
+
+// RespondOpenAIError 以OpenAI错误格式返回网关产生的错误并中止请求
+// message 只应包含面向客户端的说明，详细的内部错误应写入日志
+func RespondOpenAIError(c *gin.Context, status int, errType, code, message string) {
+	respondOpenAIErrorWithFields(c, status, errType, code, message, nil)
+}
+
+// respondOpenAIErrorWithFields 返回OpenAI格式的错误，fields为附加在error对象中的额外字段
+func respondOpenAIErrorWithFields(c *gin.Context, status int, errType, code, message string, fields gin.H) {
+	body := OpenAIErrorBody{
+		Message:   scrubSecrets(message),
+		Type:      errType,
+		Code:      code,
+		RequestID: RequestID(c),
+	}
+
+	var payload interface{} = gin.H{"error": body}
+	if len(fields) > 0 {
+		errObj := gin.H{
+			"message":    body.Message,
+			"type":       body.Type,
+			"param":      nil,
+			"code":       body.Code,
+			"request_id": body.RequestID,
+		}
+		for k, v := range fields {
+			errObj[k] = v
+		}
+		payload = gin.H{"error": errObj}
+	}
+
+	// 流式请求可能已设置event-stream，错误响应统一使用JSON
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.AbortWithStatusJSON(status, payload)
+}
+
+// respondModelDisabled 模型被禁用时的响应
+func respondModelDisabled(c *gin.Context, modelName string) {
+	config.AddRejectedRequest(ErrorCodeModelDisabled)
+	RespondOpenAIError(c, http.StatusForbidden, ErrorTypePermission, ErrorCodeModelDisabled,
+		"模型 "+modelName+" 已被禁用")
+}
+
+// respondInternalError 网关内部错误的响应，不向客户端暴露错误详情
+func respondInternalError(c *gin.Context, message string) {
+	RespondOpenAIError(c, http.StatusInternalServerError, ErrorTypeServer, ErrorCodeInternal, message)
+}
+
+// respondSendError 发送上游请求失败时的响应，区分超时与连接失败
+// 客户端已断开时不写入响应
+func respondSendError(c *gin.Context, err error) {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "context deadline exceeded") || strings.Contains(msg, "timeout"):
+		RespondOpenAIError(c, http.StatusGatewayTimeout, ErrorTypeTimeout, ErrorCodeUpstreamTimeout,
+			"请求处理超时，已达到最大响应时间限制")
+	case strings.Contains(msg, "canceled"):
+		// 客户端已断开，不需要返回任何内容
+	default:
+		RespondOpenAIError(c, http.StatusBadGateway, ErrorTypeServer, ErrorCodeUpstreamUnreachable,
+			"无法连接上游服务")
+	}
+}
+
+// rememberUpstreamError 记录上游返回的错误响应，重试全部失败后透传给客户端
+func rememberUpstreamError(c *gin.Context, resp *http.Response, body []byte) {
+	c.Set(lastUpstreamErrorKey, &upstreamError{
+		status:      resp.StatusCode,
+		contentType: resp.Header.Get("Content-Type"),
+		body:        body,
+	})
+}
+
+// rememberSendError 记录发送上游请求时的错误，重试全部失败后据此返回
+func rememberSendError(c *gin.Context, err error) {
+	c.Set(lastUpstreamErrorKey, err)
+}
+
+// rememberReadError 记录读取上游响应时的错误，重试全部失败后据此返回
+func rememberReadError(c *gin.Context, err error) {
+	c.Set(lastUpstreamErrorKey, &upstreamReadError{err: err})
+}
+
+// respondUpstreamFailure 请求最终失败且尚未写入响应时返回错误
+// 最近一次失败是上游错误响应时透传或包装，是发送错误时按超时或连接失败返回
+func respondUpstreamFailure(c *gin.Context) {
+	if c.Writer.Written() || c.IsAborted() {
+		return
+	}
+
+	if value, ok := c.Get(lastUpstreamErrorKey); ok {
+		switch last := value.(type) {
+		case *upstreamError:
+			respondUpstreamError(c, last.status, last.contentType, last.body)
+			return
+		case *upstreamReadError:
+			RespondOpenAIError(c, http.StatusBadGateway, ErrorTypeServer, ErrorCodeUpstreamReadFailed, "读取上游响应失败")
+			return
+		case error:
+			respondSendError(c, last)
+			return
+		}
+	}
+
+	RespondOpenAIError(c, http.StatusBadGateway, ErrorTypeServer, ErrorCodeAllRetriesFailed,
+		"所有重试均失败")
+}
+
+// respondUpstreamError 返回上游错误，JSON格式原样透传，其他格式包装为OpenAI错误格式
+func respondUpstreamError(c *gin.Context, status int, contentType string, body []byte) {
+	RequestID(c)
+
+	trimmed := strings.TrimSpace(string(body))
+	if trimmed != "" && json.Valid([]byte(trimmed)) {
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		c.Header("Content-Type", contentType)
+		c.Status(status)
+		c.Writer.Write(body)
+		c.Abort()
+		return
+	}
+
+	message := trimmed
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	message = truncateMessage(message, maxUpstreamErrorMessage)
+
+	RespondOpenAIError(c, status, upstreamErrorType(status), ErrorCodeUpstreamError, message)
+}
+
+// upstreamErrorType 根据上游状态码推断错误类型
+func upstreamErrorType(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return ErrorTypeAuthentication
+	case status == http.StatusForbidden:
+		return ErrorTypePermission
+	case status == http.StatusTooManyRequests:
+		return ErrorTypeRateLimit
+	case status == http.StatusGatewayTimeout || status == http.StatusRequestTimeout:
+		return ErrorTypeTimeout
+	case status >= 400 && status < 500:
+		return ErrorTypeInvalidRequest
+	default:
+		return ErrorTypeServer
+	}
+}
+
+// truncateMessage 按字符截断错误信息
+func truncateMessage(message string, limit int) string {
+	if utf8.RuneCountInString(message) <= limit {
+		return message
+	}
+	runes := []rune(message)
+	return string(runes[:limit]) + "..."
+}
+
+// scrubSecrets 遮盖错误信息中可能出现的密钥
+func scrubSecrets(message string) string {
+	return secretPattern.ReplaceAllString(message, "[REDACTED]")
+}
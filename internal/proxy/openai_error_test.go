@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"errors"
+	"flowsilicon/internal/config"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// assertOpenAIErrorSchema 检查响应为OpenAI格式的错误，返回error对象
+func assertOpenAIErrorSchema(t *testing.T, status int, body []byte, header http.Header, wantStatus int, wantType, wantCode string) map[string]interface{} {
+	t.Helper()
+	if status != wantStatus {
+		t.Fatalf("状态码 = %d, want %d: %s", status, wantStatus, body)
+	}
+	if ct := header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	fields := decodeErrorFields(t, body)
+	for _, key := range []string{"message", "type", "param", "code", "request_id"} {
+		if _, ok := fields[key]; !ok {
+			t.Fatalf("error对象缺少 %s 字段: %s", key, body)
+		}
+	}
+	if fields["param"] != nil {
+		t.Fatalf("param = %v, want null", fields["param"])
+	}
+	if msg, _ := fields["message"].(string); msg == "" {
+		t.Fatalf("message不能为空: %s", body)
+	}
+	if fields["type"] != wantType || fields["code"] != wantCode {
+		t.Fatalf("type/code = %v/%v, want %s/%s", fields["type"], fields["code"], wantType, wantCode)
+	}
+	if id, _ := fields["request_id"].(string); id == "" || id != header.Get(requestIDHeader) {
+		t.Fatalf("request_id = %v, X-Request-ID = %q", fields["request_id"], header.Get(requestIDHeader))
+	}
+	return fields
+}
+
+func TestLocalFailureModesUseOpenAIErrorSchema(t *testing.T) {
+	setupProxyTest(t, &config.Config{})
+
+	tests := []struct {
+		name     string
+		respond  func(c *gin.Context)
+		status   int
+		errType  string
+		errCode  string
+		contains string
+	}{
+		{"模型被禁用", func(c *gin.Context) { respondModelDisabled(c, "model-a") },
+			http.StatusForbidden, ErrorTypePermission, ErrorCodeModelDisabled, "model-a"},
+		{"内部错误", func(c *gin.Context) { respondInternalError(c, "处理请求失败") },
+			http.StatusInternalServerError, ErrorTypeServer, ErrorCodeInternal, ""},
+		{"上游超时", func(c *gin.Context) { respondSendError(c, errors.New("context deadline exceeded")) },
+			http.StatusGatewayTimeout, ErrorTypeTimeout, ErrorCodeUpstreamTimeout, ""},
+		{"无法连接上游", func(c *gin.Context) { respondSendError(c, errors.New("dial tcp: connection refused")) },
+			http.StatusBadGateway, ErrorTypeServer, ErrorCodeUpstreamUnreachable, ""},
+		{"读取上游响应失败", func(c *gin.Context) {
+			rememberReadError(c, errors.New("unexpected EOF"))
+			respondUpstreamFailure(c)
+		}, http.StatusBadGateway, ErrorTypeServer, ErrorCodeUpstreamReadFailed, ""},
+		{"重试全部失败", respondUpstreamFailure,
+			http.StatusBadGateway, ErrorTypeServer, ErrorCodeAllRetriesFailed, ""},
+		{"非JSON上游错误", func(c *gin.Context) {
+			respondUpstreamError(c, http.StatusTooManyRequests, "text/plain", []byte("slow down, key sk-abcdef123456"))
+		}, http.StatusTooManyRequests, ErrorTypeRateLimit, ErrorCodeUpstreamError, "[REDACTED]"},
+		{"空的上游错误", func(c *gin.Context) { respondUpstreamError(c, http.StatusServiceUnavailable, "", nil) },
+			http.StatusServiceUnavailable, ErrorTypeServer, ErrorCodeUpstreamError, "Service Unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := newTestContext(http.MethodPost, "/v1/chat/completions", "")
+			tt.respond(c)
+			fields := assertOpenAIErrorSchema(t, w.Code, w.Body.Bytes(), w.Header(), tt.status, tt.errType, tt.errCode)
+			if msg := fields["message"].(string); !strings.Contains(msg, tt.contains) || strings.Contains(msg, "sk-abcdef") {
+				t.Fatalf("message = %q, 应包含 %q 且不包含密钥", msg, tt.contains)
+			}
+		})
+	}
+}
+
+func TestRequestIDFromClientIsKept(t *testing.T) {
+	c, w := newTestContext(http.MethodPost, "/v1/chat/completions", "")
+	c.Request.Header.Set(requestIDHeader, "client-id_1")
+	respondInternalError(c, "处理请求失败")
+	if fields := decodeErrorFields(t, w.Body.Bytes()); fields["request_id"] != "client-id_1" {
+		t.Fatalf("request_id = %v, want client-id_1", fields["request_id"])
+	}
+
+	c, w = newTestContext(http.MethodPost, "/v1/chat/completions", "")
+	c.Request.Header.Set(requestIDHeader, "bad id\n")
+	respondInternalError(c, "处理请求失败")
+	if id := decodeErrorFields(t, w.Body.Bytes())["request_id"]; id == "bad id\n" || !strings.HasPrefix(id.(string), "req_") {
+		t.Fatalf("不合法的请求ID应重新生成: %v", id)
+	}
+}
+
+func TestJSONUpstreamErrorPassesThrough(t *testing.T) {
+	c, w := newTestContext(http.MethodPost, "/v1/chat/completions", "")
+	body := `{"error":{"message":"bad model","type":"invalid_request_error","code":"model_not_found"}}`
+	respondUpstreamError(c, http.StatusNotFound, "application/json", []byte(body))
+	if w.Code != http.StatusNotFound || w.Body.String() != body {
+		t.Fatalf("JSON格式的上游错误应原样透传: %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get(requestIDHeader) == "" {
+		t.Fatal("透传上游错误时同样应返回X-Request-ID")
+	}
+}
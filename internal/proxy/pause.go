@@ -0,0 +1,26 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 20:10:00
+  @desc: 代理因用量异常被暂停时拒绝请求
+**/
+
+package proxy
+
+import (
+	"flowsilicon/internal/config"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkProxyPaused 代理被暂停时返回503，返回false表示已写入错误响应
+func checkProxyPaused(c *gin.Context) bool {
+	pause := config.GetProxyPause()
+	if !pause.Paused {
+		return true
+	}
+	config.AddRejectedRequest(ErrorCodeProxyPaused)
+	RespondOpenAIError(c, http.StatusServiceUnavailable, ErrorTypeServer, ErrorCodeProxyPaused,
+		"代理已暂停: "+pause.Reason)
+	return false
+}
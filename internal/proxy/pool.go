@@ -0,0 +1,67 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/3 11:45:00
+  @desc: 向下游客户端透出密钥池状态和限流信息
+**/
+
+package proxy
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientRemainingContextKey 上下文中保存客户端在当前限流窗口内剩余请求数的键，由虚拟密钥校验写入
+const clientRemainingContextKey = "client_remaining_requests"
+
+// setPoolHeaders 在响应中附加密钥池状态头，便于客户端自行限流
+// 请求使用了限速的虚拟密钥时，同时附加该客户端在当前窗口内的剩余请求数
+func setPoolHeaders(c *gin.Context) {
+	state := key.GetPoolState()
+	c.Header("X-FS-Keys-Available", strconv.Itoa(state.AvailableKeys))
+	if remaining, ok := c.Get(clientRemainingContextKey); ok {
+		c.Header("X-FS-Client-Remaining-Requests", strconv.Itoa(remaining.(int)))
+	}
+}
+
+// setRetryAfter 按等待时间设置Retry-After响应头，向上取整到秒且至少为1秒，返回设置的秒数
+func setRetryAfter(c *gin.Context, wait time.Duration) int {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	return seconds
+}
+
+// respondNoAvailableKeys 没有可用密钥时的响应，返回响应中的错误码
+// 若存在冷却中的密钥，返回429并通过Retry-After告知最近的冷却到期时间
+func respondNoAvailableKeys(c *gin.Context, message string) string {
+	state := key.GetPoolState()
+	c.Header("X-FS-Keys-Available", strconv.Itoa(state.AvailableKeys))
+
+	retryAfter := state.RetryAfterSeconds()
+	if state.AvailableKeys == 0 && retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		respondOpenAIErrorWithFields(c, http.StatusTooManyRequests, ErrorTypeRateLimit, ErrorCodeAllKeysCoolingDown,
+			"所有API密钥均在冷却中，请稍后重试", gin.H{
+				"limit":       "key_pool",
+				"retry_after": retryAfter,
+			})
+		return ErrorCodeAllKeysCoolingDown
+	}
+
+	RespondOpenAIError(c, http.StatusServiceUnavailable, ErrorTypeServer, ErrorCodeNoAvailableKeys, message)
+	return ErrorCodeNoAvailableKeys
+}
+
+// rejectNoAvailableKeys 首次尝试前就没有可用密钥（如密钥配额用尽、全部冷却）时的响应，按本地拒绝统计
+// 重试时没有可用密钥的请求已发送过上游并记录了结果，使用respondNoAvailableKeys避免重复计数
+func rejectNoAvailableKeys(c *gin.Context, message string) {
+	config.AddRejectedRequest(respondNoAvailableKeys(c, message))
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"flowsilicon/internal/config"
+	"net/http"
+	"testing"
+)
+
+func TestRejectNoAvailableKeysCountsRejection(t *testing.T) {
+	setupProxyTest(t, &config.Config{})
+
+	c, w := newTestContext(http.MethodPost, "/v1/chat/completions", "")
+	rejectNoAvailableKeys(c, "No suitable API keys available")
+	if w.Code != http.StatusServiceUnavailable && w.Code != http.StatusTooManyRequests {
+		t.Fatalf("状态码 = %d, want 503或429", w.Code)
+	}
+	code, _ := decodeErrorFields(t, w.Body.Bytes())["code"].(string)
+	reasons, err := config.GetRejectedReasons("")
+	if err != nil || reasons[code] != 1 {
+		t.Fatalf("没有可用密钥应按 %s 记录本地拒绝: %v, %v", code, reasons, err)
+	}
+
+	// 重试时没有可用密钥不再计入拒绝
+	c, _ = newTestContext(http.MethodPost, "/v1/chat/completions", "")
+	respondNoAvailableKeys(c, "No suitable API keys available for retry")
+	if stats, _, _ := config.GetDailyStats(""); stats.Requests.Rejected != 1 || stats.Requests.Failed != 0 {
+		t.Fatalf("请求统计 = %+v, want 拒绝1、失败0", stats.Requests)
+	}
+}
@@ -0,0 +1,69 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 18:20:00
+  @desc: 流式请求的首字节超时重试与数据块空闲超时处理
+**/
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamFirstByteMsKey 上下文中记录流式请求首字节延迟（毫秒）的键
+const streamFirstByteMsKey = "stream_first_byte_ms"
+
+var (
+	// errStreamFirstByteTimeout 在首字节超时内没有收到上游数据
+	errStreamFirstByteTimeout = errors.New("流式请求首字节超时")
+	// errStreamIdleTimeout 两个数据块之间的间隔超过空闲超时
+	errStreamIdleTimeout = errors.New("流式响应空闲超时")
+)
+
+// readFirstStreamEvent 读取到首个非空、非注释的SSE行为止，返回已读取的全部内容
+// 上游排队期间可能只发送空行或注释，这些不算作首个数据
+func readFirstStreamEvent(reader *bufio.Reader) ([]byte, error) {
+	var head []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		head = append(head, line...)
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) > 0 && trimmed[0] != ':' {
+			return head, nil
+		}
+		if err != nil {
+			return head, err
+		}
+	}
+}
+
+// recordFirstByteTimeout 记录一次首字节超时，本次尝试计为超时失败
+func recordFirstByteTimeout(c *gin.Context, apiKey string, timeout time.Duration) {
+	logger.Warn("流式请求首字节超时（%v），密钥: %s", timeout, utils.MaskKey(apiKey))
+	recordUpstreamAttempt(c, apiKey, 0, errStreamFirstByteTimeout)
+	config.AddStreamTimeout(config.StreamTimeoutFirstByte, apiKey)
+	key.UpdateApiKeyStatus(apiKey, false)
+}
+
+// streamIdleTimeoutEvent 空闲超时后发送给客户端的错误事件
+func streamIdleTimeoutEvent(c *gin.Context, timeout time.Duration) []byte {
+	data, _ := json.Marshal(map[string]OpenAIErrorBody{
+		"error": {
+			Message:   "上游超过" + timeout.String() + "未返回数据，流式响应已结束",
+			Type:      ErrorTypeTimeout,
+			Code:      ErrorCodeStreamIdleTimeout,
+			RequestID: RequestID(c),
+		},
+	})
+	return []byte("data: " + string(data) + "\n\n")
+}
@@ -0,0 +1,260 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/8 01:25:00
+  @desc: 代理请求的虚拟密钥校验（速率限制、每日配额、模型白名单）及虚拟密钥的管理接口
+**/
+
+package proxy
+
+import (
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// virtualKeyContextKey 上下文中保存虚拟密钥标识的键，用于按虚拟密钥统计用量
+	virtualKeyContextKey = "virtual_key_id"
+	// virtualKeysAdminPathPrefix 虚拟密钥管理接口在/api下的路径前缀
+	virtualKeysAdminPathPrefix = "/admin/virtual-keys"
+	// virtualKeyRateWindow 速率限制的统计窗口
+	virtualKeyRateWindow = time.Minute
+)
+
+var (
+	// virtualKeyRequests 每个虚拟密钥最近一个窗口内的请求时间，按时间升序
+	virtualKeyRequests      = make(map[string][]time.Time)
+	virtualKeyRequestsMutex sync.Mutex
+)
+
+// allowVirtualKeyRequest 按每分钟请求上限判断虚拟密钥是否可以发起请求，允许时记录本次请求
+// 返回当前窗口内剩余的请求数；不允许时同时返回窗口内最早的请求过期前需要等待的时间
+func allowVirtualKeyRequest(id string, rpm int, now time.Time) (bool, int, time.Duration) {
+	if rpm <= 0 {
+		return true, 0, 0
+	}
+
+	virtualKeyRequestsMutex.Lock()
+	defer virtualKeyRequestsMutex.Unlock()
+
+	times := virtualKeyRequests[id]
+	cutoff := now.Add(-virtualKeyRateWindow)
+	start := 0
+	for start < len(times) && !times[start].After(cutoff) {
+		start++
+	}
+	times = times[start:]
+	if len(times) >= rpm {
+		virtualKeyRequests[id] = times
+		return false, 0, times[0].Add(virtualKeyRateWindow).Sub(now)
+	}
+	virtualKeyRequests[id] = append(times, now)
+	return true, rpm - len(times) - 1, 0
+}
+
+// checkVirtualKey 按请求中的虚拟密钥检查启用状态、速率限制和每日配额，通过后将虚拟密钥标识写入上下文
+// 请求未使用虚拟密钥时，只有开启require后才拒绝；返回false表示已写入错误响应
+// 达到限制时的错误响应通过Retry-After告知可以重试的时间，并在limit字段中说明达到的是哪项限制
+func checkVirtualKey(c *gin.Context) bool {
+	vk, ok := config.LookupVirtualKey(clientKeyFromRequest(c))
+	if !ok {
+		if config.GetVirtualKeysConfig().Require {
+			config.AddRejectedRequest(ErrorCodeInvalidAPIKey)
+			RespondOpenAIError(c, http.StatusUnauthorized, ErrorTypeAuthentication, ErrorCodeInvalidAPIKey,
+				"请在Authorization请求头中提供有效的虚拟密钥")
+			return false
+		}
+		return true
+	}
+
+	if vk.Disabled {
+		config.AddRejectedRequest(ErrorCodeInvalidAPIKey)
+		RespondOpenAIError(c, http.StatusUnauthorized, ErrorTypeAuthentication, ErrorCodeInvalidAPIKey,
+			"虚拟密钥已停用")
+		return false
+	}
+	now := time.Now()
+	if err := config.CheckVirtualKeyQuota(vk); err != nil {
+		config.AddRejectedRequest(ErrorCodeQuotaExceeded)
+		retryAfter := setRetryAfter(c, config.VirtualKeyQuotaResetAt(now).Sub(now))
+		respondOpenAIErrorWithFields(c, http.StatusTooManyRequests, ErrorTypeRateLimit, ErrorCodeQuotaExceeded,
+			err.Error(), gin.H{
+				"limit":       "virtual_key_daily_quota",
+				"retry_after": retryAfter,
+			})
+		return false
+	}
+	allowed, remaining, wait := allowVirtualKeyRequest(vk.ID, vk.RateLimitRPM, now)
+	if !allowed {
+		config.AddRejectedRequest(ErrorCodeRateLimitExceeded)
+		c.Header("X-FS-Client-Remaining-Requests", "0")
+		retryAfter := setRetryAfter(c, wait)
+		respondOpenAIErrorWithFields(c, http.StatusTooManyRequests, ErrorTypeRateLimit, ErrorCodeRateLimitExceeded,
+			"虚拟密钥每分钟请求数已达到上限 "+strconv.Itoa(vk.RateLimitRPM), gin.H{
+				"limit":       "virtual_key_rpm",
+				"retry_after": retryAfter,
+			})
+		return false
+	}
+	if vk.RateLimitRPM > 0 {
+		c.Set(clientRemainingContextKey, remaining)
+	}
+
+	c.Set(virtualKeyContextKey, vk.ID)
+	return true
+}
+
+// checkVirtualKeyModel 检查请求使用的虚拟密钥是否允许使用该模型，返回false表示已写入错误响应
+func checkVirtualKeyModel(c *gin.Context, model string) bool {
+	id := c.GetString(virtualKeyContextKey)
+	if id == "" || model == "" {
+		return true
+	}
+	vk, ok := config.GetVirtualKey(id)
+	if !ok || vk.AllowsModel(model) {
+		return true
+	}
+	config.AddRejectedRequest(ErrorCodeModelNotAllowed)
+	RespondOpenAIError(c, http.StatusForbidden, ErrorTypePermission, ErrorCodeModelNotAllowed,
+		"虚拟密钥不允许使用模型: "+model)
+	return false
+}
+
+// adminVirtualKey 管理接口返回的虚拟密钥信息，附带今天的用量
+type adminVirtualKey struct {
+	config.VirtualKey
+	Today config.VirtualKeyUsage `json:"today"`
+}
+
+// newAdminVirtualKey 将虚拟密钥转换为管理接口返回的格式
+func newAdminVirtualKey(vk config.VirtualKey) adminVirtualKey {
+	return adminVirtualKey{VirtualKey: vk, Today: config.GetVirtualKeyTodayUsage(vk.ID)}
+}
+
+// handleVirtualKeysAdmin 处理/api/admin/virtual-keys下的管理接口，返回false表示不是管理接口，继续代理
+// GET /api/admin/virtual-keys 列出所有虚拟密钥及今天的用量
+// POST /api/admin/virtual-keys 创建虚拟密钥，响应中的key只返回这一次
+// GET /api/admin/virtual-keys/{id} 获取单个虚拟密钥
+// PATCH /api/admin/virtual-keys/{id} 修改名称、限制、模型白名单或停用
+// DELETE /api/admin/virtual-keys/{id} 删除虚拟密钥
+// GET /api/admin/virtual-keys/{id}/usage?days=7 获取最近几天的每日用量
+func handleVirtualKeysAdmin(c *gin.Context) bool {
+	path := c.Param("path")
+	if path != virtualKeysAdminPathPrefix && !strings.HasPrefix(path, virtualKeysAdminPathPrefix+"/") {
+		return false
+	}
+
+	if !isAdminRequest(c) {
+		RespondOpenAIError(c, http.StatusForbidden, ErrorTypePermission, ErrorCodeAdminRequired,
+			"虚拟密钥管理需要管理权限")
+		return true
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(path, virtualKeysAdminPathPrefix), "/")
+	id, sub, _ := strings.Cut(rest, "/")
+	method := c.Request.Method
+	switch {
+	case id == "" && method == http.MethodGet:
+		keys := config.ListVirtualKeys()
+		result := make([]adminVirtualKey, 0, len(keys))
+		for _, vk := range keys {
+			result = append(result, newAdminVirtualKey(vk))
+		}
+		c.JSON(http.StatusOK, gin.H{"virtual_keys": result})
+	case id == "" && method == http.MethodPost:
+		handleAdminCreateVirtualKey(c)
+	case id != "" && sub == "" && method == http.MethodGet:
+		vk, ok := config.GetVirtualKey(id)
+		if !ok {
+			respondVirtualKeyNotFound(c, id)
+			return true
+		}
+		c.JSON(http.StatusOK, newAdminVirtualKey(vk))
+	case id != "" && sub == "" && method == http.MethodPatch:
+		handleAdminUpdateVirtualKey(c, id)
+	case id != "" && sub == "" && method == http.MethodDelete:
+		if err := config.DeleteVirtualKey(id); err != nil {
+			respondVirtualKeyError(c, id, err)
+			return true
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": true, "id": id})
+	case id != "" && sub == "usage" && method == http.MethodGet:
+		if _, ok := config.GetVirtualKey(id); !ok {
+			respondVirtualKeyNotFound(c, id)
+			return true
+		}
+		days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
+		usage, err := config.GetVirtualKeyUsage(id, days)
+		if err != nil {
+			RespondOpenAIError(c, http.StatusInternalServerError, ErrorTypeServer, ErrorCodeInternal,
+				"获取虚拟密钥用量失败: "+err.Error())
+			return true
+		}
+		c.JSON(http.StatusOK, gin.H{"id": id, "usage": usage})
+	default:
+		RespondOpenAIError(c, http.StatusNotFound, ErrorTypeInvalidRequest, ErrorCodeVirtualKeyNotFound,
+			"未知的虚拟密钥管理接口")
+	}
+	return true
+}
+
+// respondVirtualKeyNotFound 返回虚拟密钥不存在的错误
+func respondVirtualKeyNotFound(c *gin.Context, id string) {
+	RespondOpenAIError(c, http.StatusNotFound, ErrorTypeInvalidRequest, ErrorCodeVirtualKeyNotFound,
+		"虚拟密钥不存在: "+id)
+}
+
+// respondVirtualKeyError 按错误类型返回虚拟密钥操作失败的响应
+func respondVirtualKeyError(c *gin.Context, id string, err error) {
+	switch {
+	case errors.Is(err, config.ErrVirtualKeyNotFound):
+		respondVirtualKeyNotFound(c, id)
+	case errors.Is(err, config.ErrVirtualKeyInvalid):
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidBody, err.Error())
+	default:
+		RespondOpenAIError(c, http.StatusInternalServerError, ErrorTypeServer, ErrorCodeInternal, err.Error())
+	}
+}
+
+// handleAdminCreateVirtualKey 创建虚拟密钥，返回201和原始密钥
+func handleAdminCreateVirtualKey(c *gin.Context) {
+	var spec config.VirtualKeySpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidBody,
+			"无法解析请求体: "+err.Error())
+		return
+	}
+	vk, secret, err := config.CreateVirtualKey(spec)
+	if err != nil {
+		respondVirtualKeyError(c, "", err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"key":         secret,
+		"virtual_key": newAdminVirtualKey(vk),
+	})
+}
+
+// handleAdminUpdateVirtualKey 修改虚拟密钥，只修改请求中提供的字段
+func handleAdminUpdateVirtualKey(c *gin.Context, id string) {
+	var spec config.VirtualKeySpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		RespondOpenAIError(c, http.StatusBadRequest, ErrorTypeInvalidRequest, ErrorCodeInvalidBody,
+			"无法解析请求体: "+err.Error())
+		return
+	}
+	vk, err := config.UpdateVirtualKey(id, spec)
+	if err != nil {
+		respondVirtualKeyError(c, id, err)
+		return
+	}
+	logger.Info("已修改虚拟密钥 %s", id)
+	c.JSON(http.StatusOK, newAdminVirtualKey(vk))
+}
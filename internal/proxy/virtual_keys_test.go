@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAllowVirtualKeyRequestRemaining(t *testing.T) {
+	now := time.Now()
+	id := "vk_test_remaining"
+	t.Cleanup(func() {
+		virtualKeyRequestsMutex.Lock()
+		delete(virtualKeyRequests, id)
+		virtualKeyRequestsMutex.Unlock()
+	})
+
+	for want := 1; want >= 0; want-- {
+		ok, remaining, _ := allowVirtualKeyRequest(id, 2, now)
+		if !ok || remaining != want {
+			t.Fatalf("allowVirtualKeyRequest() = %v, %d, want true, %d", ok, remaining, want)
+		}
+	}
+	ok, remaining, wait := allowVirtualKeyRequest(id, 2, now.Add(10*time.Second))
+	if ok || remaining != 0 || wait != 50*time.Second {
+		t.Fatalf("allowVirtualKeyRequest() = %v, %d, %v, want false, 0, 50s", ok, remaining, wait)
+	}
+
+	// 窗口过期后恢复全部名额
+	ok, remaining, _ = allowVirtualKeyRequest(id, 2, now.Add(time.Minute+time.Second))
+	if !ok || remaining != 1 {
+		t.Fatalf("窗口过期后 allowVirtualKeyRequest() = %v, %d, want true, 1", ok, remaining)
+	}
+}
+
+// decodeErrorFields 解析错误响应中error对象的字段
+func decodeErrorFields(t *testing.T, body []byte) map[string]interface{} {
+	t.Helper()
+	var payload struct {
+		Error map[string]interface{} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("解析错误响应失败: %v, %s", err, body)
+	}
+	return payload.Error
+}
+
+func TestCheckVirtualKeyRateLimitHeaders(t *testing.T) {
+	setupProxyTest(t, &config.Config{})
+	rpm := 2
+	vk, secret, err := config.CreateVirtualKey(config.VirtualKeySpec{RateLimitRPM: &rpm})
+	if err != nil {
+		t.Fatalf("CreateVirtualKey() = %v", err)
+	}
+
+	for want := 1; want >= 0; want-- {
+		c, w := newTestContext(http.MethodPost, "/v1/chat/completions", secret)
+		if !checkVirtualKey(c) {
+			t.Fatalf("第%d个请求不应被限流: %s", rpm-want, w.Body.String())
+		}
+		setPoolHeaders(c)
+		if got := w.Header().Get("X-FS-Client-Remaining-Requests"); got != strconv.Itoa(want) {
+			t.Fatalf("X-FS-Client-Remaining-Requests = %q, want %d", got, want)
+		}
+		if c.GetString(virtualKeyContextKey) != vk.ID {
+			t.Fatal("应将虚拟密钥标识写入上下文")
+		}
+	}
+
+	c, w := newTestContext(http.MethodPost, "/v1/chat/completions", secret)
+	if checkVirtualKey(c) {
+		t.Fatal("超过每分钟上限的请求应被拒绝")
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("状态码 = %d, want 429", w.Code)
+	}
+	retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After"))
+	if retryAfter < 1 || retryAfter > 60 {
+		t.Fatalf("Retry-After = %q, 应为1到60秒", w.Header().Get("Retry-After"))
+	}
+	if fields := decodeErrorFields(t, w.Body.Bytes()); fields["limit"] != "virtual_key_rpm" {
+		t.Fatalf("limit = %v, want virtual_key_rpm", fields["limit"])
+	}
+	if reasons, _ := config.GetRejectedReasons(""); reasons[ErrorCodeRateLimitExceeded] != 1 {
+		t.Fatalf("超过每分钟上限应按本地拒绝统计: %v", reasons)
+	}
+}
+
+func TestCheckVirtualKeyQuotaRetryAfter(t *testing.T) {
+	setupProxyTest(t, &config.Config{})
+	limit := 1
+	vk, secret, err := config.CreateVirtualKey(config.VirtualKeySpec{DailyRequestLimit: &limit})
+	if err != nil {
+		t.Fatalf("CreateVirtualKey() = %v", err)
+	}
+	config.AddDailyRequestRecord(config.DailyRequestRecord{
+		Model:        "model-a",
+		RequestCount: 1,
+		IsSuccess:    true,
+		VirtualKey:   vk.ID,
+	})
+
+	c, w := newTestContext(http.MethodPost, "/v1/chat/completions", secret)
+	if checkVirtualKey(c) {
+		t.Fatal("达到每日配额的请求应被拒绝")
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("状态码 = %d, want 429", w.Code)
+	}
+
+	now := time.Now()
+	want := int(config.VirtualKeyQuotaResetAt(now).Sub(now).Seconds())
+	retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After"))
+	if retryAfter < want-5 || retryAfter > want+5 {
+		t.Fatalf("Retry-After = %d, 应约为距离零点的 %d 秒", retryAfter, want)
+	}
+	if fields := decodeErrorFields(t, w.Body.Bytes()); fields["limit"] != "virtual_key_daily_quota" {
+		t.Fatalf("limit = %v, want virtual_key_daily_quota", fields["limit"])
+	}
+	if reasons, _ := config.GetRejectedReasons(""); reasons[ErrorCodeQuotaExceeded] != 1 {
+		t.Fatalf("达到每日配额应按本地拒绝统计: %v", reasons)
+	}
+}
+
+func TestVirtualKeyRejectionsAreCounted(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.ApiProxy.VirtualKeys.Require = true
+	setupProxyTest(t, cfg)
+	disabled := true
+	_, disabledSecret, err := config.CreateVirtualKey(config.VirtualKeySpec{Disabled: &disabled})
+	if err != nil {
+		t.Fatalf("CreateVirtualKey() = %v", err)
+	}
+	_, limitedSecret, err := config.CreateVirtualKey(config.VirtualKeySpec{AllowedModels: []string{"model-a"}})
+	if err != nil {
+		t.Fatalf("CreateVirtualKey() = %v", err)
+	}
+
+	// 未提供虚拟密钥和虚拟密钥已停用
+	for _, secret := range []string{"", disabledSecret} {
+		c, w := newTestContext(http.MethodPost, "/v1/chat/completions", secret)
+		if checkVirtualKey(c) || w.Code != http.StatusUnauthorized {
+			t.Fatalf("checkVirtualKey(%q) 状态码 = %d, want 401", secret, w.Code)
+		}
+	}
+	// 模型不在白名单中
+	c, w := newTestContext(http.MethodPost, "/v1/chat/completions", limitedSecret)
+	if !checkVirtualKey(c) {
+		t.Fatalf("有效的虚拟密钥不应被拒绝: %s", w.Body.String())
+	}
+	if checkVirtualKeyModel(c, "model-b") || w.Code != http.StatusForbidden {
+		t.Fatalf("checkVirtualKeyModel() 状态码 = %d, want 403", w.Code)
+	}
+
+	stats, _, err := config.GetDailyStats("")
+	if err != nil {
+		t.Fatalf("GetDailyStats() = %v", err)
+	}
+	if stats.Requests.Rejected != 3 || stats.Requests.Failed != 0 {
+		t.Fatalf("请求统计 = %+v, want 拒绝3、失败0", stats.Requests)
+	}
+	reasons, _ := config.GetRejectedReasons("")
+	if reasons[ErrorCodeInvalidAPIKey] != 2 || reasons[ErrorCodeModelNotAllowed] != 1 {
+		t.Fatalf("拒绝原因 = %v", reasons)
+	}
+}
@@ -8,6 +8,7 @@ package utils
 
 import (
 	"encoding/json"
+	"flowsilicon/internal/config"
 	"os/exec"
 )
 
@@ -65,10 +66,7 @@ func GetMapKeys(m map[string]interface{}) []string {
 
 // MaskKey 掩盖 API 密钥（用于日志）
 func MaskKey(key string) string {
-	if len(key) <= 6 {
-		return "******"
-	}
-	return key[:6] + "******"
+	return config.MaskKeyWithPolicy(key, false)
 }
 
 // SetupWindowsRestartCommand 设置Windows重启命令的特定属性
@@ -8,11 +8,13 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
 	"flowsilicon/internal/common"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/key"
 	"flowsilicon/internal/logger"
 	"flowsilicon/internal/model"
+	"flowsilicon/internal/proxy"
 	"fmt"
 	"io"
 	"net/http"
@@ -51,8 +53,17 @@ func handleListKeys(c *gin.Context) {
 		}
 	}
 
+	// 熔断器未关闭的密钥，供仪表盘显示
+	breakers := make(map[string]string)
+	for _, k := range allKeys {
+		if state := config.GetKeyBreakerState(k.Key); state != config.BreakerClosed {
+			breakers[k.Key] = state
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"keys": allKeys,
+		"keys":     allKeys,
+		"breakers": breakers,
 	})
 }
 
@@ -119,8 +130,8 @@ func handleCheckKey(c *gin.Context) {
 		return
 	}
 
-	// 检查 API 密钥余额
-	balance, err := key.CheckKeyBalanceManually(req.Key)
+	// 检查 API 密钥余额，force=true时不使用缓存
+	balance, age, err := key.GetKeyBalanceCached(req.Key, c.Query("force") == "true")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to check balance: %v", err),
@@ -129,8 +140,9 @@ func handleCheckKey(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"key":     req.Key,
-		"balance": balance,
+		"key":         req.Key,
+		"balance":     balance,
+		"age_seconds": int(age.Seconds()),
 	})
 }
 
@@ -314,9 +326,16 @@ func handleStats(c *gin.Context) {
 	var avgSuccessRate float64
 	var activeKeysBalance float64
 
+	now := time.Now().Unix()
+	var expiredKeys int
 	for _, key := range keys {
-		totalBalance += key.Balance
-		if key.Balance > 0 && !key.Disabled {
+		// 过期密钥的余额已不可用，不计入余额统计
+		if key.IsExpiredAt(now) {
+			expiredKeys++
+		} else {
+			totalBalance += key.Balance
+		}
+		if key.Balance > 0 && !key.Disabled && !key.IsExpiredAt(now) {
 			activeKeys++
 			activeKeysBalance += key.Balance
 		}
@@ -349,6 +368,7 @@ func handleStats(c *gin.Context) {
 		"total_keys":          len(keys),
 		"active_keys":         activeKeys,
 		"disabled_keys":       disabledKeys,
+		"expired_keys":        expiredKeys,
 		"total_balance":       totalBalance,
 		"active_keys_balance": activeKeysBalance,
 		"last_used_time":      lastUsedTimeStr,
@@ -472,6 +492,9 @@ func handleEnableKey(c *gin.Context) {
 		return
 	}
 
+	// 手动启用时解除用量异常保护
+	config.ClearKeyAnomalyProtection(key)
+
 	// 启用 API 密钥
 	if success := config.EnableApiKey(key); !success {
 		c.JSON(http.StatusNotFound, gin.H{
@@ -485,6 +508,159 @@ func handleEnableKey(c *gin.Context) {
 	})
 }
 
+// findApiKey 判断密钥是否存在
+func findApiKey(apiKey string) bool {
+	for _, k := range config.GetApiKeys() {
+		if k.Key == apiKey {
+			return true
+		}
+	}
+	return false
+}
+
+// handleGetKeyModels 获取密钥可用的模型列表及最近一次的变化
+func handleGetKeyModels(c *gin.Context) {
+	apiKey := c.Param("key")
+	if !findApiKey(apiKey) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "API key not found",
+		})
+		return
+	}
+
+	models, known := key.GetKeyModels(apiKey)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"known":   known,
+		"models":  models,
+	})
+}
+
+// handleRefreshKeyModels 立即重新获取密钥可用的模型列表
+func handleRefreshKeyModels(c *gin.Context) {
+	apiKey := c.Param("key")
+	if !findApiKey(apiKey) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "API key not found",
+		})
+		return
+	}
+
+	models, err := key.DiscoverKeyModels(apiKey)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, key.ErrKeyModelsTooFrequent) {
+			status = http.StatusTooManyRequests
+		}
+		c.JSON(status, gin.H{
+			"error":  fmt.Sprintf("获取模型列表失败: %v", err),
+			"models": models,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"known":   true,
+		"models":  models,
+	})
+}
+
+// handleSetKeyExpiry 设置密钥的到期时间，expires_at为Unix秒，0表示不过期
+func handleSetKeyExpiry(c *gin.Context) {
+	apiKey := c.Param("key")
+
+	var req struct {
+		ExpiresAt int64 `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ExpiresAt < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的到期时间",
+		})
+		return
+	}
+
+	if !config.SetApiKeyExpiry(apiKey, req.ExpiresAt) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "API key not found",
+		})
+		return
+	}
+	key.InvalidatePoolState()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"expires_at": req.ExpiresAt,
+	})
+}
+
+// handleGetKeyExpiryWarnings 获取即将到期和已过期的密钥提醒
+func handleGetKeyExpiryWarnings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"warnings": config.GetKeyExpiryWarnings(true),
+	})
+}
+
+// handleGetKeyBreakers 获取有熔断记录的密钥的熔断器状态
+func handleGetKeyBreakers(c *gin.Context) {
+	cfg := config.GetConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":  cfg != nil && cfg.App.KeyBreaker.Enabled,
+		"breakers": config.GetKeyBreakerStates(true),
+	})
+}
+
+// handleResetKeyBreaker 手动关闭密钥的熔断器，密钥立即重新参与选择
+func handleResetKeyBreaker(c *gin.Context) {
+	apiKey := c.Param("key")
+	if resolved, ok := config.ResolveKeyID(apiKey); ok {
+		apiKey = resolved
+	}
+	if !config.ResetKeyBreaker(apiKey) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "该密钥没有熔断记录",
+		})
+		return
+	}
+	key.InvalidatePoolState()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "熔断器已重置",
+	})
+}
+
+// handleGetKeyValidation 获取定时校验配置和最近一次校验结果
+func handleGetKeyValidation(c *gin.Context) {
+	cfg := config.GetKeyValidationConfig()
+	result, ok := key.GetLastKeyValidation()
+	resp := gin.H{
+		"enabled":          cfg.Enabled,
+		"interval_minutes": cfg.IntervalMinutes,
+		"last":             nil,
+	}
+	if ok {
+		resp["last"] = result
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleValidateKeys 立即校验所有未禁用的密钥，禁用上游判定失效的密钥
+func handleValidateKeys(c *gin.Context) {
+	result, err := key.RunKeyValidation()
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, key.ErrKeyValidationRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 // handleDisableKey 处理禁用 API 密钥的请求
 func handleDisableKey(c *gin.Context) {
 	key := c.Param("key")
@@ -624,12 +800,19 @@ func handleRequestStats(c *gin.Context) {
 		})
 	}
 
+	// 今日估算费用，未配置单价表时为0
+	costToday := 0.0
+	if summary, err := config.GetCostSummary(""); err == nil {
+		costToday = summary.Total
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"rpm":       rpm,
-		"tpm":       tpm,
-		"rpd":       rpd,
-		"tpd":       tpd,
-		"key_stats": keyStats,
+		"rpm":        rpm,
+		"tpm":        tpm,
+		"rpd":        rpd,
+		"tpd":        tpd,
+		"cost_today": costToday,
+		"key_stats":  keyStats,
 	})
 }
 
@@ -797,13 +980,8 @@ func handleGetCurrentRequestStats(c *gin.Context) {
 	for _, ks := range keysWithScores {
 		k := ks.Key
 
-		// 掩盖密钥（直接在这里实现，不调用MaskKey函数）
-		var maskedKey string
-		if len(k.Key) <= 6 {
-			maskedKey = "******"
-		} else {
-			maskedKey = k.Key[:6] + "******"
-		}
+		// 按脱敏策略掩盖密钥，管理界面在reveal-to-admin策略下显示完整密钥
+		maskedKey := config.MaskKeyWithPolicy(k.Key, true)
 
 		keyStats = append(keyStats, map[string]interface{}{
 			"key":                  maskedKey,
@@ -830,9 +1008,9 @@ func handleGetCurrentRequestStats(c *gin.Context) {
 
 // handleGetDailyStats 获取每日统计数据
 func handleGetDailyStats(c *gin.Context) {
-	// 获取所有日期的统计数据
+	// 获取所有日期的统计数据，未初始化时返回空数据
 	stats, err := config.GetAllDailyStats()
-	if err != nil {
+	if err != nil && !errors.Is(err, config.ErrStatsNotInitialized) {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("获取每日统计数据失败: %v", err),
 		})
@@ -855,24 +1033,308 @@ func handleGetDailyStatsByDate(c *gin.Context) {
 		return
 	}
 
-	// 获取指定日期的统计数据
-	stats, err := config.GetDailyStats(date)
-	if err != nil {
+	// 获取指定日期的统计数据，没有数据时返回空的一天
+	// 可通过env参数查询其他统计环境，默认为当前环境
+	stats, found, err := config.GetDailyStatsInEnvironment(c.Query("env"), date)
+	if err != nil && !errors.Is(err, config.ErrStatsNotInitialized) {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("获取每日统计数据失败: %v", err),
 		})
 		return
 	}
 
-	if stats == nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": fmt.Sprintf("未找到日期 %s 的统计数据", date),
+	response := gin.H{
+		"stats": stats,
+		"found": found,
+	}
+
+	// 指定model参数时附带该模型的小时分布，供图表按模型过滤
+	if model := c.Query("model"); model != "" {
+		modelHourly, filtered, _ := config.GetModelHourly(date, model)
+		response["model"] = model
+		response["model_hourly"] = modelHourly
+		response["model_filtered"] = filtered
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// handleGetDailyStatsMarkdown 获取Markdown格式的每日统计报表
+func handleGetDailyStatsMarkdown(c *gin.Context) {
+	// 日期参数可选，默认今天
+	date := c.Query("date")
+
+	report, err := config.FormatDailyStatsMarkdown(date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("生成统计报表失败: %v", err),
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(report))
+}
+
+// handlePurgeStats 清理指定日期之前的统计数据，需要confirm=true确认
+func handlePurgeStats(c *gin.Context) {
+	before := c.Query("before")
+	if before == "" {
+		before = c.PostForm("before")
+	}
+	if before == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "缺少before参数（格式YYYY-MM-DD）",
+		})
+		return
+	}
+
+	confirm := c.Query("confirm")
+	if confirm == "" {
+		confirm = c.PostForm("confirm")
+	}
+	if confirm != "true" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "清理操作不可恢复，请添加confirm=true参数确认",
+		})
+		return
+	}
+
+	archive := c.Query("archive") == "true" || c.PostForm("archive") == "true"
+
+	var result config.PurgeResult
+	var err error
+	if archive {
+		result, err = config.PurgeAndArchiveStatsBefore(before)
+	} else {
+		result, err = config.PurgeStatsBefore(before)
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, config.ErrStatsReadOnly) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error": fmt.Sprintf("清理统计数据失败: %v", err),
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"stats": stats,
+		"success": true,
+		"result":  result,
+	})
+}
+
+// handleGetStatsConsistency 获取最近一次统计一致性检查结果
+func handleGetStatsConsistency(c *gin.Context) {
+	report := config.GetLastConsistencyReport()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"checked": report != nil,
+		"report":  report,
+	})
+}
+
+// handleCheckStatsConsistency 立即执行统计一致性检查
+func handleCheckStatsConsistency(c *gin.Context) {
+	repair := c.Query("repair") == "true" || c.PostForm("repair") == "true"
+
+	report, err := config.CheckStatsConsistency(repair)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("统计一致性检查失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"report":  report,
+	})
+}
+
+// handleGetMonthlyArchive 获取指定月份（YYYY-MM）的统计归档
+func handleGetMonthlyArchive(c *gin.Context) {
+	archive, found, err := config.GetMonthlyArchive(c.Param("month"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("获取月度归档失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"found":   found,
+		"archive": archive,
+	})
+}
+
+// handleSendTestDigest 立即生成并发送每日统计摘要，date为空时为昨天
+func handleSendTestDigest(c *gin.Context) {
+	date := c.Query("date")
+	if date == "" {
+		date = c.PostForm("date")
+	}
+
+	digest, err := common.SendDailyDigest(date)
+	if err != nil {
+		logger.Error("发送测试摘要失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  fmt.Sprintf("发送测试摘要失败: %v", err),
+			"digest": digest,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"digest":  digest,
+	})
+}
+
+// handleGetAnomalies 获取最近检测到的用量异常和代理暂停状态
+func handleGetAnomalies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":   config.GetAnomalyConfig().Enabled,
+		"anomalies": config.GetRecentAnomalies(),
+		"pause":     config.GetProxyPause(),
+	})
+}
+
+// handleResumeProxy 恢复因用量异常暂停的代理
+func handleResumeProxy(c *gin.Context) {
+	if !config.ResumeProxy() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "代理未处于暂停状态",
+		})
+		return
+	}
+
+	logger.Warn("代理已在管理界面手动恢复")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "代理已恢复",
+	})
+}
+
+// handleGetHealthScore 获取网关健康分（0-100）
+func handleGetHealthScore(c *gin.Context) {
+	score, err := config.ComputeHealthScore()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("计算健康分失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"score":   score,
+	})
+}
+
+// handleGetStatsHeatmap 获取最近N天每小时的请求数或令牌数热力图
+func handleGetStatsHeatmap(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "days参数必须为整数",
+		})
+		return
+	}
+
+	heatmap, err := config.GetHourlyHeatmap(days, c.Query("metric"), c.Query("model"))
+	if err != nil && !errors.Is(err, config.ErrStatsNotInitialized) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("获取热力图数据失败: %v", err),
+		})
+		return
+	}
+
+	// 直接编码到响应流，避免天数较多时在内存中拼接完整响应
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := json.NewEncoder(c.Writer).Encode(gin.H{
+		"success": true,
+		"heatmap": heatmap,
+	}); err != nil {
+		logger.Error("写入热力图数据失败: %v", err)
+	}
+}
+
+// handleGetStatsTrend 获取请求数、令牌数、成功率的移动平均与趋势
+func handleGetStatsTrend(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "days参数必须为整数",
+		})
+		return
+	}
+
+	trend, err := config.GetStatsTrend(days)
+	if err != nil && !errors.Is(err, config.ErrStatsNotInitialized) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("获取趋势数据失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"trend":   trend,
+	})
+}
+
+// handleGetStatsCost 获取指定日期按模型和密钥统计的估算费用，以及最近days天每天的总费用
+func handleGetStatsCost(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "days参数必须为整数",
+		})
+		return
+	}
+
+	summary, err := config.GetCostSummary(c.Query("date"))
+	if err != nil && !errors.Is(err, config.ErrStatsNotInitialized) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("获取费用统计失败: %v", err),
+		})
+		return
+	}
+	daily, err := config.GetDailyCosts(days)
+	if err != nil && !errors.Is(err, config.ErrStatsNotInitialized) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("获取费用统计失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"summary": summary,
+		"daily":   daily,
+	})
+}
+
+// handleGetMirrorReport 获取影子流量的主/备上游对比报告
+func handleGetMirrorReport(c *gin.Context) {
+	cfg := config.GetConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": cfg != nil && cfg.ApiProxy.Mirror.Enabled,
+		"report":  proxy.GetMirrorReport(),
+	})
+}
+
+// handleResetMirrorReport 清空影子流量对比报告
+func handleResetMirrorReport(c *gin.Context) {
+	proxy.ResetMirrorReport()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "影子流量对比报告已清空",
 	})
 }
 
@@ -963,6 +1425,9 @@ func handleSaveSettings(c *gin.Context) {
 		return
 	}
 
+	// 请求中的上游地址，为空表示不修改
+	var requestedBaseURL string
+
 	// 服务器设置
 	if server, ok := configData["server"].(map[string]interface{}); ok {
 		if port, ok := server["port"].(float64); ok {
@@ -972,8 +1437,9 @@ func handleSaveSettings(c *gin.Context) {
 
 	// API代理设置
 	if apiProxy, ok := configData["api_proxy"].(map[string]interface{}); ok {
+		// 上游地址需要先探测再切换，在其他配置保存后单独处理
 		if baseURL, ok := apiProxy["base_url"].(string); ok {
-			newConfig.ApiProxy.BaseURL = baseURL
+			requestedBaseURL = baseURL
 		}
 		if modelIndex, ok := apiProxy["model_index"].(float64); ok {
 			newConfig.ApiProxy.ModelIndex = int(modelIndex)
@@ -1115,25 +1581,77 @@ func handleSaveSettings(c *gin.Context) {
 		}
 	}
 
-	// 更新配置
-	config.UpdateConfig(&newConfig)
-
-	// 保存到数据库
-	if err := config.SaveConfigToDB(); err != nil {
+	// 保存到数据库，成功后再更新内存中的配置
+	if err := config.ApplyConfig(&newConfig); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("保存配置到数据库失败: %v", err),
 		})
 		return
 	}
 
+	// 探测通过后再切换上游地址，失败时保持旧地址
+	if requestedBaseURL != "" && requestedBaseURL != currentConfig.ApiProxy.BaseURL {
+		if err := common.SwitchUpstreamBaseURL(requestedBaseURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":    fmt.Sprintf("其他配置已保存，但上游地址未切换: %v", err),
+				"base_url": config.GetUpstreamStatus().BaseURL,
+			})
+			return
+		}
+	}
+
 	// 返回成功消息
 	c.JSON(http.StatusOK, gin.H{
 		"message": "配置保存成功",
 	})
 }
 
+// handleGetSystemInfo 处理获取系统信息的请求，包含当前上游地址和最近一次切换时间
+func handleGetSystemInfo(c *gin.Context) {
+	// stats_snapshot=true时在响应头中附带当天统计的压缩快照，便于反馈问题时复制
+	if c.Query("stats_snapshot") == "true" {
+		if snapshot, err := config.EncodeStatsForTransport(); err == nil {
+			c.Header("X-FS-Stats-Snapshot", snapshot)
+		} else {
+			logger.Warn("生成统计快照失败: %v", err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"version":  config.GetVersion(),
+		"profile":  config.GetActiveProfile(),
+		"upstream": config.GetUpstreamStatus(),
+	})
+}
+
+// handleTestNotification 向指定通知渠道（webhook、bark、serverchan、telegram）同步发送测试通知
+func handleTestNotification(c *gin.Context) {
+	channel := c.Param("channel")
+	if err := common.SendTestNotification(channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("发送测试通知失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "测试通知已发送到 " + channel,
+	})
+}
+
 // handleRefreshAllKeysBalance 处理刷新所有API密钥余额的请求
+// force=true时立即查询上游，否则返回缓存的余额并在后台刷新过期的余额
 func handleRefreshAllKeysBalance(c *gin.Context) {
+	if c.Query("force") != "true" {
+		oldest, failed := key.RefreshAllKeysBalanceCached()
+		c.JSON(http.StatusOK, gin.H{
+			"message":         "已返回缓存的API密钥余额，过期的余额正在后台刷新",
+			"max_age_seconds": int(oldest.Seconds()),
+			"failed":          failed,
+		})
+		return
+	}
+
 	// 使用新的ForceRefreshAllKeysBalance函数，该函数带有2秒超时
 	err := key.ForceRefreshAllKeysBalance()
 	if err != nil {
@@ -1755,6 +2273,7 @@ func handleModelManagementPage(c *gin.Context) {
 		c.HTML(http.StatusOK, "llmmodel.html", gin.H{
 			"title":   "流动硅基",
 			"version": version,
+			"profile": config.GetActiveProfile(),
 		})
 		return
 	}
@@ -1763,6 +2282,7 @@ func handleModelManagementPage(c *gin.Context) {
 	c.HTML(http.StatusOK, "llmmodel.html", gin.H{
 		"title":   cfg.App.Title,
 		"version": version,
+		"profile": config.GetActiveProfile(),
 	})
 }
 
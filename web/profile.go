@@ -0,0 +1,159 @@
+/**
+  @author: Hanhai
+  @since: 2025/4/7 21:50:00
+  @desc: 配置档案的查看与运行时切换
+**/
+
+package web
+
+import (
+	"context"
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/model"
+	"flowsilicon/internal/proxy"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// profileDrainTimeout 切换档案前等待正在处理的请求结束的最长时间
+const profileDrainTimeout = 30 * time.Second
+
+// profileSwitchMutex 同一时间只允许一次档案切换
+var profileSwitchMutex sync.Mutex
+
+// handleListProfiles 列出所有配置档案和当前档案
+func handleListProfiles(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"active":   config.GetActiveProfile(),
+		"profiles": config.ListProfiles(),
+	})
+}
+
+// handleSwitchProfile 切换到指定的配置档案，目标档案校验失败时不切换
+func handleSwitchProfile(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请提供档案名称(name)",
+		})
+		return
+	}
+
+	if err := switchProfile(req.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已切换到配置档案 " + req.Name,
+		"active":  config.GetActiveProfile(),
+	})
+}
+
+// switchProfile 切换配置档案：校验目标档案，暂停代理并等待正在处理的请求结束，
+// 保存当前数据后打开目标档案的配置数据库和统计文件，重新加载配置和密钥池
+// 打开目标档案失败时恢复原档案
+func switchProfile(name string) error {
+	if !profileSwitchMutex.TryLock() {
+		return errors.New("正在切换配置档案，请稍后重试")
+	}
+	defer profileSwitchMutex.Unlock()
+
+	current := config.GetActiveProfile()
+	if name == current {
+		return fmt.Errorf("当前已在使用配置档案 %s", name)
+	}
+	paths, err := config.ResolveProfilePaths(name)
+	if err != nil {
+		return err
+	}
+	if err := config.ValidateProfile(paths); err != nil {
+		return fmt.Errorf("配置档案 %s 校验失败，未切换: %w", name, err)
+	}
+	oldPaths, err := config.ResolveProfilePaths(current)
+	if err != nil {
+		return err
+	}
+
+	// 暂停新请求并等待正在处理的请求结束，已因其他原因暂停时保持原暂停状态
+	if !config.GetProxyPause().Paused {
+		config.PauseProxy("正在切换配置档案到 " + name)
+		defer config.ResumeProxy()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), profileDrainTimeout)
+	defer cancel()
+	if err := proxy.WaitForIdle(ctx); err != nil {
+		return fmt.Errorf("等待正在处理的请求结束超时（剩余 %d 个），未切换", proxy.InFlightRequests())
+	}
+
+	logger.Info("开始从配置档案 %s 切换到 %s", current, name)
+	port := config.GetConfig().Server.Port
+	key.StopKeyManager()
+	if err := config.SaveApiKeys(); err != nil {
+		logger.Error("保存API密钥失败: %v", err)
+	}
+
+	if err := openProfile(paths); err != nil {
+		logger.Error("打开配置档案 %s 失败，恢复配置档案 %s: %v", name, current, err)
+		if restoreErr := openProfile(oldPaths); restoreErr != nil {
+			logger.Error("恢复配置档案 %s 失败: %v", current, restoreErr)
+		}
+		key.StartKeyManager()
+		return fmt.Errorf("打开配置档案 %s 失败，已恢复原档案: %w", name, err)
+	}
+
+	config.SetActiveProfile(name)
+	key.StartKeyManager()
+	if newPort := config.GetConfig().Server.Port; newPort != port {
+		logger.Warn("配置档案 %s 的端口为 %d，重启程序后生效，当前仍监听 %d", name, newPort, port)
+	}
+	logger.Info("已切换到配置档案 %s", name)
+	return nil
+}
+
+// openProfile 关闭当前数据库，打开档案的配置数据库和统计文件，重新加载配置和API密钥
+func openProfile(paths config.ProfilePaths) error {
+	config.CloseConfigDB()
+	model.CloseModelDB()
+
+	if err := config.InitConfigDB(paths.DBPath); err != nil {
+		return fmt.Errorf("打开配置数据库失败: %w", err)
+	}
+	if err := model.InitModelDB(paths.DBPath); err != nil {
+		logger.Error("初始化模型数据库失败: %v", err)
+	}
+	if err := config.EnsureApikeys(paths.DBPath); err != nil {
+		logger.Error("创建apikeys表失败: %v", err)
+	}
+
+	cfg, err := config.LoadConfigFromDB()
+	if err != nil {
+		return err
+	}
+	config.UpdateConfig(cfg)
+
+	if err := config.LoadApiKeysFromDB(); err != nil {
+		return fmt.Errorf("加载API密钥失败: %w", err)
+	}
+	if err := config.SwitchDailyStatsFile(paths.DailyFilePath); err != nil {
+		return err
+	}
+	if err := config.SetStatsEnvironment(cfg.Stats.Environment); err != nil {
+		logger.Error("设置统计环境失败: %v", err)
+	}
+	config.ResetSWRCaches()
+	config.MigrateKeyUsageIdentifiers()
+	return nil
+}
@@ -32,6 +32,9 @@ func SetupApiProxy(router *gin.Engine) {
 	// 添加对 OpenAI 格式 API 的支持
 	router.Any("/v1/*path", proxy.HandleOpenAIProxy)
 
+	// 添加对 Gemini 格式 API 的支持
+	router.Any("/v1beta/*path", proxy.HandleGeminiProxy)
+
 	// 添加对无版本号路径的支持
 	// 聊天完成
 	router.Any("/chat", proxy.HandleOpenAIProxy)
@@ -68,6 +71,42 @@ func SetupKeysAPI(router *gin.Engine) {
 	// 获取指定日期的统计数据
 	router.GET("/request-stats/daily/:date", handleGetDailyStatsByDate)
 
+	// 获取Markdown格式的每日统计报表
+	router.GET("/request-stats/markdown", handleGetDailyStatsMarkdown)
+
+	// 清理指定日期之前的统计数据
+	router.POST("/request-stats/purge", handlePurgeStats)
+
+	// 获取网关健康分
+	router.GET("/request-stats/health", handleGetHealthScore)
+
+	// 获取按天和小时组织的热力图数据
+	router.GET("/request-stats/heatmap", handleGetStatsHeatmap)
+
+	// 获取移动平均与趋势数据
+	router.GET("/request-stats/trend", handleGetStatsTrend)
+
+	// 获取按单价表估算的费用
+	router.GET("/request-stats/cost", handleGetStatsCost)
+
+	// 获取最近一次统计一致性检查结果
+	router.GET("/request-stats/consistency", handleGetStatsConsistency)
+
+	// 立即执行统计一致性检查，repair=true时修复汇总值
+	router.POST("/request-stats/consistency/check", handleCheckStatsConsistency)
+
+	// 获取月度归档
+	router.GET("/request-stats/archive/:month", handleGetMonthlyArchive)
+
+	// 立即发送一次每日统计摘要，用于验证发送配置
+	router.POST("/request-stats/digest/test", handleSendTestDigest)
+
+	// 获取最近的用量异常和代理暂停状态
+	router.GET("/request-stats/anomalies", handleGetAnomalies)
+
+	// 恢复因用量异常暂停的代理
+	router.POST("/request-stats/anomalies/resume", handleResumeProxy)
+
 	// 刷新所有API密钥余额
 	router.POST("/keys/refresh", handleRefreshAllKeysBalance)
 }
@@ -103,6 +142,7 @@ func SetupWebServer(router *gin.Engine) {
 	router.GET("/", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "index.html", gin.H{
 			"title":                  config.GetConfig().App.Title,
+			"profile":                config.GetActiveProfile(),
 			"max_balance_display":    config.GetConfig().App.MaxBalanceDisplay,
 			"items_per_page":         config.GetConfig().App.ItemsPerPage,
 			"auto_update_interval":   config.GetConfig().App.AutoUpdateInterval,
@@ -114,7 +154,8 @@ func SetupWebServer(router *gin.Engine) {
 	// 设置页面
 	router.GET("/setting", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "setting.html", gin.H{
-			"title": config.GetConfig().App.Title,
+			"title":   config.GetConfig().App.Title,
+			"profile": config.GetActiveProfile(),
 		})
 	})
 
@@ -131,6 +172,14 @@ func SetupWebServer(router *gin.Engine) {
 	router.GET("/keys/mode", handleGetKeyMode)
 	router.POST("/keys/:key/enable", handleEnableKey)
 	router.POST("/keys/:key/disable", handleDisableKey)
+	router.GET("/keys/:key/models", handleGetKeyModels)
+	router.POST("/keys/:key/models/refresh", handleRefreshKeyModels)
+	router.POST("/keys/:key/expiry", handleSetKeyExpiry)
+	router.GET("/keys/expiring", handleGetKeyExpiryWarnings)
+	router.GET("/keys/breakers", handleGetKeyBreakers)
+	router.POST("/keys/:key/breaker/reset", handleResetKeyBreaker)
+	router.GET("/keys/validation", handleGetKeyValidation)
+	router.POST("/keys/validate", handleValidateKeys)
 	router.DELETE("/keys/zero-balance", handleDeleteZeroBalanceKeys)
 	router.DELETE("/keys/low-balance/:threshold", handleDeleteLowBalanceKeys)
 	router.GET("/test-key", handleGetTestKey)
@@ -178,6 +227,20 @@ func SetupWebServer(router *gin.Engine) {
 	// 系统重启API
 	router.POST("/system/restart", handleSystemRestart)
 
+	// 获取系统信息
+	router.GET("/system/info", handleGetSystemInfo)
+
+	// 配置档案
+	router.GET("/system/profiles", handleListProfiles)
+	router.POST("/system/profiles/switch", handleSwitchProfile)
+
+	// 向指定通知渠道发送测试通知
+	router.POST("/system/notify/test/:channel", handleTestNotification)
+
+	// 影子流量对比报告
+	router.GET("/mirror/report", handleGetMirrorReport)
+	router.POST("/mirror/reset", handleResetMirrorReport)
+
 	// API密钥代理 - 解决CORS问题
 	router.GET("/proxy/apikeys", handleApiKeyProxy)
 }
@@ -35,7 +35,9 @@ const STRATEGY_TYPES = {
     5: "高余额",
     6: "普通",
     7: "低余额",
-    8: "免费"
+    8: "免费",
+    9: "临期优先",
+    10: "加权轮询"
 };
 
 // 调试日志函数
@@ -6,6 +6,7 @@
 
 // 全局变量
 let allKeys = [];
+let keyBreakers = {}; // 熔断器未关闭的密钥及其状态
 let selectedKeyId = null;
 let currentPage = 1;
 let currentSortField = 'score';
@@ -191,6 +192,7 @@ function loadKeys() {
         .then(data => {
             // 获取所有密钥
             const keys = data.keys || [];
+            keyBreakers = data.breakers || {};
             
             // 将密钥分为启用和禁用两组
             const enabledKeys = keys.filter(key => !key.disabled);
@@ -330,6 +332,15 @@ function renderKeysList() {
         const isSelected = key.selected || false;
         const selectedClass = isSelected ? 'selected' : '';
 
+        // 熔断状态标记，断开或半开时可手动重置
+        const breakerState = keyBreakers[key.key];
+        let breakerHtml = '';
+        if (breakerState === 'open') {
+            breakerHtml = `<span class="badge bg-danger ms-2 reset-breaker-btn" data-key="${key.key}" title="熔断器已断开，点击重置" style="cursor: pointer;">熔断</span>`;
+        } else if (breakerState === 'half_open') {
+            breakerHtml = `<span class="badge bg-warning text-dark ms-2 reset-breaker-btn" data-key="${key.key}" title="熔断器半开试探中，点击重置" style="cursor: pointer;">半开</span>`;
+        }
+
         // console.log("key.score",key.score);
         
         
@@ -346,7 +357,7 @@ function renderKeysList() {
                 <div class="key-info-row">
                     <div class="key-content">
                         <input type="checkbox" class="form-check-input key-checkbox key-select" data-key="${key.key}" ${key.disabled ? 'disabled' : ''} ${isSelected ? 'checked' : ''}>
-                        <span class="key-label ms-2">${maskedKey}</span>
+                        <span class="key-label ms-2">${maskedKey}</span>${breakerHtml}
                         <span class="key-score ms-2" data-score="${parseFloat(key.score || 0).toFixed(2)}">${parseFloat(key.score || 0).toFixed(2)}</span>
                         <span class="ms-2">余额: <span class="key-balance" data-balance="${key.balance || 0}">${key.balance.toFixed(2)}</span></span>
                         <span class="key-stat ms-2" data-usage="${key.total_calls || 0}">调用: ${key.total_calls}</span>
@@ -481,6 +492,14 @@ function renderKeysList() {
         });
     });
     
+    // 添加重置熔断器事件
+    document.querySelectorAll('.reset-breaker-btn').forEach(btn => {
+        btn.addEventListener('click', function(e) {
+            e.stopPropagation(); // 阻止事件冒泡
+            resetKeyBreaker(this.dataset.key);
+        });
+    });
+    
     // 添加检测API按钮事件
     document.querySelectorAll('.check-api-btn').forEach(btn => {
         btn.addEventListener('click', function(e) {
@@ -834,12 +853,14 @@ function loadCurrentRequestStats() {
             const tpm = data.tpm !== undefined ? data.tpm : 0;
             const rpd = data.rpd !== undefined ? data.rpd : 0;
             const tpd = data.tpd !== undefined ? data.tpd : 0;
+            const costToday = data.cost_today !== undefined ? data.cost_today : 0;
             
             // 更新当前RPM和TPM显示
             document.getElementById('rpm-value').innerText = rpm;
             document.getElementById('tpm-value').innerText = tpm;
             document.getElementById('rpd-value').innerText = rpd;
             document.getElementById('tpd-value').innerText = tpd;
+            document.getElementById('cost-today-value').innerText = costToday.toFixed(2);
             
             // 如果没有密钥统计数据，显示信息提示
             if (!data.key_stats || !Array.isArray(data.key_stats) || data.key_stats.length === 0) {
@@ -1259,7 +1280,7 @@ function checkKeyBalance(key) {
     }
     
     // 正常处理普通API密钥
-    return fetch('/keys/check', {
+    return fetch('/keys/check?force=true', {
         method: 'POST',
         headers: {
             'Content-Type': 'application/json',
@@ -1321,7 +1342,7 @@ function checkKeyBalance(key) {
 
 // 检查 API 密钥可用性
 function checkKeyAvailability(key) {
-    return fetch('/keys/check', {
+    return fetch('/keys/check?force=true', {
         method: 'POST',
         headers: {
             'Content-Type': 'application/json',
@@ -1506,6 +1527,27 @@ function batchAddKeys(keys, balance) {
     });
 }
 
+// 重置密钥的熔断器
+function resetKeyBreaker(key) {
+    fetch(`/keys/${key}/breaker/reset`, {
+        method: 'POST',
+    })
+        .then(response => {
+            if (!response.ok) {
+                throw new Error('Failed to reset breaker');
+            }
+            return response.json();
+        })
+        .then(() => {
+            showToast('熔断器已重置', 'success');
+            loadKeys();
+        })
+        .catch(error => {
+            console.error('Error resetting breaker:', error);
+            showToast('重置熔断器失败', 'error');
+        });
+}
+
 // 删除 API 密钥
 function deleteKey(key) {
     fetch(`/keys/${key}`, {
@@ -1676,8 +1718,8 @@ function refreshAllKeysBalance(silent = false) {
         refreshSpinner.style.display = 'inline-block';
     }
     
-    // 使用新的API刷新所有密钥
-    fetch('/keys/refresh', {
+    // 使用新的API刷新所有密钥，手动刷新时跳过余额缓存
+    fetch(silent ? '/keys/refresh' : '/keys/refresh?force=true', {
         method: 'POST',
     })
     .then(response => {
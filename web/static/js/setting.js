@@ -744,6 +744,10 @@ function getStrategyText(strategy) {
             return '策略7 - 低余额';
         case 8:
             return '策略8 - 免费';
+        case 9:
+            return '策略9 - 临期优先';
+        case 10:
+            return '策略10 - 加权轮询';
         default:
             return '未知策略';
     }